@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 基于 Ed25519 签名 JWT 的认证。角色从低到高为 viewer、editor、admin：
+// viewer 读取资源和上报统计，editor 上传和编辑场景，admin 删除和管理。未配置 -auth-key 时所有接口匿名可用
+
+// 角色
+const (
+	roleViewer = "viewer"
+	roleEditor = "editor"
+	roleAdmin  = "admin"
+)
+
+var roleLevels = map[string]int{roleViewer: 1, roleEditor: 2, roleAdmin: 3}
+
+// tokenIssuer 写在 JWT 的 iss 中，校验时必须一致
+const tokenIssuer = "tServer"
+
+// tokenCookie 是登录后保存令牌的 cookie；sendBeacon 和 WebSocket 无法带 Authorization 头，只能靠它
+const tokenCookie = "tserver_token"
+
+// bcryptCost 是密码哈希的计算强度
+const bcryptCost = 12
+
+// tokenClockSkew 允许签发时间比本机时钟超前的量
+const tokenClockSkew = time.Minute
+
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]{1,64}$`)
+
+var (
+	errTokenMissing = errors.New("authentication required")
+	errTokenInvalid = errors.New("token is invalid")
+	errTokenExpired = errors.New("token has expired")
+	errTokenRevoked = errors.New("token has been revoked")
+)
+
+// Claims 是 JWT 的载荷
+type Claims struct {
+	Subject  string `json:"sub"`
+	Role     string `json:"role"`
+	Issuer   string `json:"iss"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+	Password string `json:"pwd,omitempty"` // 登录签发的令牌带上密码哈希的摘要，改密码或删除用户后失效
+}
+
+// authConfig 是认证配置；key 为 nil 表示未开启认证
+var authConfig struct {
+	key   ed25519.PrivateKey
+	users string // bcrypt 密码文件，为空时不开放登录
+	ttl   time.Duration
+}
+
+// setupAuth 按命令行参数加载签名私钥
+func setupAuth(keyFile, usersFile string, ttl time.Duration) error {
+	if keyFile == "" {
+		if usersFile != "" {
+			return fmt.Errorf("a password file needs a signing key (-auth-key)")
+		}
+		return nil
+	}
+	key, err := loadAuthKey(keyFile)
+	if err != nil {
+		return err
+	}
+	if usersFile != "" {
+		if _, err := loadUsers(usersFile); err != nil {
+			return err
+		}
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("token lifetime must be positive")
+	}
+	authConfig.key, authConfig.users, authConfig.ttl = key, usersFile, ttl
+	return nil
+}
+
+// loadAuthKey 读取 PKCS#8 PEM 格式的 Ed25519 私钥
+func loadAuthKey(file string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: expected a PEM \"PRIVATE KEY\" block", file)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", file)
+	}
+	return key, nil
+}
+
+// generateAuthKey 生成新私钥写入 file，文件已存在时报错
+func generateAuthKey(file string) error {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT"}`))
+
+// signToken 签发 JWT
+func signToken(key ed25519.PrivateKey, cl Claims) (string, error) {
+	payload, err := json.Marshal(cl)
+	if err != nil {
+		return "", err
+	}
+	signing := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig := ed25519.Sign(key, []byte(signing))
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parseToken 校验 JWT 的签名、签发者、有效期和角色
+func parseToken(pub ed25519.PublicKey, token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errTokenInvalid
+	}
+	hdr, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errTokenInvalid
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	// 只接受 EdDSA，防止 alg 被改成 none 或 HS256
+	if json.Unmarshal(hdr, &h) != nil || h.Alg != "EdDSA" {
+		return nil, errTokenInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !ed25519.Verify(pub, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, errTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errTokenInvalid
+	}
+	var cl Claims
+	if err := json.Unmarshal(payload, &cl); err != nil {
+		return nil, errTokenInvalid
+	}
+	if cl.Issuer != tokenIssuer || roleLevels[cl.Role] == 0 || cl.Subject == "" ||
+		cl.IssuedAt > now.Add(tokenClockSkew).Unix() {
+		return nil, errTokenInvalid
+	}
+	if now.Unix() >= cl.Expires {
+		return nil, errTokenExpired
+	}
+	return &cl, nil
+}
+
+// issueToken 用服务器私钥为密码文件中的用户签发令牌
+func issueToken(user *passwdEntry, ttl time.Duration, now time.Time) (string, Claims, error) {
+	cl := Claims{Subject: user.name, Role: user.role, Issuer: tokenIssuer, IssuedAt: now.Unix(), Expires: now.Add(ttl).Unix(),
+		Password: passwordTag(user.hash)}
+	tok, err := signToken(authConfig.key, cl)
+	return tok, cl, err
+}
+
+// requestToken 从 Authorization: Bearer 或登录 cookie 中取出令牌
+func requestToken(c *gin.Context) string {
+	if h := c.GetHeader("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	tok, _ := c.Cookie(tokenCookie)
+	return tok
+}
+
+// currentUser 返回请求的用户，未开启认证时返回 nil
+func currentUser(c *gin.Context) *Claims {
+	if v, ok := c.Get("claims"); ok {
+		return v.(*Claims)
+	}
+	return nil
+}
+
+// requireRole 要求请求携带的令牌至少具有 role 角色：缺少或无效时返回 401，权限不够返回 403。
+// 有效的签名 URL 等同于 viewer
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authConfig.key == nil {
+			c.Next()
+			return
+		}
+		if role == roleViewer && c.GetBool("signedURL") {
+			c.Next()
+			return
+		}
+		tok := requestToken(c)
+		if tok == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="tServer"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errTokenMissing.Error()})
+			return
+		}
+		cl, err := parseToken(authConfig.key.Public().(ed25519.PublicKey), tok, time.Now())
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="tServer", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkTokenUser(cl); err != nil {
+			if err != errTokenRevoked {
+				requestLog(c, levelError, "读取密码文件失败", "error", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "authentication is unavailable"})
+				return
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="tServer", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if roleLevels[cl.Role] < roleLevels[role] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("this action requires the %s role", role)})
+			return
+		}
+		c.Set("claims", cl)
+		c.Next()
+	}
+}
+
+// passwordTag 是写进令牌的密码哈希摘要，不泄露哈希本身
+func passwordTag(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return base64.RawURLEncoding.EncodeToString(sum[:9])
+}
+
+// checkTokenUser 按当前的密码文件确认令牌仍然有效：登录签发的令牌在用户被删除或改密码后吊销，
+// 角色被降低时按文件中的角色处理。不在密码文件中的用户（tServer token 签发）只能靠更换密钥吊销
+func checkTokenUser(cl *Claims) error {
+	if authConfig.users == "" {
+		return nil
+	}
+	user, err := lookupUser(cl.Subject)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		if cl.Password != "" {
+			return errTokenRevoked
+		}
+		return nil
+	}
+	if cl.Password != "" && cl.Password != passwordTag(user.hash) {
+		return errTokenRevoked
+	}
+	if roleLevels[user.role] < roleLevels[cl.Role] {
+		cl.Role = user.role
+	}
+	return nil
+}
+
+// userCache 缓存密码文件，修改时间或大小变化时重新读取
+var userCache struct {
+	sync.Mutex
+	mod   time.Time
+	size  int64
+	users map[string]*passwdEntry
+}
+
+// lookupUser 在密码文件中查找用户，不存在时返回 nil
+func lookupUser(name string) (*passwdEntry, error) {
+	st, err := os.Stat(authConfig.users)
+	if err != nil {
+		return nil, err
+	}
+	userCache.Lock()
+	defer userCache.Unlock()
+	if userCache.users == nil || !st.ModTime().Equal(userCache.mod) || st.Size() != userCache.size {
+		list, err := loadUsers(authConfig.users)
+		if err != nil {
+			return nil, err
+		}
+		userCache.users = map[string]*passwdEntry{}
+		for i := range list {
+			userCache.users[list[i].name] = &list[i]
+		}
+		userCache.mod, userCache.size = st.ModTime(), st.Size()
+	}
+	return userCache.users[name], nil
+}
+
+// passwdEntry 是密码文件中的一行："用户名:角色:bcrypt 哈希"
+type passwdEntry struct {
+	name, role, hash string
+}
+
+func loadUsers(file string) ([]passwdEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []passwdEntry
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || !userNamePattern.MatchString(parts[0]) || roleLevels[parts[1]] == 0 {
+			return nil, fmt.Errorf("%s:%d: expected \"<user>:<viewer|editor|admin>:<bcrypt hash>\"", file, n)
+		}
+		if _, err := bcrypt.Cost([]byte(parts[2])); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		list = append(list, passwdEntry{parts[0], parts[1], parts[2]})
+	}
+	return list, sc.Err()
+}
+
+// dummyHash 用于不存在的用户，使其耗时与密码错误相同，不暴露用户名是否存在；第一次登录时生成
+var dummyHash struct {
+	once sync.Once
+	hash []byte
+}
+
+// loginHandler 处理 POST /api/login，body 为 {username, password}；成功后返回令牌并写入 cookie
+func loginHandler(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 每次登录都重新读取，修改密码文件不需要重启
+	users, err := loadUsers(authConfig.users)
+	if err != nil {
+		requestLog(c, levelError, "读取密码文件失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login is unavailable"})
+		return
+	}
+	var user *passwdEntry
+	for i := range users {
+		if users[i].name == req.Username {
+			user = &users[i]
+		}
+	}
+	dummyHash.once.Do(func() {
+		dummyHash.hash, _ = bcrypt.GenerateFromPassword([]byte("tServer"), bcryptCost)
+	})
+	hash := dummyHash.hash
+	if user != nil {
+		hash = []byte(user.hash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || user == nil {
+		requestLog(c, levelWarn, "登录失败", "user", req.Username, "client_ip", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		return
+	}
+	now := time.Now()
+	tok, cl, err := issueToken(user, authConfig.ttl, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setTokenCookie(c, tok, int(authConfig.ttl.Seconds()))
+	requestLog(c, levelInfo, "登录成功", "user", user.name, "role", user.role)
+	c.JSON(http.StatusOK, gin.H{"token": tok, "role": cl.Role, "expires": time.Unix(cl.Expires, 0).UTC()})
+}
+
+// logoutHandler 处理 POST /api/logout，清除登录 cookie
+func logoutHandler(c *gin.Context) {
+	setTokenCookie(c, "", -1)
+	c.Status(http.StatusNoContent)
+}
+
+func setTokenCookie(c *gin.Context, tok string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	// SameSite=Strict：其他站点发起的请求不带 cookie，避免跨站伪造写请求
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(tokenCookie, tok, maxAge, "/", "", secure, true)
+}
+
+// meHandler 处理 GET /api/me，返回当前用户；未开启认证时 enabled 为 false
+func meHandler(c *gin.Context) {
+	cl := currentUser(c)
+	if cl == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": authConfig.key != nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "user": cl.Subject, "role": cl.Role, "expires": time.Unix(cl.Expires, 0).UTC()})
+}
+
+// runToken 实现 tServer token 子命令：生成密钥，或为用户签发令牌，例如：tServer token -key auth.pem -sub ci -role editor
+func runToken(args []string) int {
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	keyFile := fs.String("key", "", "Ed25519 私钥文件（PKCS#8 PEM）")
+	genkey := fs.Bool("genkey", false, "生成新的私钥写入 -key 指定的文件")
+	sub := fs.String("sub", "", "用户名")
+	role := fs.String("role", roleViewer, "角色：viewer、editor 或 admin")
+	ttl := fs.Duration("ttl", 24*time.Hour, "有效期")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法：tServer token -key 文件 -genkey | tServer token -key 文件 -sub 用户名 [-role 角色] [-ttl 有效期]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *keyFile == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *genkey {
+		if err := generateAuthKey(*keyFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	if !userNamePattern.MatchString(*sub) || roleLevels[*role] == 0 || *ttl <= 0 {
+		fs.Usage()
+		return 2
+	}
+	key, err := loadAuthKey(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	now := time.Now()
+	tok, err := signToken(key, Claims{Subject: *sub, Role: *role, Issuer: tokenIssuer, IssuedAt: now.Unix(), Expires: now.Add(*ttl).Unix()})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(tok)
+	return 0
+}
+
+// runPasswd 实现 tServer passwd 子命令：从标准输入读取密码，添加或更新密码文件中的用户
+func runPasswd(args []string) int {
+	fs := flag.NewFlagSet("passwd", flag.ExitOnError)
+	file := fs.String("file", "", "密码文件")
+	role := fs.String("role", roleViewer, "角色：viewer、editor 或 admin")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法：tServer passwd -file 文件 [-role 角色] 用户名 < 密码")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *file == "" || fs.NArg() != 1 || !userNamePattern.MatchString(fs.Arg(0)) || roleLevels[*role] == 0 {
+		fs.Usage()
+		return 2
+	}
+	name := fs.Arg(0)
+	pw, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	pw = strings.TrimRight(pw, "\r\n")
+	if pw == "" {
+		fmt.Fprintln(os.Stderr, "password must not be empty")
+		return 1
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcryptCost)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	users, err := loadUsers(*file)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	entry := passwdEntry{name, *role, string(hash)}
+	found := false
+	for i := range users {
+		if users[i].name == name {
+			users[i], found = entry, true
+		}
+	}
+	if !found {
+		users = append(users, entry)
+	}
+	var b strings.Builder
+	for _, u := range users {
+		fmt.Fprintf(&b, "%s:%s:%s\n", u.name, u.role, u.hash)
+	}
+	// 哈希也不该被其他用户读到，临时文件一开始就是 0600
+	if err := writeFileAtomic(*file, []byte(b.String()), 0600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
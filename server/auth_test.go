@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParseToken(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	pub := key.Public().(ed25519.PublicKey)
+	now := time.Unix(1700000000, 0)
+	claims := func(edit func(*Claims)) Claims {
+		cl := Claims{Subject: "alice", Role: roleEditor, Issuer: tokenIssuer, IssuedAt: now.Unix(), Expires: now.Add(time.Hour).Unix()}
+		if edit != nil {
+			edit(&cl)
+		}
+		return cl
+	}
+	sign := func(k ed25519.PrivateKey, cl Claims) string {
+		tok, err := signToken(k, cl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	valid := sign(key, claims(nil))
+	parts := strings.Split(valid, ".")
+	enc := func(v interface{}) string {
+		js, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(js)
+	}
+	admin := claims(func(cl *Claims) { cl.Role = roleAdmin })
+
+	tests := []struct {
+		name string
+		tok  string
+		want error
+	}{
+		{"valid", valid, nil},
+		{"wrong key", sign(other, claims(nil)), errTokenInvalid},
+		{"alg none", enc(map[string]string{"alg": "none"}) + "." + parts[1] + ".", errTokenInvalid},
+		{"alg HS256", enc(map[string]string{"alg": "HS256"}) + "." + parts[1] + "." + parts[2], errTokenInvalid},
+		{"tampered payload", parts[0] + "." + enc(admin) + "." + parts[2], errTokenInvalid},
+		{"truncated signature", parts[0] + "." + parts[1] + "." + parts[2][:10], errTokenInvalid},
+		{"two parts", parts[0] + "." + parts[1], errTokenInvalid},
+		{"garbage", "not a token", errTokenInvalid},
+		{"expired", sign(key, claims(func(cl *Claims) { cl.Expires = now.Unix() })), errTokenExpired},
+		{"issued in the future", sign(key, claims(func(cl *Claims) { cl.IssuedAt = now.Add(time.Hour).Unix() })), errTokenInvalid},
+		{"wrong issuer", sign(key, claims(func(cl *Claims) { cl.Issuer = "other" })), errTokenInvalid},
+		{"unknown role", sign(key, claims(func(cl *Claims) { cl.Role = "root" })), errTokenInvalid},
+		{"empty subject", sign(key, claims(func(cl *Claims) { cl.Subject = "" })), errTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl, err := parseToken(pub, tt.tok, now)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && (cl.Subject != "alice" || cl.Role != roleEditor) {
+				t.Fatalf("unexpected claims %+v", cl)
+			}
+		})
+	}
+}
+
+func TestCheckTokenUser(t *testing.T) {
+	hash := func(pw string) string {
+		h, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(h)
+	}
+	aliceHash, bobHash := hash("pw1"), hash("pw2")
+	file := filepath.Join(t.TempDir(), "users")
+	mtime := time.Now()
+	write := func(lines ...string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// 文件系统的修改时间精度可能不足以区分两次写入，每次写入后往后拨一秒
+		mtime = mtime.Add(time.Second)
+		os.Chtimes(file, mtime, mtime)
+	}
+	old := authConfig.users
+	defer func() { authConfig.users = old }()
+	authConfig.users = file
+	write("alice:editor:"+aliceHash, "bob:viewer:"+bobHash)
+
+	login := func(name, role, h string) *Claims {
+		return &Claims{Subject: name, Role: role, Password: passwordTag(h)}
+	}
+	if err := checkTokenUser(login("alice", roleEditor, aliceHash)); err != nil {
+		t.Fatalf("valid login token: %v", err)
+	}
+	// 命令行签发的令牌没有密码摘要，用户不在文件中时保持原样
+	ci := &Claims{Subject: "ci", Role: roleAdmin}
+	if err := checkTokenUser(ci); err != nil || ci.Role != roleAdmin {
+		t.Fatalf("service token: %v, role %s", err, ci.Role)
+	}
+
+	write("alice:viewer:"+aliceHash, "bob:viewer:"+bobHash)
+	cl := login("alice", roleEditor, aliceHash)
+	if err := checkTokenUser(cl); err != nil || cl.Role != roleViewer {
+		t.Fatalf("demoted user: %v, role %s", err, cl.Role)
+	}
+	cl = &Claims{Subject: "bob", Role: roleAdmin}
+	if err := checkTokenUser(cl); err != nil || cl.Role != roleViewer {
+		t.Fatalf("service token for a file user is capped by the file: %v, role %s", err, cl.Role)
+	}
+
+	write("alice:viewer:"+hash("changed"), "bob:viewer:"+bobHash)
+	if err := checkTokenUser(login("alice", roleViewer, aliceHash)); !errors.Is(err, errTokenRevoked) {
+		t.Fatalf("changed password: got %v", err)
+	}
+	write("bob:viewer:" + bobHash)
+	if err := checkTokenUser(login("alice", roleViewer, aliceHash)); !errors.Is(err, errTokenRevoked) {
+		t.Fatalf("removed user: got %v", err)
+	}
+
+	os.Remove(file)
+	if err := checkTokenUser(login("bob", roleViewer, bobHash)); err == nil || errors.Is(err, errTokenRevoked) {
+		t.Fatalf("missing password file should be an error, got %v", err)
+	}
+}
+
+func TestDebugRequiresAdmin(t *testing.T) {
+	oldKey, oldUsers := authConfig.key, authConfig.users
+	t.Cleanup(func() { authConfig.key, authConfig.users = oldKey, oldUsers })
+	_, authConfig.key, _ = ed25519.GenerateKey(rand.Reader)
+	authConfig.users = ""
+	token := func(role string) string {
+		now := time.Now()
+		tok, err := signToken(authConfig.key, Claims{Subject: "ann", Role: role, Issuer: tokenIssuer, IssuedAt: now.Unix(), Expires: now.Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerDebugRoutes(r.Group("/debug", requireRole(roleAdmin)))
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"invalid token", "Bearer nope", http.StatusUnauthorized},
+		{"editor", "Bearer " + token(roleEditor), http.StatusForbidden},
+		{"admin", "Bearer " + token(roleAdmin), http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/debug/goroutines", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
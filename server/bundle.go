@@ -0,0 +1,596 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	bundleManifestName = "manifest.json"
+	bundleVersion      = 1
+	bundleMaxBytes     = 1 << 30 // 解压后的总大小上限
+	bundleMaxFiles     = 10000
+	bundleMaxManifest  = 16 << 20
+)
+
+var projectNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// bundleImportMu 串行化导入，避免两个包同时写入同一个项目目录
+var bundleImportMu sync.Mutex
+
+// BundleManifest 描述场景包的内容，位于 zip 根目录的 manifest.json
+type BundleManifest struct {
+	Version int          `json:"version"`
+	Root    string       `json:"root"`   // 场景根文件在包内的路径
+	Source  string       `json:"source"` // 导出时根文件相对数据根目录的路径
+	Created time.Time    `json:"created"`
+	Files   []BundleFile `json:"files"`
+}
+
+// BundleFile 是包内的一个文件，哈希按包内字节（改写引用之后）计算
+type BundleFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Source string `json:"source,omitempty"`
+}
+
+// BundleImportResult 是导入场景包的结果
+type BundleImportResult struct {
+	Project string   `json:"project"`
+	Root    string   `json:"root"` // 导入后根文件相对数据根目录的路径
+	URL     string   `json:"url"`  // 根文件的访问地址 /p/<project>/data/...
+	Files   []string `json:"files"`
+	Bytes   int64    `json:"bytes"`
+}
+
+// bundleError 表示包本身有问题（返回 422），其余错误按服务器错误处理
+type bundleError struct{ msg string }
+
+func (e *bundleError) Error() string { return e.msg }
+
+func bundleErrorf(format string, args ...interface{}) error {
+	return &bundleError{fmt.Sprintf(format, args...)}
+}
+
+// projectsRoot 返回项目命名空间的存放目录
+func projectsRoot() string {
+	return filepath.Join(dataRoot, "projects")
+}
+
+// bundleEntry 是导出时要写入 zip 的一个文件
+type bundleEntry struct {
+	Source string // 相对数据根目录
+	Path   string // 包内路径
+	Data   []byte // 改写过引用的内容，为 nil 时直接复制源文件
+}
+
+// planBundle 计算场景根文件的完整依赖闭包，按它们的公共父目录确定包内路径，
+// 这样相对引用在包内保持有效；只有 three.js 的 /data/ 绝对路径需要改写
+func planBundle(root string) ([]bundleEntry, []AssetRef, error) {
+	g, err := buildDepGraph()
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg, ok := g.Errors[root]; ok {
+		return nil, nil, &bundleError{msg}
+	}
+	refs := walkRefs(root, g.Refs, func(r AssetRef) string { return r.Path }, true)
+	files := []string{root}
+	seen := map[string]bool{root: true}
+	var dangling []AssetRef
+	for _, r := range refs {
+		if r.dangling() {
+			dangling = append(dangling, r)
+			continue
+		}
+		if !seen[r.Path] {
+			seen[r.Path] = true
+			files = append(files, r.Path)
+		}
+	}
+	if len(dangling) > 0 {
+		return nil, dangling, bundleErrorf("scene has %d dangling references", len(dangling))
+	}
+	for _, f := range files {
+		if msg, ok := g.Errors[f]; ok {
+			return nil, nil, bundleErrorf("%s: %s", f, msg)
+		}
+	}
+
+	base := commonDir(files)
+	inBundle := func(p string) string {
+		if base == "" {
+			return p
+		}
+		return strings.TrimPrefix(p, base+"/")
+	}
+	entries := make([]bundleEntry, 0, len(files))
+	for _, f := range files {
+		e := bundleEntry{Source: f, Path: inBundle(f)}
+		if e.Path == bundleManifestName {
+			return nil, nil, bundleErrorf("%s conflicts with the bundle manifest", f)
+		}
+		rewrite := map[string]string{}
+		for _, r := range g.Refs[f] {
+			if strings.HasPrefix(r.URI, "/") {
+				rel, err := filepath.Rel(filepath.FromSlash(path.Dir(e.Path)), filepath.FromSlash(inBundle(r.Path)))
+				if err != nil {
+					return nil, nil, err
+				}
+				rewrite[r.URI] = (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath()
+			}
+		}
+		if len(rewrite) > 0 {
+			if e.Data, err = rewriteThreeJSONURLs(filepath.Join(dataRoot, filepath.FromSlash(f)), rewrite); err != nil {
+				return nil, nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil, nil
+}
+
+// commonDir 返回一组斜杠路径所在目录的公共前缀，数据根目录本身为空串
+func commonDir(files []string) string {
+	var common []string
+	for i, f := range files {
+		dir := strings.Split(path.Dir(f), "/")
+		if dir[0] == "." {
+			dir = nil
+		}
+		if i == 0 {
+			common = dir
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(dir) && common[n] == dir[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return strings.Join(common, "/")
+}
+
+// rewriteThreeJSONURLs 按映射替换 three.js 场景里 images[].url 的值
+func rewriteThreeJSONURLs(file string, rewrite map[string]string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	images, _ := doc["images"].([]interface{})
+	for _, im := range images {
+		img, ok := im.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch u := img["url"].(type) {
+		case string:
+			if v, ok := rewrite[u]; ok {
+				img["url"] = v
+			}
+		case []interface{}:
+			for i, s := range u {
+				if str, ok := s.(string); ok {
+					if v, ok := rewrite[str]; ok {
+						u[i] = v
+					}
+				}
+			}
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// writeBundle 把文件依次写入 zip，最后写入带哈希的清单
+func writeBundle(w io.Writer, root string, entries []bundleEntry) error {
+	zw := zip.NewWriter(w)
+	manifest := BundleManifest{Version: bundleVersion, Source: root, Created: time.Now().UTC()}
+	for _, e := range entries {
+		if e.Source == root {
+			manifest.Root = e.Path
+		}
+		bf, err := writeBundleEntry(zw, e, manifest.Created)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, bf)
+	}
+	js, _ := json.MarshalIndent(manifest, "", "  ")
+	zf, err := zw.CreateHeader(&zip.FileHeader{Name: bundleManifestName, Method: zip.Deflate, Modified: manifest.Created})
+	if err != nil {
+		return err
+	}
+	if _, err := zf.Write(js); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeBundleEntry 写入一个文件并计算哈希
+func writeBundleEntry(zw *zip.Writer, e bundleEntry, modified time.Time) (BundleFile, error) {
+	hdr := &zip.FileHeader{Name: e.Path, Method: zip.Deflate, Modified: modified}
+	switch strings.ToLower(path.Ext(e.Path)) {
+	case ".png", ".jpg", ".jpeg", ".webp", ".gif", ".ktx2", ".basis":
+		hdr.Method = zip.Store // 已经压缩过的格式
+	}
+	var src io.Reader = bytes.NewReader(e.Data)
+	if e.Data == nil {
+		f, err := os.Open(filepath.Join(dataRoot, filepath.FromSlash(e.Source)))
+		if err != nil {
+			return BundleFile{}, err
+		}
+		defer f.Close()
+		if st, err := f.Stat(); err == nil {
+			hdr.Modified = st.ModTime()
+		}
+		src = f
+	}
+	zf, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return BundleFile{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(zf, h), src)
+	if err != nil {
+		return BundleFile{}, err
+	}
+	return BundleFile{Path: e.Path, Size: n, SHA256: hex.EncodeToString(h.Sum(nil)), Source: e.Source}, nil
+}
+
+// exportBundleHandler 处理 GET /api/bundles?root=scene.gltf，流式返回 zip
+func exportBundleHandler(c *gin.Context) {
+	if c.Query("root") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "root is required"})
+		return
+	}
+	file, err := resolveDataPath(c.Query("root"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if st, err := os.Stat(file); err != nil || st.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "root not found"})
+		return
+	}
+	root := dataRelPath(file)
+	if !checkSigned(c, root) {
+		return
+	}
+	entries, dangling, err := planBundle(root)
+	var be *bundleError
+	switch {
+	case errors.As(err, &be):
+		body := gin.H{"error": err.Error()}
+		if dangling != nil {
+			body["dangling"] = dangling
+		}
+		c.JSON(http.StatusUnprocessableEntity, body)
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 包里的每个文件都会被读出，受保护的依赖同样需要签名（scope 签名可覆盖整个目录）
+	for _, e := range entries {
+		if !checkSigned(c, e.Source) {
+			return
+		}
+	}
+	name := strings.TrimSuffix(path.Base(root), path.Ext(root)) + ".zip"
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, strings.ReplaceAll(name, `"`, "_")))
+	c.Status(http.StatusOK)
+	if err := writeBundle(c.Writer, root, entries); err != nil {
+		// 响应头已经发出，只能中断连接让客户端拿到不完整的 zip
+		c.Error(err)
+		c.Abort()
+	}
+}
+
+// validBundlePath 检查包内路径：相对、已规范化、不含隐藏或上级目录
+func validBundlePath(p string) bool {
+	if p == "" || strings.Contains(p, "\\") || path.IsAbs(p) || path.Clean(p) != p {
+		return false
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || strings.HasPrefix(part, ".") || strings.Contains(part, ":") {
+			return false
+		}
+	}
+	return true
+}
+
+// readBundleManifest 校验 zip 的结构并返回清单：条目必须与清单一一对应，大小一致，没有符号链接
+func readBundleManifest(zr *zip.Reader) (*BundleManifest, map[string]*zip.File, error) {
+	var mf *zip.File
+	entries := map[string]*zip.File{}
+	for _, f := range zr.File {
+		if f.Name == bundleManifestName {
+			mf = f
+			continue
+		}
+		if strings.HasSuffix(f.Name, "/") && f.UncompressedSize64 == 0 {
+			continue // 目录条目
+		}
+		if f.Mode()&os.ModeType != 0 {
+			return nil, nil, bundleErrorf("%s: only regular files are allowed", f.Name)
+		}
+		if _, dup := entries[f.Name]; dup {
+			return nil, nil, bundleErrorf("%s: duplicate entry", f.Name)
+		}
+		entries[f.Name] = f
+	}
+	if mf == nil {
+		return nil, nil, bundleErrorf("bundle has no %s", bundleManifestName)
+	}
+	if mf.UncompressedSize64 > bundleMaxManifest {
+		return nil, nil, bundleErrorf("%s is too large", bundleManifestName)
+	}
+	rc, err := mf.Open()
+	if err != nil {
+		return nil, nil, bundleErrorf("%s: %v", bundleManifestName, err)
+	}
+	defer rc.Close()
+	m := new(BundleManifest)
+	if err := json.NewDecoder(io.LimitReader(rc, bundleMaxManifest)).Decode(m); err != nil {
+		return nil, nil, bundleErrorf("%s: %v", bundleManifestName, err)
+	}
+	if m.Version != bundleVersion {
+		return nil, nil, bundleErrorf("unsupported bundle version %d", m.Version)
+	}
+	if len(m.Files) > bundleMaxFiles {
+		return nil, nil, bundleErrorf("bundle has more than %d files", bundleMaxFiles)
+	}
+	listed := map[string]bool{}
+	var total int64
+	for _, bf := range m.Files {
+		if !validBundlePath(bf.Path) {
+			return nil, nil, bundleErrorf("invalid path %q", bf.Path)
+		}
+		if listed[bf.Path] {
+			return nil, nil, bundleErrorf("%s listed twice", bf.Path)
+		}
+		listed[bf.Path] = true
+		f, ok := entries[bf.Path]
+		if !ok {
+			return nil, nil, bundleErrorf("%s is listed in the manifest but missing", bf.Path)
+		}
+		if bf.Size < 0 || uint64(bf.Size) != f.UncompressedSize64 {
+			return nil, nil, bundleErrorf("%s: size does not match the manifest", bf.Path)
+		}
+		if total += bf.Size; total > bundleMaxBytes {
+			return nil, nil, bundleErrorf("bundle exceeds %d bytes", bundleMaxBytes)
+		}
+	}
+	for name := range entries {
+		if !listed[name] {
+			return nil, nil, bundleErrorf("%s is not listed in the manifest", name)
+		}
+	}
+	if !listed[m.Root] {
+		return nil, nil, bundleErrorf("root %q is not in the bundle", m.Root)
+	}
+	return m, entries, nil
+}
+
+// extractBundle 把包解压到 dir，边写边校验哈希
+func extractBundle(m *BundleManifest, entries map[string]*zip.File, dir string) error {
+	for _, bf := range m.Files {
+		rc, err := entries[bf.Path].Open()
+		if err != nil {
+			return bundleErrorf("%s: %v", bf.Path, err)
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(bf.Path))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			rc.Close()
+			return err
+		}
+		out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			rc.Close()
+			return err
+		}
+		h := sha256.New()
+		// 多读 1 字节以发现实际内容比声明的更大
+		n, err := io.Copy(io.MultiWriter(out, h), io.LimitReader(rc, bf.Size+1))
+		rc.Close()
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return bundleErrorf("%s: %v", bf.Path, err)
+		}
+		if n != bf.Size || !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), bf.SHA256) {
+			return bundleErrorf("%s: checksum mismatch", bf.Path)
+		}
+	}
+	return nil
+}
+
+// checkBundleRefs 确认解压后的文件只引用包内存在的文件
+func checkBundleRefs(m *BundleManifest, dir string) error {
+	prefix := dataRelPath(dir) + "/"
+	for _, bf := range m.Files {
+		file := filepath.Join(dir, filepath.FromSlash(bf.Path))
+		if assetKind(file) == "" {
+			continue
+		}
+		raw, err := readAssetRefs(file)
+		if err != nil {
+			return bundleErrorf("%s: %v", bf.Path, err)
+		}
+		for _, r := range raw {
+			ref := resolveAssetRef(file, r)
+			if ref.dangling() || !strings.HasPrefix(ref.Path, prefix) {
+				return bundleErrorf("%s: reference %q is not contained in the bundle", bf.Path, r.URI)
+			}
+		}
+	}
+	return nil
+}
+
+// importBundle 校验并把场景包解压到 projects/<project>/ 下；已有同名文件时需要 overwrite
+func importBundle(zr *zip.Reader, project string, overwrite bool) (*BundleImportResult, error) {
+	m, entries, err := readBundleManifest(zr)
+	if err != nil {
+		return nil, err
+	}
+	// 场景、预设等目录由各自的接口维护，包里的文件不能覆盖它们
+	for _, bf := range m.Files {
+		if managedPath(bf.Path) {
+			return nil, bundleErrorf("%s: bundles cannot write to the scenes, presets, layouts or cameras directories", bf.Path)
+		}
+	}
+	if err := os.MkdirAll(projectsRoot(), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(projectsRoot(), ".bundle-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractBundle(m, entries, tmp); err != nil {
+		return nil, err
+	}
+	if err := checkBundleRefs(m, tmp); err != nil {
+		return nil, err
+	}
+
+	bundleImportMu.Lock()
+	defer bundleImportMu.Unlock()
+	targets, err := bundleTargets(m, project)
+	if err != nil {
+		return nil, err
+	}
+	if !overwrite {
+		var conflicts []string
+		for _, bf := range m.Files {
+			if _, err := os.Lstat(targets[bf.Path]); err == nil {
+				conflicts = append(conflicts, bf.Path)
+			}
+		}
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return nil, fmt.Errorf("%w: %s", errOutputExists, strings.Join(conflicts, ", "))
+		}
+	}
+	res := &BundleImportResult{Project: project, Files: []string{}}
+	for _, bf := range m.Files {
+		dst := targets[bf.Path]
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(filepath.Join(tmp, filepath.FromSlash(bf.Path)), dst); err != nil {
+			return nil, err
+		}
+		res.Files = append(res.Files, dataRelPath(dst))
+		res.Bytes += bf.Size
+	}
+	res.Root = dataRelPath(targets[m.Root])
+	res.URL = projectStore(project).dataURL(targets[m.Root])
+	return res, nil
+}
+
+// bundleTargets 解析每个文件在项目目录中的实际位置：项目里已有的符号链接不能把文件带出项目目录，
+// 也不能把文件带进场景、预设等接口维护的目录
+func bundleTargets(m *BundleManifest, project string) (map[string]string, error) {
+	s := projectStore(project)
+	if err := os.MkdirAll(s.root, 0755); err != nil {
+		return nil, err
+	}
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(m.Files))
+	for _, bf := range m.Files {
+		dst, err := s.resolve(bf.Path)
+		if errors.Is(err, errOutsideRoot) {
+			return nil, bundleErrorf("%s: resolves outside the project", bf.Path)
+		} else if err != nil {
+			return nil, err
+		}
+		if rel, err := filepath.Rel(root, dst); err != nil || managedPath(filepath.ToSlash(rel)) {
+			return nil, bundleErrorf("%s: bundles cannot write to the scenes, presets, layouts or cameras directories", bf.Path)
+		}
+		targets[bf.Path] = dst
+	}
+	return targets, nil
+}
+
+// importBundleHandler 处理 POST /p/:project/api/bundles?overwrite=true，挂在 projectAccess(roleEditor) 之后；
+// 请求体为 multipart 的 file 字段，或直接是 application/zip
+func importBundleHandler(c *gin.Context) {
+	project := requestStore(c).project
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, bundleMaxBytes)
+	var ra io.ReaderAt
+	var size int64
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		ra, size = f, fh.Size
+	} else {
+		// zip 需要随机访问，先把请求体落到临时文件
+		tmp, err := os.CreateTemp("", "bundle-*.zip")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if size, err = io.Copy(tmp, c.Request.Body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ra = tmp
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid zip: " + err.Error()})
+		return
+	}
+	res, err := importBundle(zr, project, c.Query("overwrite") == "true")
+	var be *bundleError
+	switch {
+	case errors.As(err, &be):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, errOutputExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusCreated, res)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidBundlePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"scene.gltf", true},
+		{"tex/a b.png", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"../x.png", false},
+		{"a/../b.png", false},
+		{"a//b.png", false},
+		{"tex\\a.png", false},
+		{".hidden/a.png", false},
+		{"c:/a.png", false},
+	}
+	for _, tt := range tests {
+		if got := validBundlePath(tt.path); got != tt.want {
+			t.Errorf("validBundlePath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"a/b/c.gltf", "a/b/c.bin"}, "a/b"},
+		{[]string{"a/b/c.gltf", "a/tex/c.png"}, "a"},
+		{[]string{"a/c.gltf", "b/c.png"}, ""},
+		{[]string{"c.gltf"}, ""},
+	}
+	for _, tt := range tests {
+		if got := commonDir(tt.files); got != tt.want {
+			t.Errorf("commonDir(%q) = %q, want %q", tt.files, got, tt.want)
+		}
+	}
+}
+
+// exportTestBundle 导出 root 的场景包并返回 zip 读取器
+func exportTestBundle(t *testing.T, root string) *zip.Reader {
+	t.Helper()
+	entries, dangling, err := planBundle(root)
+	if err != nil {
+		t.Fatalf("planBundle: %v (dangling %v)", err, dangling)
+	}
+	var buf bytes.Buffer
+	if err := writeBundle(&buf, root, entries); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	root := setTestDataRoot(t)
+	writeDataFiles(t, root, map[string]string{
+		"scenes/city/car.obj":  "mtllib car.mtl\nv 0 0 0\n",
+		"scenes/city/car.mtl":  "newmtl paint\nmap_Kd ../tex/paint.png\n",
+		"scenes/tex/paint.png": "png",
+		"scenes/city.json":     `{"metadata":{"type":"Object","version":4.5},"images":[{"url":"/data/scenes/tex/paint.png"}]}`,
+	})
+	for _, scene := range []string{"scenes/city/car.obj", "scenes/city.json"} {
+		t.Run(scene, func(t *testing.T) {
+			zr := exportTestBundle(t, scene)
+			res, err := importBundle(zr, "p1", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 导入后的场景只引用项目内的文件，/data/ 绝对路径已改写为相对路径
+			g, err := buildDepGraph()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range walkRefs(res.Root, g.Refs, func(r AssetRef) string { return r.Path }, true) {
+				if r.dangling() || !strings.HasPrefix(r.Path, "projects/p1/") {
+					t.Errorf("imported reference %+v escapes the project", r)
+				}
+			}
+			if _, err := importBundle(zr, "p1", false); !errors.Is(err, errOutputExists) {
+				t.Fatalf("second import: got %v, want errOutputExists", err)
+			}
+			if _, err := importBundle(zr, "p1", true); err != nil {
+				t.Fatalf("overwrite: %v", err)
+			}
+			os.RemoveAll(filepath.Join(projectsRoot(), "p1"))
+		})
+	}
+}
+
+func TestBundleDangling(t *testing.T) {
+	root := setTestDataRoot(t)
+	writeDataFiles(t, root, map[string]string{"car.obj": "mtllib missing.mtl\n"})
+	_, dangling, err := planBundle("car.obj")
+	var be *bundleError
+	if !errors.As(err, &be) || len(dangling) != 1 {
+		t.Fatalf("got %v, %v; want a bundle error with one dangling reference", dangling, err)
+	}
+}
+
+// testZip 按清单写入文件；files 可以和清单不一致，用来构造错误的包
+func testZip(t *testing.T, m BundleManifest, files map[string]string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if m.Version != 0 {
+		js, _ := json.Marshal(m)
+		w, _ := zw.Create(bundleManifestName)
+		w.Write(js)
+	}
+	zw.Close()
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func bundleFile(path, data string) BundleFile {
+	sum := sha256.Sum256([]byte(data))
+	return BundleFile{Path: path, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func TestImportBundleRejected(t *testing.T) {
+	setTestDataRoot(t)
+	obj := "v 0 0 0\n"
+	ok := []BundleFile{bundleFile("a.obj", obj)}
+	tests := []struct {
+		name  string
+		m     BundleManifest
+		files map[string]string
+	}{
+		{"no manifest", BundleManifest{}, map[string]string{"a.obj": obj}},
+		{"wrong version", BundleManifest{Version: 9, Root: "a.obj", Files: ok}, map[string]string{"a.obj": obj}},
+		{"missing root", BundleManifest{Version: 1, Root: "b.obj", Files: ok}, map[string]string{"a.obj": obj}},
+		{"unlisted entry", BundleManifest{Version: 1, Root: "a.obj", Files: ok}, map[string]string{"a.obj": obj, "x.png": "png"}},
+		{"listed but missing", BundleManifest{Version: 1, Root: "a.obj", Files: append(ok, bundleFile("x.png", "png"))}, map[string]string{"a.obj": obj}},
+		{"parent path", BundleManifest{Version: 1, Root: "../a.obj", Files: []BundleFile{bundleFile("../a.obj", obj)}}, map[string]string{"../a.obj": obj}},
+		{"size mismatch", BundleManifest{Version: 1, Root: "a.obj", Files: []BundleFile{{Path: "a.obj", Size: 1, SHA256: ok[0].SHA256}}}, map[string]string{"a.obj": obj}},
+		{"checksum mismatch", BundleManifest{Version: 1, Root: "a.obj", Files: []BundleFile{{Path: "a.obj", Size: int64(len(obj)), SHA256: "00"}}}, map[string]string{"a.obj": obj}},
+		{"reference outside bundle", BundleManifest{Version: 1, Root: "a.obj", Files: []BundleFile{bundleFile("a.obj", "mtllib ../x.mtl\n")}}, map[string]string{"a.obj": "mtllib ../x.mtl\n"}},
+		{"managed directory", BundleManifest{Version: 1, Root: "a.obj", Files: append(ok, bundleFile("scenes/x.json", "{}"))}, map[string]string{"a.obj": obj, "scenes/x.json": "{}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := importBundle(testZip(t, tt.m, tt.files), "p1", false)
+			var be *bundleError
+			if !errors.As(err, &be) {
+				t.Fatalf("got %v, want a bundle error", err)
+			}
+			if _, err := os.Stat(filepath.Join(projectsRoot(), "p1")); !os.IsNotExist(err) {
+				t.Fatal("rejected bundle left files in the project")
+			}
+		})
+	}
+}
+
+func TestImportBundleSymlinks(t *testing.T) {
+	root := setTestDataRoot(t)
+	obj := "v 0 0 0\n"
+	os.MkdirAll(filepath.Join(root, "projects/p1/scenes"), 0755)
+	os.MkdirAll(filepath.Join(root, "public"), 0755)
+	for name, target := range map[string]string{"to-public": "../../public", "assets": "scenes"} {
+		if err := os.Symlink(target, filepath.Join(root, "projects/p1", name)); err != nil {
+			t.Skip("symlinks are not supported:", err)
+		}
+	}
+	for _, p := range []string{"to-public/a.obj", "assets/a.obj"} {
+		m := BundleManifest{Version: 1, Root: p, Files: []BundleFile{bundleFile(p, obj)}}
+		_, err := importBundle(testZip(t, m, map[string]string{p: obj}), "p1", false)
+		var be *bundleError
+		if !errors.As(err, &be) {
+			t.Errorf("%s: got %v, want a bundle error", p, err)
+		}
+	}
+	for _, dir := range []string{"public", "projects/p1/scenes"} {
+		if entries, _ := os.ReadDir(filepath.Join(root, dir)); len(entries) != 0 {
+			t.Errorf("%s: import wrote %d files through a symlink", dir, len(entries))
+		}
+	}
+}
+
+func TestImportBundleHandler(t *testing.T) {
+	setTestDataRoot(t)
+	if err := writeProject(&Project{Name: "p1", Members: []ProjectMember{{"ann", roleEditor}, {"vic", roleViewer}}}); err != nil {
+		t.Fatal(err)
+	}
+	oldKey := authConfig.key
+	t.Cleanup(func() { authConfig.key = oldKey })
+	_, authConfig.key, _ = ed25519.GenerateKey(rand.Reader)
+
+	obj := "v 0 0 0\n"
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("a.obj")
+	w.Write([]byte(obj))
+	js, _ := json.Marshal(BundleManifest{Version: 1, Root: "a.obj", Files: []BundleFile{bundleFile("a.obj", obj)}})
+	w, _ = zw.Create(bundleManifestName)
+	w.Write(js)
+	zw.Close()
+
+	tests := []struct {
+		name    string
+		project string
+		user    string
+		status  int
+	}{
+		{"viewer", "p1", "vic", http.StatusForbidden},
+		{"not a member", "p1", "eve", http.StatusNotFound},
+		{"unknown project", "p2", "ann", http.StatusNotFound},
+		{"editor", "p1", "ann", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := func(c *gin.Context) { c.Set("claims", &Claims{Subject: tt.user, Role: roleEditor}) }
+			w := serveTest(http.MethodPost, "/p/:project/api/bundles", "/p/"+tt.project+"/api/bundles", buf.String(), login, projectAccess(roleEditor), importBundleHandler)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(projectsRoot(), "p1", "a.obj")); err != nil {
+		t.Fatal(err)
+	}
+}
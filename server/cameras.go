@@ -0,0 +1,617 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	cameraMaxBytes     = 1 << 20
+	cameraMaxKeyframes = 256
+	tourDefaultRate    = 30
+	tourMaxRate        = 120
+	tourMaxSamples     = 100000
+	tourMaxSeconds     = 3600 // 单个关键帧 duration 和 hold 的上限
+	// 向心 Catmull-Rom：不会在关键帧之间打结，也不会明显越过关键帧
+	catmullRomAlpha = 0.5
+)
+
+// camerasMu 串行化书签和漫游路线的写操作
+var camerasMu sync.Mutex
+
+// tourEasings 是关键帧之间可用的缓动，空字符串等同于 linear
+var tourEasings = map[string]func(float64) float64{
+	"":       func(u float64) float64 { return u },
+	"linear": func(u float64) float64 { return u },
+	"easeIn": func(u float64) float64 { return u * u * u },
+	"easeOut": func(u float64) float64 {
+		v := 1 - u
+		return 1 - v*v*v
+	},
+	"easeInOut": func(u float64) float64 {
+		if u < 0.5 {
+			return 4 * u * u * u
+		}
+		v := -2*u + 2
+		return 1 - v*v*v/2
+	},
+}
+
+// CameraPose 与 three.js 的 PerspectiveCamera 对应：camera.position、camera.up、camera.fov，再 lookAt(target)
+type CameraPose struct {
+	Position vec3    `json:"position"`
+	Target   vec3    `json:"target"`
+	Fov      float64 `json:"fov"`
+	Up       vec3    `json:"up"`
+}
+
+// Bookmark 是场景中一个命名的相机位置
+type Bookmark struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	CameraPose
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// TourKeyframe 是漫游路线的一个关键帧，Bookmark 和 Pose 二选一；
+// 相机在关键帧停留 Hold 秒，再用 Duration 秒按 Easing 移动到下一个关键帧
+type TourKeyframe struct {
+	Bookmark string      `json:"bookmark,omitempty"`
+	Pose     *CameraPose `json:"pose,omitempty"`
+	Duration float64     `json:"duration"`
+	Hold     float64     `json:"hold,omitempty"`
+	Easing   string      `json:"easing,omitempty"`
+}
+
+// Tour 是按顺序播放的关键帧，Loop 为 true 时最后一个关键帧会回到第一个
+type Tour struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Loop      bool           `json:"loop"`
+	Keyframes []TourKeyframe `json:"keyframes"`
+	Created   time.Time      `json:"created"`
+	Updated   time.Time      `json:"updated"`
+}
+
+// TourSample 是采样得到的一帧，T 为从漫游开始计的秒数
+type TourSample struct {
+	T float64 `json:"t"`
+	CameraPose
+}
+
+// TourPath 是预先计算好的相机路径，前端按 rate 逐帧播放即可
+type TourPath struct {
+	Tour      string       `json:"tour"`
+	Rate      int          `json:"rate"`
+	Duration  float64      `json:"duration"`
+	Keyframes []float64    `json:"keyframes"` // 每个关键帧到达的时间
+	Poses     []TourSample `json:"poses"`
+}
+
+// sceneCameras 是一个场景的全部书签和漫游路线，保存在 cameras/<scene>.json
+type sceneCameras struct {
+	Bookmarks []*Bookmark `json:"bookmarks"`
+	Tours     []*Tour     `json:"tours"`
+}
+
+// bookmarkRequest 是创建/更新书签的请求体，up 省略时为 (0, 1, 0)
+type bookmarkRequest struct {
+	Name string `json:"name" binding:"required,max=128"`
+	CameraPose
+}
+
+// tourRequest 是创建/更新漫游路线的请求体
+type tourRequest struct {
+	Name      string         `json:"name" binding:"required,max=128"`
+	Loop      bool           `json:"loop"`
+	Keyframes []TourKeyframe `json:"keyframes"`
+}
+
+func (s store) camerasFile(scene string) string {
+	return filepath.Join(s.root, "cameras", scene+".json")
+}
+
+func (s store) readCameras(scene string) (*sceneCameras, error) {
+	cams := &sceneCameras{Bookmarks: []*Bookmark{}, Tours: []*Tour{}}
+	data, err := os.ReadFile(s.camerasFile(scene))
+	if os.IsNotExist(err) {
+		return cams, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cams); err != nil {
+		return nil, err
+	}
+	return cams, nil
+}
+
+func (s store) writeCameras(scene string, cams *sceneCameras) error {
+	js, _ := json.MarshalIndent(cams, "", "  ")
+	return writeFileAtomic(s.camerasFile(scene), js, 0644)
+}
+
+func (cams *sceneCameras) bookmark(id string) *Bookmark {
+	for _, b := range cams.Bookmarks {
+		if b.ID == id {
+			return b
+		}
+	}
+	return nil
+}
+
+func (cams *sceneCameras) tour(id string) *Tour {
+	for _, t := range cams.Tours {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// normalize 补上默认的 up 并归一化
+func (p *CameraPose) normalize() {
+	if p.Up == (vec3{}) {
+		p.Up = vec3{0, 1, 0}
+	}
+	p.Up = p.Up.norm()
+}
+
+// validate 检查相机参数，问题位置以 p 为前缀
+func (pose *CameraPose) validate(p string, issues *[]Issue) {
+	if pose.Fov <= 0 || pose.Fov >= 180 {
+		*issues = append(*issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: p + "/fov", Message: "fov must be between 0 and 180 degrees"})
+	}
+	dir := pose.Target.sub(pose.Position)
+	if dir.length() < 1e-9 {
+		*issues = append(*issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: p + "/target", Message: "target must differ from position"})
+		return
+	}
+	if dir.cross(pose.Up).length() < 1e-9*dir.length() {
+		*issues = append(*issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: p + "/up", Message: "up must not be parallel to the view direction"})
+	}
+}
+
+// validateTour 检查关键帧，书签引用在 cams 中查找
+func validateTour(req *tourRequest, cams *sceneCameras) []Issue {
+	issues := []Issue{}
+	n := len(req.Keyframes)
+	if n < 2 || n > cameraMaxKeyframes {
+		issues = append(issues, Issue{Code: "ARRAY_LENGTH", Pointer: "/keyframes", Message: fmt.Sprintf("a tour needs 2 to %d keyframes", cameraMaxKeyframes)})
+	}
+	for i := range req.Keyframes {
+		k := &req.Keyframes[i]
+		p := fmt.Sprintf("/keyframes/%d", i)
+		switch {
+		case k.Bookmark != "" && k.Pose != nil:
+			issues = append(issues, Issue{Code: "TYPE_MISMATCH", Pointer: p, Message: "bookmark and pose are mutually exclusive"})
+		case k.Bookmark != "":
+			if cams.bookmark(k.Bookmark) == nil {
+				issues = append(issues, Issue{Code: "UNRESOLVED_REFERENCE", Pointer: p + "/bookmark", Message: fmt.Sprintf("bookmark %q not found", k.Bookmark)})
+			}
+		case k.Pose != nil:
+			k.Pose.normalize()
+			k.Pose.validate(p+"/pose", &issues)
+		default:
+			issues = append(issues, Issue{Code: "REQUIRED", Pointer: p, Message: "keyframe needs a bookmark or a pose"})
+		}
+		// 不循环时最后一个关键帧之后没有移动，duration 不起作用
+		if (i < n-1 || req.Loop) && k.Duration <= 0 {
+			issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: p + "/duration", Message: "duration must be greater than 0"})
+		} else if k.Duration < 0 || k.Duration > tourMaxSeconds {
+			issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: p + "/duration", Message: fmt.Sprintf("duration must be between 0 and %d seconds", tourMaxSeconds)})
+		}
+		if k.Hold < 0 || k.Hold > tourMaxSeconds {
+			issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: p + "/hold", Message: fmt.Sprintf("hold must be between 0 and %d seconds", tourMaxSeconds)})
+		}
+		if _, ok := tourEasings[k.Easing]; !ok {
+			issues = append(issues, Issue{Code: "VALUE_NOT_IN_LIST", Pointer: p + "/easing", Message: "easing must be one of linear, easeIn, easeOut, easeInOut"})
+		}
+	}
+	return issues
+}
+
+// catmullRom 用 Barry-Goldman 算法求 p1 到 p2 之间参数 s 处的点，alpha 为 0 时是均匀参数化
+func catmullRom(p0, p1, p2, p3 vec3, s, alpha float64) vec3 {
+	if p2 == p1 {
+		return p1
+	}
+	knot := func(a, b vec3) float64 {
+		return math.Pow(math.Max(b.sub(a).length(), 1e-9), alpha)
+	}
+	t0 := 0.0
+	t1 := t0 + knot(p0, p1)
+	t2 := t1 + knot(p1, p2)
+	t3 := t2 + knot(p2, p3)
+	t := t1 + s*(t2-t1)
+	mix := func(a, b vec3, ta, tb float64) vec3 {
+		return a.lerp(b, (t-ta)/(tb-ta))
+	}
+	a1 := mix(p0, p1, t0, t1)
+	a2 := mix(p1, p2, t1, t2)
+	a3 := mix(p2, p3, t2, t3)
+	b1 := mix(a1, a2, t0, t2)
+	b2 := mix(a2, a3, t1, t3)
+	return mix(b1, b2, t1, t2)
+}
+
+// sampleTour 按 rate 帧每秒对漫游路线采样。位置和目标点各走一条向心 Catmull-Rom 样条，
+// fov 用均匀 Catmull-Rom，up 线性插值后归一化；缓动作用在每一段的样条参数上
+func sampleTour(t *Tour, cams *sceneCameras, rate int) (*TourPath, error) {
+	poses := make([]CameraPose, len(t.Keyframes))
+	for i, k := range t.Keyframes {
+		if k.Pose != nil {
+			poses[i] = *k.Pose
+		} else if b := cams.bookmark(k.Bookmark); b != nil {
+			poses[i] = b.CameraPose
+		} else {
+			return nil, fmt.Errorf("keyframe %d: bookmark %q not found", i, k.Bookmark)
+		}
+		poses[i].normalize()
+	}
+	n := len(poses)
+	// 不循环时在两端外推一个虚拟关键帧，让首尾两段也有切线
+	at := func(i int, get func(CameraPose) vec3) vec3 {
+		if t.Loop {
+			return get(poses[(i%n+n)%n])
+		}
+		switch {
+		case i < 0:
+			a, b := get(poses[0]), get(poses[1])
+			return b.lerp(a, 2)
+		case i >= n:
+			a, b := get(poses[n-2]), get(poses[n-1])
+			return a.lerp(b, 2)
+		}
+		return get(poses[i])
+	}
+	position := func(p CameraPose) vec3 { return p.Position }
+	target := func(p CameraPose) vec3 { return p.Target }
+	fov := func(p CameraPose) vec3 { return vec3{p.Fov} }
+
+	segments := n - 1
+	if t.Loop {
+		segments = n
+	}
+	path := &TourPath{Tour: t.ID, Rate: rate, Keyframes: make([]float64, 0, n)}
+	// 先算出每个关键帧的到达时间和整条路线的时长
+	starts := make([]float64, n)
+	for i, k := range t.Keyframes {
+		starts[i] = path.Duration
+		path.Keyframes = append(path.Keyframes, path.Duration)
+		path.Duration += k.Hold
+		if i < segments {
+			path.Duration += k.Duration
+		}
+	}
+	// 先按浮点数比较：时长很大时转换为 int 会溢出
+	if samples := math.Floor(path.Duration*float64(rate)) + 1; samples > tourMaxSamples {
+		return nil, fmt.Errorf("tour would produce %.0f poses, the limit is %d; lower the rate", samples, tourMaxSamples)
+	}
+	frames := int(math.Floor(path.Duration*float64(rate))) + 1
+	eval := func(ts float64) CameraPose {
+		i := 0
+		for i < n-1 && starts[i+1] <= ts {
+			i++
+		}
+		k := t.Keyframes[i]
+		local := ts - starts[i] - k.Hold
+		if local <= 0 || i >= segments {
+			return poses[i]
+		}
+		s := tourEasings[k.Easing](math.Min(local/k.Duration, 1))
+		seg := func(get func(CameraPose) vec3, alpha float64) vec3 {
+			return catmullRom(at(i-1, get), at(i, get), at(i+1, get), at(i+2, get), s, alpha)
+		}
+		pose := CameraPose{
+			Position: seg(position, catmullRomAlpha),
+			Target:   seg(target, catmullRomAlpha),
+			Fov:      math.Max(1, math.Min(179, seg(fov, 0)[0])),
+			Up:       poses[i].Up.lerp(poses[(i+1)%n].Up, s),
+		}
+		if pose.Up.length() < 1e-6 {
+			pose.Up = poses[i].Up
+		}
+		pose.normalize()
+		return pose
+	}
+	path.Poses = make([]TourSample, 0, frames+1)
+	for f := 0; f < frames; f++ {
+		ts := float64(f) / float64(rate)
+		path.Poses = append(path.Poses, TourSample{T: ts, CameraPose: eval(ts)})
+	}
+	// 时长不是帧间隔的整数倍时补上终点
+	if last := path.Poses[len(path.Poses)-1].T; path.Duration-last > 1e-9 {
+		path.Poses = append(path.Poses, TourSample{T: path.Duration, CameraPose: eval(path.Duration)})
+	}
+	return path, nil
+}
+
+// cameraScene 检查路由中的场景是否存在，失败时直接写出错误响应
+func cameraScene(c *gin.Context) (string, bool) {
+	id, ok := sceneID(c)
+	if !ok {
+		return "", false
+	}
+	if _, err := os.Stat(requestStore(c).sceneMetaFile(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return "", false
+	}
+	return id, true
+}
+
+// loadCameras 读取场景的书签和路线，失败时直接写出错误响应
+func loadCameras(c *gin.Context) (string, *sceneCameras, bool) {
+	id, ok := cameraScene(c)
+	if !ok {
+		return "", nil, false
+	}
+	cams, err := requestStore(c).readCameras(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	return id, cams, true
+}
+
+// bindBookmark 读取并校验书签请求体，失败时直接写出错误响应
+func bindBookmark(c *gin.Context) (*bookmarkRequest, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cameraMaxBytes)
+	var req bookmarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	req.normalize()
+	issues := []Issue{}
+	req.validate("", &issues)
+	if len(issues) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid bookmark", "errors": issues})
+		return nil, false
+	}
+	return &req, true
+}
+
+// bindTour 读取并校验路线请求体，失败时直接写出错误响应
+func bindTour(c *gin.Context, cams *sceneCameras) (*tourRequest, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cameraMaxBytes)
+	var req tourRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if issues := validateTour(&req, cams); len(issues) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid tour", "errors": issues})
+		return nil, false
+	}
+	return &req, true
+}
+
+// saveCameras 写入场景的书签和路线，失败时直接写出错误响应
+func saveCameras(c *gin.Context, scene string, cams *sceneCameras) bool {
+	if err := requestStore(c).writeCameras(scene, cams); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// listBookmarksHandler 处理 GET /api/scenes/:id/bookmarks
+func listBookmarksHandler(c *gin.Context) {
+	if _, cams, ok := loadCameras(c); ok {
+		c.JSON(http.StatusOK, cams.Bookmarks)
+	}
+}
+
+// createBookmarkHandler 处理 POST /api/scenes/:id/bookmarks
+func createBookmarkHandler(c *gin.Context) {
+	req, ok := bindBookmark(c)
+	if !ok {
+		return
+	}
+	camerasMu.Lock()
+	defer camerasMu.Unlock()
+	scene, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	b := &Bookmark{ID: newJobID(), Name: req.Name, CameraPose: req.CameraPose, Created: now, Updated: now}
+	cams.Bookmarks = append(cams.Bookmarks, b)
+	if saveCameras(c, scene, cams) {
+		c.JSON(http.StatusCreated, b)
+	}
+}
+
+// getBookmarkHandler 处理 GET /api/scenes/:id/bookmarks/:bid
+func getBookmarkHandler(c *gin.Context) {
+	_, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	if b := cams.bookmark(c.Param("bid")); b != nil {
+		c.JSON(http.StatusOK, b)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "bookmark not found"})
+}
+
+// updateBookmarkHandler 处理 PUT /api/scenes/:id/bookmarks/:bid，引用它的路线随之改变
+func updateBookmarkHandler(c *gin.Context) {
+	req, ok := bindBookmark(c)
+	if !ok {
+		return
+	}
+	camerasMu.Lock()
+	defer camerasMu.Unlock()
+	scene, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	b := cams.bookmark(c.Param("bid"))
+	if b == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bookmark not found"})
+		return
+	}
+	b.Name, b.CameraPose, b.Updated = req.Name, req.CameraPose, time.Now().UTC()
+	if saveCameras(c, scene, cams) {
+		c.JSON(http.StatusOK, b)
+	}
+}
+
+// deleteBookmarkHandler 处理 DELETE /api/scenes/:id/bookmarks/:bid，仍被路线引用时返回 409
+func deleteBookmarkHandler(c *gin.Context) {
+	camerasMu.Lock()
+	defer camerasMu.Unlock()
+	scene, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	id := c.Param("bid")
+	if cams.bookmark(id) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bookmark not found"})
+		return
+	}
+	users := []string{}
+	for _, t := range cams.Tours {
+		for _, k := range t.Keyframes {
+			if k.Bookmark == id {
+				users = append(users, t.ID)
+				break
+			}
+		}
+	}
+	if len(users) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "bookmark is used by tours", "tours": users})
+		return
+	}
+	for i, b := range cams.Bookmarks {
+		if b.ID == id {
+			cams.Bookmarks = append(cams.Bookmarks[:i], cams.Bookmarks[i+1:]...)
+			break
+		}
+	}
+	if saveCameras(c, scene, cams) {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// listToursHandler 处理 GET /api/scenes/:id/tours
+func listToursHandler(c *gin.Context) {
+	if _, cams, ok := loadCameras(c); ok {
+		c.JSON(http.StatusOK, cams.Tours)
+	}
+}
+
+// createTourHandler 处理 POST /api/scenes/:id/tours
+func createTourHandler(c *gin.Context) {
+	camerasMu.Lock()
+	defer camerasMu.Unlock()
+	scene, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	req, ok := bindTour(c, cams)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	t := &Tour{ID: newJobID(), Name: req.Name, Loop: req.Loop, Keyframes: req.Keyframes, Created: now, Updated: now}
+	cams.Tours = append(cams.Tours, t)
+	if saveCameras(c, scene, cams) {
+		c.JSON(http.StatusCreated, t)
+	}
+}
+
+// getTourHandler 处理 GET /api/scenes/:id/tours/:tid
+func getTourHandler(c *gin.Context) {
+	_, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	if t := cams.tour(c.Param("tid")); t != nil {
+		c.JSON(http.StatusOK, t)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "tour not found"})
+}
+
+// updateTourHandler 处理 PUT /api/scenes/:id/tours/:tid
+func updateTourHandler(c *gin.Context) {
+	camerasMu.Lock()
+	defer camerasMu.Unlock()
+	scene, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	t := cams.tour(c.Param("tid"))
+	if t == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tour not found"})
+		return
+	}
+	req, ok := bindTour(c, cams)
+	if !ok {
+		return
+	}
+	t.Name, t.Loop, t.Keyframes, t.Updated = req.Name, req.Loop, req.Keyframes, time.Now().UTC()
+	if saveCameras(c, scene, cams) {
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// deleteTourHandler 处理 DELETE /api/scenes/:id/tours/:tid
+func deleteTourHandler(c *gin.Context) {
+	camerasMu.Lock()
+	defer camerasMu.Unlock()
+	scene, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	for i, t := range cams.Tours {
+		if t.ID == c.Param("tid") {
+			cams.Tours = append(cams.Tours[:i], cams.Tours[i+1:]...)
+			if saveCameras(c, scene, cams) {
+				c.Status(http.StatusNoContent)
+			}
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "tour not found"})
+}
+
+// tourPathHandler 处理 GET /api/scenes/:id/tours/:tid/path?rate=，返回按 rate 帧每秒采样的相机位姿
+func tourPathHandler(c *gin.Context) {
+	rate := tourDefaultRate
+	if r := c.Query("rate"); r != "" {
+		n, err := strconv.Atoi(r)
+		if err != nil || n < 1 || n > tourMaxRate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rate must be an integer between 1 and %d", tourMaxRate)})
+			return
+		}
+		rate = n
+	}
+	_, cams, ok := loadCameras(c)
+	if !ok {
+		return
+	}
+	t := cams.tour(c.Param("tid"))
+	if t == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tour not found"})
+		return
+	}
+	path, err := sampleTour(t, cams, rate)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, path)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCatmullRom(t *testing.T) {
+	p0, p1, p2, p3 := vec3{-1, 0, 0}, vec3{0, 0, 0}, vec3{1, 1, 0}, vec3{2, 1, 0}
+	for _, alpha := range []float64{0, 0.5, 1} {
+		// 端点与关键帧重合
+		if got := catmullRom(p0, p1, p2, p3, 0, alpha); got.sub(p1).length() > 1e-9 {
+			t.Errorf("alpha %v: s=0 gives %v, want %v", alpha, got, p1)
+		}
+		if got := catmullRom(p0, p1, p2, p3, 1, alpha); got.sub(p2).length() > 1e-9 {
+			t.Errorf("alpha %v: s=1 gives %v, want %v", alpha, got, p2)
+		}
+	}
+	// 共线等距的点退化为直线插值
+	a, b, c, d := vec3{0, 0, 0}, vec3{1, 0, 0}, vec3{2, 0, 0}, vec3{3, 0, 0}
+	if got := catmullRom(a, b, c, d, 0.25, catmullRomAlpha); got.sub(vec3{1.25, 0, 0}).length() > 1e-9 {
+		t.Errorf("collinear s=0.25 gives %v", got)
+	}
+	// 重合的关键帧不产生 NaN
+	if got := catmullRom(b, b, b, c, 0.5, catmullRomAlpha); got != b {
+		t.Errorf("coincident keyframes give %v", got)
+	}
+}
+
+func TestTourEasings(t *testing.T) {
+	for name, f := range tourEasings {
+		if f(0) != 0 || math.Abs(f(1)-1) > 1e-12 {
+			t.Errorf("%q does not map [0, 1] onto itself", name)
+		}
+		for u := 0.0; u < 1; u += 0.05 {
+			if f(u+0.05) < f(u) {
+				t.Errorf("%q is not monotonic at %v", name, u)
+			}
+		}
+	}
+}
+
+func testPose(x float64) *CameraPose {
+	return &CameraPose{Position: vec3{x, 0, 10}, Target: vec3{x, 0, 0}, Fov: 50}
+}
+
+func TestValidateTour(t *testing.T) {
+	cams := &sceneCameras{Bookmarks: []*Bookmark{{ID: "b1", CameraPose: *testPose(0)}}}
+	tests := []struct {
+		name      string
+		loop      bool
+		keyframes []TourKeyframe
+		code      string
+		pointer   string
+	}{
+		{"valid", false, []TourKeyframe{{Bookmark: "b1", Duration: 2}, {Pose: testPose(1)}}, "", ""},
+		{"one keyframe", false, []TourKeyframe{{Bookmark: "b1"}}, "ARRAY_LENGTH", "/keyframes"},
+		{"both bookmark and pose", false, []TourKeyframe{{Bookmark: "b1", Pose: testPose(1), Duration: 1}, {Bookmark: "b1"}}, "TYPE_MISMATCH", "/keyframes/0"},
+		{"neither", false, []TourKeyframe{{Duration: 1}, {Bookmark: "b1"}}, "REQUIRED", "/keyframes/0"},
+		{"unknown bookmark", false, []TourKeyframe{{Bookmark: "nope", Duration: 1}, {Bookmark: "b1"}}, "UNRESOLVED_REFERENCE", "/keyframes/0/bookmark"},
+		{"zero duration", false, []TourKeyframe{{Bookmark: "b1"}, {Bookmark: "b1"}}, "VALUE_OUT_OF_RANGE", "/keyframes/0/duration"},
+		{"loop needs last duration", true, []TourKeyframe{{Bookmark: "b1", Duration: 1}, {Bookmark: "b1"}}, "VALUE_OUT_OF_RANGE", "/keyframes/1/duration"},
+		{"duration too long", false, []TourKeyframe{{Bookmark: "b1", Duration: tourMaxSeconds + 1}, {Bookmark: "b1"}}, "VALUE_OUT_OF_RANGE", "/keyframes/0/duration"},
+		{"huge last duration", false, []TourKeyframe{{Bookmark: "b1", Duration: 1}, {Bookmark: "b1", Duration: 1e300}}, "VALUE_OUT_OF_RANGE", "/keyframes/1/duration"},
+		{"hold too long", false, []TourKeyframe{{Bookmark: "b1", Duration: 1, Hold: 1e300}, {Bookmark: "b1"}}, "VALUE_OUT_OF_RANGE", "/keyframes/0/hold"},
+		{"negative hold", false, []TourKeyframe{{Bookmark: "b1", Duration: 1, Hold: -1}, {Bookmark: "b1"}}, "VALUE_OUT_OF_RANGE", "/keyframes/0/hold"},
+		{"unknown easing", false, []TourKeyframe{{Bookmark: "b1", Duration: 1, Easing: "bounce"}, {Bookmark: "b1"}}, "VALUE_NOT_IN_LIST", "/keyframes/0/easing"},
+		{"bad fov", false, []TourKeyframe{{Pose: &CameraPose{Position: vec3{0, 0, 1}, Fov: 180}, Duration: 1}, {Bookmark: "b1"}}, "VALUE_OUT_OF_RANGE", "/keyframes/0/pose/fov"},
+		{"up along view", false, []TourKeyframe{{Pose: &CameraPose{Position: vec3{0, 1, 0}, Fov: 50}, Duration: 1}, {Bookmark: "b1"}}, "VALUE_OUT_OF_RANGE", "/keyframes/0/pose/up"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := validateTour(&tourRequest{Name: "t", Loop: tt.loop, Keyframes: tt.keyframes}, cams)
+			if tt.code == "" {
+				if len(issues) > 0 {
+					t.Fatalf("unexpected issues %+v", issues)
+				}
+				return
+			}
+			for _, is := range issues {
+				if is.Code == tt.code && is.Pointer == tt.pointer {
+					return
+				}
+			}
+			t.Fatalf("missing %s at %s in %+v", tt.code, tt.pointer, issues)
+		})
+	}
+}
+
+func TestSampleTour(t *testing.T) {
+	cams := &sceneCameras{Bookmarks: []*Bookmark{{ID: "b1", CameraPose: *testPose(0)}}}
+	tests := []struct {
+		name      string
+		tour      Tour
+		rate      int
+		duration  float64
+		frames    int
+		keyframes []float64
+	}{
+		{"two keyframes", Tour{Keyframes: []TourKeyframe{{Bookmark: "b1", Duration: 2}, {Pose: testPose(4)}}}, 10, 2, 21, []float64{0, 2}},
+		{"hold", Tour{Keyframes: []TourKeyframe{{Bookmark: "b1", Duration: 1, Hold: 0.5}, {Pose: testPose(4), Hold: 1}}}, 10, 2.5, 26, []float64{0, 1.5}},
+		{"loop", Tour{Loop: true, Keyframes: []TourKeyframe{{Bookmark: "b1", Duration: 1}, {Pose: testPose(4), Duration: 1}}}, 10, 2, 21, []float64{0, 1}},
+		{"end between frames", Tour{Keyframes: []TourKeyframe{{Bookmark: "b1", Duration: 0.25}, {Pose: testPose(4)}}}, 10, 0.25, 4, []float64{0, 0.25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := sampleTour(&tt.tour, cams, tt.rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(path.Duration-tt.duration) > 1e-9 || len(path.Poses) != tt.frames {
+				t.Fatalf("duration %v with %d poses, want %v with %d", path.Duration, len(path.Poses), tt.duration, tt.frames)
+			}
+			for i, k := range tt.keyframes {
+				if math.Abs(path.Keyframes[i]-k) > 1e-9 {
+					t.Fatalf("keyframes = %v, want %v", path.Keyframes, tt.keyframes)
+				}
+			}
+			first, last := path.Poses[0], path.Poses[len(path.Poses)-1]
+			if first.Position != testPose(0).Position || last.T != path.Duration {
+				t.Fatalf("first %+v, last %+v", first, last)
+			}
+			want := tt.tour.Keyframes[len(tt.tour.Keyframes)-1].Pose.Position
+			if tt.tour.Loop {
+				want = testPose(0).Position
+			}
+			if last.Position.sub(want).length() > 1e-9 {
+				t.Fatalf("tour ends at %v, want %v", last.Position, want)
+			}
+			for _, s := range path.Poses {
+				if math.IsNaN(s.Position[0]) || math.Abs(s.Up.length()-1) > 1e-9 {
+					t.Fatalf("bad pose %+v", s)
+				}
+			}
+		})
+	}
+}
+
+func TestSampleTourLimit(t *testing.T) {
+	// 旧版本保存的路线可能有极大的时长，采样前不能溢出
+	for _, d := range []float64{tourMaxSamples, 1e300, math.MaxFloat64} {
+		tour := &Tour{Keyframes: []TourKeyframe{{Pose: testPose(0), Duration: d, Hold: d}, {Pose: testPose(1)}}}
+		if _, err := sampleTour(tour, &sceneCameras{}, tourMaxRate); err == nil {
+			t.Fatalf("duration %g: expected the sample limit to be enforced", d)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	collabMaxMessage   = 8 << 20
+	collabSendBuffer   = 256
+	collabWriteWait    = 10 * time.Second
+	collabPongWait     = 60 * time.Second
+	collabPingPeriod   = collabPongWait * 9 / 10
+	collabHelloWait    = 10 * time.Second
+	collabPersistDelay = time.Second
+	// 操作日志超过这个长度时，下次打开房间会开始新的 epoch，旧客户端改为接收快照
+	collabMaxLog = 50000
+)
+
+var collabActorPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var collabUpgrader = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+
+// collabMessage 是 WebSocket 上双向传递的消息：
+//
+//	客户端 hello {actor, epoch, vector}：epoch 与服务端一致时补发 vector 之后的操作（sync），否则发送快照（snapshot）
+//	客户端 ops {ops}：服务端合并后回复 ack {vector, rejected}，并把生效的操作以 ops 广播给其他客户端
+//	服务端 reset {error}：场景被整体替换或删除，客户端需要重新打开
+type collabMessage struct {
+	Type     string            `json:"type"`
+	Actor    string            `json:"actor,omitempty"`
+	Epoch    string            `json:"epoch,omitempty"`
+	Vector   map[string]uint64 `json:"vector,omitempty"`
+	Clock    uint64            `json:"clock,omitempty"`
+	Ops      []collabOp        `json:"ops,omitempty"`
+	Scene    interface{}       `json:"scene,omitempty"`
+	Rejected []collabRejected  `json:"rejected,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// collabRejected 是被拒绝的操作及原因
+type collabRejected struct {
+	Seq   uint64 `json:"seq"`
+	Error string `json:"error"`
+}
+
+// collabRoom 是一个场景的协作会话，所有连接共享同一个 CRDT 状态
+type collabRoom struct {
+	store  store
+	id     string
+	mu     sync.Mutex
+	doc    *collabDoc
+	log    []collabOp
+	peers  map[*collabPeer]bool
+	timer  *time.Timer
+	dirty  bool
+	closed bool
+}
+
+// collabPeer 是一个 WebSocket 连接，写操作都由 writeLoop 完成
+type collabPeer struct {
+	conn   *websocket.Conn
+	actor  string
+	send   chan []byte
+	once   sync.Once
+	reason string
+}
+
+// collabRooms 保存有连接的房间，按 store.key 区分不同项目的同名场景，最后一个连接断开时落盘并移除
+var collabRooms = struct {
+	sync.Mutex
+	m map[string]*collabRoom
+}{m: map[string]*collabRoom{}}
+
+func (s store) collabDir() string {
+	return filepath.Join(s.scenesRoot(), ".collab")
+}
+
+func (s store) collabStateFile(id string) string {
+	return filepath.Join(s.collabDir(), id+".json")
+}
+
+func (s store) collabLogFile(id string) string {
+	return filepath.Join(s.collabDir(), id+".ops.jsonl")
+}
+
+// openCollabRoom 读取持久化的 CRDT 状态，没有时从场景文件建立；状态之后的日志重新应用一遍
+func openCollabRoom(s store, id string) (*collabRoom, error) {
+	r := &collabRoom{store: s, id: id, peers: map[*collabPeer]bool{}}
+	if data, err := os.ReadFile(s.collabStateFile(id)); err == nil {
+		r.doc = new(collabDoc)
+		if err := json.Unmarshal(data, r.doc); err != nil {
+			return nil, err
+		}
+		r.doc.index()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	} else {
+		data, err := os.ReadFile(s.sceneFile(id))
+		if err != nil {
+			return nil, err
+		}
+		var scene map[string]interface{}
+		if err := json.Unmarshal(data, &scene); err != nil {
+			return nil, err
+		}
+		r.doc = newCollabDoc(scene)
+		os.Remove(s.collabLogFile(id))
+	}
+	f, err := os.Open(s.collabLogFile(id))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if f != nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, collabMaxMessage)
+		for sc.Scan() {
+			var op collabOp
+			if json.Unmarshal(sc.Bytes(), &op) != nil {
+				continue
+			}
+			r.log = append(r.log, op)
+			if op.Seq > r.doc.Vector[op.Actor] {
+				// 被拒绝的操作不写日志，日志中的序号可能不连续
+				r.doc.Vector[op.Actor] = op.Seq - 1
+				r.doc.apply(&op)
+				r.dirty = true
+			}
+		}
+	}
+	if len(r.log) > collabMaxLog {
+		r.doc.Epoch, r.log = newJobID(), nil
+		if err := r.writeState(); err != nil {
+			return nil, err
+		}
+		os.Remove(s.collabLogFile(id))
+	}
+	return r, nil
+}
+
+// joinCollabRoom 把连接加入场景的房间，房间不存在时打开
+func joinCollabRoom(s store, id string, p *collabPeer) (*collabRoom, error) {
+	collabRooms.Lock()
+	defer collabRooms.Unlock()
+	r := collabRooms.m[s.key(id)]
+	if r == nil {
+		var err error
+		if r, err = openCollabRoom(s, id); err != nil {
+			return nil, err
+		}
+		collabRooms.m[s.key(id)] = r
+	}
+	r.mu.Lock()
+	r.peers[p] = true
+	r.mu.Unlock()
+	return r, nil
+}
+
+// leave 移除连接；最后一个连接离开时立即落盘并关闭房间
+func (r *collabRoom) leave(p *collabPeer) {
+	r.mu.Lock()
+	delete(r.peers, p)
+	empty := len(r.peers) == 0
+	r.mu.Unlock()
+	if !empty {
+		return
+	}
+	r.persist()
+	collabRooms.Lock()
+	r.mu.Lock()
+	// 落盘期间可能又有新连接加入
+	if len(r.peers) == 0 && collabRooms.m[r.store.key(r.id)] == r {
+		delete(collabRooms.m, r.store.key(r.id))
+		r.closed = true
+	}
+	r.mu.Unlock()
+	collabRooms.Unlock()
+}
+
+// collabReset 在场景被 PUT 覆盖或删除后调用：断开所有协作连接并丢弃 CRDT 状态。
+// 调用方持有 scenesMu
+func collabReset(s store, id, reason string) {
+	collabRooms.Lock()
+	r := collabRooms.m[s.key(id)]
+	delete(collabRooms.m, s.key(id))
+	collabRooms.Unlock()
+	if r != nil {
+		r.mu.Lock()
+		r.closed = true
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+		for p := range r.peers {
+			if msg, err := json.Marshal(collabMessage{Type: "reset", Error: reason}); err == nil {
+				p.push(msg)
+			}
+			p.close(reason)
+		}
+		r.mu.Unlock()
+	}
+	os.Remove(s.collabStateFile(id))
+	os.Remove(s.collabLogFile(id))
+}
+
+// hello 根据客户端的 epoch 和版本向量补发缺少的操作，或者发送完整快照。
+// 消息引用了文档状态，需要在持锁时编码
+func (r *collabRoom) hello(m *collabMessage) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reply := collabMessage{Epoch: r.doc.Epoch, Vector: r.doc.Vector, Clock: r.doc.Clock}
+	if m.Epoch != r.doc.Epoch || m.Vector == nil {
+		reply.Type, reply.Scene = "snapshot", r.doc.scene()
+		return json.Marshal(reply)
+	}
+	reply.Type = "sync"
+	for _, op := range r.log {
+		if op.Seq > m.Vector[op.Actor] {
+			reply.Ops = append(reply.Ops, op)
+		}
+	}
+	return json.Marshal(reply)
+}
+
+// merge 应用客户端的一批操作，记录日志并广播给其他连接，返回给发送方的 ack
+func (r *collabRoom) merge(p *collabPeer, ops []collabOp) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, errors.New("scene was replaced")
+	}
+	var applied []collabOp
+	var rejected []collabRejected
+	for i := range ops {
+		op := &ops[i]
+		if op.Actor != p.actor {
+			rejected = append(rejected, collabRejected{Seq: op.Seq, Error: "actor does not match the connection"})
+			continue
+		}
+		switch err := r.doc.apply(op); {
+		case errors.Is(err, errDuplicateOp):
+		case err != nil:
+			rejected = append(rejected, collabRejected{Seq: op.Seq, Error: err.Error()})
+		default:
+			applied = append(applied, *op)
+		}
+	}
+	if len(applied) > 0 {
+		if err := r.appendLog(applied); err != nil {
+			return nil, err
+		}
+		r.log = append(r.log, applied...)
+		msg, err := json.Marshal(collabMessage{Type: "ops", Epoch: r.doc.Epoch, Vector: r.doc.Vector, Clock: r.doc.Clock, Ops: applied})
+		if err != nil {
+			return nil, err
+		}
+		for peer := range r.peers {
+			if peer != p {
+				peer.push(msg)
+			}
+		}
+		r.dirty = true
+		if r.timer == nil {
+			r.timer = time.AfterFunc(collabPersistDelay, r.persist)
+		}
+	}
+	return json.Marshal(collabMessage{Type: "ack", Epoch: r.doc.Epoch, Vector: r.doc.Vector, Clock: r.doc.Clock, Rejected: rejected})
+}
+
+// appendLog 先把操作追加到日志，崩溃后可从上次落盘的状态重放
+func (r *collabRoom) appendLog(ops []collabOp) error {
+	if err := os.MkdirAll(r.store.collabDir(), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.store.collabLogFile(r.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range ops {
+		if err := enc.Encode(&ops[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeState 写入 CRDT 状态，调用方持有 r.mu
+func (r *collabRoom) writeState() error {
+	js, err := json.Marshal(r.doc)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.store.collabStateFile(r.id), js, 0644)
+}
+
+// persist 把合并后的场景写回 scenes/<id>.json 并更新元数据，同时保存 CRDT 状态
+func (r *collabRoom) persist() {
+	scenesMu.Lock()
+	defer scenesMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	if r.closed || !r.dirty {
+		return
+	}
+	prev, err := r.store.readSceneMeta(r.id)
+	if err != nil {
+		return // 场景已被删除
+	}
+	scene, err := json.Marshal(r.doc.scene())
+	if err != nil {
+		logError("协作场景序列化失败", "scene", r.id, "error", err)
+		return
+	}
+	req := &sceneRequest{Name: prev.Name, Author: prev.Author, Scene: scene}
+	if _, err := r.store.saveScene(r.id, req, nil, prev); err != nil {
+		logError("协作场景保存失败", "scene", r.id, "error", err)
+		return
+	}
+	if err := r.writeState(); err != nil {
+		logError("协作状态保存失败", "scene", r.id, "error", err)
+		return
+	}
+	r.dirty = false
+}
+
+// push 把消息放入发送队列，队列满时断开这个过慢的连接
+func (p *collabPeer) push(msg []byte) {
+	select {
+	case p.send <- msg:
+	default:
+		p.close("client is too slow")
+	}
+}
+
+func (p *collabPeer) close(reason string) {
+	p.once.Do(func() {
+		p.reason = reason
+		close(p.send)
+	})
+}
+
+func (p *collabPeer) writeLoop() {
+	ticker := time.NewTicker(collabPingPeriod)
+	defer func() {
+		ticker.Stop()
+		p.conn.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-p.send:
+			p.conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if !ok {
+				p.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, p.reason))
+				return
+			}
+			if err := p.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			p.conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if err := p.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (p *collabPeer) reply(msg []byte, err error) {
+	if err != nil {
+		msg, err = json.Marshal(collabMessage{Type: "error", Error: err.Error()})
+	}
+	if err == nil {
+		p.push(msg)
+	}
+}
+
+// collabHandler 处理 GET /api/scenes/:id/collab 的 WebSocket 连接
+func collabHandler(c *gin.Context) {
+	id, ok := sceneID(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	if _, err := os.Stat(s.sceneMetaFile(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+	conn, err := collabUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrade 已经写出了错误响应
+	}
+	conn.SetReadLimit(collabMaxMessage)
+
+	// 第一条消息必须是 hello
+	var hello collabMessage
+	conn.SetReadDeadline(time.Now().Add(collabHelloWait))
+	if err := conn.ReadJSON(&hello); err != nil || hello.Type != "hello" || !collabActorPattern.MatchString(hello.Actor) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "expected hello with a valid actor"), time.Now().Add(collabWriteWait))
+		conn.Close()
+		return
+	}
+	p := &collabPeer{conn: conn, actor: hello.Actor, send: make(chan []byte, collabSendBuffer)}
+	room, err := joinCollabRoom(s, id, p)
+	if err != nil {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()), time.Now().Add(collabWriteWait))
+		conn.Close()
+		return
+	}
+	defer room.leave(p)
+	go p.writeLoop()
+	defer p.close("")
+	p.reply(room.hello(&hello))
+
+	conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+	for {
+		var m collabMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(collabPongWait))
+		switch m.Type {
+		case "ops":
+			p.reply(room.merge(p, m.Ops))
+		case "hello":
+			p.reply(room.hello(&m))
+		default:
+			p.reply(nil, errors.New("unknown message type "+m.Type))
+		}
+	}
+}
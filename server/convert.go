@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errOutputExists = errors.New("output file already exists")
+
+// ConvertOptions 是一次模型转换的参数
+type ConvertOptions struct {
+	Output        string // 输出路径（相对数据根目录），为空时与源文件同名、扩展名改为 .glb
+	EmbedTextures bool   // true 时把贴图嵌入 GLB
+	Overwrite     bool
+}
+
+// ConversionReport 记录一次转换的结果，同时写到输出文件旁边
+type ConversionReport struct {
+	Source           string              `json:"source"`
+	Output           string              `json:"output"`
+	Format           string              `json:"format"`
+	Vertices         int                 `json:"vertices"`
+	Triangles        int                 `json:"triangles"`
+	Primitives       int                 `json:"primitives"`
+	Materials        int                 `json:"materials"`
+	GeneratedNormals bool                `json:"generatedNormals"`
+	Textures         []meshTextureReport `json:"textures"`
+	Warnings         []string            `json:"warnings"`
+	Unsupported      []Issue             `json:"unsupported,omitempty"` // 无法用 glTF 表示的内容（three.js 场景）
+	InputBytes       int64               `json:"inputBytes"`
+	OutputBytes      int64               `json:"outputBytes"`
+	DurationMs       int64               `json:"durationMs"`
+	CreatedAt        time.Time           `json:"createdAt"`
+}
+
+// convertModel 把 OBJ/STL/three.js JSON 等格式转换为 GLB 并写回数据目录
+func convertModel(src string, opts ConvertOptions) (*ConversionReport, error) {
+	start := time.Now()
+	st, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	out := strings.TrimSuffix(src, filepath.Ext(src)) + ".glb"
+	if opts.Output != "" {
+		if out, err = resolveDataPath(opts.Output); err != nil {
+			return nil, err
+		}
+	}
+	if !strings.EqualFold(filepath.Ext(out), ".glb") {
+		return nil, errors.New("output must have a .glb extension")
+	}
+	if _, err := os.Stat(out); err == nil && !opts.Overwrite {
+		return nil, errOutputExists
+	}
+
+	rep := &ConversionReport{
+		Source:     dataRelPath(src),
+		Output:     dataRelPath(out),
+		InputBytes: st.Size(),
+		CreatedAt:  start.UTC(),
+	}
+	b := newGLTFBuilder("tServer convert")
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	texOpts := textureOptions{Embed: opts.EmbedTextures, OutDir: filepath.Dir(out)}
+	var mesh *meshData
+	var warnings []string
+	switch ext := strings.ToLower(filepath.Ext(src)); ext {
+	case ".obj":
+		rep.Format = "obj"
+		mesh, warnings, err = parseOBJ(src)
+	case ".stl":
+		rep.Format = "stl"
+		mesh, warnings, err = parseSTL(src)
+	case ".json":
+		rep.Format = "threejs"
+		err = convertThreeScene(src, b, texOpts, rep)
+	default:
+		return nil, fmt.Errorf("unsupported source format %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mesh != nil {
+		rep.GeneratedNormals = mesh.GeneratedNormals
+		rep.Vertices = mesh.vertexCount()
+		rep.Triangles = mesh.triangleCount()
+		rep.Materials = len(mesh.Materials)
+		textures, texWarnings := mesh.toGLTF(b, name, texOpts)
+		rep.Textures = textures
+		rep.Warnings = append(warnings, texWarnings...)
+		rep.Primitives = len(b.doc.Meshes[0].Primitives)
+	}
+	glb, err := b.glb()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(out, glb, 0644); err != nil {
+		return nil, err
+	}
+	rep.OutputBytes = int64(len(glb))
+	rep.DurationMs = time.Since(start).Milliseconds()
+	if rep.Textures == nil {
+		rep.Textures = []meshTextureReport{}
+	}
+	if rep.Warnings == nil {
+		rep.Warnings = []string{}
+	}
+	js, _ := json.MarshalIndent(rep, "", "  ")
+	if err := writeFileAtomic(conversionReportPath(out), js, 0644); err != nil {
+		return rep, err
+	}
+	return rep, nil
+}
+
+// conversionReportPath 返回转换报告的存放位置（与 GLB 同目录）
+func conversionReportPath(out string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + ".conversion.json"
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免读到写了一半的文件；
+// 临时文件在写入前就设为 perm，不会有一段时间以更宽的权限存在
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// convertHandler 处理 POST /api/models/*path/convert
+// 查询参数：out 输出路径，textures=embed|reference，overwrite=true
+func convertHandler(c *gin.Context, rel string) {
+	src, ok := modelFile(c, rel)
+	if !ok {
+		return
+	}
+	opts := ConvertOptions{
+		Output:        c.Query("out"),
+		EmbedTextures: c.DefaultQuery("textures", "embed") == "embed",
+		Overwrite:     c.Query("overwrite") == "true",
+	}
+	end := startSpan(c, "transform")
+	rep, err := convertModel(src, opts)
+	end()
+	switch {
+	case errors.Is(err, errOutputExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusCreated, rep)
+	}
+}
+
+// runConvert 实现 tServer convert 子命令
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	data := fs.String("data", "../data/", "静态资源根目录")
+	out := fs.String("out", "", "输出路径（相对数据根目录，只能在转换单个文件时使用）")
+	textures := fs.String("textures", "embed", "贴图处理方式：embed 或 reference")
+	overwrite := fs.Bool("overwrite", false, "覆盖已存在的输出文件")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法：tServer convert [参数] 文件...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || *out != "" && fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := setDataRoot(*data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	status := 0
+	for _, arg := range fs.Args() {
+		src, err := resolveCLIPath(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+			status = 1
+			continue
+		}
+		rep, err := convertModel(src, ConvertOptions{Output: *out, EmbedTextures: *textures == "embed", Overwrite: *overwrite})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+			status = 1
+			continue
+		}
+		fmt.Printf("%s -> %s (%d vertices, %d triangles, %d bytes)\n", rep.Source, rep.Output, rep.Vertices, rep.Triangles, rep.OutputBytes)
+		for _, w := range rep.Warnings {
+			fmt.Printf("  warning: %s\n", w)
+		}
+		for _, u := range rep.Unsupported {
+			fmt.Printf("  unsupported: %s: %s\n", u.Pointer, u.Message)
+		}
+	}
+	return status
+}
+
+// resolveCLIPath 把命令行中的路径解析为数据根目录内的文件：
+// 先按当前目录查找，找不到时按数据根目录的相对路径处理
+func resolveCLIPath(arg string) (string, error) {
+	if abs, err := filepath.Abs(arg); err == nil {
+		if _, err := os.Stat(abs); err == nil {
+			if !withinRoot(abs) {
+				return "", errOutsideRoot
+			}
+			return abs, nil
+		}
+	}
+	file := dataPath(arg)
+	if _, err := os.Stat(file); err != nil {
+		return "", err
+	}
+	return file, nil
+}
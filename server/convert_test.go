@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setTestDataRoot 把数据根目录指向临时目录，测试结束后恢复
+func setTestDataRoot(t *testing.T) string {
+	t.Helper()
+	old := dataRoot
+	t.Cleanup(func() { dataRoot = old })
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setDataRoot(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dataRoot
+}
+
+// setTestStateRoot 把状态目录指向数据根目录以外的临时目录，测试结束后恢复
+func setTestStateRoot(t *testing.T) string {
+	t.Helper()
+	old := stateRoot
+	t.Cleanup(func() { stateRoot = old })
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setStateRoot(dir); err != nil {
+		t.Fatal(err)
+	}
+	return stateRoot
+}
+
+func TestConvertModel(t *testing.T) {
+	root := setTestDataRoot(t)
+	files := map[string]string{
+		"quad.obj": "mtllib quad.mtl\nv 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nusemtl red\nf 1 2 3 4\n",
+		"quad.mtl": "newmtl red\nKd 1 0 0\n",
+		"tri.stl":  "solid t\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nvertex 0 1 0\nendloop\nendfacet\nendsolid t\n",
+	}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(root, name), []byte(data), 0644)
+	}
+	tests := []struct {
+		src       string
+		format    string
+		triangles int
+		materials int
+	}{
+		{"quad.obj", "obj", 2, 1},
+		{"tri.stl", "stl", 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			src := filepath.Join(root, tt.src)
+			rep, err := convertModel(src, ConvertOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.Format != tt.format || rep.Triangles != tt.triangles || rep.Materials != tt.materials {
+				t.Fatalf("unexpected report %+v", rep)
+			}
+			// 输出的 GLB 必须能通过自己的校验
+			ins, err := inspectModel(filepath.Join(root, rep.Output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ins.Validation.Valid {
+				t.Fatalf("converted GLB is invalid: %+v", ins.Validation.Errors)
+			}
+			if _, err := os.Stat(conversionReportPath(filepath.Join(root, rep.Output))); err != nil {
+				t.Fatalf("conversion report missing: %v", err)
+			}
+			if _, err := convertModel(src, ConvertOptions{}); !errors.Is(err, errOutputExists) {
+				t.Fatalf("second conversion: got %v, want errOutputExists", err)
+			}
+			if _, err := convertModel(src, ConvertOptions{Overwrite: true}); err != nil {
+				t.Fatalf("overwrite: %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomicPerm(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sub", "users")
+	for _, perm := range []os.FileMode{0644, 0600} {
+		if err := writeFileAtomic(file, []byte("ann:admin:x\n"), perm); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != perm {
+			t.Errorf("mode %v, want %v", fi.Mode().Perm(), perm)
+		}
+	}
+	// 不留下临时文件
+	if entries, _ := os.ReadDir(filepath.Dir(file)); len(entries) != 1 {
+		t.Errorf("%d files in directory, want 1", len(entries))
+	}
+}
+
+func TestConvertModelRejected(t *testing.T) {
+	root := setTestDataRoot(t)
+	os.WriteFile(filepath.Join(root, "a.obj"), []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"), 0644)
+	os.WriteFile(filepath.Join(root, "a.ply"), []byte("ply\n"), 0644)
+	tests := []struct {
+		name string
+		src  string
+		opts ConvertOptions
+	}{
+		{"missing source", "none.obj", ConvertOptions{}},
+		{"unsupported format", "a.ply", ConvertOptions{}},
+		{"non-glb output", "a.obj", ConvertOptions{Output: "a.gltf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := convertModel(filepath.Join(root, tt.src), tt.opts); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
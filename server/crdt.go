@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 协作操作的种类
+const (
+	opSet      = "set"      // 设置对象或资源的一个属性（LWW）
+	opAdd      = "add"      // 在父对象的 children 中插入对象（RGA）
+	opRemove   = "remove"   // 删除对象，留下墓碑
+	opResource = "resource" // 添加几何体/材质/纹理/图片，只增不改
+)
+
+// errDuplicateOp 表示操作已经应用过（客户端重连后重发）
+var errDuplicateOp = errors.New("duplicate operation")
+
+// threeResourceKeys 是场景中按 uuid 引用的资源数组
+var threeResourceKeys = []string{"geometries", "materials", "textures", "images"}
+
+// stamp 是 Lamport 时间戳，(Clock, Actor) 构成全序
+type stamp struct {
+	Clock uint64 `json:"clock"`
+	Actor string `json:"actor"`
+}
+
+func (a stamp) after(b stamp) bool {
+	if a.Clock != b.Clock {
+		return a.Clock > b.Clock
+	}
+	return a.Actor > b.Actor
+}
+
+// collabOp 是客户端发送的一个属性级操作；Seq 在同一 actor 内从 1 连续递增，
+// Clock 是客户端的 Lamport 时钟（大于它见过的所有 clock）
+type collabOp struct {
+	Actor  string          `json:"actor"`
+	Seq    uint64          `json:"seq"`
+	Clock  uint64          `json:"clock"`
+	Kind   string          `json:"kind"`
+	Target string          `json:"target,omitempty"` // set/remove：对象或资源的 uuid
+	Key    string          `json:"key,omitempty"`    // set：属性名；resource：资源数组名
+	Value  json.RawMessage `json:"value,omitempty"`  // set：新值，null 表示删除属性；resource：资源本身
+	Parent string          `json:"parent,omitempty"` // add：父对象 uuid
+	After  string          `json:"after,omitempty"`  // add：插在哪个兄弟之后，空表示最前
+	Object json.RawMessage `json:"object,omitempty"` // add：对象，可带 children
+}
+
+func (op *collabOp) stamp() stamp {
+	return stamp{Clock: op.Clock, Actor: op.Actor}
+}
+
+// rgaNode 是 children 序列中的一个元素；删除的对象保留为墓碑，后续插入仍可以引用它
+type rgaNode struct {
+	ID      string `json:"id"`
+	After   string `json:"after,omitempty"`
+	Stamp   stamp  `json:"stamp"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// collabDoc 是一个场景的 CRDT 状态：属性是 LWW 寄存器，children 是 RGA 序列。
+// 同一组操作以任意顺序应用都得到相同的场景
+type collabDoc struct {
+	Epoch    string                            `json:"epoch"`
+	Clock    uint64                            `json:"clock"`
+	Vector   map[string]uint64                 `json:"vector"`
+	Head     map[string]interface{}            `json:"head"` // 除 object 以外的顶层字段（metadata 和资源数组）
+	Root     string                            `json:"root"`
+	Objects  map[string]map[string]interface{} `json:"objects"` // uuid -> 不含 children 的对象
+	Children map[string][]*rgaNode             `json:"children"`
+	Stamps   map[string]stamp                  `json:"stamps"` // uuid + "/" + 属性名 -> 最后一次写入
+
+	resources map[string]map[string]interface{} // uuid -> Head 中的资源
+	parents   map[string]string                 // 对象 uuid -> 父对象 uuid
+}
+
+// newCollabDoc 从已通过校验的场景文档建立初始状态
+func newCollabDoc(scene map[string]interface{}) *collabDoc {
+	d := &collabDoc{
+		Epoch:    newJobID(),
+		Vector:   map[string]uint64{},
+		Head:     map[string]interface{}{},
+		Objects:  map[string]map[string]interface{}{},
+		Children: map[string][]*rgaNode{},
+		Stamps:   map[string]stamp{},
+	}
+	for k, v := range scene {
+		if k != "object" {
+			d.Head[k] = v
+		}
+	}
+	root := scene["object"].(map[string]interface{})
+	d.Root = root["uuid"].(string)
+	d.addTree(root, "", "", stamp{})
+	d.index()
+	return d
+}
+
+// index 重建资源和父对象索引（加载持久化状态后调用）
+func (d *collabDoc) index() {
+	d.resources = map[string]map[string]interface{}{}
+	for _, key := range threeResourceKeys {
+		list, _ := d.Head[key].([]interface{})
+		for _, it := range list {
+			if m, ok := it.(map[string]interface{}); ok {
+				if id, ok := m["uuid"].(string); ok {
+					d.resources[id] = m
+				}
+			}
+		}
+	}
+	d.parents = map[string]string{}
+	for parent, nodes := range d.Children {
+		for _, n := range nodes {
+			d.parents[n.ID] = parent
+		}
+	}
+}
+
+// addTree 把对象及其子树加入状态，子对象依次排在前一个兄弟之后
+func (d *collabDoc) addTree(obj map[string]interface{}, parent, after string, ts stamp) {
+	id := obj["uuid"].(string)
+	props := map[string]interface{}{}
+	for k, v := range obj {
+		if k != "children" {
+			props[k] = v
+		}
+	}
+	d.Objects[id] = props
+	if parent != "" {
+		d.Children[parent] = append(d.Children[parent], &rgaNode{ID: id, After: after, Stamp: ts})
+		if d.parents != nil {
+			d.parents[id] = parent
+		}
+	}
+	prev := ""
+	children, _ := obj["children"].([]interface{})
+	for _, ch := range children {
+		m := ch.(map[string]interface{})
+		d.addTree(m, id, prev, ts)
+		prev = m["uuid"].(string)
+	}
+}
+
+// apply 应用一个操作；重复的操作返回 errDuplicateOp，其余错误表示操作被拒绝。
+// 被拒绝的操作同样消耗序号，避免客户端之后的操作因序号空洞全部失败
+func (d *collabDoc) apply(op *collabOp) error {
+	if op.Actor == "" {
+		return errors.New("actor is required")
+	}
+	seen := d.Vector[op.Actor]
+	switch {
+	case op.Seq <= seen:
+		return errDuplicateOp
+	case op.Seq != seen+1:
+		return fmt.Errorf("expected seq %d, got %d", seen+1, op.Seq)
+	case op.Clock == 0:
+		return errors.New("clock must be positive")
+	}
+	d.Vector[op.Actor] = op.Seq
+	if op.Clock > d.Clock {
+		d.Clock = op.Clock
+	}
+	switch op.Kind {
+	case opSet:
+		return d.set(op)
+	case opAdd:
+		return d.add(op)
+	case opRemove:
+		return d.remove(op)
+	case opResource:
+		return d.resource(op)
+	}
+	return fmt.Errorf("unknown operation kind %q", op.Kind)
+}
+
+func (d *collabDoc) set(op *collabOp) error {
+	target, isObject := d.Objects[op.Target]
+	if !isObject {
+		target = d.resources[op.Target]
+	}
+	if target == nil {
+		return fmt.Errorf("unknown target %q", op.Target)
+	}
+	switch op.Key {
+	case "", "uuid", "type", "children":
+		return fmt.Errorf("property %q cannot be set", op.Key)
+	}
+	var value interface{}
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return fmt.Errorf("value: %w", err)
+	}
+	if err := d.checkProperty(isObject, op.Key, value); err != nil {
+		return err
+	}
+	key := op.Target + "/" + op.Key
+	if prev, ok := d.Stamps[key]; ok && !op.stamp().after(prev) {
+		return nil // 更晚的写入已经生效
+	}
+	d.Stamps[key] = op.stamp()
+	if value == nil {
+		delete(target, op.Key)
+	} else {
+		target[op.Key] = value
+	}
+	return nil
+}
+
+// checkProperty 检查会破坏场景结构的属性：矩阵和对资源的引用
+func (d *collabDoc) checkProperty(isObject bool, key string, value interface{}) error {
+	switch {
+	case value == nil && isObject && (key == "geometry" || key == "material"):
+		return fmt.Errorf("%s cannot be removed", key)
+	case value == nil:
+		return nil
+	case isObject && key == "matrix":
+		if len(threeFloats(value)) != 16 {
+			return errors.New("matrix must be an array of 16 numbers")
+		}
+		return nil
+	case isObject && (key == "geometry" || key == "material"):
+	case !isObject && (key == "map" || strings.HasSuffix(key, "Map") || key == "image"):
+	default:
+		return nil
+	}
+	v := d.validator()
+	switch key {
+	case "geometry":
+		v.ref("/geometry", value, v.geometries, "geometry")
+	case "material":
+		if list, ok := value.([]interface{}); ok {
+			for i, id := range list {
+				v.ref(fmt.Sprintf("/material/%d", i), id, v.materials, "material")
+			}
+		} else {
+			v.ref("/material", value, v.materials, "material")
+		}
+	case "image":
+		v.ref("/image", value, v.images, "image")
+	default:
+		v.ref("/"+key, value, v.textures, "texture")
+	}
+	if len(v.issues) > 0 {
+		return fmt.Errorf("%s: %s", v.issues[0].Pointer, v.issues[0].Message)
+	}
+	return nil
+}
+
+func (d *collabDoc) add(op *collabOp) error {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(op.Object, &obj); err != nil || obj == nil {
+		return errors.New("object must be a JSON object")
+	}
+	if _, ok := d.Objects[op.Parent]; !ok {
+		return fmt.Errorf("unknown parent %q", op.Parent)
+	}
+	if op.After != "" && d.parents[op.After] != op.Parent {
+		return fmt.Errorf("%q is not a child of %q", op.After, op.Parent)
+	}
+	v := d.validator()
+	v.object("/object", obj)
+	if len(v.issues) > 0 {
+		return fmt.Errorf("%s: %s", v.issues[0].Pointer, v.issues[0].Message)
+	}
+	d.addTree(obj, op.Parent, op.After, op.stamp())
+	return nil
+}
+
+func (d *collabDoc) remove(op *collabOp) error {
+	parent, ok := d.parents[op.Target]
+	if !ok {
+		if op.Target == d.Root {
+			return errors.New("the root object cannot be removed")
+		}
+		return fmt.Errorf("unknown object %q", op.Target)
+	}
+	for _, n := range d.Children[parent] {
+		if n.ID == op.Target {
+			n.Removed = true
+		}
+	}
+	return nil
+}
+
+// resource 添加新资源；uuid 已存在时保留先到的版本，修改资源属性用 set
+func (d *collabDoc) resource(op *collabOp) error {
+	var item map[string]interface{}
+	if err := json.Unmarshal(op.Value, &item); err != nil || item == nil {
+		return errors.New("value must be a JSON object")
+	}
+	v := d.validator()
+	p := "/" + op.Key
+	switch op.Key {
+	case "geometries":
+		v.geometry(p, item)
+	case "materials":
+		v.material(p, item)
+	case "textures":
+		v.texture(p, item)
+	case "images":
+	default:
+		return fmt.Errorf("unknown resource collection %q", op.Key)
+	}
+	id, ok := item["uuid"].(string)
+	if !ok || id == "" {
+		v.error(p+"/uuid", "REQUIRED", "uuid must be a non-empty string")
+	}
+	if len(v.issues) > 0 {
+		return fmt.Errorf("%s: %s", v.issues[0].Pointer, v.issues[0].Message)
+	}
+	if _, ok := d.resources[id]; ok {
+		return nil
+	}
+	list, _ := d.Head[op.Key].([]interface{})
+	d.Head[op.Key] = append(list, item)
+	d.resources[id] = item
+	return nil
+}
+
+// validator 返回一个已知晓当前资源和对象 uuid 的校验器，用来检查单个操作
+func (d *collabDoc) validator() *threeValidator {
+	v := &threeValidator{objects: map[string]string{}}
+	sets := map[string]map[string]bool{}
+	for _, key := range threeResourceKeys {
+		sets[key] = map[string]bool{}
+		list, _ := d.Head[key].([]interface{})
+		for _, it := range list {
+			if m, ok := it.(map[string]interface{}); ok {
+				if id, ok := m["uuid"].(string); ok {
+					sets[key][id] = true
+				}
+			}
+		}
+	}
+	v.geometries, v.materials, v.textures, v.images = sets["geometries"], sets["materials"], sets["textures"], sets["images"]
+	for id := range d.Objects {
+		v.objects[id] = "the scene"
+	}
+	return v
+}
+
+// order 按 RGA 规则排列父对象的 children：同一位置上的并发插入按时间戳从新到旧，墓碑不输出
+func (d *collabDoc) order(parent string) []string {
+	next := map[string][]*rgaNode{}
+	for _, n := range d.Children[parent] {
+		next[n.After] = append(next[n.After], n)
+	}
+	for _, list := range next {
+		sort.Slice(list, func(a, b int) bool {
+			if list[a].Stamp != list[b].Stamp {
+				return list[a].Stamp.after(list[b].Stamp)
+			}
+			return list[a].ID < list[b].ID
+		})
+	}
+	var ids []string
+	var walk func(after string)
+	walk = func(after string) {
+		for _, n := range next[after] {
+			if !n.Removed {
+				ids = append(ids, n.ID)
+			}
+			walk(n.ID)
+		}
+	}
+	walk("")
+	return ids
+}
+
+// scene 生成合并后的 three.js JSON 文档
+func (d *collabDoc) scene() map[string]interface{} {
+	out := make(map[string]interface{}, len(d.Head)+1)
+	for k, v := range d.Head {
+		out[k] = v
+	}
+	out["object"] = d.tree(d.Root)
+	return out
+}
+
+func (d *collabDoc) tree(id string) map[string]interface{} {
+	obj := make(map[string]interface{}, len(d.Objects[id])+1)
+	for k, v := range d.Objects[id] {
+		obj[k] = v
+	}
+	var children []interface{}
+	for _, ch := range d.order(id) {
+		children = append(children, d.tree(ch))
+	}
+	if len(children) > 0 {
+		obj["children"] = children
+	}
+	return obj
+}
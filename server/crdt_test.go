@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func testCollabDoc() *collabDoc {
+	return newCollabDoc(map[string]interface{}{
+		"metadata": map[string]interface{}{"version": 4.5, "type": "Object"},
+		"object": map[string]interface{}{
+			"uuid": "root", "type": "Scene",
+			"children": []interface{}{map[string]interface{}{"uuid": "a", "type": "Group"}},
+		},
+	})
+}
+
+func TestCollabMergeOrderIndependent(t *testing.T) {
+	// 两个 actor 并发地在同一位置插入、修改同一属性、删除对象
+	alice := []*collabOp{
+		{Actor: "alice", Seq: 1, Clock: 1, Kind: opAdd, Parent: "root", After: "a", Object: json.RawMessage(`{"uuid":"b","type":"Group"}`)},
+		{Actor: "alice", Seq: 2, Clock: 2, Kind: opSet, Target: "a", Key: "name", Value: json.RawMessage(`"from alice"`)},
+		{Actor: "alice", Seq: 3, Clock: 3, Kind: opAdd, Parent: "b", Object: json.RawMessage(`{"uuid":"b1","type":"Group"}`)},
+	}
+	bob := []*collabOp{
+		{Actor: "bob", Seq: 1, Clock: 1, Kind: opAdd, Parent: "root", After: "a", Object: json.RawMessage(`{"uuid":"c","type":"Group"}`)},
+		{Actor: "bob", Seq: 2, Clock: 2, Kind: opSet, Target: "a", Key: "name", Value: json.RawMessage(`"from bob"`)},
+		{Actor: "bob", Seq: 3, Clock: 4, Kind: opRemove, Target: "a"},
+	}
+	orders := [][]*collabOp{
+		append(append([]*collabOp{}, alice...), bob...),
+		append(append([]*collabOp{}, bob...), alice...),
+		{bob[0], alice[0], alice[1], bob[1], bob[2], alice[2]},
+		{alice[0], bob[0], bob[1], bob[2], alice[1], alice[2]},
+	}
+	var want string
+	for i, ops := range orders {
+		d := testCollabDoc()
+		for _, op := range ops {
+			if err := d.apply(op); err != nil {
+				t.Fatalf("order %d: %s seq %d: %v", i, op.Actor, op.Seq, err)
+			}
+		}
+		js, _ := json.Marshal(d.scene())
+		if i == 0 {
+			want = string(js)
+		} else if string(js) != want {
+			t.Fatalf("order %d produced\n%s\nwant\n%s", i, js, want)
+		}
+	}
+	d := testCollabDoc()
+	for _, op := range orders[0] {
+		d.apply(op)
+	}
+	// 同一时钟的并发写入按 actor 决定胜负，并发插入按时间戳从新到旧排列
+	if got := d.Objects["a"]["name"]; got != "from bob" {
+		t.Errorf("name = %v, want the write from bob", got)
+	}
+	if got := d.order("root"); len(got) != 2 || got[0] != "c" || got[1] != "b" {
+		t.Errorf("children = %v, want [c b]", got)
+	}
+}
+
+func TestCollabApplyDuplicate(t *testing.T) {
+	d := testCollabDoc()
+	op := &collabOp{Actor: "alice", Seq: 1, Clock: 1, Kind: opSet, Target: "a", Key: "name", Value: json.RawMessage(`"x"`)}
+	if err := d.apply(op); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.apply(op); !errors.Is(err, errDuplicateOp) {
+		t.Fatalf("got %v, want errDuplicateOp", err)
+	}
+}
+
+func TestCollabApplyMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		op   collabOp
+	}{
+		{"missing actor", collabOp{Seq: 1, Clock: 1, Kind: opRemove, Target: "a"}},
+		{"sequence gap", collabOp{Actor: "x", Seq: 2, Clock: 1, Kind: opRemove, Target: "a"}},
+		{"zero clock", collabOp{Actor: "x", Seq: 1, Kind: opRemove, Target: "a"}},
+		{"unknown kind", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: "move"}},
+		{"unknown target", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opSet, Target: "nope", Key: "name", Value: json.RawMessage(`"x"`)}},
+		{"set uuid", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opSet, Target: "a", Key: "uuid", Value: json.RawMessage(`"b"`)}},
+		{"set children", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opSet, Target: "a", Key: "children", Value: json.RawMessage(`[]`)}},
+		{"invalid value", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opSet, Target: "a", Key: "name", Value: json.RawMessage(`{`)}},
+		{"short matrix", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opSet, Target: "a", Key: "matrix", Value: json.RawMessage(`[1,0,0]`)}},
+		{"unknown geometry", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opSet, Target: "a", Key: "geometry", Value: json.RawMessage(`"g"`)}},
+		{"add to unknown parent", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opAdd, Parent: "nope", Object: json.RawMessage(`{"uuid":"b","type":"Group"}`)}},
+		{"add after non-sibling", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opAdd, Parent: "a", After: "root", Object: json.RawMessage(`{"uuid":"b","type":"Group"}`)}},
+		{"add duplicate uuid", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opAdd, Parent: "root", Object: json.RawMessage(`{"uuid":"a","type":"Group"}`)}},
+		{"add without uuid", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opAdd, Parent: "root", Object: json.RawMessage(`{"type":"Group"}`)}},
+		{"add non-object", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opAdd, Parent: "root", Object: json.RawMessage(`[1]`)}},
+		{"remove root", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opRemove, Target: "root"}},
+		{"remove unknown", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opRemove, Target: "nope"}},
+		{"resource non-object", collabOp{Actor: "x", Seq: 1, Clock: 1, Kind: opResource, Key: "materials", Value: json.RawMessage(`"m"`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testCollabDoc()
+			before, _ := json.Marshal(d.scene())
+			if err := d.apply(&tt.op); err == nil || errors.Is(err, errDuplicateOp) {
+				t.Fatalf("got %v, want a rejection", err)
+			}
+			if after, _ := json.Marshal(d.scene()); string(after) != string(before) {
+				t.Fatalf("rejected operation changed the scene:\n%s", after)
+			}
+		})
+	}
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 引用类型
+const (
+	refBuffer  = "buffer"
+	refImage   = "image"
+	refMTLLib  = "mtllib"
+	refTexture = "texture"
+)
+
+// resourceExts 是只会被其它文件引用的资源类型，没有任何文件引用时视为孤立文件
+var resourceExts = map[string]bool{
+	".bin": true, ".mtl": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".webp": true, ".gif": true, ".bmp": true,
+	".tga": true, ".dds": true, ".ktx": true, ".ktx2": true, ".basis": true,
+}
+
+// AssetRef 是一个文件对另一个文件的引用
+type AssetRef struct {
+	From    string `json:"from"`
+	URI     string `json:"uri"`
+	Kind    string `json:"kind"`
+	Path    string `json:"path,omitempty"` // 解析后的路径（相对数据根目录）
+	Missing bool   `json:"missing,omitempty"`
+	Error   string `json:"error,omitempty"` // URI 无法解析（越出数据根目录、绝对路径等）
+}
+
+// dangling 判断引用是否失效
+func (r AssetRef) dangling() bool {
+	return r.Missing || r.Error != ""
+}
+
+// rawRef 是从文件里读到的未解析引用
+type rawRef struct {
+	URI     string
+	Kind    string
+	Escaped bool // glTF 和 three.js 的 URI 需要先做百分号解码
+	Site    bool // three.js 在浏览器里加载，允许以 /data/ 开头的站点路径
+}
+
+// DepGraph 是数据目录下所有文件之间的引用关系
+type DepGraph struct {
+	Files      []string              // 扫描到的全部文件
+	Refs       map[string][]AssetRef // 按引用方分组
+	Dependents map[string][]AssetRef // 按被引用的路径分组
+	Errors     map[string]string     // 无法解析的文件
+}
+
+// DepCheckReport 是 tServer check 的结果
+type DepCheckReport struct {
+	Files    int               `json:"files"`
+	Dangling []AssetRef        `json:"dangling"`
+	Orphans  []string          `json:"orphans"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// assetRefCache 缓存每个文件解析出的引用，文件大小和修改时间不变时直接复用
+var assetRefCache = struct {
+	sync.Mutex
+	m map[string]assetRefEntry
+}{m: map[string]assetRefEntry{}}
+
+type assetRefEntry struct {
+	size    int64
+	modTime time.Time
+	refs    []rawRef
+	err     error
+}
+
+// depGraphCache 保存最近一次扫描的引用图。目录的修改时间反映文件的增删和改名，
+// 可解析文件的大小和修改时间反映内容变化，这些都没变时直接复用，不再遍历整个数据目录
+var depGraphCache struct {
+	sync.Mutex
+	graph  *DepGraph
+	stamps map[string]fileStamp
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// buildDepGraph 返回数据根目录的引用图，调用方不能修改返回值
+func buildDepGraph() (*DepGraph, error) {
+	depGraphCache.Lock()
+	defer depGraphCache.Unlock()
+	hit := depGraphCache.graph != nil && stampsCurrent(depGraphCache.stamps)
+	cacheLookup("dep_graph", hit)
+	if hit {
+		return depGraphCache.graph, nil
+	}
+	g, stamps, err := scanDepGraph()
+	if err != nil {
+		return nil, err
+	}
+	depGraphCache.graph, depGraphCache.stamps = g, stamps
+	return g, nil
+}
+
+// stampsCurrent 判断记录的目录和文件都没有变化
+func stampsCurrent(stamps map[string]fileStamp) bool {
+	for file, st := range stamps {
+		info, err := os.Stat(file)
+		if err != nil || info.Size() != st.size || !info.ModTime().Equal(st.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanDepGraph 扫描数据根目录并建立引用图；隐藏目录（缓存、临时文件）和点云切片不参与。
+// 同时返回扫描过的目录和可解析文件的时间戳，并清掉已不存在的文件的引用缓存
+func scanDepGraph() (*DepGraph, map[string]fileStamp, error) {
+	stamps := map[string]fileStamp{}
+	g := &DepGraph{
+		Refs:       map[string][]AssetRef{},
+		Dependents: map[string][]AssetRef{},
+		Errors:     map[string]string{},
+	}
+	pcRoot := pointCloudRoot()
+	err := filepath.WalkDir(dataRoot, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// 项目目录不参与全局的依赖关系
+		if file != dataRoot && (strings.HasPrefix(d.Name(), ".") || d.IsDir() && (file == pcRoot || file == projectsRoot())) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || d.Type().IsRegular() && assetKind(file) != "" {
+			if info, err := d.Info(); err == nil {
+				stamps[file] = fileStamp{info.Size(), info.ModTime()}
+			}
+		}
+		if file == dataRoot || !d.Type().IsRegular() {
+			return nil
+		}
+		rel := dataRelPath(file)
+		g.Files = append(g.Files, rel)
+		raw, err := cachedAssetRefs(file, d)
+		if err != nil {
+			g.Errors[rel] = err.Error()
+			return nil
+		}
+		for _, r := range raw {
+			ref := resolveAssetRef(file, r)
+			g.Refs[rel] = append(g.Refs[rel], ref)
+			if ref.Path != "" {
+				g.Dependents[ref.Path] = append(g.Dependents[ref.Path], ref)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	assetRefCache.Lock()
+	for file := range assetRefCache.m {
+		if _, ok := stamps[file]; !ok {
+			delete(assetRefCache.m, file)
+		}
+	}
+	assetRefCache.Unlock()
+	return g, stamps, nil
+}
+
+// cachedAssetRefs 读取文件中的引用，结果按文件大小和修改时间缓存
+func cachedAssetRefs(file string, d fs.DirEntry) ([]rawRef, error) {
+	if assetKind(file) == "" {
+		return nil, nil
+	}
+	st, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	assetRefCache.Lock()
+	e, ok := assetRefCache.m[file]
+	assetRefCache.Unlock()
+	hit := ok && e.size == st.Size() && e.modTime.Equal(st.ModTime())
+	cacheLookup("asset_refs", hit)
+	if hit {
+		return e.refs, e.err
+	}
+	refs, err := readAssetRefs(file)
+	assetRefCache.Lock()
+	assetRefCache.m[file] = assetRefEntry{size: st.Size(), modTime: st.ModTime(), refs: refs, err: err}
+	assetRefCache.Unlock()
+	return refs, err
+}
+
+// assetKind 根据扩展名判断文件是否可能引用其它文件
+func assetKind(file string) string {
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".gltf", ".glb":
+		return "gltf"
+	case ".obj", ".mtl":
+		return ext[1:]
+	case ".json":
+		return "json"
+	}
+	return ""
+}
+
+// readAssetRefs 按文件类型提取外部引用，data URI 和远程 URL 不算引用
+func readAssetRefs(file string) ([]rawRef, error) {
+	var refs []rawRef
+	var err error
+	switch assetKind(file) {
+	case "gltf":
+		refs, err = gltfRefs(file)
+	case "obj":
+		refs, err = objRefs(file)
+	case "mtl":
+		refs, err = mtlRefs(file)
+	case "json":
+		refs, err = threeJSONRefs(file)
+	}
+	out := refs[:0]
+	for _, r := range refs {
+		if r.URI == "" || strings.HasPrefix(r.URI, "data:") || isRemoteURI(r.URI) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, err
+}
+
+// gltfRefs 返回 glTF/GLB 引用的外部缓冲和图片
+func gltfRefs(file string) ([]rawRef, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	doc, _, _, err := decodeGLTF(data)
+	if err != nil {
+		return nil, err
+	}
+	var refs []rawRef
+	for _, b := range doc.Buffers {
+		refs = append(refs, rawRef{URI: b.URI, Kind: refBuffer, Escaped: true})
+	}
+	for _, img := range doc.Images {
+		refs = append(refs, rawRef{URI: img.URI, Kind: refImage, Escaped: true})
+	}
+	return refs, nil
+}
+
+// objRefs 返回 OBJ 的 mtllib 引用
+func objRefs(file string) ([]rawRef, error) {
+	var refs []rawRef
+	err := scanStatements(file, func(fields []string) {
+		if fields[0] == "mtllib" {
+			for _, lib := range splitMTLLib(fields[1:]) {
+				refs = append(refs, rawRef{URI: strings.ReplaceAll(lib, "\\", "/"), Kind: refMTLLib})
+			}
+		}
+	})
+	return refs, err
+}
+
+// mtlRefs 返回 MTL 中全部贴图语句引用的文件（包括转换时忽略的贴图）
+func mtlRefs(file string) ([]rawRef, error) {
+	var refs []rawRef
+	err := scanStatements(file, func(fields []string) {
+		switch strings.ToLower(fields[0]) {
+		case "map_kd", "map_ka", "map_ks", "map_ke", "map_ns", "map_d", "map_bump", "bump",
+			"norm", "map_kn", "disp", "decal", "refl", "map_pr", "map_pm", "map_ps", "map_rma", "map_orm":
+			if name := mtlMapFile(fields[1:]); name != "" {
+				refs = append(refs, rawRef{URI: name, Kind: refTexture})
+			}
+		}
+	})
+	return refs, err
+}
+
+// scanStatements 逐行读取 OBJ/MTL 风格的文本，去掉注释后按空白切分
+func scanStatements(file string, fn func(fields []string)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if fields := strings.Fields(line); len(fields) > 0 {
+			fn(fields)
+		}
+	}
+	return sc.Err()
+}
+
+// threeJSON 是 three.js JSON（Object/Scene 格式 4）中与外部资源有关的部分
+type threeJSON struct {
+	Metadata struct {
+		Type    string  `json:"type"`
+		Version float64 `json:"version"`
+	} `json:"metadata"`
+	Images []struct {
+		URL json.RawMessage `json:"url"`
+	} `json:"images"`
+}
+
+// threeJSONRefs 返回 three.js 场景引用的图片；不是 three.js 格式的 JSON 没有引用
+func threeJSONRefs(file string) ([]rawRef, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc threeJSON
+	if json.Unmarshal(data, &doc) != nil || doc.Metadata.Type == "" || doc.Metadata.Version < 4 {
+		return nil, nil
+	}
+	var refs []rawRef
+	for _, img := range doc.Images {
+		// url 可以是字符串、立方体贴图的数组，或者内嵌像素数据的对象
+		var one string
+		var many []json.RawMessage
+		switch {
+		case json.Unmarshal(img.URL, &one) == nil:
+			refs = append(refs, rawRef{URI: one, Kind: refImage, Escaped: true, Site: true})
+		case json.Unmarshal(img.URL, &many) == nil:
+			for _, m := range many {
+				if json.Unmarshal(m, &one) == nil {
+					refs = append(refs, rawRef{URI: one, Kind: refImage, Escaped: true, Site: true})
+				}
+			}
+		}
+	}
+	return refs, nil
+}
+
+// resolveAssetRef 把引用解析为数据根目录下的路径并检查目标是否存在；
+// three.js 场景中以 /data/ 开头的绝对路径按静态资源路由解析
+func resolveAssetRef(from string, r rawRef) AssetRef {
+	ref := AssetRef{From: dataRelPath(from), URI: r.URI, Kind: r.Kind}
+	p := r.URI
+	if r.Escaped {
+		var err error
+		if p, err = url.PathUnescape(p); err != nil {
+			ref.Error = err.Error()
+			return ref
+		}
+	}
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	var file string
+	var err error
+	switch {
+	case r.Site && strings.HasPrefix(p, "/data/"):
+		file, err = resolveDataPath(strings.TrimPrefix(p, "/data/"))
+	case path.IsAbs(p) || filepath.IsAbs(p):
+		err = fmt.Errorf("absolute uri %q not allowed", r.URI)
+	default:
+		file, err = resolveRelative(filepath.Dir(from), p)
+	}
+	if err != nil {
+		ref.Error = err.Error()
+		return ref
+	}
+	ref.Path = dataRelPath(file)
+	if st, err := os.Stat(file); err != nil || st.IsDir() {
+		ref.Missing = true
+	}
+	return ref
+}
+
+// walkRefs 从 start 出发沿 edges 收集引用；recursive 为 false 时只取一层
+func walkRefs(start string, edges map[string][]AssetRef, next func(AssetRef) string, recursive bool) []AssetRef {
+	out := []AssetRef{}
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, r := range edges[cur] {
+			out = append(out, r)
+			n := next(r)
+			if recursive && n != "" && !seen[n] {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	return out
+}
+
+// Check 找出失效的引用和没有被引用的资源文件
+func (g *DepGraph) Check() *DepCheckReport {
+	rep := &DepCheckReport{Files: len(g.Files), Dangling: []AssetRef{}, Orphans: []string{}}
+	for _, file := range g.Files {
+		for _, r := range g.Refs[file] {
+			if r.dangling() {
+				rep.Dangling = append(rep.Dangling, r)
+			}
+		}
+		if resourceExts[strings.ToLower(path.Ext(file))] && len(g.Dependents[file]) == 0 {
+			rep.Orphans = append(rep.Orphans, file)
+		}
+	}
+	if len(g.Errors) > 0 {
+		rep.Errors = g.Errors
+	}
+	sort.SliceStable(rep.Dangling, func(i, j int) bool { return rep.Dangling[i].From < rep.Dangling[j].From })
+	sort.Strings(rep.Orphans)
+	return rep
+}
+
+// assetAction 按路径后缀分发资源依赖接口
+func assetAction(c *gin.Context) {
+	p := c.Param("path")
+	switch {
+	case strings.HasSuffix(p, "/dependencies"):
+		dependenciesHandler(c, strings.TrimSuffix(p, "/dependencies"))
+	case strings.HasSuffix(p, "/dependents"):
+		dependentsHandler(c, strings.TrimSuffix(p, "/dependents"))
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown asset action"})
+	}
+}
+
+// dependenciesHandler 处理 GET /api/assets/*path/dependencies?recursive=true
+func dependenciesHandler(c *gin.Context, rel string) {
+	file, err := resolveDataPath(rel)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if st, err := os.Stat(file); err != nil || st.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	g, err := buildDepGraph()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rel = dataRelPath(file)
+	if !checkSigned(c, rel) {
+		return
+	}
+	if msg, ok := g.Errors[rel]; ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": msg})
+		return
+	}
+	refs := signedRefs(c, walkRefs(rel, g.Refs, func(r AssetRef) string { return r.Path }, c.Query("recursive") == "true"))
+	c.JSON(http.StatusOK, gin.H{"path": rel, "dependencies": refs})
+}
+
+// dependentsHandler 处理 GET /api/assets/*path/dependents?recursive=true
+// 被引用的文件可以不存在，便于在删除文件后找出受影响的场景
+func dependentsHandler(c *gin.Context, rel string) {
+	file, err := resolveDataPath(rel)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	g, err := buildDepGraph()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rel = dataRelPath(file)
+	if !checkSigned(c, rel) {
+		return
+	}
+	refs := signedRefs(c, walkRefs(rel, g.Dependents, func(r AssetRef) string { return r.From }, c.Query("recursive") == "true"))
+	c.JSON(http.StatusOK, gin.H{"path": rel, "dependents": refs})
+}
+
+// signedRefs 去掉来自未签名的受保护文件的引用：这些引用是读取该文件的内容得到的
+func signedRefs(c *gin.Context, refs []AssetRef) []AssetRef {
+	out := refs[:0]
+	for _, r := range refs {
+		if signedFor(c, r.From) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// checkSignedRefs 检查 rel 递归引用的受保护文件的签名，失败时写出 403 并返回 false
+func checkSignedRefs(c *gin.Context, rel string) bool {
+	if !signer.enabled() {
+		return true
+	}
+	g, err := buildDepGraph()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	for _, r := range walkRefs(rel, g.Refs, func(r AssetRef) string { return r.Path }, true) {
+		if r.Path != "" && !checkSigned(c, r.Path) {
+			return false
+		}
+	}
+	return true
+}
+
+// runCheck 实现 tServer check 子命令：列出失效引用和孤立文件，存在失效引用时返回 1
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	data := fs.String("data", "../data/", "静态资源根目录")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出")
+	strict := fs.Bool("strict", false, "存在孤立文件时也返回非零状态")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法：tServer check [参数]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := setDataRoot(*data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if st, err := os.Stat(dataRoot); err != nil || !st.IsDir() {
+		fmt.Fprintln(os.Stderr, "data root is not a directory")
+		return 1
+	}
+	g, err := buildDepGraph()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	rep := g.Check()
+	if *asJSON {
+		js, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(js))
+	} else {
+		for _, r := range rep.Dangling {
+			reason := "not found"
+			if r.Error != "" {
+				reason = r.Error
+			}
+			fmt.Printf("dangling: %s -> %s (%s): %s\n", r.From, r.URI, r.Kind, reason)
+		}
+		for _, f := range rep.Orphans {
+			fmt.Printf("orphan: %s\n", f)
+		}
+		files := make([]string, 0, len(rep.Errors))
+		for f := range rep.Errors {
+			files = append(files, f)
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			fmt.Printf("error: %s: %s\n", f, rep.Errors[f])
+		}
+		fmt.Printf("%d files, %d dangling references, %d orphans\n", rep.Files, len(rep.Dangling), len(rep.Orphans))
+	}
+	if len(rep.Dangling) > 0 || *strict && len(rep.Orphans) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeDataFiles 在数据根目录下写入一组文件
+func writeDataFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDepGraph(t *testing.T) {
+	root := setTestDataRoot(t)
+	writeDataFiles(t, root, map[string]string{
+		"models/car.obj":          "mtllib car.mtl missing.mtl\nv 0 0 0\n",
+		"models/car.mtl":          "newmtl paint\nmap_Kd -s 1 1 1 ../tex/paint.png\nmap_bump ../../../etc/passwd\n",
+		"tex/paint.png":           "png",
+		"tex/unused.png":          "png",
+		"scene.gltf":              `{"asset":{"version":"2.0"},"buffers":[{"uri":"scene%20data.bin","byteLength":4},{"uri":"data:application/octet-stream;base64,AAAAAA==","byteLength":4}],"images":[{"uri":"/data/tex/paint.png"},{"uri":"https://example.com/a.png"}]}`,
+		"scene data.bin":          "1234",
+		"three.json":              `{"metadata":{"type":"Object","version":4.5},"images":[{"url":["/data/tex/paint.png","tex/gone.png"]}]}`,
+		"broken.gltf":             `{"asset":`,
+		".cache/thumbnails/x.png": "png",
+	})
+	g, err := buildDepGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := g.Check()
+	var dangling []string
+	for _, r := range rep.Dangling {
+		dangling = append(dangling, r.From+" -> "+r.URI)
+	}
+	want := []string{
+		"models/car.mtl -> ../../../etc/passwd",
+		"models/car.obj -> missing.mtl",
+		"scene.gltf -> /data/tex/paint.png", // 只有 three.js 场景允许 /data/ 站点路径
+		"three.json -> tex/gone.png",
+	}
+	if !reflect.DeepEqual(dangling, want) {
+		t.Errorf("dangling = %q, want %q", dangling, want)
+	}
+	if !reflect.DeepEqual(rep.Orphans, []string{"tex/unused.png"}) {
+		t.Errorf("orphans = %q", rep.Orphans)
+	}
+	if _, ok := rep.Errors["broken.gltf"]; !ok || len(rep.Errors) != 1 {
+		t.Errorf("errors = %v, want only broken.gltf", rep.Errors)
+	}
+	if rep.Files != 8 {
+		t.Errorf("files = %d, want 8 (hidden directories are skipped)", rep.Files)
+	}
+
+	// tex/paint.png 被 MTL 和 three.js（/data/ 站点路径）引用
+	from := map[string]bool{}
+	for _, r := range g.Dependents["tex/paint.png"] {
+		from[r.From] = true
+	}
+	if len(from) != 2 || !from["models/car.mtl"] || !from["three.json"] {
+		t.Errorf("dependents of tex/paint.png = %v", from)
+	}
+	next := func(r AssetRef) string { return r.Path }
+	if got := walkRefs("models/car.obj", g.Refs, next, false); len(got) != 2 {
+		t.Errorf("direct dependencies = %d, want 2", len(got))
+	}
+	if got := walkRefs("models/car.obj", g.Refs, next, true); len(got) != 4 {
+		t.Errorf("recursive dependencies = %d, want 4", len(got))
+	}
+}
+
+func TestDepGraphCache(t *testing.T) {
+	root := setTestDataRoot(t)
+	writeDataFiles(t, root, map[string]string{
+		"models/car.obj": "mtllib car.mtl\nv 0 0 0\n",
+		"models/car.mtl": "newmtl paint\n",
+	})
+	first, err := buildDepGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		change  func()
+		rebuilt bool
+	}{
+		{"unchanged", func() {}, false},
+		{"new file", func() { writeDataFiles(t, root, map[string]string{"tex/a.png": "png"}) }, true},
+		{"edited file", func() { writeDataFiles(t, root, map[string]string{"models/car.obj": "v 0 0 0\n"}) }, true},
+		{"deleted file", func() { os.Remove(filepath.Join(root, "models/car.mtl")) }, true},
+	}
+	prev := first
+	for _, tt := range tests {
+		tt.change()
+		g, err := buildDepGraph()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (g != prev) != tt.rebuilt {
+			t.Errorf("%s: rebuilt = %v, want %v", tt.name, g != prev, tt.rebuilt)
+		}
+		prev = g
+	}
+	if len(prev.Refs["models/car.obj"]) != 0 {
+		t.Errorf("stale refs after edit: %+v", prev.Refs["models/car.obj"])
+	}
+	// 已删除文件的引用缓存被清掉
+	assetRefCache.Lock()
+	_, cached := assetRefCache.m[filepath.Join(root, "models", "car.mtl")]
+	assetRefCache.Unlock()
+	if cached {
+		t.Error("asset ref cache still holds the deleted file")
+	}
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// glTF 2.0 文档结构（只声明服务端用得到的字段，扩展和 extras 原样保留）
+
+type GLTF struct {
+	Asset              GLTFAsset                  `json:"asset"`
+	ExtensionsUsed     []string                   `json:"extensionsUsed,omitempty"`
+	ExtensionsRequired []string                   `json:"extensionsRequired,omitempty"`
+	Scene              *int                       `json:"scene,omitempty"`
+	Scenes             []GLTFScene                `json:"scenes,omitempty"`
+	Nodes              []GLTFNode                 `json:"nodes,omitempty"`
+	Meshes             []GLTFMesh                 `json:"meshes,omitempty"`
+	Accessors          []GLTFAccessor             `json:"accessors,omitempty"`
+	BufferViews        []GLTFBufferView           `json:"bufferViews,omitempty"`
+	Buffers            []GLTFBuffer               `json:"buffers,omitempty"`
+	Materials          []GLTFMaterial             `json:"materials,omitempty"`
+	Textures           []GLTFTexture              `json:"textures,omitempty"`
+	Images             []GLTFImage                `json:"images,omitempty"`
+	Samplers           []GLTFSampler              `json:"samplers,omitempty"`
+	Animations         []GLTFAnimation            `json:"animations,omitempty"`
+	Skins              []GLTFSkin                 `json:"skins,omitempty"`
+	Cameras            []json.RawMessage          `json:"cameras,omitempty"`
+	Extensions         map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras             json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFAsset struct {
+	Version    string          `json:"version"`
+	MinVersion string          `json:"minVersion,omitempty"`
+	Generator  string          `json:"generator,omitempty"`
+	Copyright  string          `json:"copyright,omitempty"`
+	Extras     json.RawMessage `json:"extras,omitempty"`
+}
+
+type GLTFScene struct {
+	Name   string          `json:"name,omitempty"`
+	Nodes  []int           `json:"nodes,omitempty"`
+	Extras json.RawMessage `json:"extras,omitempty"`
+}
+
+type GLTFNode struct {
+	Name        string                     `json:"name,omitempty"`
+	Children    []int                      `json:"children,omitempty"`
+	Mesh        *int                       `json:"mesh,omitempty"`
+	Skin        *int                       `json:"skin,omitempty"`
+	Camera      *int                       `json:"camera,omitempty"`
+	Matrix      []float64                  `json:"matrix,omitempty"`
+	Translation []float64                  `json:"translation,omitempty"`
+	Rotation    []float64                  `json:"rotation,omitempty"`
+	Scale       []float64                  `json:"scale,omitempty"`
+	Weights     []float64                  `json:"weights,omitempty"`
+	Extensions  map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras      json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFMesh struct {
+	Name       string                     `json:"name,omitempty"`
+	Primitives []GLTFPrimitive            `json:"primitives"`
+	Weights    []float64                  `json:"weights,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras     json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFPrimitive struct {
+	Attributes map[string]int             `json:"attributes"`
+	Indices    *int                       `json:"indices,omitempty"`
+	Material   *int                       `json:"material,omitempty"`
+	Mode       *int                       `json:"mode,omitempty"`
+	Targets    []map[string]int           `json:"targets,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras     json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFAccessor struct {
+	Name          string                     `json:"name,omitempty"`
+	BufferView    *int                       `json:"bufferView,omitempty"`
+	ByteOffset    int                        `json:"byteOffset,omitempty"`
+	ComponentType int                        `json:"componentType"`
+	Normalized    bool                       `json:"normalized,omitempty"`
+	Count         int                        `json:"count"`
+	Type          string                     `json:"type"`
+	Max           []float64                  `json:"max,omitempty"`
+	Min           []float64                  `json:"min,omitempty"`
+	Sparse        json.RawMessage            `json:"sparse,omitempty"`
+	Extensions    map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras        json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFBufferView struct {
+	Name       string                     `json:"name,omitempty"`
+	Buffer     int                        `json:"buffer"`
+	ByteOffset int                        `json:"byteOffset,omitempty"`
+	ByteLength int                        `json:"byteLength"`
+	ByteStride int                        `json:"byteStride,omitempty"`
+	Target     int                        `json:"target,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras     json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFBuffer struct {
+	Name       string                     `json:"name,omitempty"`
+	URI        string                     `json:"uri,omitempty"`
+	ByteLength int                        `json:"byteLength"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras     json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFTextureInfo struct {
+	Index      int                        `json:"index"`
+	TexCoord   int                        `json:"texCoord,omitempty"`
+	Scale      *float64                   `json:"scale,omitempty"`
+	Strength   *float64                   `json:"strength,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras     json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFPBR struct {
+	BaseColorFactor          []float64        `json:"baseColorFactor,omitempty"`
+	BaseColorTexture         *GLTFTextureInfo `json:"baseColorTexture,omitempty"`
+	MetallicFactor           *float64         `json:"metallicFactor,omitempty"`
+	RoughnessFactor          *float64         `json:"roughnessFactor,omitempty"`
+	MetallicRoughnessTexture *GLTFTextureInfo `json:"metallicRoughnessTexture,omitempty"`
+	Extras                   json.RawMessage  `json:"extras,omitempty"`
+}
+
+type GLTFMaterial struct {
+	Name                 string                     `json:"name,omitempty"`
+	PBRMetallicRoughness *GLTFPBR                   `json:"pbrMetallicRoughness,omitempty"`
+	NormalTexture        *GLTFTextureInfo           `json:"normalTexture,omitempty"`
+	OcclusionTexture     *GLTFTextureInfo           `json:"occlusionTexture,omitempty"`
+	EmissiveTexture      *GLTFTextureInfo           `json:"emissiveTexture,omitempty"`
+	EmissiveFactor       []float64                  `json:"emissiveFactor,omitempty"`
+	AlphaMode            string                     `json:"alphaMode,omitempty"`
+	AlphaCutoff          *float64                   `json:"alphaCutoff,omitempty"`
+	DoubleSided          bool                       `json:"doubleSided,omitempty"`
+	Extensions           map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras               json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFTexture struct {
+	Name       string                     `json:"name,omitempty"`
+	Sampler    *int                       `json:"sampler,omitempty"`
+	Source     *int                       `json:"source,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras     json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFImage struct {
+	Name       string                     `json:"name,omitempty"`
+	URI        string                     `json:"uri,omitempty"`
+	MimeType   string                     `json:"mimeType,omitempty"`
+	BufferView *int                       `json:"bufferView,omitempty"`
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+	Extras     json.RawMessage            `json:"extras,omitempty"`
+}
+
+type GLTFSampler struct {
+	Name      string          `json:"name,omitempty"`
+	MagFilter int             `json:"magFilter,omitempty"`
+	MinFilter int             `json:"minFilter,omitempty"`
+	WrapS     int             `json:"wrapS,omitempty"`
+	WrapT     int             `json:"wrapT,omitempty"`
+	Extras    json.RawMessage `json:"extras,omitempty"`
+}
+
+type GLTFAnimation struct {
+	Name     string                 `json:"name,omitempty"`
+	Channels []GLTFAnimationChannel `json:"channels"`
+	Samplers []GLTFAnimationSampler `json:"samplers"`
+	Extras   json.RawMessage        `json:"extras,omitempty"`
+}
+
+type GLTFAnimationChannel struct {
+	Sampler int `json:"sampler"`
+	Target  struct {
+		Node *int   `json:"node,omitempty"`
+		Path string `json:"path"`
+	} `json:"target"`
+	Extras json.RawMessage `json:"extras,omitempty"`
+}
+
+type GLTFAnimationSampler struct {
+	Input         int             `json:"input"`
+	Interpolation string          `json:"interpolation,omitempty"`
+	Output        int             `json:"output"`
+	Extras        json.RawMessage `json:"extras,omitempty"`
+}
+
+type GLTFSkin struct {
+	Name                string          `json:"name,omitempty"`
+	InverseBindMatrices *int            `json:"inverseBindMatrices,omitempty"`
+	Skeleton            *int            `json:"skeleton,omitempty"`
+	Joints              []int           `json:"joints"`
+	Extras              json.RawMessage `json:"extras,omitempty"`
+}
+
+// 访问器分量类型
+const (
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+)
+
+// 不可信文件的解码上限：没有 bufferView 的访问器最多这么多个元素，meshopt 解码后最多这么多字节
+const (
+	gltfMaxAccessorCount = 1 << 24
+	gltfMaxDecodedBytes  = 256 << 20
+)
+
+// 缓冲视图 target
+const (
+	gltfArrayBuffer        = 34962
+	gltfElementArrayBuffer = 34963
+)
+
+// 图元绘制模式
+const (
+	gltfPoints        = 0
+	gltfLines         = 1
+	gltfLineLoop      = 2
+	gltfLineStrip     = 3
+	gltfTriangles     = 4
+	gltfTriangleStrip = 5
+	gltfTriangleFan   = 6
+)
+
+// GLB 容器常量
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN\0"
+)
+
+// gltfComponentSize 返回分量类型的字节数，未知类型返回 0
+func gltfComponentSize(componentType int) int {
+	switch componentType {
+	case gltfByte, gltfUnsignedByte:
+		return 1
+	case gltfShort, gltfUnsignedShort:
+		return 2
+	case gltfUnsignedInt, gltfFloat:
+		return 4
+	}
+	return 0
+}
+
+// gltfTypeComponents 返回访问器类型的分量个数，未知类型返回 0
+func gltfTypeComponents(typ string) int {
+	switch typ {
+	case "SCALAR":
+		return 1
+	case "VEC2":
+		return 2
+	case "VEC3":
+		return 3
+	case "VEC4", "MAT2":
+		return 4
+	case "MAT3":
+		return 9
+	case "MAT4":
+		return 16
+	}
+	return 0
+}
+
+// ElementSize 返回一个元素占用的字节数（矩阵列按 4 字节对齐）
+func (a *GLTFAccessor) ElementSize() int {
+	size := gltfComponentSize(a.ComponentType)
+	switch a.Type {
+	case "MAT2":
+		if size == 1 {
+			return 8
+		}
+	case "MAT3":
+		if size == 1 {
+			return 12
+		}
+		if size == 2 {
+			return 24
+		}
+	}
+	return size * gltfTypeComponents(a.Type)
+}
+
+// primitiveMode 返回图元的绘制模式，缺省为三角形
+func (p *GLTFPrimitive) primitiveMode() int {
+	if p.Mode == nil {
+		return gltfTriangles
+	}
+	return *p.Mode
+}
+
+// GLTFFile 是解析后的 glTF 资源：JSON 文档、GLB 二进制块以及已加载的缓冲数据
+type GLTFFile struct {
+	Doc     *GLTF
+	IsGLB   bool
+	BIN     []byte
+	Dir     string   // 文件所在目录，外部 URI 相对于它解析
+	Buffers [][]byte // 与 Doc.Buffers 一一对应，加载失败的为 nil
+
+	// 缓冲加载过程中遇到的问题，由调用方决定如何汇报
+	BufferErrors map[int]error
+
+	decoded map[int][]byte // 已解压的 EXT_meshopt_compression bufferView
+}
+
+// parseGLB 拆分 GLB 容器，返回 JSON 块和可选的 BIN 块
+func parseGLB(data []byte) (jsonChunk, binChunk []byte, err error) {
+	if len(data) < 20 {
+		return nil, nil, errors.New("glb: file too short")
+	}
+	if binary.LittleEndian.Uint32(data[0:4]) != glbMagic {
+		return nil, nil, errors.New("glb: bad magic")
+	}
+	if v := binary.LittleEndian.Uint32(data[4:8]); v != 2 {
+		return nil, nil, fmt.Errorf("glb: unsupported container version %d", v)
+	}
+	total := int(binary.LittleEndian.Uint32(data[8:12]))
+	if total > len(data) {
+		return nil, nil, fmt.Errorf("glb: header length %d exceeds file size %d", total, len(data))
+	}
+	data = data[:total]
+	offset := 12
+	for i := 0; offset < len(data); i++ {
+		if offset+8 > len(data) {
+			return nil, nil, errors.New("glb: truncated chunk header")
+		}
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		typ := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+		if length < 0 || offset+length > len(data) {
+			return nil, nil, errors.New("glb: chunk exceeds file length")
+		}
+		chunk := data[offset : offset+length]
+		offset += length
+		switch {
+		case i == 0 && typ != glbChunkJSON:
+			return nil, nil, errors.New("glb: first chunk is not JSON")
+		case i == 0:
+			jsonChunk = chunk
+		case i == 1 && typ == glbChunkBIN:
+			binChunk = chunk
+		}
+		// 未知块类型按规范忽略
+	}
+	if jsonChunk == nil {
+		return nil, nil, errors.New("glb: missing JSON chunk")
+	}
+	return jsonChunk, binChunk, nil
+}
+
+// isGLB 根据文件头判断是否为 GLB 容器
+func isGLB(data []byte) bool {
+	return len(data) >= 4 && binary.LittleEndian.Uint32(data[0:4]) == glbMagic
+}
+
+// decodeGLTF 解析 glTF JSON 或 GLB 数据，不加载外部缓冲
+func decodeGLTF(data []byte) (*GLTF, []byte, bool, error) {
+	raw := data
+	var bin []byte
+	glb := isGLB(data)
+	if glb {
+		var err error
+		raw, bin, err = parseGLB(data)
+		if err != nil {
+			return nil, nil, true, err
+		}
+	}
+	doc := new(GLTF)
+	if err := json.Unmarshal(bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf")), doc); err != nil {
+		return nil, nil, glb, fmt.Errorf("gltf: invalid JSON: %w", err)
+	}
+	return doc, bin, glb, nil
+}
+
+// loadGLTF 读取 glTF/GLB 文件并加载全部缓冲（data URI、外部文件或 GLB 的 BIN 块）
+func loadGLTF(file string) (*GLTFFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	doc, bin, glb, err := decodeGLTF(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &GLTFFile{Doc: doc, IsGLB: glb, BIN: bin, Dir: filepath.Dir(file)}
+	f.loadBuffers()
+	return f, nil
+}
+
+func (f *GLTFFile) loadBuffers() {
+	f.Buffers = make([][]byte, len(f.Doc.Buffers))
+	f.BufferErrors = map[int]error{}
+	for i, b := range f.Doc.Buffers {
+		var data []byte
+		var err error
+		switch {
+		case b.URI == "" && i == 0 && f.IsGLB:
+			if f.BIN == nil {
+				err = errors.New("GLB has no BIN chunk")
+			}
+			data = f.BIN
+		case isMeshoptFallback(b):
+			continue // 只有占位作用，数据全部来自压缩的 bufferView
+		case b.URI == "":
+			err = errors.New("buffer has no uri")
+		default:
+			data, err = f.readURI(b.URI)
+		}
+		if err != nil {
+			f.BufferErrors[i] = err
+			continue
+		}
+		f.Buffers[i] = data
+	}
+}
+
+// readURI 读取 data URI 或相对于 glTF 文件目录的外部资源
+func (f *GLTFFile) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		return decodeDataURI(uri)
+	}
+	file, err := f.resolveURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(file)
+}
+
+// resolveURI 把相对 URI 解析为本地路径，拒绝绝对 URL 和越出数据根目录的路径
+func (f *GLTFFile) resolveURI(uri string) (string, error) {
+	if isRemoteURI(uri) {
+		return "", fmt.Errorf("remote uri %q not supported", uri)
+	}
+	p, err := url.PathUnescape(uri)
+	if err != nil {
+		return "", err
+	}
+	if path.IsAbs(p) {
+		return "", fmt.Errorf("absolute uri %q not allowed", uri)
+	}
+	return resolveRelative(f.Dir, p)
+}
+
+// ImageData 返回图片的原始字节（bufferView 或 URI）
+func (f *GLTFFile) ImageData(i int) ([]byte, error) {
+	if i < 0 || i >= len(f.Doc.Images) {
+		return nil, fmt.Errorf("image %d out of range", i)
+	}
+	img := f.Doc.Images[i]
+	if img.BufferView != nil {
+		return f.BufferViewData(*img.BufferView)
+	}
+	if img.URI == "" {
+		return nil, fmt.Errorf("image %d has neither uri nor bufferView", i)
+	}
+	return f.readURI(img.URI)
+}
+
+// BufferViewData 返回缓冲视图对应的字节切片
+func (f *GLTFFile) BufferViewData(i int) ([]byte, error) {
+	if i < 0 || i >= len(f.Doc.BufferViews) {
+		return nil, fmt.Errorf("bufferView %d out of range", i)
+	}
+	bv := f.Doc.BufferViews[i]
+	if raw, ok := bv.Extensions[extMeshopt]; ok {
+		return f.decodeMeshoptView(i, raw)
+	}
+	if bv.Buffer < 0 || bv.Buffer >= len(f.Buffers) || f.Buffers[bv.Buffer] == nil {
+		return nil, fmt.Errorf("bufferView %d: buffer %d unavailable", i, bv.Buffer)
+	}
+	buf := f.Buffers[bv.Buffer]
+	if !sliceInBounds(bv.ByteOffset, bv.ByteLength, len(buf)) {
+		return nil, fmt.Errorf("bufferView %d exceeds buffer %d", i, bv.Buffer)
+	}
+	return buf[bv.ByteOffset : bv.ByteOffset+bv.ByteLength], nil
+}
+
+// ReadAccessor 把访问器数据解码为 float64（按 normalized 归一化），每个元素占 Components 个值
+func (f *GLTFFile) ReadAccessor(i int) ([]float64, error) {
+	if i < 0 || i >= len(f.Doc.Accessors) {
+		return nil, fmt.Errorf("accessor %d out of range", i)
+	}
+	a := &f.Doc.Accessors[i]
+	n := gltfTypeComponents(a.Type)
+	csize := gltfComponentSize(a.ComponentType)
+	if n == 0 || csize == 0 {
+		return nil, fmt.Errorf("accessor %d: invalid type %s/%d", i, a.Type, a.ComponentType)
+	}
+	if a.Count < 0 || a.ByteOffset < 0 {
+		return nil, fmt.Errorf("accessor %d: negative count or byteOffset", i)
+	}
+	if a.BufferView == nil {
+		// 没有 bufferView 的访问器全部为 0（可能由 sparse 覆盖，此处不支持）
+		if a.Count > gltfMaxAccessorCount {
+			return nil, fmt.Errorf("accessor %d: count %d exceeds %d", i, a.Count, gltfMaxAccessorCount)
+		}
+		return make([]float64, a.Count*n), nil
+	}
+	data, err := f.BufferViewData(*a.BufferView)
+	if err != nil {
+		return nil, err
+	}
+	stride := f.Doc.BufferViews[*a.BufferView].ByteStride
+	elem := a.ElementSize()
+	if stride == 0 {
+		stride = elem
+	}
+	if stride < elem || stride > 252 {
+		return nil, fmt.Errorf("accessor %d: invalid byteStride %d", i, stride)
+	}
+	// 先按 bufferView 的长度检查 count，避免相乘溢出或按伪造的 count 分配内存
+	if a.Count > 0 && (a.ByteOffset > len(data)-elem || a.Count-1 > (len(data)-elem-a.ByteOffset)/stride) {
+		return nil, fmt.Errorf("accessor %d exceeds bufferView %d", i, *a.BufferView)
+	}
+	out := make([]float64, a.Count*n)
+	// 矩阵类型的列需要 4 字节对齐
+	cols, rows := 1, n
+	switch a.Type {
+	case "MAT2":
+		cols, rows = 2, 2
+	case "MAT3":
+		cols, rows = 3, 3
+	case "MAT4":
+		cols, rows = 4, 4
+	}
+	colStride := (rows*csize + 3) &^ 3
+	if cols == 1 {
+		colStride = rows * csize
+	}
+	for e := 0; e < a.Count; e++ {
+		base := a.ByteOffset + e*stride
+		for c := 0; c < cols; c++ {
+			for r := 0; r < rows; r++ {
+				v := readComponent(data[base+c*colStride+r*csize:], a.ComponentType, a.Normalized)
+				out[e*n+c*rows+r] = v
+			}
+		}
+	}
+	return out, nil
+}
+
+// ReadIndices 读取图元索引；没有索引时按顶点顺序生成
+func (f *GLTFFile) ReadIndices(p *GLTFPrimitive) ([]uint32, error) {
+	if p.Indices == nil {
+		pos, ok := p.Attributes["POSITION"]
+		if !ok || pos < 0 || pos >= len(f.Doc.Accessors) {
+			return nil, errors.New("primitive has no POSITION")
+		}
+		n := f.Doc.Accessors[pos].Count
+		if n < 0 || n > gltfMaxAccessorCount {
+			return nil, fmt.Errorf("POSITION count %d out of range", n)
+		}
+		idx := make([]uint32, n)
+		for i := range idx {
+			idx[i] = uint32(i)
+		}
+		return idx, nil
+	}
+	a := *p.Indices
+	if a < 0 || a >= len(f.Doc.Accessors) {
+		return nil, fmt.Errorf("indices accessor %d out of range", a)
+	}
+	vals, err := f.ReadAccessor(a)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]uint32, len(vals))
+	for i, v := range vals {
+		idx[i] = uint32(v)
+	}
+	return idx, nil
+}
+
+// sliceInBounds 判断 [offset, offset+length) 落在长度为 size 的数据内，不会整数溢出
+func sliceInBounds(offset, length, size int) bool {
+	return offset >= 0 && length >= 0 && offset <= size && length <= size-offset
+}
+
+func readComponent(b []byte, componentType int, normalized bool) float64 {
+	switch componentType {
+	case gltfByte:
+		v := float64(int8(b[0]))
+		if normalized {
+			return maxf(v/127, -1)
+		}
+		return v
+	case gltfUnsignedByte:
+		v := float64(b[0])
+		if normalized {
+			return v / 255
+		}
+		return v
+	case gltfShort:
+		v := float64(int16(binary.LittleEndian.Uint16(b)))
+		if normalized {
+			return maxf(v/32767, -1)
+		}
+		return v
+	case gltfUnsignedShort:
+		v := float64(binary.LittleEndian.Uint16(b))
+		if normalized {
+			return v / 65535
+		}
+		return v
+	case gltfUnsignedInt:
+		return float64(binary.LittleEndian.Uint32(b))
+	case gltfFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	return 0
+}
+
+func maxf(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// decodeDataURI 解码 base64 形式的 data URI
+func decodeDataURI(uri string) ([]byte, error) {
+	comma := strings.IndexByte(uri, ',')
+	if comma < 0 {
+		return nil, errors.New("malformed data uri")
+	}
+	meta, payload := uri[5:comma], uri[comma+1:]
+	if strings.HasSuffix(meta, ";base64") {
+		return base64.StdEncoding.DecodeString(payload)
+	}
+	s, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// dataURIMime 返回 data URI 声明的 MIME 类型
+func dataURIMime(uri string) string {
+	if !strings.HasPrefix(uri, "data:") {
+		return ""
+	}
+	meta := uri[5:]
+	if i := strings.IndexAny(meta, ";,"); i >= 0 {
+		meta = meta[:i]
+	}
+	return meta
+}
+
+// isRemoteURI 判断 URI 是否带有协议（http:、https: 等），data: 除外
+func isRemoteURI(uri string) bool {
+	i := strings.Index(uri, ":")
+	if i <= 0 || strings.HasPrefix(uri, "data:") {
+		return false
+	}
+	for _, r := range uri[:i] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	// Windows 盘符不是协议
+	return i > 1
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func intPtr(i int) *int { return &i }
+
+// testGLTF 构造一个只有一块 24 字节缓冲（两个 VEC3 float）和一个 bufferView 的文件
+func testGLTF(acc GLTFAccessor, stride int) *GLTFFile {
+	buf := make([]byte, 24)
+	for i := 0; i < 6; i++ {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(i)))
+	}
+	return &GLTFFile{
+		Doc: &GLTF{
+			Accessors:   []GLTFAccessor{acc},
+			BufferViews: []GLTFBufferView{{Buffer: 0, ByteLength: 24, ByteStride: stride}},
+			Buffers:     []GLTFBuffer{{ByteLength: 24}},
+		},
+		Buffers: [][]byte{buf},
+	}
+}
+
+func TestReadAccessor(t *testing.T) {
+	f := testGLTF(GLTFAccessor{BufferView: intPtr(0), ComponentType: 5126, Count: 2, Type: "VEC3"}, 0)
+	got, err := f.ReadAccessor(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range got {
+		if v != float64(i) {
+			t.Fatalf("value %d = %v, want %d", i, v, i)
+		}
+	}
+}
+
+func TestReadAccessorMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		acc    GLTFAccessor
+		stride int
+	}{
+		{"negative count", GLTFAccessor{BufferView: intPtr(0), ComponentType: 5126, Count: -1, Type: "VEC3"}, 0},
+		{"count beyond view", GLTFAccessor{BufferView: intPtr(0), ComponentType: 5126, Count: 3, Type: "VEC3"}, 0},
+		{"huge count", GLTFAccessor{BufferView: intPtr(0), ComponentType: 5126, Count: math.MaxInt64 / 4, Type: "VEC3"}, 0},
+		{"huge count without view", GLTFAccessor{ComponentType: 5126, Count: math.MaxInt32, Type: "VEC3"}, 0},
+		{"negative byteOffset", GLTFAccessor{BufferView: intPtr(0), ByteOffset: -8, ComponentType: 5126, Count: 1, Type: "VEC3"}, 0},
+		{"byteOffset past view", GLTFAccessor{BufferView: intPtr(0), ByteOffset: 20, ComponentType: 5126, Count: 1, Type: "VEC3"}, 0},
+		{"overflowing byteOffset", GLTFAccessor{BufferView: intPtr(0), ByteOffset: math.MaxInt64 - 4, ComponentType: 5126, Count: 1, Type: "VEC3"}, 0},
+		{"stride below element", GLTFAccessor{BufferView: intPtr(0), ComponentType: 5126, Count: 1, Type: "VEC3"}, 4},
+		{"stride too large", GLTFAccessor{BufferView: intPtr(0), ComponentType: 5126, Count: 1, Type: "VEC3"}, 256},
+		{"unknown type", GLTFAccessor{BufferView: intPtr(0), ComponentType: 5126, Count: 1, Type: "VEC5"}, 0},
+		{"unknown component type", GLTFAccessor{BufferView: intPtr(0), ComponentType: 1, Count: 1, Type: "VEC3"}, 0},
+		{"missing bufferView", GLTFAccessor{BufferView: intPtr(3), ComponentType: 5126, Count: 1, Type: "VEC3"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testGLTF(tt.acc, tt.stride).ReadAccessor(0); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestBufferViewDataMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		bv   GLTFBufferView
+	}{
+		{"negative offset", GLTFBufferView{Buffer: 0, ByteOffset: -1, ByteLength: 4}},
+		{"negative length", GLTFBufferView{Buffer: 0, ByteLength: -4}},
+		{"past end", GLTFBufferView{Buffer: 0, ByteOffset: 20, ByteLength: 8}},
+		{"overflowing offset", GLTFBufferView{Buffer: 0, ByteOffset: math.MaxInt64, ByteLength: 8}},
+		{"unknown buffer", GLTFBufferView{Buffer: 2, ByteLength: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testGLTF(GLTFAccessor{}, 0)
+			f.Doc.BufferViews[0] = tt.bv
+			if _, err := f.BufferViewData(0); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadIndicesMalformed(t *testing.T) {
+	f := testGLTF(GLTFAccessor{BufferView: intPtr(0), ComponentType: 5126, Count: -5, Type: "VEC3"}, 0)
+	if _, err := f.ReadIndices(&GLTFPrimitive{Attributes: map[string]int{"POSITION": 0}}); err == nil {
+		t.Fatal("expected an error for a negative POSITION count")
+	}
+	if _, err := f.ReadIndices(&GLTFPrimitive{Attributes: map[string]int{"POSITION": 7}}); err == nil {
+		t.Fatal("expected an error for a missing POSITION accessor")
+	}
+}
+
+func TestDecodeGLTFMalformed(t *testing.T) {
+	glb := make([]byte, 12)
+	binary.LittleEndian.PutUint32(glb, glbMagic)
+	binary.LittleEndian.PutUint32(glb[4:], 2)
+	binary.LittleEndian.PutUint32(glb[8:], 1<<30)
+	for name, data := range map[string][]byte{
+		"truncated json":   []byte(`{"asset":{"version":"2.0"`),
+		"not json":         []byte("solid cube"),
+		"glb bad length":   glb,
+		"glb header only":  glb[:8],
+		"wrong field type": []byte(`{"accessors":[{"count":"many"}]}`),
+	} {
+		if _, _, _, err := decodeGLTF(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
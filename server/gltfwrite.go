@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+)
+
+// gltfBuilder 逐步构造 glTF 文档，所有二进制数据写入同一个 GLB BIN 缓冲
+type gltfBuilder struct {
+	doc *GLTF
+	bin []byte
+}
+
+func newGLTFBuilder(generator string) *gltfBuilder {
+	return &gltfBuilder{doc: &GLTF{Asset: GLTFAsset{Version: "2.0", Generator: generator}}}
+}
+
+// addBufferView 追加一段数据（按 4 字节对齐）并返回 bufferView 索引
+func (b *gltfBuilder) addBufferView(data []byte, stride, target int) int {
+	for len(b.bin)%4 != 0 {
+		b.bin = append(b.bin, 0)
+	}
+	b.doc.BufferViews = append(b.doc.BufferViews, GLTFBufferView{
+		Buffer:     0,
+		ByteOffset: len(b.bin),
+		ByteLength: len(data),
+		ByteStride: stride,
+		Target:     target,
+	})
+	b.bin = append(b.bin, data...)
+	return len(b.doc.BufferViews) - 1
+}
+
+// addFloatAccessor 写入 float 顶点数据；withBounds 为 true 时记录 min/max（POSITION 必须）
+func (b *gltfBuilder) addFloatAccessor(vals []float32, typ string, withBounds bool) int {
+	n := gltfTypeComponents(typ)
+	data := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	acc := GLTFAccessor{
+		ComponentType: gltfFloat,
+		Count:         len(vals) / n,
+		Type:          typ,
+	}
+	if withBounds {
+		acc.Min, acc.Max = floatBounds(vals, n)
+	}
+	bv := b.addBufferView(data, 0, gltfArrayBuffer)
+	acc.BufferView = &bv
+	b.doc.Accessors = append(b.doc.Accessors, acc)
+	return len(b.doc.Accessors) - 1
+}
+
+// addRawAccessor 写入已编码的数据，调用方负责保证格式正确
+func (b *gltfBuilder) addRawAccessor(data []byte, acc GLTFAccessor, target int) int {
+	bv := b.addBufferView(data, 0, target)
+	acc.BufferView = &bv
+	b.doc.Accessors = append(b.doc.Accessors, acc)
+	return len(b.doc.Accessors) - 1
+}
+
+// addIndexAccessor 写入索引，按最大值选择 uint16 或 uint32
+func (b *gltfBuilder) addIndexAccessor(idx []uint32) int {
+	var max uint32
+	for _, i := range idx {
+		if i > max {
+			max = i
+		}
+	}
+	acc := GLTFAccessor{Count: len(idx), Type: "SCALAR"}
+	var data []byte
+	if max < 65535 {
+		acc.ComponentType = gltfUnsignedShort
+		data = make([]byte, 2*len(idx))
+		for i, v := range idx {
+			binary.LittleEndian.PutUint16(data[2*i:], uint16(v))
+		}
+	} else {
+		acc.ComponentType = gltfUnsignedInt
+		data = make([]byte, 4*len(idx))
+		for i, v := range idx {
+			binary.LittleEndian.PutUint32(data[4*i:], v)
+		}
+	}
+	return b.addRawAccessor(data, acc, gltfElementArrayBuffer)
+}
+
+// addImage 把图片嵌入 BIN 缓冲
+func (b *gltfBuilder) addImage(data []byte, mime, name string) int {
+	bv := b.addBufferView(data, 0, 0)
+	b.doc.Images = append(b.doc.Images, GLTFImage{Name: name, MimeType: mime, BufferView: &bv})
+	return len(b.doc.Images) - 1
+}
+
+// addImageURI 以外部引用的方式添加图片
+func (b *gltfBuilder) addImageURI(uri, name string) int {
+	b.doc.Images = append(b.doc.Images, GLTFImage{Name: name, URI: uri})
+	return len(b.doc.Images) - 1
+}
+
+// addTexture 为图片创建纹理（使用共享的默认重复采样器）
+func (b *gltfBuilder) addTexture(image int) int {
+	if len(b.doc.Samplers) == 0 {
+		b.doc.Samplers = append(b.doc.Samplers, GLTFSampler{
+			MagFilter: 9729,  // LINEAR
+			MinFilter: 9987,  // LINEAR_MIPMAP_LINEAR
+			WrapS:     10497, // REPEAT
+			WrapT:     10497,
+		})
+	}
+	s, img := 0, image
+	b.doc.Textures = append(b.doc.Textures, GLTFTexture{Sampler: &s, Source: &img})
+	return len(b.doc.Textures) - 1
+}
+
+// useExtension 登记用到的扩展，required 为 true 时同时加入 extensionsRequired
+func (b *gltfBuilder) useExtension(name string, required bool) {
+	b.doc.ExtensionsUsed = appendUnique(b.doc.ExtensionsUsed, name)
+	if required {
+		b.doc.ExtensionsRequired = appendUnique(b.doc.ExtensionsRequired, name)
+	}
+}
+
+// glb 补齐缓冲信息并编码为 GLB
+func (b *gltfBuilder) glb() ([]byte, error) {
+	if len(b.bin) > 0 {
+		if len(b.doc.Buffers) == 0 {
+			b.doc.Buffers = []GLTFBuffer{{}}
+		}
+		b.doc.Buffers[0].ByteLength = len(b.bin)
+	}
+	return encodeGLB(b.doc, b.bin)
+}
+
+// encodeGLB 把文档和 BIN 数据打包为 GLB 容器
+func encodeGLB(doc *GLTF, bin []byte) ([]byte, error) {
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+	binLen := (len(bin) + 3) &^ 3
+	total := 12 + 8 + len(js)
+	if len(bin) > 0 {
+		total += 8 + binLen
+	}
+	out := make([]byte, 0, total)
+	out = appendUint32(out, glbMagic)
+	out = appendUint32(out, 2)
+	out = appendUint32(out, uint32(total))
+	out = appendUint32(out, uint32(len(js)))
+	out = appendUint32(out, glbChunkJSON)
+	out = append(out, js...)
+	if len(bin) > 0 {
+		out = appendUint32(out, uint32(binLen))
+		out = appendUint32(out, glbChunkBIN)
+		out = append(out, bin...)
+		for i := len(bin); i < binLen; i++ {
+			out = append(out, 0)
+		}
+	}
+	return out, nil
+}
+
+// floatBounds 计算每个分量的最小值和最大值
+func floatBounds(vals []float32, n int) (min, max []float64) {
+	min = make([]float64, n)
+	max = make([]float64, n)
+	for c := 0; c < n; c++ {
+		min[c] = math.Inf(1)
+		max[c] = math.Inf(-1)
+	}
+	for i, v := range vals {
+		c := i % n
+		min[c] = math.Min(min[c], float64(v))
+		max[c] = math.Max(max[c], float64(v))
+	}
+	if len(vals) == 0 {
+		for c := 0; c < n; c++ {
+			min[c], max[c] = 0, 0
+		}
+	}
+	return min, max
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, x := range list {
+		if x == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readyCheckTimeout 是单项就绪检查的超时，存储挂死时 /readyz 也要及时返回
+const readyCheckTimeout = 2 * time.Second
+
+// secretFlagPattern 匹配需要在 /debug/config 中隐藏取值的参数名
+var secretFlagPattern = regexp.MustCompile(`(?i)token|secret|key|password`)
+
+// workerBeats 记录后台循环最近一次运行的时间，period 是它们的运行间隔
+var workerBeats = struct {
+	sync.Mutex
+	last   map[string]time.Time
+	period map[string]time.Duration
+}{last: map[string]time.Time{}, period: map[string]time.Duration{}}
+
+// workerBeat 由定期运行的后台循环调用，超过两个周期没有调用时 /readyz 判为不可用
+func workerBeat(name string, period time.Duration) {
+	workerBeats.Lock()
+	workerBeats.last[name] = time.Now()
+	workerBeats.period[name] = period
+	workerBeats.Unlock()
+}
+
+// ReadyCheck 是一项就绪检查的结果
+type ReadyCheck struct {
+	OK       bool    `json:"ok"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"durationMs"`
+}
+
+// readyChecks 是 /readyz 依次执行的检查
+var readyChecks = []struct {
+	name  string
+	check func() error
+}{
+	{"data", func() error { return checkDir(dataRoot, false) }},
+	{"state", func() error { return checkDir(stateRoot, true) }},
+	{"cache", checkCache},
+	{"workers", checkWorkers},
+}
+
+// checkDir 检查目录可以列出并写入；create 为 true 时目录不存在则创建
+func checkDir(dir string, create bool) error {
+	if create {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if _, err := os.ReadDir(dir); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_, err = f.Write([]byte("ok"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// checkCache 检查缩略图缓存目录可写；数据目录不存在时不创建，避免在错误的位置建出目录
+func checkCache() error {
+	if _, err := os.Stat(dataRoot); err != nil {
+		return err
+	}
+	return checkDir(thumbnailCacheDir(), true)
+}
+
+// checkWorkers 检查任务 worker 都在运行，定期保存的循环没有卡住
+func checkWorkers() error {
+	if alive, want := jobs.Alive(); alive < want {
+		return fmt.Errorf("%d of %d job workers running", alive, want)
+	}
+	workerBeats.Lock()
+	defer workerBeats.Unlock()
+	var stale []string
+	for name, t := range workerBeats.last {
+		if time.Since(t) > 2*workerBeats.period[name] {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("background loops not running: %s", strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// readyRuns 记录每项检查正在进行的一次运行。存储挂死时检查无法中断，
+// 之后的探针等待同一次运行的结果，而不是每次再启动一个 goroutine
+var readyRuns = struct {
+	sync.Mutex
+	m map[string]*readyRun
+}{m: map[string]*readyRun{}}
+
+type readyRun struct {
+	done chan struct{}
+	err  error
+}
+
+// startReadyCheck 返回名为 name 的检查正在进行的运行，没有时启动一次
+func startReadyCheck(name string, check func() error) *readyRun {
+	readyRuns.Lock()
+	defer readyRuns.Unlock()
+	if r := readyRuns.m[name]; r != nil {
+		return r
+	}
+	r := &readyRun{done: make(chan struct{})}
+	readyRuns.m[name] = r
+	go func() {
+		r.err = check()
+		readyRuns.Lock()
+		delete(readyRuns.m, name)
+		readyRuns.Unlock()
+		close(r.done)
+	}()
+	return r
+}
+
+// runReadyCheck 执行一项检查，超时按失败处理
+func runReadyCheck(name string, check func() error) ReadyCheck {
+	start := time.Now()
+	run := startReadyCheck(name, check)
+	var err error
+	select {
+	case <-run.done:
+		err = run.err
+	case <-time.After(readyCheckTimeout):
+		err = fmt.Errorf("timed out after %s", readyCheckTimeout)
+	}
+	rc := ReadyCheck{OK: err == nil, Duration: sinceMs(start, time.Now())}
+	if err != nil {
+		rc.Error = err.Error()
+	}
+	return rc
+}
+
+// healthzHandler 处理 GET /healthz：进程能响应请求即为存活
+func healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler 处理 GET /readyz：数据目录可读写、状态目录和缓存可用、后台 worker 在运行时返回 200，否则 503
+func readyzHandler(c *gin.Context) {
+	checks := map[string]ReadyCheck{}
+	ready := true
+	for _, rc := range readyChecks {
+		r := runReadyCheck(rc.name, rc.check)
+		if !r.OK {
+			ready = false
+			requestLog(c, levelWarn, "就绪检查失败", "check", rc.name, "error", r.Error)
+		}
+		checks[rc.name] = r
+	}
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
+
+// bearerAuth 要求 Authorization: Bearer <token>，realm 用于区分不同用途的令牌
+func bearerAuth(realm, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, realm))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "a valid " + realm + " token is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerDebugRoutes 在 g 下注册诊断接口，访问控制由 g 的中间件负责
+func registerDebugRoutes(g *gin.RouterGroup) {
+	g.GET("/pprof/*name", pprofHandler)
+	g.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.GET("/buildinfo", buildInfoHandler)
+	g.GET("/config", configHandler)
+	g.GET("/goroutines", goroutinesHandler)
+	g.GET("/traces", slowTracesHandler)
+}
+
+// pprofHandler 把 /debug/pprof/* 转给 net/http/pprof，例如 /debug/pprof/heap、/debug/pprof/profile?seconds=10
+func pprofHandler(c *gin.Context) {
+	switch c.Param("name") {
+	case "/cmdline":
+		// 不用 pprof.Cmdline，命令行里可能带着令牌
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.String(http.StatusOK, strings.Join(redactedArgs(os.Args), "\x00"))
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		// Index 按 /debug/pprof/ 之后的路径查找 heap、goroutine 等 profile
+		pprof.Index(c.Writer, c.Request)
+	}
+}
+
+// redactedArgs 隐藏命令行中令牌、密钥等参数的取值，支持 -name=value 和 -name value 两种写法
+func redactedArgs(args []string) []string {
+	out := make([]string, len(args))
+	copy(out, args)
+	for i := 1; i < len(out); i++ {
+		name := strings.TrimLeft(out[i], "-")
+		if name == out[i] || !secretFlagPattern.MatchString(strings.SplitN(name, "=", 2)[0]) {
+			continue
+		}
+		if k := strings.IndexByte(out[i], '='); k >= 0 {
+			out[i] = out[i][:k+1] + "[redacted]"
+		} else if i+1 < len(out) {
+			out[i+1] = "[redacted]"
+			i++
+		}
+	}
+	return out
+}
+
+// buildInfoHandler 处理 GET /debug/buildinfo
+func buildInfoHandler(c *gin.Context) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "build info is not available"})
+		return
+	}
+	deps := make([]gin.H, 0, len(bi.Deps))
+	for _, d := range bi.Deps {
+		deps = append(deps, gin.H{"path": d.Path, "version": d.Version, "sum": d.Sum})
+	}
+	settings := map[string]string{}
+	for _, s := range bi.Settings {
+		settings[s.Key] = s.Value
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"goVersion": bi.GoVersion,
+		"path":      bi.Path,
+		"main":      gin.H{"path": bi.Main.Path, "version": bi.Main.Version, "sum": bi.Main.Sum},
+		"deps":      deps,
+		"settings":  settings,
+	})
+}
+
+// configHandler 处理 GET /debug/config：列出生效的命令行参数，令牌、密钥等只显示是否设置
+func configHandler(c *gin.Context) {
+	flags := map[string]gin.H{}
+	flag.VisitAll(func(f *flag.Flag) {
+		value, def := f.Value.String(), f.DefValue
+		if secretFlagPattern.MatchString(f.Name) {
+			if value != "" {
+				value = "[redacted]"
+			}
+			if def != "" {
+				def = "[redacted]"
+			}
+		}
+		flags[f.Name] = gin.H{"value": value, "default": def, "usage": f.Usage}
+	})
+	c.JSON(http.StatusOK, gin.H{"dataRoot": dataRoot, "stateRoot": stateRoot, "flags": flags})
+}
+
+// goroutinesHandler 处理 GET /debug/goroutines：按状态统计 goroutine 数量
+func goroutinesHandler(c *gin.Context) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	states := map[string]int{}
+	for _, line := range strings.Split(string(buf), "\n") {
+		// 每个 goroutine 以 "goroutine 12 [chan receive, 3 minutes]:" 开头
+		if !strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+		i, j := strings.IndexByte(line, '['), strings.IndexByte(line, ']')
+		if i < 0 || j < i {
+			continue
+		}
+		state := line[i+1 : j]
+		if k := strings.IndexByte(state, ','); k >= 0 {
+			state = state[:k]
+		}
+		states[state]++
+	}
+	queued, running := jobs.Depth()
+	alive, workers := jobs.Alive()
+	c.JSON(http.StatusOK, gin.H{
+		"total":   runtime.NumGoroutine(),
+		"byState": states,
+		"jobs":    gin.H{"workers": workers, "alive": alive, "queued": queued, "running": running},
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactedArgs(t *testing.T) {
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"tServer", "-addr", ":5004"}, []string{"tServer", "-addr", ":5004"}},
+		{[]string{"tServer", "-debug-token=abc"}, []string{"tServer", "-debug-token=[redacted]"}},
+		{[]string{"tServer", "--debug-token", "abc", "-data", "d"}, []string{"tServer", "--debug-token", "[redacted]", "-data", "d"}},
+		{[]string{"tServer", "-signing-key"}, []string{"tServer", "-signing-key"}},
+		{[]string{"tServer", "-Password=x", "token"}, []string{"tServer", "-Password=[redacted]", "token"}},
+	}
+	for _, tt := range tests {
+		if got := redactedArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("redactedArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/debug/x", bearerAuth("debug", "s3cret"), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	tests := []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", http.StatusNoContent},
+		{"Bearer s3cret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/debug/x", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%q: status %d, want %d", tt.header, w.Code, tt.status)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != `Bearer realm="debug"` {
+			t.Errorf("%q: missing WWW-Authenticate", tt.header)
+		}
+	}
+}
+
+func TestCheckWorkers(t *testing.T) {
+	t.Cleanup(func() {
+		workerBeats.Lock()
+		delete(workerBeats.last, "test_loop")
+		delete(workerBeats.period, "test_loop")
+		workerBeats.Unlock()
+	})
+	workerBeat("test_loop", time.Minute)
+	if err := checkWorkers(); err != nil {
+		t.Fatal(err)
+	}
+	workerBeats.Lock()
+	workerBeats.last["test_loop"] = time.Now().Add(-3 * time.Minute)
+	workerBeats.Unlock()
+	if err := checkWorkers(); err == nil || !strings.Contains(err.Error(), "test_loop") {
+		t.Fatalf("stale loop not reported: %v", err)
+	}
+}
+
+func TestCheckDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	if err := checkDir(dir, false); err == nil {
+		t.Fatal("missing dir passed without create")
+	}
+	if err := checkDir(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("probe file left behind: %v", entries)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	captureLog(t, false, levelError)
+	root := setTestDataRoot(t)
+	setTestStateRoot(t)
+	w := serveTest(http.MethodGet, "/readyz", "/readyz", "", readyzHandler)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	setDataRoot(filepath.Join(root, "missing"))
+	w = serveTest(http.MethodGet, "/readyz", "/readyz", "", readyzHandler)
+	var resp struct {
+		Status string
+		Checks map[string]ReadyCheck
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable || resp.Status != "unavailable" ||
+		resp.Checks["data"].OK || resp.Checks["cache"].OK || !resp.Checks["state"].OK || !resp.Checks["workers"].OK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(filepath.Join(root, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("readyz created the data root: %v", err)
+	}
+}
+
+func TestRunReadyCheck(t *testing.T) {
+	if rc := runReadyCheck("test_fail", func() error { return errors.New("boom") }); rc.OK || rc.Error != "boom" {
+		t.Fatalf("got %+v", rc)
+	}
+	if rc := runReadyCheck("test_ok", func() error { return nil }); !rc.OK || rc.Error != "" {
+		t.Fatalf("got %+v", rc)
+	}
+}
+
+func TestStartReadyCheckShared(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+	hang := func() error {
+		calls++
+		<-release
+		return errors.New("storage hung")
+	}
+	first := startReadyCheck("test_hang", hang)
+	// 挂住的检查还没结束时，之后的探针等待同一次运行
+	if again := startReadyCheck("test_hang", hang); again != first {
+		t.Fatal("a second run was started while the first is still running")
+	}
+	close(release)
+	<-first.done
+	if calls != 1 || first.err == nil || first.err.Error() != "storage hung" {
+		t.Fatalf("calls %d, err %v", calls, first.err)
+	}
+	next := startReadyCheck("test_hang", func() error { return nil })
+	<-next.done
+	if next == first || next.err != nil {
+		t.Fatalf("finished run was reused: %+v", next)
+	}
+}
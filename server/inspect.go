@@ -0,0 +1,875 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ModelReport 是 /api/models/*path/inspect 返回的检查报告
+type ModelReport struct {
+	Path               string            `json:"path"`
+	Format             string            `json:"format"`
+	FileSize           int64             `json:"fileSize"`
+	Version            string            `json:"version"`
+	Generator          string            `json:"generator,omitempty"`
+	Scenes             int               `json:"scenes"`
+	Nodes              int               `json:"nodes"`
+	Meshes             []MeshReport      `json:"meshes"`
+	Materials          []MaterialReport  `json:"materials"`
+	Textures           []TextureReport   `json:"textures"`
+	Animations         []AnimationReport `json:"animations"`
+	ExtensionsUsed     []string          `json:"extensionsUsed"`
+	ExtensionsRequired []string          `json:"extensionsRequired"`
+	Totals             ModelTotals       `json:"totals"`
+	GPUMemory          GPUMemory         `json:"gpuMemory"`
+	Validation         ValidationReport  `json:"validation"`
+}
+
+type MeshReport struct {
+	Name       string            `json:"name,omitempty"`
+	Primitives []PrimitiveReport `json:"primitives"`
+}
+
+type PrimitiveReport struct {
+	Mode       string   `json:"mode"`
+	Attributes []string `json:"attributes"`
+	Vertices   int      `json:"vertices"`
+	Indices    int      `json:"indices"`
+	Triangles  int      `json:"triangles"`
+	Material   *int     `json:"material,omitempty"`
+	Targets    int      `json:"morphTargets,omitempty"`
+}
+
+type MaterialReport struct {
+	Name        string         `json:"name,omitempty"`
+	AlphaMode   string         `json:"alphaMode"`
+	DoubleSided bool           `json:"doubleSided"`
+	Textures    map[string]int `json:"textures,omitempty"`
+	Extensions  []string       `json:"extensions,omitempty"`
+}
+
+type TextureReport struct {
+	Name     string `json:"name,omitempty"`
+	Image    *int   `json:"image,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Bytes    int    `json:"bytes"`
+	GPUBytes int64  `json:"gpuBytes"`
+}
+
+type AnimationReport struct {
+	Name     string  `json:"name,omitempty"`
+	Channels int     `json:"channels"`
+	Samplers int     `json:"samplers"`
+	Duration float64 `json:"duration"`
+}
+
+type ModelTotals struct {
+	Meshes     int `json:"meshes"`
+	Primitives int `json:"primitives"`
+	Vertices   int `json:"vertices"`
+	Triangles  int `json:"triangles"`
+	DrawCalls  int `json:"drawCalls"`
+}
+
+// GPUMemory 估算上传到显卡后的占用（纹理按 RGBA8 加完整 mipmap 链计算）
+type GPUMemory struct {
+	Geometry int64 `json:"geometry"`
+	Textures int64 `json:"textures"`
+	Total    int64 `json:"total"`
+}
+
+type ValidationReport struct {
+	Valid      bool            `json:"valid"`
+	Errors     []Issue         `json:"errors"`
+	Warnings   []Issue         `json:"warnings"`
+	Unresolved []UnresolvedURI `json:"unresolvedUris"`
+}
+
+// Issue 是一条校验问题，Pointer 为 JSON Pointer 形式的位置
+type Issue struct {
+	Code    string `json:"code"`
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+type UnresolvedURI struct {
+	Pointer string `json:"pointer"`
+	URI     string `json:"uri"`
+	Reason  string `json:"reason"`
+}
+
+var primitiveModeNames = map[int]string{
+	gltfPoints:        "POINTS",
+	gltfLines:         "LINES",
+	gltfLineLoop:      "LINE_LOOP",
+	gltfLineStrip:     "LINE_STRIP",
+	gltfTriangles:     "TRIANGLES",
+	gltfTriangleStrip: "TRIANGLE_STRIP",
+	gltfTriangleFan:   "TRIANGLE_FAN",
+}
+
+// inspectModel 解析并检查 glTF/GLB 文件；文件本身无法解析时返回错误
+func inspectModel(file string) (*ModelReport, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rep := &ModelReport{
+		Path:     dataRelPath(file),
+		FileSize: int64(len(data)),
+		Format:   "gltf",
+	}
+	v := &gltfValidator{}
+	if isGLB(data) {
+		rep.Format = "glb"
+		v.checkGLBContainer(data)
+	}
+	doc, bin, glb, err := decodeGLTF(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &GLTFFile{Doc: doc, IsGLB: glb, BIN: bin, Dir: filepath.Dir(file)}
+	f.loadBuffers()
+
+	v.f = f
+	v.validate()
+
+	rep.Version = doc.Asset.Version
+	rep.Generator = doc.Asset.Generator
+	rep.Scenes = len(doc.Scenes)
+	rep.Nodes = len(doc.Nodes)
+	rep.ExtensionsUsed = nonNil(doc.ExtensionsUsed)
+	rep.ExtensionsRequired = nonNil(doc.ExtensionsRequired)
+	rep.summarizeMeshes(f)
+	rep.summarizeMaterials(f)
+	rep.summarizeTextures(f, v)
+	rep.summarizeAnimations(f)
+	rep.GPUMemory.Total = rep.GPUMemory.Geometry + rep.GPUMemory.Textures
+
+	rep.Validation = ValidationReport{
+		Valid:      len(v.errors) == 0,
+		Errors:     nonNilIssues(v.errors),
+		Warnings:   nonNilIssues(v.warnings),
+		Unresolved: v.unresolved,
+	}
+	if rep.Validation.Unresolved == nil {
+		rep.Validation.Unresolved = []UnresolvedURI{}
+	}
+	return rep, nil
+}
+
+func (rep *ModelReport) summarizeMeshes(f *GLTFFile) {
+	doc := f.Doc
+	counted := map[int]bool{}
+	rep.Meshes = []MeshReport{}
+	for _, m := range doc.Meshes {
+		mr := MeshReport{Name: m.Name, Primitives: []PrimitiveReport{}}
+		for _, p := range m.Primitives {
+			pr := PrimitiveReport{
+				Mode:     primitiveModeNames[p.primitiveMode()],
+				Material: p.Material,
+				Targets:  len(p.Targets),
+				// 没有属性时输出 []，不是 null
+				Attributes: []string{},
+			}
+			for name, a := range p.Attributes {
+				pr.Attributes = append(pr.Attributes, name)
+				rep.GPUMemory.Geometry += accessorBytes(doc, a, counted)
+			}
+			sort.Strings(pr.Attributes)
+			for _, t := range p.Targets {
+				for _, a := range t {
+					rep.GPUMemory.Geometry += accessorBytes(doc, a, counted)
+				}
+			}
+			if a, ok := p.Attributes["POSITION"]; ok && a >= 0 && a < len(doc.Accessors) {
+				pr.Vertices = doc.Accessors[a].Count
+			}
+			n := pr.Vertices
+			if p.Indices != nil && *p.Indices >= 0 && *p.Indices < len(doc.Accessors) {
+				pr.Indices = doc.Accessors[*p.Indices].Count
+				n = pr.Indices
+				rep.GPUMemory.Geometry += accessorBytes(doc, *p.Indices, counted)
+			}
+			pr.Triangles = triangleCount(p.primitiveMode(), n)
+			rep.Totals.Primitives++
+			rep.Totals.Vertices += pr.Vertices
+			rep.Totals.Triangles += pr.Triangles
+			mr.Primitives = append(mr.Primitives, pr)
+		}
+		rep.Meshes = append(rep.Meshes, mr)
+	}
+	rep.Totals.Meshes = len(doc.Meshes)
+
+	// 绘制调用数按场景图中实际引用网格的节点统计
+	for _, n := range doc.Nodes {
+		if n.Mesh != nil && *n.Mesh >= 0 && *n.Mesh < len(doc.Meshes) {
+			rep.Totals.DrawCalls += len(doc.Meshes[*n.Mesh].Primitives)
+		}
+	}
+}
+
+// accessorBytes 返回访问器数据的字节数，同一访问器只计算一次
+func accessorBytes(doc *GLTF, a int, counted map[int]bool) int64 {
+	if a < 0 || a >= len(doc.Accessors) || counted[a] {
+		return 0
+	}
+	counted[a] = true
+	acc := &doc.Accessors[a]
+	return int64(acc.Count) * int64(acc.ElementSize())
+}
+
+// triangleCount 根据绘制模式和顶点（索引）数计算三角形数
+func triangleCount(mode, n int) int {
+	switch mode {
+	case gltfTriangles:
+		return n / 3
+	case gltfTriangleStrip, gltfTriangleFan:
+		if n >= 3 {
+			return n - 2
+		}
+	}
+	return 0
+}
+
+func (rep *ModelReport) summarizeMaterials(f *GLTFFile) {
+	rep.Materials = []MaterialReport{}
+	for _, m := range f.Doc.Materials {
+		mr := MaterialReport{
+			Name:        m.Name,
+			AlphaMode:   m.AlphaMode,
+			DoubleSided: m.DoubleSided,
+			Textures:    map[string]int{},
+		}
+		if mr.AlphaMode == "" {
+			mr.AlphaMode = "OPAQUE"
+		}
+		for _, slot := range materialTextureSlots(&m) {
+			mr.Textures[path.Base(slot.Name)] = slot.Info.Index
+		}
+		for ext := range m.Extensions {
+			mr.Extensions = append(mr.Extensions, ext)
+		}
+		sort.Strings(mr.Extensions)
+		rep.Materials = append(rep.Materials, mr)
+	}
+}
+
+// textureSlot 是材质中的一个纹理槽位
+type textureSlot struct {
+	Name string
+	Info *GLTFTextureInfo
+}
+
+// materialTextureSlots 按固定顺序返回材质引用的全部纹理槽位
+func materialTextureSlots(m *GLTFMaterial) []textureSlot {
+	var slots []textureSlot
+	add := func(name string, ti *GLTFTextureInfo) {
+		if ti != nil {
+			slots = append(slots, textureSlot{name, ti})
+		}
+	}
+	if pbr := m.PBRMetallicRoughness; pbr != nil {
+		add("pbrMetallicRoughness/baseColorTexture", pbr.BaseColorTexture)
+		add("pbrMetallicRoughness/metallicRoughnessTexture", pbr.MetallicRoughnessTexture)
+	}
+	add("normalTexture", m.NormalTexture)
+	add("occlusionTexture", m.OcclusionTexture)
+	add("emissiveTexture", m.EmissiveTexture)
+	return slots
+}
+
+func (rep *ModelReport) summarizeTextures(f *GLTFFile, v *gltfValidator) {
+	doc := f.Doc
+	rep.Textures = []TextureReport{}
+	sized := map[int]int64{}
+	for _, t := range doc.Textures {
+		tr := TextureReport{Name: t.Name, Image: t.Source}
+		if t.Source != nil && *t.Source >= 0 && *t.Source < len(doc.Images) {
+			img := doc.Images[*t.Source]
+			tr.MimeType = img.MimeType
+			if !strings.HasPrefix(img.URI, "data:") {
+				tr.URI = img.URI
+			}
+			if data, err := f.ImageData(*t.Source); err == nil {
+				tr.Bytes = len(data)
+				if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+					tr.Width, tr.Height = cfg.Width, cfg.Height
+					if tr.MimeType == "" {
+						tr.MimeType = "image/" + format
+					}
+				} else {
+					v.warn(fmt.Sprintf("/images/%d", *t.Source), "IMAGE_UNRECOGNIZED", "image data could not be decoded: %v", err)
+				}
+			}
+			tr.GPUBytes = textureGPUBytes(tr.Width, tr.Height)
+			// 多个纹理共享同一图片时只上传一次
+			if _, ok := sized[*t.Source]; !ok {
+				sized[*t.Source] = tr.GPUBytes
+				rep.GPUMemory.Textures += tr.GPUBytes
+			}
+		}
+		rep.Textures = append(rep.Textures, tr)
+	}
+}
+
+// textureGPUBytes 按 RGBA8 加 mipmap（约 4/3）估算纹理显存
+func textureGPUBytes(w, h int) int64 {
+	return int64(w) * int64(h) * 4 * 4 / 3
+}
+
+func (rep *ModelReport) summarizeAnimations(f *GLTFFile) {
+	doc := f.Doc
+	rep.Animations = []AnimationReport{}
+	for _, a := range doc.Animations {
+		ar := AnimationReport{Name: a.Name, Channels: len(a.Channels), Samplers: len(a.Samplers)}
+		for _, s := range a.Samplers {
+			if s.Input < 0 || s.Input >= len(doc.Accessors) {
+				continue
+			}
+			in := doc.Accessors[s.Input]
+			if len(in.Max) == 1 {
+				ar.Duration = maxf(ar.Duration, in.Max[0])
+			} else if times, err := f.ReadAccessor(s.Input); err == nil && len(times) > 0 {
+				ar.Duration = maxf(ar.Duration, times[len(times)-1])
+			}
+		}
+		rep.Animations = append(rep.Animations, ar)
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func nonNilIssues(s []Issue) []Issue {
+	if s == nil {
+		return []Issue{}
+	}
+	return s
+}
+
+// gltfValidator 按 glTF 2.0 规范检查文档，收集错误和警告
+type gltfValidator struct {
+	f          *GLTFFile
+	errors     []Issue
+	warnings   []Issue
+	unresolved []UnresolvedURI
+}
+
+func (v *gltfValidator) error(pointer, code, format string, args ...interface{}) {
+	v.errors = append(v.errors, Issue{Code: code, Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *gltfValidator) warn(pointer, code, format string, args ...interface{}) {
+	v.warnings = append(v.warnings, Issue{Code: code, Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+}
+
+// ref 检查索引引用是否越界
+func (v *gltfValidator) ref(pointer, kind string, idx, n int) bool {
+	if idx < 0 || idx >= n {
+		v.error(pointer, "UNRESOLVED_REFERENCE", "%s index %d out of range (have %d)", kind, idx, n)
+		return false
+	}
+	return true
+}
+
+// checkGLBContainer 检查 GLB 头和块的布局
+func (v *gltfValidator) checkGLBContainer(data []byte) {
+	if len(data) < 12 {
+		return
+	}
+	total := int(binary.LittleEndian.Uint32(data[8:12]))
+	if total != len(data) {
+		v.error("", "GLB_LENGTH_MISMATCH", "header length %d does not match file size %d", total, len(data))
+	}
+	offset := 12
+	for i := 0; offset+8 <= len(data) && offset < total; i++ {
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		typ := binary.LittleEndian.Uint32(data[offset+4:])
+		if length%4 != 0 {
+			v.error("", "GLB_CHUNK_ALIGNMENT", "chunk %d length %d is not 4-byte aligned", i, length)
+		}
+		if i == 1 && typ != glbChunkBIN {
+			v.warn("", "GLB_UNKNOWN_CHUNK", "second chunk has unknown type 0x%08x", typ)
+		}
+		if i > 1 && typ == glbChunkBIN {
+			v.error("", "GLB_EXTRA_BIN", "chunk %d: only one BIN chunk is allowed", i)
+		}
+		offset += 8 + length
+	}
+}
+
+func (v *gltfValidator) validate() {
+	doc := v.f.Doc
+	v.checkAsset()
+	v.checkExtensions()
+	v.checkBuffers()
+	v.checkBufferViews()
+	v.checkAccessors()
+	v.checkMeshes()
+	v.checkNodes()
+	if doc.Scene != nil {
+		v.ref("/scene", "scene", *doc.Scene, len(doc.Scenes))
+	}
+	for i, s := range doc.Scenes {
+		for j, n := range s.Nodes {
+			v.ref(fmt.Sprintf("/scenes/%d/nodes/%d", i, j), "node", n, len(doc.Nodes))
+		}
+	}
+	v.checkMaterials()
+	v.checkTextures()
+	v.checkImages()
+	v.checkAnimations()
+	v.checkSkins()
+}
+
+func (v *gltfValidator) checkAsset() {
+	ver := v.f.Doc.Asset.Version
+	switch {
+	case ver == "":
+		v.error("/asset/version", "MISSING_VERSION", "asset.version is required")
+	case !strings.HasPrefix(ver, "2."):
+		v.error("/asset/version", "UNSUPPORTED_VERSION", "unsupported glTF version %q", ver)
+	}
+}
+
+func (v *gltfValidator) checkExtensions() {
+	doc := v.f.Doc
+	used := map[string]bool{}
+	for _, e := range doc.ExtensionsUsed {
+		used[e] = true
+	}
+	for i, e := range doc.ExtensionsRequired {
+		if !used[e] {
+			v.error(fmt.Sprintf("/extensionsRequired/%d", i), "REQUIRED_NOT_USED", "%s is required but not listed in extensionsUsed", e)
+		}
+	}
+}
+
+func (v *gltfValidator) checkBuffers() {
+	f := v.f
+	for i, b := range f.Doc.Buffers {
+		p := fmt.Sprintf("/buffers/%d", i)
+		if isMeshoptFallback(b) {
+			continue
+		}
+		if b.URI != "" && !strings.HasPrefix(b.URI, "data:") {
+			v.checkExternalURI(p+"/uri", b.URI)
+		}
+		if err, ok := f.BufferErrors[i]; ok {
+			if b.URI == "" || strings.HasPrefix(b.URI, "data:") {
+				v.error(p, "BUFFER_UNAVAILABLE", "%v", err)
+			}
+			continue
+		}
+		if b.URI == "" && i > 0 {
+			v.error(p+"/uri", "BUFFER_MISSING_URI", "only the first buffer of a GLB may omit uri")
+		}
+		if got := len(f.Buffers[i]); got < b.ByteLength {
+			v.error(p+"/byteLength", "BUFFER_TOO_SHORT", "byteLength %d but only %d bytes available", b.ByteLength, got)
+		} else if b.URI == "" && got-b.ByteLength > 3 {
+			v.warn(p+"/byteLength", "GLB_BIN_PADDING", "BIN chunk has %d bytes beyond byteLength", got-b.ByteLength)
+		}
+	}
+}
+
+// checkExternalURI 检查外部资源是否可以在数据根目录内找到
+func (v *gltfValidator) checkExternalURI(pointer, uri string) {
+	file, err := v.f.resolveURI(uri)
+	if err == nil {
+		_, err = os.Stat(file)
+	}
+	if err == nil {
+		return
+	}
+	reason := err.Error()
+	if os.IsNotExist(err) {
+		reason = "file not found"
+	}
+	v.unresolved = append(v.unresolved, UnresolvedURI{Pointer: pointer, URI: uri, Reason: reason})
+	v.error(pointer, "URI_UNRESOLVED", "%s: %s", uri, reason)
+}
+
+func (v *gltfValidator) checkBufferViews() {
+	doc := v.f.Doc
+	for i, bv := range doc.BufferViews {
+		p := fmt.Sprintf("/bufferViews/%d", i)
+		if !v.ref(p+"/buffer", "buffer", bv.Buffer, len(doc.Buffers)) {
+			continue
+		}
+		if bv.ByteLength < 1 {
+			v.error(p+"/byteLength", "VALUE_OUT_OF_RANGE", "byteLength must be >= 1")
+		}
+		if bv.ByteOffset < 0 {
+			v.error(p+"/byteOffset", "VALUE_OUT_OF_RANGE", "byteOffset must be >= 0")
+		}
+		// 用减法比较，避免 byteOffset+byteLength 溢出
+		if size := doc.Buffers[bv.Buffer].ByteLength; bv.ByteOffset >= 0 && (bv.ByteOffset > size || bv.ByteLength > size-bv.ByteOffset) {
+			v.error(p, "BUFFER_VIEW_TOO_LONG", "byteOffset %d + byteLength %d exceeds buffer %d byteLength %d",
+				bv.ByteOffset, bv.ByteLength, bv.Buffer, size)
+		}
+		if bv.ByteStride != 0 && (bv.ByteStride < 4 || bv.ByteStride > 252 || bv.ByteStride%4 != 0) {
+			v.error(p+"/byteStride", "VALUE_OUT_OF_RANGE", "byteStride %d must be a multiple of 4 in [4, 252]", bv.ByteStride)
+		}
+		if bv.Target != 0 && bv.Target != gltfArrayBuffer && bv.Target != gltfElementArrayBuffer {
+			v.error(p+"/target", "VALUE_NOT_IN_LIST", "invalid target %d", bv.Target)
+		}
+		if _, ok := bv.Extensions[extMeshopt]; ok {
+			if _, err := v.f.BufferViewData(i); err != nil {
+				v.error(p+"/extensions/"+extMeshopt, "MESHOPT_DECODE", "%v", err)
+			} else if got := len(v.f.decoded[i]); got != bv.ByteLength {
+				v.error(p+"/extensions/"+extMeshopt, "MESHOPT_LENGTH", "decoded %d bytes but byteLength is %d", got, bv.ByteLength)
+			}
+		}
+	}
+}
+
+func (v *gltfValidator) checkAccessors() {
+	doc := v.f.Doc
+	for i := range doc.Accessors {
+		a := &doc.Accessors[i]
+		p := fmt.Sprintf("/accessors/%d", i)
+		csize := gltfComponentSize(a.ComponentType)
+		if csize == 0 {
+			v.error(p+"/componentType", "VALUE_NOT_IN_LIST", "invalid componentType %d", a.ComponentType)
+		}
+		ncomp := gltfTypeComponents(a.Type)
+		if ncomp == 0 {
+			v.error(p+"/type", "VALUE_NOT_IN_LIST", "invalid type %q", a.Type)
+		}
+		if a.Count < 1 {
+			v.error(p+"/count", "VALUE_OUT_OF_RANGE", "count must be >= 1")
+		}
+		if a.Normalized && (a.ComponentType == gltfFloat || a.ComponentType == gltfUnsignedInt) {
+			v.error(p+"/normalized", "INVALID_NORMALIZED", "normalized is not allowed for componentType %d", a.ComponentType)
+		}
+		if (a.Min != nil && len(a.Min) != ncomp) || (a.Max != nil && len(a.Max) != ncomp) {
+			v.error(p, "MINMAX_LENGTH", "min/max must have %d components", ncomp)
+		}
+		if csize == 0 || ncomp == 0 || a.BufferView == nil {
+			continue
+		}
+		if !v.ref(p+"/bufferView", "bufferView", *a.BufferView, len(doc.BufferViews)) {
+			continue
+		}
+		if a.ByteOffset < 0 {
+			v.error(p+"/byteOffset", "VALUE_OUT_OF_RANGE", "byteOffset must be >= 0")
+			continue
+		}
+		if a.ByteOffset%csize != 0 {
+			v.error(p+"/byteOffset", "ACCESSOR_ALIGNMENT", "byteOffset %d is not a multiple of component size %d", a.ByteOffset, csize)
+		}
+		bv := doc.BufferViews[*a.BufferView]
+		elem := a.ElementSize()
+		stride := bv.ByteStride
+		if stride != 0 && stride < elem {
+			v.error(p, "ACCESSOR_STRIDE", "bufferView byteStride %d is smaller than element size %d", stride, elem)
+		}
+		if stride < elem {
+			stride = elem
+		}
+		// 与 ReadAccessor 一样用除法比较，count、byteOffset 很大时不会溢出
+		if a.Count > 0 && (a.ByteOffset > bv.ByteLength-elem || a.Count-1 > (bv.ByteLength-elem-a.ByteOffset)/stride) {
+			v.error(p, "ACCESSOR_TOO_LONG", "accessor with byteOffset %d and count %d does not fit in bufferView %d byteLength %d",
+				a.ByteOffset, a.Count, *a.BufferView, bv.ByteLength)
+		}
+	}
+}
+
+func (v *gltfValidator) checkMeshes() {
+	doc := v.f.Doc
+	for i, m := range doc.Meshes {
+		if len(m.Primitives) == 0 {
+			v.error(fmt.Sprintf("/meshes/%d/primitives", i), "EMPTY_ARRAY", "mesh has no primitives")
+		}
+		for j := range m.Primitives {
+			v.checkPrimitive(fmt.Sprintf("/meshes/%d/primitives/%d", i, j), &m.Primitives[j])
+		}
+	}
+}
+
+func (v *gltfValidator) checkPrimitive(p string, prim *GLTFPrimitive) {
+	doc := v.f.Doc
+	mode := prim.primitiveMode()
+	if _, ok := primitiveModeNames[mode]; !ok {
+		v.error(p+"/mode", "VALUE_NOT_IN_LIST", "invalid mode %d", mode)
+	}
+	if prim.Material != nil {
+		v.ref(p+"/material", "material", *prim.Material, len(doc.Materials))
+	}
+	count := -1
+	for _, name := range sortedKeys(prim.Attributes) {
+		a := prim.Attributes[name]
+		ap := p + "/attributes/" + name
+		if !v.ref(ap, "accessor", a, len(doc.Accessors)) {
+			continue
+		}
+		acc := doc.Accessors[a]
+		if count >= 0 && acc.Count != count {
+			v.error(ap, "MESH_ATTRIBUTE_COUNT", "attribute count %d differs from %d", acc.Count, count)
+		}
+		if count < 0 {
+			count = acc.Count
+		}
+		if bv := acc.BufferView; bv != nil && *bv >= 0 && *bv < len(doc.BufferViews) && doc.BufferViews[*bv].Target == gltfElementArrayBuffer {
+			v.error(ap, "BUFFER_VIEW_TARGET", "vertex attribute uses an ELEMENT_ARRAY_BUFFER bufferView")
+		}
+		switch name {
+		case "POSITION":
+			if acc.Type != "VEC3" || acc.ComponentType != gltfFloat && !quantizedAllowed(doc) {
+				v.error(ap, "MESH_ATTRIBUTE_FORMAT", "POSITION must be float VEC3")
+			}
+			if acc.Min == nil || acc.Max == nil {
+				v.error(ap, "POSITION_MINMAX", "POSITION accessor must define min and max")
+			}
+		case "NORMAL":
+			if acc.Type != "VEC3" {
+				v.error(ap, "MESH_ATTRIBUTE_FORMAT", "NORMAL must be VEC3")
+			}
+		case "TANGENT":
+			if acc.Type != "VEC4" {
+				v.error(ap, "MESH_ATTRIBUTE_FORMAT", "TANGENT must be VEC4")
+			}
+		}
+	}
+	if _, ok := prim.Attributes["POSITION"]; !ok {
+		v.warn(p+"/attributes", "MESH_NO_POSITION", "primitive has no POSITION attribute")
+	}
+	if prim.Indices != nil && v.ref(p+"/indices", "accessor", *prim.Indices, len(doc.Accessors)) {
+		acc := doc.Accessors[*prim.Indices]
+		switch {
+		case acc.Type != "SCALAR":
+			v.error(p+"/indices", "INDICES_FORMAT", "indices accessor must be SCALAR")
+		case acc.ComponentType != gltfUnsignedByte && acc.ComponentType != gltfUnsignedShort && acc.ComponentType != gltfUnsignedInt:
+			v.error(p+"/indices", "INDICES_FORMAT", "indices must be unsigned byte, short or int")
+		}
+		if mode == gltfTriangles && acc.Count%3 != 0 {
+			v.error(p+"/indices", "INDICES_COUNT", "TRIANGLES needs a multiple of 3 indices, got %d", acc.Count)
+		}
+		v.checkIndexRange(p+"/indices", prim, count)
+	} else if prim.Indices == nil && mode == gltfTriangles && count > 0 && count%3 != 0 {
+		v.error(p+"/attributes", "VERTEX_COUNT", "non-indexed TRIANGLES needs a multiple of 3 vertices, got %d", count)
+	}
+	for t, target := range prim.Targets {
+		for name, a := range target {
+			tp := fmt.Sprintf("%s/targets/%d/%s", p, t, name)
+			if v.ref(tp, "accessor", a, len(doc.Accessors)) && count >= 0 && doc.Accessors[a].Count != count {
+				v.error(tp, "MESH_ATTRIBUTE_COUNT", "morph target count %d differs from %d", doc.Accessors[a].Count, count)
+			}
+		}
+	}
+}
+
+// checkIndexRange 检查索引值不超过顶点数
+func (v *gltfValidator) checkIndexRange(p string, prim *GLTFPrimitive, vertices int) {
+	if vertices < 0 {
+		return
+	}
+	idx, err := v.f.ReadIndices(prim)
+	if err != nil {
+		return
+	}
+	for i, x := range idx {
+		if int(x) >= vertices {
+			v.error(p, "INDEX_OUT_OF_RANGE", "index %d at position %d exceeds vertex count %d", x, i, vertices)
+			return
+		}
+	}
+}
+
+// quantizedAllowed 判断是否启用了允许整型顶点属性的 KHR_mesh_quantization
+func quantizedAllowed(doc *GLTF) bool {
+	for _, e := range doc.ExtensionsUsed {
+		if e == "KHR_mesh_quantization" {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *gltfValidator) checkNodes() {
+	doc := v.f.Doc
+	parent := make([]int, len(doc.Nodes))
+	for i := range parent {
+		parent[i] = -1
+	}
+	for i, n := range doc.Nodes {
+		p := fmt.Sprintf("/nodes/%d", i)
+		if n.Mesh != nil {
+			v.ref(p+"/mesh", "mesh", *n.Mesh, len(doc.Meshes))
+		}
+		if n.Skin != nil {
+			v.ref(p+"/skin", "skin", *n.Skin, len(doc.Skins))
+		}
+		if n.Camera != nil {
+			v.ref(p+"/camera", "camera", *n.Camera, len(doc.Cameras))
+		}
+		if n.Matrix != nil && (n.Translation != nil || n.Rotation != nil || n.Scale != nil) {
+			v.error(p, "NODE_MATRIX_TRS", "matrix and TRS must not both be defined")
+		}
+		if n.Matrix != nil && len(n.Matrix) != 16 {
+			v.error(p+"/matrix", "ARRAY_LENGTH", "matrix must have 16 elements")
+		}
+		if n.Translation != nil && len(n.Translation) != 3 || n.Scale != nil && len(n.Scale) != 3 {
+			v.error(p, "ARRAY_LENGTH", "translation and scale must have 3 elements")
+		}
+		if n.Rotation != nil && len(n.Rotation) != 4 {
+			v.error(p+"/rotation", "ARRAY_LENGTH", "rotation must have 4 elements")
+		}
+		for j, c := range n.Children {
+			cp := fmt.Sprintf("%s/children/%d", p, j)
+			if !v.ref(cp, "node", c, len(doc.Nodes)) {
+				continue
+			}
+			if parent[c] >= 0 {
+				v.error(cp, "NODE_MULTIPLE_PARENTS", "node %d has multiple parents (%d and %d)", c, parent[c], i)
+			}
+			parent[c] = i
+		}
+	}
+	// 沿父链向上走，超过节点数说明存在环
+	for i := range doc.Nodes {
+		steps := 0
+		for n := parent[i]; n >= 0; n = parent[n] {
+			if n == i || steps > len(doc.Nodes) {
+				v.error(fmt.Sprintf("/nodes/%d", i), "NODE_LOOP", "node hierarchy contains a cycle")
+				break
+			}
+			steps++
+		}
+	}
+}
+
+func (v *gltfValidator) checkMaterials() {
+	doc := v.f.Doc
+	for i := range doc.Materials {
+		m := &doc.Materials[i]
+		p := fmt.Sprintf("/materials/%d", i)
+		switch m.AlphaMode {
+		case "", "OPAQUE", "MASK", "BLEND":
+		default:
+			v.error(p+"/alphaMode", "VALUE_NOT_IN_LIST", "invalid alphaMode %q", m.AlphaMode)
+		}
+		for _, slot := range materialTextureSlots(m) {
+			v.ref(p+"/"+slot.Name+"/index", "texture", slot.Info.Index, len(doc.Textures))
+		}
+		if pbr := m.PBRMetallicRoughness; pbr != nil && pbr.BaseColorFactor != nil && len(pbr.BaseColorFactor) != 4 {
+			v.error(p+"/pbrMetallicRoughness/baseColorFactor", "ARRAY_LENGTH", "baseColorFactor must have 4 elements")
+		}
+	}
+}
+
+func (v *gltfValidator) checkTextures() {
+	doc := v.f.Doc
+	for i, t := range doc.Textures {
+		p := fmt.Sprintf("/textures/%d", i)
+		if t.Sampler != nil {
+			v.ref(p+"/sampler", "sampler", *t.Sampler, len(doc.Samplers))
+		}
+		if t.Source != nil {
+			v.ref(p+"/source", "image", *t.Source, len(doc.Images))
+		} else if len(t.Extensions) == 0 {
+			v.warn(p, "TEXTURE_NO_SOURCE", "texture has no source image")
+		}
+	}
+}
+
+func (v *gltfValidator) checkImages() {
+	doc := v.f.Doc
+	for i, img := range doc.Images {
+		p := fmt.Sprintf("/images/%d", i)
+		switch {
+		case img.URI != "" && img.BufferView != nil:
+			v.error(p, "IMAGE_URI_AND_BUFFERVIEW", "image must not define both uri and bufferView")
+		case img.URI == "" && img.BufferView == nil:
+			v.error(p, "IMAGE_NO_DATA", "image must define uri or bufferView")
+		case img.BufferView != nil:
+			v.ref(p+"/bufferView", "bufferView", *img.BufferView, len(doc.BufferViews))
+			if img.MimeType == "" {
+				v.error(p+"/mimeType", "IMAGE_MIME_REQUIRED", "mimeType is required when bufferView is used")
+			}
+		case strings.HasPrefix(img.URI, "data:"):
+			if _, err := decodeDataURI(img.URI); err != nil {
+				v.error(p+"/uri", "INVALID_DATA_URI", "%v", err)
+			}
+		default:
+			v.checkExternalURI(p+"/uri", img.URI)
+		}
+	}
+}
+
+func (v *gltfValidator) checkAnimations() {
+	doc := v.f.Doc
+	for i, a := range doc.Animations {
+		p := fmt.Sprintf("/animations/%d", i)
+		for j, s := range a.Samplers {
+			sp := fmt.Sprintf("%s/samplers/%d", p, j)
+			if v.ref(sp+"/input", "accessor", s.Input, len(doc.Accessors)) {
+				if in := doc.Accessors[s.Input]; in.Type != "SCALAR" || in.ComponentType != gltfFloat {
+					v.error(sp+"/input", "ANIMATION_INPUT_FORMAT", "sampler input must be float SCALAR")
+				}
+			}
+			v.ref(sp+"/output", "accessor", s.Output, len(doc.Accessors))
+			switch s.Interpolation {
+			case "", "LINEAR", "STEP", "CUBICSPLINE":
+			default:
+				v.error(sp+"/interpolation", "VALUE_NOT_IN_LIST", "invalid interpolation %q", s.Interpolation)
+			}
+		}
+		for j, c := range a.Channels {
+			cp := fmt.Sprintf("%s/channels/%d", p, j)
+			v.ref(cp+"/sampler", "sampler", c.Sampler, len(a.Samplers))
+			if c.Target.Node != nil {
+				v.ref(cp+"/target/node", "node", *c.Target.Node, len(doc.Nodes))
+			}
+			switch c.Target.Path {
+			case "translation", "rotation", "scale", "weights":
+			default:
+				v.error(cp+"/target/path", "VALUE_NOT_IN_LIST", "invalid target path %q", c.Target.Path)
+			}
+		}
+	}
+}
+
+func (v *gltfValidator) checkSkins() {
+	doc := v.f.Doc
+	for i, s := range doc.Skins {
+		p := fmt.Sprintf("/skins/%d", i)
+		for j, n := range s.Joints {
+			v.ref(fmt.Sprintf("%s/joints/%d", p, j), "node", n, len(doc.Nodes))
+		}
+		if s.InverseBindMatrices != nil && v.ref(p+"/inverseBindMatrices", "accessor", *s.InverseBindMatrices, len(doc.Accessors)) {
+			acc := doc.Accessors[*s.InverseBindMatrices]
+			if acc.Type != "MAT4" || acc.Count < len(s.Joints) {
+				v.error(p+"/inverseBindMatrices", "SKIN_IBM", "inverseBindMatrices must be MAT4 with at least %d elements", len(s.Joints))
+			}
+		}
+	}
+}
+
+// sortedKeys 返回 map 的有序键，保证报告顺序稳定
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTriangleDoc 返回一个带索引的单三角形 glTF，缓冲以 data URI 内嵌；indices 为三个 uint16 索引
+func testTriangleDoc(indices [3]uint16) map[string]interface{} {
+	buf := make([]byte, 44)
+	for i, v := range []float32{0, 0, 0, 1, 0, 0, 0, 1, 0} {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	for i, x := range indices {
+		binary.LittleEndian.PutUint16(buf[36+2*i:], x)
+	}
+	var doc map[string]interface{}
+	js := `{
+		"asset": {"version": "2.0"},
+		"scene": 0,
+		"scenes": [{"nodes": [0]}],
+		"nodes": [{"mesh": 0}],
+		"meshes": [{"primitives": [{"attributes": {"POSITION": 0}, "indices": 1}]}],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3", "min": [0, 0, 0], "max": [1, 1, 0]},
+			{"bufferView": 1, "componentType": 5123, "count": 3, "type": "SCALAR"}
+		],
+		"bufferViews": [
+			{"buffer": 0, "byteLength": 36, "target": 34962},
+			{"buffer": 0, "byteOffset": 36, "byteLength": 6, "target": 34963}
+		],
+		"buffers": [{"byteLength": 44, "uri": "data:application/octet-stream;base64,` + base64.StdEncoding.EncodeToString(buf) + `"}]
+	}`
+	if err := json.Unmarshal([]byte(js), &doc); err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+func inspectTestDoc(t *testing.T, doc map[string]interface{}) *ModelReport {
+	t.Helper()
+	js, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "t.gltf")
+	if err := os.WriteFile(file, js, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := inspectModel(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rep
+}
+
+// docItem 取出文档中的数组元素，用于修改测试用例
+func docItem(doc map[string]interface{}, key string, i int) map[string]interface{} {
+	return doc[key].([]interface{})[i].(map[string]interface{})
+}
+
+func TestInspectValid(t *testing.T) {
+	rep := inspectTestDoc(t, testTriangleDoc([3]uint16{0, 1, 2}))
+	if !rep.Validation.Valid {
+		t.Fatalf("unexpected errors %+v", rep.Validation.Errors)
+	}
+	if rep.Format != "gltf" || len(rep.Meshes) != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	prim := rep.Meshes[0].Primitives[0]
+	if prim.Mode != "TRIANGLES" || prim.Vertices != 3 || prim.Indices != 3 || prim.Triangles != 1 {
+		t.Fatalf("unexpected primitive %+v", prim)
+	}
+}
+
+func TestInspectErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		indices [3]uint16
+		edit    func(doc map[string]interface{})
+		code    string
+		pointer string
+	}{
+		{"missing version", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { d["asset"] = map[string]interface{}{} },
+			"MISSING_VERSION", "/asset/version"},
+		{"version 1", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { d["asset"] = map[string]interface{}{"version": "1.0"} },
+			"UNSUPPORTED_VERSION", "/asset/version"},
+		{"required but unused extension", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { d["extensionsRequired"] = []string{"KHR_draco_mesh_compression"} },
+			"REQUIRED_NOT_USED", "/extensionsRequired/0"},
+		{"buffer too short", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "buffers", 0)["byteLength"] = 100 },
+			"BUFFER_TOO_SHORT", "/buffers/0/byteLength"},
+		{"bufferView past buffer", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "bufferViews", 1)["byteLength"] = 40 },
+			"BUFFER_VIEW_TOO_LONG", "/bufferViews/1"},
+		{"accessor past bufferView", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "accessors", 1)["count"] = 6 },
+			"ACCESSOR_TOO_LONG", "/accessors/1"},
+		{"huge bufferView byteOffset", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "bufferViews", 1)["byteOffset"] = int64(math.MaxInt64) },
+			"BUFFER_VIEW_TOO_LONG", "/bufferViews/1"},
+		{"negative bufferView byteOffset", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "bufferViews", 1)["byteOffset"] = -4 },
+			"VALUE_OUT_OF_RANGE", "/bufferViews/1/byteOffset"},
+		{"huge accessor byteOffset", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "accessors", 1)["byteOffset"] = int64(math.MaxInt64 - 7) },
+			"ACCESSOR_TOO_LONG", "/accessors/1"},
+		{"huge accessor count", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "accessors", 0)["count"] = int64(math.MaxInt64) },
+			"ACCESSOR_TOO_LONG", "/accessors/0"},
+		{"negative accessor byteOffset", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "accessors", 1)["byteOffset"] = -2 },
+			"VALUE_OUT_OF_RANGE", "/accessors/1/byteOffset"},
+		{"misaligned accessor", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "accessors", 0)["byteOffset"] = 2 },
+			"ACCESSOR_ALIGNMENT", "/accessors/0/byteOffset"},
+		{"zero count", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "accessors", 1)["count"] = 0 },
+			"VALUE_OUT_OF_RANGE", "/accessors/1/count"},
+		{"odd stride", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "bufferViews", 0)["byteStride"] = 13 },
+			"VALUE_OUT_OF_RANGE", "/bufferViews/0/byteStride"},
+		{"index past vertices", [3]uint16{0, 1, 7}, nil,
+			"INDEX_OUT_OF_RANGE", "/meshes/0/primitives/0/indices"},
+		{"float indices", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "accessors", 1)["componentType"] = 5126 },
+			"INDICES_FORMAT", "/meshes/0/primitives/0/indices"},
+		{"position without bounds", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { delete(docItem(d, "accessors", 0), "min") },
+			"POSITION_MINMAX", "/meshes/0/primitives/0/attributes/POSITION"},
+		{"missing node", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(d, "scenes", 0)["nodes"] = []int{3} },
+			"UNRESOLVED_REFERENCE", "/scenes/0/nodes/0"},
+		{"missing accessor", [3]uint16{0, 1, 2}, func(d map[string]interface{}) { docItem(docItem(d, "meshes", 0), "primitives", 0)["indices"] = 9 },
+			"UNRESOLVED_REFERENCE", "/meshes/0/primitives/0/indices"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := testTriangleDoc(tt.indices)
+			if tt.edit != nil {
+				tt.edit(doc)
+			}
+			rep := inspectTestDoc(t, doc)
+			if rep.Validation.Valid {
+				t.Fatal("report is valid, want an error")
+			}
+			for _, e := range rep.Validation.Errors {
+				if e.Code == tt.code && e.Pointer == tt.pointer {
+					return
+				}
+			}
+			t.Fatalf("no %s at %s in %+v", tt.code, tt.pointer, rep.Validation.Errors)
+		})
+	}
+}
+
+func TestInspectEmptyAttributes(t *testing.T) {
+	doc := testTriangleDoc([3]uint16{0, 1, 2})
+	docItem(docItem(doc, "meshes", 0), "primitives", 0)["attributes"] = map[string]interface{}{}
+	rep := inspectTestDoc(t, doc)
+	js, _ := json.Marshal(rep.Meshes[0].Primitives[0])
+	var pr map[string]interface{}
+	json.Unmarshal(js, &pr)
+	if attrs, ok := pr["attributes"].([]interface{}); !ok || len(attrs) != 0 {
+		t.Fatalf("attributes = %v, want []", pr["attributes"])
+	}
+}
+
+func TestInspectUnresolvedURI(t *testing.T) {
+	old := dataRoot
+	defer func() { dataRoot = old }()
+	if err := setDataRoot(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	doc := testTriangleDoc([3]uint16{0, 1, 2})
+	docItem(doc, "buffers", 0)["uri"] = "../outside.bin"
+	js, _ := json.Marshal(doc)
+	file := filepath.Join(dataRoot, "t.gltf")
+	os.WriteFile(file, js, 0644)
+	rep, err := inspectModel(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Validation.Valid || len(rep.Validation.Unresolved) != 1 || rep.Validation.Unresolved[0].URI != "../outside.bin" {
+		t.Fatalf("unexpected validation %+v", rep.Validation)
+	}
+}
+
+func TestInspectUnparsable(t *testing.T) {
+	for name, data := range map[string]string{
+		"truncated json": `{"asset":{"version":"2.0"`,
+		"not json":       "solid cube",
+	} {
+		file := filepath.Join(t.TempDir(), "t.gltf")
+		os.WriteFile(file, []byte(data), 0644)
+		if _, err := inspectModel(file); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
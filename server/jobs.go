@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 后台任务状态
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// Job 是一个耗时的后台任务（点云切片、模型优化等），进度可通过 /api/jobs/:id 查询
+type Job struct {
+	ID        string      `json:"id"`
+	Kind      string      `json:"kind"`
+	Target    string      `json:"target"`
+	RequestID string      `json:"requestId,omitempty"`
+	Status    string      `json:"status"`
+	Progress  float64     `json:"progress"`
+	Error     string      `json:"error,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+	Created   time.Time   `json:"created"`
+	Started   *time.Time  `json:"started,omitempty"`
+	Finished  *time.Time  `json:"finished,omitempty"`
+	run       func(j *Job) (interface{}, error)
+}
+
+// jobQueue 用固定数量的 worker 依次执行任务，完成的任务保留一段时间供查询
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	pending chan *Job
+	keep    time.Duration
+	workers int
+	alive   int32 // 正在运行的 worker 数，供 /readyz 检查
+}
+
+var jobs = newJobQueue(2, 256, time.Hour)
+
+func newJobQueue(workers, capacity int, keep time.Duration) *jobQueue {
+	q := &jobQueue{
+		jobs:    map[string]*Job{},
+		pending: make(chan *Job, capacity),
+		keep:    keep,
+		workers: workers,
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// Submit 把任务加入队列，队列已满时返回错误；requestID 是提交任务的请求，便于对照日志
+func (q *jobQueue) Submit(kind, target, requestID string, run func(j *Job) (interface{}, error)) (*Job, error) {
+	j := &Job{
+		ID:        newJobID(),
+		Kind:      kind,
+		Target:    target,
+		RequestID: requestID,
+		Status:    jobQueued,
+		Created:   time.Now().UTC(),
+		run:       run,
+	}
+	q.mu.Lock()
+	q.gc()
+	q.jobs[j.ID] = j
+	q.mu.Unlock()
+	select {
+	case q.pending <- j:
+		return j, nil
+	default:
+		q.mu.Lock()
+		delete(q.jobs, j.ID)
+		q.mu.Unlock()
+		return nil, fmt.Errorf("job queue is full")
+	}
+}
+
+func (q *jobQueue) worker() {
+	atomic.AddInt32(&q.alive, 1)
+	defer atomic.AddInt32(&q.alive, -1)
+	for j := range q.pending {
+		q.mu.Lock()
+		started := time.Now().UTC()
+		j.Status, j.Started = jobRunning, &started
+		q.mu.Unlock()
+
+		res, err := runJob(j)
+		if err != nil {
+			logWarn("后台任务失败", "request_id", j.RequestID, "job", j.ID, "kind", j.Kind, "target", j.Target, "error", err)
+		}
+
+		q.mu.Lock()
+		finished := time.Now().UTC()
+		j.Finished = &finished
+		if err != nil {
+			j.Status, j.Error = jobFailed, err.Error()
+		} else {
+			j.Status, j.Result, j.Progress = jobDone, res, 1
+		}
+		q.mu.Unlock()
+	}
+}
+
+// runJob 执行任务函数；任务 panic 时记为失败，worker 继续处理后面的任务
+func runJob(j *Job) (res interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logError("后台任务 panic", "request_id", j.RequestID, "job", j.ID, "kind", j.Kind, "error", fmt.Sprint(p), "stack", string(debug.Stack()))
+			res, err = nil, fmt.Errorf("internal error: %v", p)
+		}
+	}()
+	return j.run(j)
+}
+
+// SetProgress 由任务函数调用，更新 0~1 的进度
+func (q *jobQueue) SetProgress(j *Job, p float64) {
+	q.mu.Lock()
+	j.Progress = p
+	q.mu.Unlock()
+}
+
+// Get 返回任务的快照
+func (q *jobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// List 返回全部任务的快照，新任务在前
+func (q *jobQueue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.gc()
+	list := make([]Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		list = append(list, *j)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Created.After(list[b].Created) })
+	return list
+}
+
+// Depth 返回排队中和执行中的任务数
+func (q *jobQueue) Depth() (queued, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		switch j.Status {
+		case jobQueued:
+			queued++
+		case jobRunning:
+			running++
+		}
+	}
+	return queued, running
+}
+
+// Alive 返回正在运行的 worker 数和配置的 worker 数
+func (q *jobQueue) Alive() (alive, workers int) {
+	return int(atomic.LoadInt32(&q.alive)), q.workers
+}
+
+// gc 清理过期的已完成任务，调用方持有锁
+func (q *jobQueue) gc() {
+	cutoff := time.Now().Add(-q.keep)
+	for id, j := range q.jobs {
+		if j.Finished != nil && j.Finished.Before(cutoff) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// jobHandler 处理 GET /api/jobs/:id
+func jobHandler(c *gin.Context) {
+	j, ok := jobs.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, j)
+}
+
+// listJobsHandler 处理 GET /api/jobs
+func listJobsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, jobs.List())
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitJob 等待任务结束，超时则让测试失败
+func waitJob(t *testing.T, q *jobQueue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if j, ok := q.Get(id); ok && (j.Status == jobDone || j.Status == jobFailed) {
+			return j
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobQueue(t *testing.T) {
+	q := newJobQueue(1, 4, time.Hour)
+	tests := []struct {
+		name   string
+		run    func(j *Job) (interface{}, error)
+		status string
+		errMsg string
+	}{
+		{"success", func(j *Job) (interface{}, error) {
+			q.SetProgress(j, 0.5)
+			return "ok", nil
+		}, jobDone, ""},
+		{"failure", func(j *Job) (interface{}, error) { return nil, errors.New("boom") }, jobFailed, "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := q.Submit("test", tt.name, "req-"+tt.name, tt.run)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := waitJob(t, q, j.ID)
+			if got.Status != tt.status || got.Error != tt.errMsg || got.RequestID != "req-"+tt.name || got.Started == nil || got.Finished == nil {
+				t.Fatalf("unexpected job %+v", got)
+			}
+			if tt.status == jobDone && (got.Progress != 1 || got.Result != "ok") {
+				t.Fatalf("finished job has progress %v result %v", got.Progress, got.Result)
+			}
+		})
+	}
+	if list := q.List(); len(list) != 2 || list[0].Target != "failure" {
+		t.Fatalf("List() = %+v, want newest first", list)
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	// 没有 worker，容量为 1：第二个任务被拒绝，且不会留在任务表里
+	q := newJobQueue(0, 1, time.Hour)
+	noop := func(j *Job) (interface{}, error) { return nil, nil }
+	if _, err := q.Submit("test", "a", "", noop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Submit("test", "b", "", noop); err == nil {
+		t.Fatal("expected the queue to be full")
+	}
+	if queued, running := q.Depth(); queued != 1 || running != 0 {
+		t.Fatalf("Depth() = %d, %d; want 1, 0", queued, running)
+	}
+}
+
+func TestJobQueueExpiry(t *testing.T) {
+	q := newJobQueue(1, 4, time.Millisecond)
+	j, err := q.Submit("test", "a", "", func(j *Job) (interface{}, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJob(t, q, j.ID)
+	time.Sleep(5 * time.Millisecond)
+	if list := q.List(); len(list) != 0 {
+		t.Fatalf("expired job still listed: %+v", list)
+	}
+}
+
+func TestJobQueuePanic(t *testing.T) {
+	captureLog(t, false, levelError+1)
+	q := newJobQueue(1, 4, time.Hour)
+	bad, err := q.Submit("test", "bad", "", func(j *Job) (interface{}, error) { panic("boom") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := waitJob(t, q, bad.ID); got.Status != jobFailed || got.Error != "internal error: boom" {
+		t.Fatalf("unexpected job %+v", got)
+	}
+	// worker 没有退出，后面的任务照常执行
+	next, err := q.Submit("test", "next", "", func(j *Job) (interface{}, error) { return "ok", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := waitJob(t, q, next.ID); got.Status != jobDone {
+		t.Fatalf("unexpected job %+v", got)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	errorMaxBytes     = 64 << 10
+	errorMaxFrames    = 50
+	errorMaxGroups    = 5000
+	errorFingerFrames = 5 // 参与指纹计算的栈顶帧数
+	sourceMapMaxBytes = 32 << 20
+	sourceMapCacheMax = 32
+)
+
+// errorsMu 串行化错误分组的读改写
+var errorsMu sync.Mutex
+
+var (
+	// Chrome/Edge：at fn (url:1:2) 或 at url:1:2
+	chromeFramePattern = regexp.MustCompile(`^\s*at (?:(.+?) \()?(.+?):(\d+):(\d+)\)?$`)
+	// Firefox/Safari：fn@url:1:2
+	geckoFramePattern = regexp.MustCompile(`^\s*(.*?)@(.+?):(\d+):(\d+)$`)
+	// 指纹计算前把消息中的数字抹掉，同一个错误不会因为 id、坐标不同而分成多组
+	errorDigitsPattern = regexp.MustCompile(`\d+`)
+	// 构建产物文件名中的内容哈希，例如 main.1a2b.js、main.9f8e3c1d.chunk.js
+	errorBuildHashPattern = regexp.MustCompile(`\.[0-9a-f]{4,}\.`)
+)
+
+// ErrorReport 是前端上报的一次错误，Type 为 error 或 unhandledrejection
+type ErrorReport struct {
+	Release   string `json:"release"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Message   string `json:"message"`
+	Stack     string `json:"stack"`
+	URL       string `json:"url"`
+	UserAgent string `json:"userAgent"`
+}
+
+// StackFrame 是堆栈中的一帧；找到 source map 时 Original 为还原后的位置
+type StackFrame struct {
+	Function string            `json:"function,omitempty"`
+	File     string            `json:"file"`
+	Line     int               `json:"line"`
+	Column   int               `json:"column"`
+	Original *OriginalPosition `json:"original,omitempty"`
+}
+
+// ErrorGroup 是指纹相同的错误，保存在状态目录的 errors/<fingerprint>.json，只保留最近一次的堆栈
+type ErrorGroup struct {
+	Fingerprint string         `json:"fingerprint"`
+	Type        string         `json:"type"`
+	Name        string         `json:"name"`
+	Message     string         `json:"message"`
+	Count       int            `json:"count"`
+	Releases    map[string]int `json:"releases"`
+	FirstSeen   time.Time      `json:"firstSeen"`
+	LastSeen    time.Time      `json:"lastSeen"`
+	Release     string         `json:"release"` // 最近一次的版本，Frames 按它还原
+	Frames      []StackFrame   `json:"frames,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	UserAgent   string         `json:"userAgent,omitempty"`
+}
+
+// sourceMaps 缓存解析过的 source map，键为本地文件路径
+var sourceMaps = struct {
+	sync.Mutex
+	m map[string]*sourceMap
+}{m: map[string]*sourceMap{}}
+
+func errorsRoot() string {
+	return statePath("errors")
+}
+
+func errorGroupFile(fp string) string {
+	return filepath.Join(errorsRoot(), fp+".json")
+}
+
+// sourceMapFile 返回某个版本的 source map 在状态目录中的路径：sourcemaps/<release>/static/js/main.abc123.js.map
+func sourceMapFile(release, script string) string {
+	return statePath("sourcemaps", release, filepath.FromSlash(path.Clean("/"+script)))
+}
+
+// loadSourceMap 读取脚本对应的 source map，没有上传时返回 nil
+func loadSourceMap(release, scriptURL string) *sourceMap {
+	u, err := url.Parse(scriptURL)
+	if err != nil || !strings.HasSuffix(u.Path, ".js") {
+		return nil
+	}
+	file := sourceMapFile(release, u.Path+".map")
+	sourceMaps.Lock()
+	defer sourceMaps.Unlock()
+	m, ok := sourceMaps.m[file]
+	cacheLookup("sourcemap", ok)
+	if ok {
+		return m
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	m, err = parseSourceMap(data)
+	if err != nil {
+		return nil
+	}
+	if len(sourceMaps.m) >= sourceMapCacheMax {
+		sourceMaps.m = map[string]*sourceMap{}
+	}
+	sourceMaps.m[file] = m
+	return m
+}
+
+// parseStack 解析浏览器的 error.stack，认不出的行跳过
+func parseStack(stack string) []StackFrame {
+	frames := []StackFrame{}
+	for _, line := range strings.Split(stack, "\n") {
+		m := chromeFramePattern.FindStringSubmatch(line)
+		if m == nil {
+			m = geckoFramePattern.FindStringSubmatch(line)
+		}
+		if m == nil {
+			continue
+		}
+		ln, _ := strconv.Atoi(m[3])
+		col, _ := strconv.Atoi(m[4])
+		frames = append(frames, StackFrame{Function: m[1], File: m[2], Line: ln, Column: col})
+		if len(frames) == errorMaxFrames {
+			break
+		}
+	}
+	return frames
+}
+
+// symbolicate 用 release 的 source map 还原每一帧，mapping 带名字时记在 Original.Name
+func symbolicate(release string, frames []StackFrame) {
+	for i := range frames {
+		f := &frames[i]
+		f.Original = nil
+		m := loadSourceMap(release, f.File)
+		if m == nil {
+			continue
+		}
+		if pos, ok := m.lookup(f.Line, f.Column); ok {
+			f.Original = pos
+		}
+	}
+}
+
+// errorFingerprint 由错误类型、名字、抹掉数字的消息和栈顶几帧的文件、函数组成；
+// 行号不参与，新版本改动代码后同一个错误仍归为一组
+func errorFingerprint(r *ErrorReport, frames []StackFrame) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", r.Type, r.Name, errorDigitsPattern.ReplaceAllString(r.Message, "0"))
+	for i, f := range frames {
+		if i == errorFingerFrames {
+			break
+		}
+		if f.Original != nil {
+			fmt.Fprintf(h, "\x00%s:%s", f.Original.Source, f.Original.Name)
+		} else {
+			// 去掉 main.abc123.js 中的哈希
+			file := f.File
+			if u, err := url.Parse(file); err == nil {
+				file = u.Path
+			}
+			file = errorBuildHashPattern.ReplaceAllString(file, ".")
+			fmt.Fprintf(h, "\x00%s:%s", errorDigitsPattern.ReplaceAllString(file, "0"), f.Function)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func readErrorGroup(file string) (*ErrorGroup, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	g := new(ErrorGroup)
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// postErrorHandler 处理 POST /api/errors，同样接受 sendBeacon 的 text/plain 请求
+func postErrorHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, errorMaxBytes)
+	var r ErrorReport
+	if err := json.NewDecoder(c.Request.Body).Decode(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if r.Type == "" {
+		r.Type = "error"
+	}
+	if r.Type != "error" && r.Type != "unhandledrejection" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "type must be error or unhandledrejection"})
+		return
+	}
+	if r.Release == "" {
+		r.Release = "unknown"
+	}
+	if !vitalsBuildPattern.MatchString(r.Release) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid release"})
+		return
+	}
+	if r.Message == "" && r.Stack == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "message or stack is required"})
+		return
+	}
+	frames := parseStack(r.Stack)
+	symbolicate(r.Release, frames)
+	fp := errorFingerprint(&r, frames)
+	now := time.Now().UTC()
+
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	g, err := readErrorGroup(errorGroupFile(fp))
+	if os.IsNotExist(err) {
+		if n, _ := filepath.Glob(filepath.Join(errorsRoot(), "*.json")); len(n) >= errorMaxGroups {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "too many error groups"})
+			return
+		}
+		g = &ErrorGroup{Fingerprint: fp, Type: r.Type, Name: r.Name, Releases: map[string]int{}, FirstSeen: now}
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	g.Count++
+	g.Releases[r.Release]++
+	g.Message, g.LastSeen, g.Release, g.Frames = r.Message, now, r.Release, frames
+	g.URL, g.UserAgent = r.URL, r.UserAgent
+	js, _ := json.Marshal(g)
+	if err := writeFileAtomic(errorGroupFile(fp), js, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"fingerprint": fp, "count": g.Count, "frames": frames})
+}
+
+// listErrorsHandler 处理 GET /api/errors?release=，按最近出现时间排序，不返回堆栈；
+// 带 release 时只列出该版本出现过的错误，count 为该版本的次数
+func listErrorsHandler(c *gin.Context) {
+	release := c.Query("release")
+	files, err := filepath.Glob(filepath.Join(errorsRoot(), "*.json"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	list := []*ErrorGroup{}
+	for _, f := range files {
+		g, err := readErrorGroup(f)
+		if err != nil {
+			continue
+		}
+		if release != "" {
+			if g.Releases[release] == 0 {
+				continue
+			}
+			g.Count = g.Releases[release]
+		}
+		g.Frames = nil
+		list = append(list, g)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].LastSeen.After(list[b].LastSeen) })
+	c.JSON(http.StatusOK, list)
+}
+
+// errorGroupHandler 处理 GET /api/errors/:fingerprint，按当前的 source map 重新还原堆栈，
+// 所以错误发生后才上传的 source map 也能生效
+func errorGroupHandler(c *gin.Context) {
+	fp := c.Param("fingerprint")
+	if !sceneIDPattern.MatchString(fp) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fingerprint"})
+		return
+	}
+	g, err := readErrorGroup(errorGroupFile(fp))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "error group not found"})
+		return
+	}
+	symbolicate(g.Release, g.Frames)
+	c.JSON(http.StatusOK, g)
+}
+
+// putSourceMapHandler 处理 PUT /api/sourcemaps/:release/*file，例如构建后上传
+// build/static/js/main.abc123.js.map 到 /api/sourcemaps/<release>/static/js/main.abc123.js.map
+func putSourceMapHandler(c *gin.Context) {
+	release, file := c.Param("release"), c.Param("file")
+	if !vitalsBuildPattern.MatchString(release) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid release"})
+		return
+	}
+	if !strings.HasSuffix(file, ".js.map") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file must end with .js.map"})
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, sourceMapMaxBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, err := parseSourceMap(data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	local := sourceMapFile(release, file)
+	if err := writeFileAtomic(local, data, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sourceMaps.Lock()
+	delete(sourceMaps.m, local)
+	sourceMaps.Unlock()
+	c.JSON(http.StatusOK, gin.H{"release": release, "file": path.Clean("/" + file), "sources": len(m.Sources), "names": len(m.Names), "lines": len(m.lines)})
+}
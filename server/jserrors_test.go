@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStack(t *testing.T) {
+	tests := []struct {
+		name  string
+		stack string
+		want  []StackFrame
+	}{
+		{"chrome", "TypeError: x is undefined\n    at render (https://example.com/static/js/main.1a2b.js:1:230)\n    at https://example.com/static/js/main.1a2b.js:2:15",
+			[]StackFrame{{Function: "render", File: "https://example.com/static/js/main.1a2b.js", Line: 1, Column: 230}, {File: "https://example.com/static/js/main.1a2b.js", Line: 2, Column: 15}}},
+		{"firefox", "render@https://example.com/main.js:1:230\n@https://example.com/main.js:3:4",
+			[]StackFrame{{Function: "render", File: "https://example.com/main.js", Line: 1, Column: 230}, {File: "https://example.com/main.js", Line: 3, Column: 4}}},
+		{"unrecognized lines", "Error: boom\n    at <anonymous>\n", []StackFrame{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseStack(tt.stack); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	long := strings.Repeat("    at f (https://example.com/a.js:1:1)\n", errorMaxFrames+10)
+	if got := len(parseStack(long)); got != errorMaxFrames {
+		t.Fatalf("kept %d frames, want %d", got, errorMaxFrames)
+	}
+}
+
+func TestErrorFingerprint(t *testing.T) {
+	base := &ErrorReport{Type: "error", Name: "TypeError", Message: "item 12 is undefined"}
+	frames := []StackFrame{{Function: "render", File: "https://example.com/static/js/main.1a2b.js?v=1", Line: 1, Column: 230}}
+	fp := errorFingerprint(base, frames)
+	tests := []struct {
+		name   string
+		report *ErrorReport
+		frames []StackFrame
+		same   bool
+	}{
+		{"other numbers in message", &ErrorReport{Type: "error", Name: "TypeError", Message: "item 345 is undefined"}, frames, true},
+		{"other line", base, []StackFrame{{Function: "render", File: frames[0].File, Line: 7, Column: 1}}, true},
+		{"other build hash", base, []StackFrame{{Function: "render", File: "https://example.com/static/js/main.9f8e.js?v=2"}}, true},
+		{"other bundle", base, []StackFrame{{Function: "render", File: "https://example.com/static/js/vendor.9f8e.js"}}, false},
+		{"other function", base, []StackFrame{{Function: "update", File: frames[0].File}}, false},
+		{"other type", &ErrorReport{Type: "unhandledrejection", Name: "TypeError", Message: base.Message}, frames, false},
+		{"original position wins", base, []StackFrame{{Function: "render", File: frames[0].File, Original: &OriginalPosition{Source: "src/App.tsx", Name: "render"}}}, false},
+	}
+	for _, tt := range tests {
+		if got := errorFingerprint(tt.report, tt.frames) == fp; got != tt.same {
+			t.Errorf("%s: same fingerprint = %v, want %v", tt.name, got, tt.same)
+		}
+	}
+}
+
+func TestSymbolicate(t *testing.T) {
+	setTestDataRoot(t)
+	setTestStateRoot(t)
+	file := sourceMapFile("v1", "/static/js/main.js.map")
+	os.MkdirAll(filepath.Dir(file), 0755)
+	os.WriteFile(file, []byte(`{"version":3,"sources":["a.ts"],"names":["f"],"mappings":"AAAA,IAAIA;;EACE"}`), 0644)
+	frames := []StackFrame{
+		{File: "https://example.com/static/js/main.js", Line: 1, Column: 6},
+		{File: "https://example.com/static/js/other.js", Line: 1, Column: 6},
+	}
+	symbolicate("v1", frames)
+	if o := frames[0].Original; o == nil || o.Source != "a.ts" || o.Name != "f" {
+		t.Fatalf("frame 0 original = %+v", o)
+	}
+	if frames[1].Original != nil {
+		t.Fatal("frame without a source map was symbolicated")
+	}
+	// 其它版本没有上传 source map
+	symbolicate("v2", frames)
+	if frames[0].Original != nil {
+		t.Fatal("stale original position was kept")
+	}
+}
+
+func TestSetStateRoot(t *testing.T) {
+	root := setTestDataRoot(t)
+	old := stateRoot
+	t.Cleanup(func() { stateRoot = old })
+	tests := []struct {
+		dir string
+		ok  bool
+	}{
+		{filepath.Join(filepath.Dir(root), "state"), true},
+		{root, false},
+		{filepath.Join(root, "state"), false},
+		{filepath.Join(root, "a", "..", "errors"), false},
+	}
+	for _, tt := range tests {
+		if err := setStateRoot(tt.dir); (err == nil) != tt.ok {
+			t.Errorf("setStateRoot(%s) = %v, want ok=%v", tt.dir, err, tt.ok)
+		}
+	}
+}
+
+func TestErrorsStoredOutsideData(t *testing.T) {
+	root := setTestDataRoot(t)
+	state := setTestStateRoot(t)
+	w := serveTest(http.MethodPut, "/api/sourcemaps/:release/*file", "/api/sourcemaps/v1/static/js/main.js.map",
+		`{"version":3,"sources":["a.ts"],"names":[],"mappings":"AAAA"}`, putSourceMapHandler)
+	if w.Code/100 != 2 {
+		t.Fatalf("upload status %d: %s", w.Code, w.Body)
+	}
+	w = serveTest(http.MethodPost, "/api/errors", "/api/errors",
+		`{"release":"v1","message":"boom","stack":"Error: boom\n    at https://example.com/static/js/main.js:1:1"}`, postErrorHandler)
+	if w.Code/100 != 2 {
+		t.Fatalf("report status %d: %s", w.Code, w.Body)
+	}
+	for _, dir := range []string{"errors", "sourcemaps"} {
+		if entries, err := os.ReadDir(filepath.Join(state, dir)); err != nil || len(entries) == 0 {
+			t.Errorf("%s not written to the state directory: %v", dir, err)
+		}
+		if _, err := os.Stat(filepath.Join(root, dir)); !os.IsNotExist(err) {
+			t.Errorf("%s written to the data directory", dir)
+		}
+	}
+	writeDataFiles(t, root, map[string]string{"errors/x.json": "{}"})
+	if got := legacyStateInData(); len(got) != 1 || got[0] != "errors" {
+		t.Errorf("legacyStateInData() = %q", got)
+	}
+}
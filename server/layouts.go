@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const layoutMaxBytes = 256 << 10
+
+// layoutPanelIDs 是前端已有的面板
+var layoutPanelIDs = map[string]bool{"try_func": true, "three_line": true, "text": true}
+
+// layoutsMu 串行化布局的写操作
+var layoutsMu sync.Mutex
+
+// PanelStyle 是一个面板的绝对定位，单位为像素
+type PanelStyle struct {
+	Left         float64 `json:"left" validate:"gte=0"`
+	Top          float64 `json:"top" validate:"gte=0"`
+	Width        float64 `json:"width" validate:"gt=0"`
+	Height       float64 `json:"height" validate:"gt=0"`
+	Border       string  `json:"border,omitempty" validate:"max=128"`
+	BorderRadius string  `json:"borderRadius,omitempty" validate:"max=32"`
+	Hidden       bool    `json:"hidden,omitempty"`
+}
+
+// LayoutVariant 在视口宽度不小于 MinWidth 时生效，取满足条件的最大 MinWidth
+type LayoutVariant struct {
+	MinWidth int `json:"minWidth" validate:"gte=0"`
+	// endkeys 后面必须再跟一个规则，否则 dive 只校验键，不会进入 PanelStyle
+	Panels map[string]PanelStyle `json:"panels" validate:"required,min=1,dive,keys,panelid,endkeys,required"`
+}
+
+// Layout 是一个命名布局；User 为空表示所有人共用
+type Layout struct {
+	Name     string          `json:"name"`
+	User     string          `json:"user,omitempty"`
+	Variants []LayoutVariant `json:"variants" validate:"required,min=1,max=16,dive"`
+	Updated  time.Time       `json:"updated"`
+}
+
+// LayoutResponse 附带布局的来源和按 width 选出的变体
+type LayoutResponse struct {
+	*Layout
+	Source string         `json:"source"` // user | shared | builtin
+	Active *LayoutVariant `json:"active,omitempty"`
+}
+
+// builtinLayouts 是原先写死在 src/distribute/position.tsx 中的主题，没有保存过布局时使用
+var builtinLayouts = map[string]*Layout{
+	"default": {Name: "default", Variants: []LayoutVariant{{
+		MinWidth: 0,
+		Panels: map[string]PanelStyle{
+			"try_func":   {Left: 10, Top: 5, Width: 400, Height: 500, Border: "1px solid rgb(180, 180, 180)", BorderRadius: "5px"},
+			"three_line": {Left: 10, Top: 5, Width: 400, Height: 500, Border: "1px solid rgb(180, 180, 180)", BorderRadius: "5px"},
+			"text":       {Left: 10, Top: 5, Width: 700, Height: 600, Border: "1px solid rgb(180, 180, 180)", BorderRadius: "5px"},
+		},
+	}}},
+}
+
+var layoutValidate = newLayoutValidator()
+
+func newLayoutValidator() *validator.Validate {
+	v := validator.New()
+	// 错误路径使用 JSON 字段名
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("panelid", func(fl validator.FieldLevel) bool {
+		return layoutPanelIDs[fl.Field().String()]
+	})
+	// 断点不能重复；放在结构体级别，这样各变体的字段错误也能一起报告
+	v.RegisterStructValidation(func(sl validator.StructLevel) {
+		l := sl.Current().Interface().(Layout)
+		seen := map[int]bool{}
+		for _, variant := range l.Variants {
+			if seen[variant.MinWidth] {
+				sl.ReportError(l.Variants, "variants", "Variants", "unique", "")
+				return
+			}
+			seen[variant.MinWidth] = true
+		}
+	}, Layout{})
+	return v
+}
+
+// layoutIssueCodes 把校验规则映射为与模型检查一致的问题代码
+var layoutIssueCodes = map[string]string{
+	"required": "REQUIRED",
+	"min":      "ARRAY_LENGTH",
+	"max":      "ARRAY_LENGTH",
+	"gt":       "VALUE_OUT_OF_RANGE",
+	"gte":      "VALUE_OUT_OF_RANGE",
+	"panelid":  "VALUE_NOT_IN_LIST",
+	"unique":   "DUPLICATE_BREAKPOINT",
+}
+
+// validateLayout 校验布局，错误位置转换为 JSON Pointer，例如 /variants/0/panels/text/width
+func validateLayout(l *Layout) []Issue {
+	err := layoutValidate.Struct(l)
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+	issues := make([]Issue, 0, len(verrs))
+	for _, e := range verrs {
+		// Namespace 形如 Layout.variants[0].panels[text].width
+		ns := strings.SplitN(e.Namespace(), ".", 2)
+		p := ""
+		if len(ns) == 2 {
+			p = "/" + strings.NewReplacer("[", "/", "]", "", ".", "/").Replace(ns[1])
+		}
+		code := layoutIssueCodes[e.Tag()]
+		if code == "" {
+			code = "INVALID_VALUE"
+		}
+		msg := fmt.Sprintf("failed %q validation", e.Tag())
+		switch e.Tag() {
+		case "panelid":
+			msg = fmt.Sprintf("unknown panel %q", e.Value())
+		case "unique":
+			msg = "minWidth must be unique across variants"
+		case "gt", "gte", "min", "max":
+			msg = fmt.Sprintf("must be %s %s", e.Tag(), e.Param())
+		}
+		issues = append(issues, Issue{Code: code, Pointer: p, Message: msg})
+	}
+	return issues
+}
+
+// activeVariant 选出 MinWidth 不超过视口宽度的最大变体，都不满足时用最小的
+func (l *Layout) activeVariant(width int) *LayoutVariant {
+	var best, smallest *LayoutVariant
+	for i := range l.Variants {
+		v := &l.Variants[i]
+		if v.MinWidth <= width && (best == nil || v.MinWidth > best.MinWidth) {
+			best = v
+		}
+		if smallest == nil || v.MinWidth < smallest.MinWidth {
+			smallest = v
+		}
+	}
+	if best == nil {
+		return smallest
+	}
+	return best
+}
+
+func (s store) layoutsRoot() string {
+	return filepath.Join(s.root, "layouts")
+}
+
+// layoutFile 返回布局的存放路径：共用布局在 layouts/<name>.json，个人布局在 layouts/users/<user>/<name>.json
+func (s store) layoutFile(user, name string) string {
+	if user == "" {
+		return filepath.Join(s.layoutsRoot(), name+".json")
+	}
+	return filepath.Join(s.layoutsRoot(), "users", user, name+".json")
+}
+
+func readLayout(file string) (*Layout, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	l := new(Layout)
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// layoutParams 检查路由中的布局名，并返回个人布局所属的用户：开启认证时为当前登录的用户，
+// 未开启认证或通过签名 URL 访问时为空，只使用共用布局。失败时直接写出错误响应
+func layoutParams(c *gin.Context) (name, user string, ok bool) {
+	name = c.Param("name")
+	if !projectNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid layout name"})
+		return "", "", false
+	}
+	if cl := currentUser(c); cl != nil {
+		user = cl.Subject
+		// 用户名会成为目录名，命令行签发的令牌也可能带任意 sub
+		if !userNamePattern.MatchString(user) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user"})
+			return "", "", false
+		}
+	}
+	return name, user, true
+}
+
+// getLayoutHandler 处理 GET /api/layouts/:name?width=，
+// 依次查找当前用户的个人布局、共用布局和内置布局；带 width 时同时返回生效的变体
+func getLayoutHandler(c *gin.Context) {
+	name, user, ok := layoutParams(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	resp := &LayoutResponse{}
+	if user != "" {
+		if l, err := readLayout(s.layoutFile(user, name)); err == nil {
+			resp.Layout, resp.Source = l, "user"
+		}
+	}
+	if resp.Layout == nil {
+		if l, err := readLayout(s.layoutFile("", name)); err == nil {
+			resp.Layout, resp.Source = l, "shared"
+		} else if l, ok := builtinLayouts[name]; ok {
+			resp.Layout, resp.Source = l, "builtin"
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": "layout not found"})
+			return
+		}
+	}
+	if w := c.Query("width"); w != "" {
+		width, err := strconv.Atoi(w)
+		if err != nil || width < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "width must be a non-negative integer"})
+			return
+		}
+		resp.Active = resp.Layout.activeVariant(width)
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, resp)
+}
+
+// putLayoutHandler 处理 PUT /api/layouts/:name，请求体为 {variants: [...]}；
+// 开启认证时保存为当前用户的个人布局，未开启时保存为共用布局
+func putLayoutHandler(c *gin.Context) {
+	name, user, ok := layoutParams(c)
+	if !ok {
+		return
+	}
+	saveLayout(c, name, user)
+}
+
+// putSharedLayoutHandler 处理 PUT /api/layouts/:name/shared，保存所有人共用的布局，需要 admin
+func putSharedLayoutHandler(c *gin.Context) {
+	name, _, ok := layoutParams(c)
+	if !ok {
+		return
+	}
+	saveLayout(c, name, "")
+}
+
+// saveLayout 读取请求体中的布局，校验后保存为 user 的个人布局，user 为空时为共用布局
+func saveLayout(c *gin.Context, name, user string) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, layoutMaxBytes)
+	l := new(Layout)
+	if err := json.NewDecoder(c.Request.Body).Decode(l); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	l.Name, l.User, l.Updated = name, user, time.Now().UTC()
+	if issues := validateLayout(l); len(issues) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid layout", "errors": issues})
+		return
+	}
+	js, _ := json.MarshalIndent(l, "", "  ")
+	layoutsMu.Lock()
+	defer layoutsMu.Unlock()
+	if err := writeFileAtomic(requestStore(c).layoutFile(user, name), js, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, l)
+}
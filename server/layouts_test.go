@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateLayout(t *testing.T) {
+	panel := PanelStyle{Width: 400, Height: 300}
+	tests := []struct {
+		name     string
+		variants []LayoutVariant
+		code     string
+		pointer  string
+	}{
+		{"valid", []LayoutVariant{{Panels: map[string]PanelStyle{"text": panel}}, {MinWidth: 1200, Panels: map[string]PanelStyle{"text": panel}}}, "", ""},
+		{"no variants", nil, "REQUIRED", "/variants"},
+		{"no panels", []LayoutVariant{{Panels: map[string]PanelStyle{}}}, "ARRAY_LENGTH", "/variants/0/panels"},
+		{"unknown panel", []LayoutVariant{{Panels: map[string]PanelStyle{"chart": panel}}}, "VALUE_NOT_IN_LIST", "/variants/0/panels/chart"},
+		{"zero width", []LayoutVariant{{Panels: map[string]PanelStyle{"text": {Height: 300}}}}, "VALUE_OUT_OF_RANGE", "/variants/0/panels/text/width"},
+		{"negative left", []LayoutVariant{{Panels: map[string]PanelStyle{"text": {Left: -1, Width: 400, Height: 300}}}}, "VALUE_OUT_OF_RANGE", "/variants/0/panels/text/left"},
+		{"negative breakpoint", []LayoutVariant{{MinWidth: -1, Panels: map[string]PanelStyle{"text": panel}}}, "VALUE_OUT_OF_RANGE", "/variants/0/minWidth"},
+		{"duplicate breakpoint", []LayoutVariant{{Panels: map[string]PanelStyle{"text": panel}}, {Panels: map[string]PanelStyle{"text": panel}}}, "DUPLICATE_BREAKPOINT", "/variants"},
+		{"too many variants", make([]LayoutVariant, 17), "ARRAY_LENGTH", "/variants"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := validateLayout(&Layout{Name: "x", Variants: tt.variants})
+			if tt.code == "" {
+				if len(issues) > 0 {
+					t.Fatalf("unexpected issues %+v", issues)
+				}
+				return
+			}
+			for _, is := range issues {
+				if is.Code == tt.code && is.Pointer == tt.pointer {
+					return
+				}
+			}
+			t.Fatalf("missing %s at %s in %+v", tt.code, tt.pointer, issues)
+		})
+	}
+}
+
+func TestActiveVariant(t *testing.T) {
+	l := &Layout{Variants: []LayoutVariant{{MinWidth: 800}, {MinWidth: 1200}, {MinWidth: 400}}}
+	tests := []struct{ width, want int }{
+		{0, 400}, // 都不满足时用最小的
+		{400, 400},
+		{1199, 800},
+		{5000, 1200},
+	}
+	for _, tt := range tests {
+		if got := l.activeVariant(tt.width).MinWidth; got != tt.want {
+			t.Errorf("activeVariant(%d) = %d, want %d", tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestLayoutHandlers(t *testing.T) {
+	setTestDataRoot(t)
+	const body = `{"variants":[{"minWidth":0,"panels":{"text":{"left":0,"top":0,"width":500,"height":400}}}]}`
+	tests := []struct {
+		name   string
+		method string
+		route  string
+		target string
+		user   string // 当前登录的用户，为空表示未开启认证
+		body   string
+		status int
+		source string
+	}{
+		{"builtin", http.MethodGet, "/api/layouts/:name", "/api/layouts/default", "", "", http.StatusOK, "builtin"},
+		{"unknown", http.MethodGet, "/api/layouts/:name", "/api/layouts/nope", "", "", http.StatusNotFound, ""},
+		{"bad name", http.MethodGet, "/api/layouts/:name", "/api/layouts/a.b", "", "", http.StatusBadRequest, ""},
+		{"invalid body", http.MethodPut, "/api/layouts/:name", "/api/layouts/default", "", `{"variants":[]}`, http.StatusUnprocessableEntity, ""},
+		{"save without auth is shared", http.MethodPut, "/api/layouts/:name", "/api/layouts/default", "", body, http.StatusOK, ""},
+		{"shared", http.MethodGet, "/api/layouts/:name", "/api/layouts/default?width=900", "", "", http.StatusOK, "shared"},
+		{"save personal", http.MethodPut, "/api/layouts/:name", "/api/layouts/default", "ann", body, http.StatusOK, ""},
+		{"personal", http.MethodGet, "/api/layouts/:name", "/api/layouts/default", "ann", "", http.StatusOK, "user"},
+		{"falls back to shared", http.MethodGet, "/api/layouts/:name", "/api/layouts/default", "bob", "", http.StatusOK, "shared"},
+		{"user query is ignored", http.MethodGet, "/api/layouts/:name", "/api/layouts/default?user=ann", "bob", "", http.StatusOK, "shared"},
+		{"invalid user", http.MethodPut, "/api/layouts/:name", "/api/layouts/default", "../ann", body, http.StatusBadRequest, ""},
+		{"save shared with auth", http.MethodPut, "/api/layouts/:name/shared", "/api/layouts/wide/shared", "ann", body, http.StatusOK, ""},
+		{"shared saved with auth", http.MethodGet, "/api/layouts/:name", "/api/layouts/wide", "bob", "", http.StatusOK, "shared"},
+		{"bad width", http.MethodGet, "/api/layouts/:name", "/api/layouts/default?width=-1", "", "", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := getLayoutHandler
+			switch {
+			case strings.HasSuffix(tt.route, "/shared"):
+				h = putSharedLayoutHandler
+			case tt.method == http.MethodPut:
+				h = putLayoutHandler
+			}
+			login := func(c *gin.Context) {
+				if tt.user != "" {
+					c.Set("claims", &Claims{Subject: tt.user, Role: roleEditor})
+				}
+			}
+			w := serveTest(tt.method, tt.route, tt.target, tt.body, login, h)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.source != "" {
+				var resp LayoutResponse
+				json.Unmarshal(w.Body.Bytes(), &resp)
+				if resp.Source != tt.source {
+					t.Fatalf("source %q, want %q", resp.Source, tt.source)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 日志级别
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// logger 输出分级的结构化日志，每条一行，格式为 text 或 json
+type logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	json  bool
+	level int
+}
+
+var appLog = &logger{out: os.Stderr, level: levelInfo}
+
+// setupLogging 按命令行参数配置日志；file 为空时写到标准错误，否则按大小轮转
+func setupLogging(format, level, file string, maxSize int64, backups int) error {
+	switch format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("log format must be text or json, got %q", format)
+	}
+	lv := -1
+	for i, name := range levelNames {
+		if name == level {
+			lv = i
+		}
+	}
+	if lv < 0 {
+		return fmt.Errorf("log level must be one of %s, got %q", strings.Join(levelNames, ", "), level)
+	}
+	var out io.Writer = os.Stderr
+	if file != "" {
+		rf, err := openRotatingFile(file, maxSize, backups)
+		if err != nil {
+			return err
+		}
+		out = rf
+	}
+	appLog.mu.Lock()
+	appLog.out, appLog.json, appLog.level = out, format == "json", lv
+	appLog.mu.Unlock()
+	// gin 自身的输出（调试信息、panic 堆栈）也进入日志
+	gin.DefaultWriter = logLineWriter{levelDebug}
+	gin.DefaultErrorWriter = logLineWriter{levelError}
+	return nil
+}
+
+// log 写一条日志，kv 为 键, 值, 键, 值 ...
+func (l *logger) log(level int, msg string, kv ...interface{}) {
+	if level < l.level {
+		return
+	}
+	now := time.Now().UTC()
+	var line []byte
+	if l.json {
+		// 保持 time、level、msg 在最前面，其余字段按传入顺序
+		var b strings.Builder
+		fmt.Fprintf(&b, `{"time":%q,"level":%q,"msg":%s`, now.Format(time.RFC3339Nano), levelNames[level], jsonString(msg))
+		for i := 0; i+1 < len(kv); i += 2 {
+			v, err := json.Marshal(logValue(kv[i+1]))
+			if err != nil {
+				v = jsonString(fmt.Sprint(kv[i+1]))
+			}
+			fmt.Fprintf(&b, `,%s:%s`, jsonString(fmt.Sprint(kv[i])), v)
+		}
+		b.WriteString("}\n")
+		line = []byte(b.String())
+	} else {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %-5s %s", now.Format("2006-01-02T15:04:05.000Z07:00"), strings.ToUpper(levelNames[level]), msg)
+		for i := 0; i+1 < len(kv); i += 2 {
+			v := fmt.Sprint(logValue(kv[i+1]))
+			if v == "" || strings.ContainsAny(v, " \"=\n") {
+				v = fmt.Sprintf("%q", v)
+			}
+			fmt.Fprintf(&b, " %v=%s", kv[i], v)
+		}
+		b.WriteByte('\n')
+		line = []byte(b.String())
+	}
+	l.mu.Lock()
+	l.out.Write(line)
+	l.mu.Unlock()
+}
+
+// logValue 把 error 转成字符串，否则 JSON 中会变成 {}
+func logValue(v interface{}) interface{} {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
+
+func jsonString(s string) []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+func logDebug(msg string, kv ...interface{}) { appLog.log(levelDebug, msg, kv...) }
+func logInfo(msg string, kv ...interface{})  { appLog.log(levelInfo, msg, kv...) }
+func logWarn(msg string, kv ...interface{})  { appLog.log(levelWarn, msg, kv...) }
+func logError(msg string, kv ...interface{}) { appLog.log(levelError, msg, kv...) }
+
+// requestLog 写一条带 request_id 的日志，用于处理请求过程中的日志
+func requestLog(c *gin.Context, level int, msg string, kv ...interface{}) {
+	appLog.log(level, msg, append([]interface{}{"request_id", requestID(c)}, kv...)...)
+}
+
+// recoveryMiddleware 替代 gin.Recovery：handler panic 时返回 500，并记录带 request_id 的错误和堆栈
+func recoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err interface{}) {
+		requestLog(c, levelError, "请求处理 panic", "error", fmt.Sprint(err), "stack", string(debug.Stack()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+// logLineWriter 把 gin 写出的文本按行转为日志
+type logLineWriter struct{ level int }
+
+func (w logLineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			appLog.log(w.level, line)
+		}
+	}
+	return len(p), nil
+}
+
+// requestID 返回当前请求的 id：沿用合法的 X-Request-ID 请求头，否则新生成一个
+func requestID(c *gin.Context) string {
+	if id := c.GetString("requestID"); id != "" {
+		return id
+	}
+	id := c.GetHeader("X-Request-ID")
+	if !requestIDPattern.MatchString(id) {
+		id = newJobID()
+	}
+	c.Set("requestID", id)
+	return id
+}
+
+// accessLogMiddleware 每个请求输出一行访问日志，替代 gin.Logger
+func accessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := requestID(c)
+		c.Header("X-Request-ID", id)
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0 // 没有写出响应体
+		}
+		level := levelInfo
+		switch {
+		case status >= 500:
+			level = levelError
+		case status >= 400:
+			level = levelWarn
+		}
+		kv := []interface{}{
+			"request_id", id,
+			"method", c.Request.Method,
+			"route", route,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", size,
+			"client_ip", c.ClientIP(),
+			"user_agent", c.Request.UserAgent(),
+		}
+		if len(c.Errors) > 0 {
+			kv = append(kv, "errors", c.Errors.String())
+		}
+		appLog.log(level, "request", kv...)
+	}
+}
+
+// rotatingFile 是按大小轮转的日志文件：超过 maxSize 时 app.log 改名为 app.log.1，旧的依次后移，保留 backups 个
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	f       *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("log file size limit must be positive")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, st.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	if err != nil {
+		return err
+	}
+	if r.backups > 0 {
+		for i := r.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			// 轮转失败时继续写原文件，不丢日志
+			fmt.Fprintln(os.Stderr, "log rotation failed:", err)
+			if r.f == nil {
+				if err := r.open(); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureLog 把 appLog 临时指向一个缓冲区
+func captureLog(t *testing.T, asJSON bool, level int) *bytes.Buffer {
+	var buf bytes.Buffer
+	appLog.mu.Lock()
+	out, js, lv := appLog.out, appLog.json, appLog.level
+	appLog.out, appLog.json, appLog.level = &buf, asJSON, level
+	appLog.mu.Unlock()
+	t.Cleanup(func() {
+		appLog.mu.Lock()
+		appLog.out, appLog.json, appLog.level = out, js, lv
+		appLog.mu.Unlock()
+	})
+	return &buf
+}
+
+func TestLogText(t *testing.T) {
+	tests := []struct {
+		level int
+		msg   string
+		kv    []interface{}
+		want  string
+	}{
+		{levelInfo, "started", []interface{}{"port", 5004}, " INFO  started port=5004\n"},
+		{levelWarn, "slow", []interface{}{"path", "/a b", "empty", ""}, ` WARN  slow path="/a b" empty=""` + "\n"},
+		{levelError, "failed", []interface{}{"err", errors.New("boom")}, " ERROR failed err=boom\n"},
+		{levelDebug, "hidden", nil, ""},
+	}
+	for _, tt := range tests {
+		buf := captureLog(t, false, levelInfo)
+		appLog.log(tt.level, tt.msg, tt.kv...)
+		got := buf.String()
+		if tt.want == "" {
+			if got != "" {
+				t.Errorf("%s: got %q, want nothing", tt.msg, got)
+			}
+			continue
+		}
+		if !strings.HasSuffix(got, tt.want) {
+			t.Errorf("%s: got %q, want suffix %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestLogJSON(t *testing.T) {
+	buf := captureLog(t, true, levelDebug)
+	logDebug("hello \"world\"", "n", 3, "err", errors.New("boom"), "tags", []string{"a"})
+	line := buf.String()
+	if !strings.HasPrefix(line, `{"time":`) || !strings.HasSuffix(line, "}\n") {
+		t.Fatalf("line %q", line)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["level"] != "debug" || m["msg"] != `hello "world"` || m["n"] != 3.0 || m["err"] != "boom" {
+		t.Fatalf("fields %v", m)
+	}
+}
+
+func TestSetupLoggingInvalid(t *testing.T) {
+	tests := []struct{ format, level string }{
+		{"xml", "info"},
+		{"text", "verbose"},
+	}
+	for _, tt := range tests {
+		if err := setupLogging(tt.format, tt.level, "", 0, 0); err == nil {
+			t.Errorf("setupLogging(%q, %q) succeeded", tt.format, tt.level)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		status int
+		keepID bool
+		level  string
+	}{
+		{"ok", "abc-123", http.StatusOK, true, "info"},
+		{"client error", "", http.StatusNotFound, false, "warn"},
+		{"server error", "bad id with spaces", http.StatusInternalServerError, false, "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t, true, levelInfo)
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(accessLogMiddleware())
+			r.GET("/api/items/:id", func(c *gin.Context) { c.Status(tt.status) })
+			req := httptest.NewRequest(http.MethodGet, "/api/items/7", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get("X-Request-ID")
+			if !requestIDPattern.MatchString(id) || (id == tt.header) != tt.keepID {
+				t.Fatalf("request id %q", id)
+			}
+			var m map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+				t.Fatal(err)
+			}
+			if m["level"] != tt.level || m["request_id"] != id || m["route"] != "/api/items/:id" ||
+				m["path"] != "/api/items/7" || m["status"] != float64(tt.status) {
+				t.Fatalf("fields %v", m)
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	r, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.f.Close()
+	for name, want := range map[string]string{
+		"app.log":   "dddddd\n",
+		"app.log.1": "cccccc\n",
+		"app.log.2": "bbbbbb\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(path), name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("app.log.3 exists: %v", err)
+	}
+	if _, err := openRotatingFile(path, 0, 1); err == nil {
+		t.Error("zero size limit accepted")
+	}
+}
@@ -1,22 +1,220 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// commands 是除启动服务以外的子命令，例如：tServer convert model.obj
+var commands = map[string]func(args []string) int{
+	"convert": runConvert,
+	"check":   runCheck,
+	"sign":    runSign,
+	"token":   runToken,
+	"passwd":  runPasswd,
+}
+
 func png(c *gin.Context) {
 	fmt.Println("ok")
 }
 func main() {
-	// 创建一个默认的路由引擎
-	r := gin.Default()
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+	addr := flag.String("addr", ":3000", "监听地址")
+	data := flag.String("data", "../data/", "静态资源根目录")
+	state := flag.String("state", "../state/", "服务自身数据（前端错误、source map、Web Vitals、渲染统计）的目录，不能放在 -data 目录内")
+	logFormat := flag.String("log-format", "text", "日志格式：text 或 json")
+	logLevel := flag.String("log-level", "info", "日志级别：debug、info、warn 或 error")
+	logFile := flag.String("log-file", "", "日志文件，为空时输出到标准错误")
+	logMaxSize := flag.Int64("log-max-size", 100, "日志文件超过多少 MB 时轮转")
+	logBackups := flag.Int("log-backups", 5, "轮转后保留的旧日志文件个数")
+	traceSlow := flag.Duration("trace-slow", 500*time.Millisecond, "超过该耗时的请求记为慢请求，0 表示不记录")
+	debugToken := flag.String("debug-token", os.Getenv("TSERVER_DEBUG_TOKEN"), "未开启认证时访问 /debug/ 诊断接口的令牌，为空时不开启；也可用环境变量 TSERVER_DEBUG_TOKEN 设置")
+	signKeys := flag.String("sign-keys", "", "签名 URL 的密钥文件，每行 \"kid base64密钥\"，第一把用于签名；收到 SIGHUP 时重新读取")
+	protect := flag.String("protect", "", "需要签名 URL 才能访问的 /data 路径模式，逗号分隔，例如 clients/*,nda")
+	signToken := flag.String("sign-token", os.Getenv("TSERVER_SIGN_TOKEN"), "调用 POST /api/signed-urls 的令牌，为空时不开启；也可用环境变量 TSERVER_SIGN_TOKEN 设置")
+	trustedProxies := flag.String("trusted-proxies", "", "信任其 X-Forwarded-For 的代理地址或网段，逗号分隔；为空时使用连接的对端地址")
+	authKey := flag.String("auth-key", "", "签发和校验登录令牌的 Ed25519 私钥（tServer token -genkey 生成），为空时不开启认证")
+	authUsers := flag.String("auth-users", "", "登录用的密码文件，每行 \"用户名:角色:bcrypt哈希\"（tServer passwd 生成）")
+	authTTL := flag.Duration("auth-ttl", 12*time.Hour, "登录令牌的有效期")
+	flag.Parse()
+	if err := setupLogging(*logFormat, *logLevel, *logFile, *logMaxSize<<20, *logBackups); err != nil {
+		fmt.Fprintln(os.Stderr, "日志参数无效：", err)
+		os.Exit(2)
+	}
+	if err := setDataRoot(*data); err != nil {
+		logError("数据目录无效", "dir", *data, "error", err)
+		return
+	}
+	if err := setStateRoot(*state); err != nil {
+		logError("状态目录无效", "dir", *state, "error", err)
+		os.Exit(2)
+	}
+	if dirs := legacyStateInData(); len(dirs) > 0 {
+		logWarn("数据目录中有旧版本保存的服务数据，可通过 /data 读取，请移到状态目录", "dirs", strings.Join(dirs, ","), "state", stateRoot)
+	}
+	if err := setupSigning(*signKeys, *protect); err != nil {
+		logError("签名 URL 配置无效", "error", err)
+		os.Exit(2)
+	}
+	if err := setupAuth(*authKey, *authUsers, *authTTL); err != nil {
+		logError("认证配置无效", "error", err)
+		os.Exit(2)
+	}
+	if authConfig.key == nil {
+		logWarn("未设置 -auth-key，所有接口可匿名访问")
+	}
+	setSlowTraceThreshold(*traceSlow)
+	startVitals()
+	startRenderStats()
+	// 创建路由引擎，访问日志由 accessLogMiddleware 输出
+	r := gin.New()
+	var proxies []string
+	if *trustedProxies != "" {
+		proxies = strings.Split(*trustedProxies, ",")
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		logError("-trusted-proxies 无效", "error", err)
+		os.Exit(2)
+	}
+	r.Use(accessLogMiddleware(), tracingMiddleware(), recoveryMiddleware(), metricsMiddleware())
+	// Prometheus 指标
+	r.GET("/metrics", metricsHandler)
+	// 存活和就绪探针
+	r.GET("/healthz", healthzHandler)
+	r.GET("/readyz", readyzHandler)
+	// pprof、构建信息、生效配置、goroutine 数量和最近的慢请求：开启认证时需要 admin，否则用 -debug-token
+	if authConfig.key != nil {
+		registerDebugRoutes(r.Group("/debug", requireRole(roleAdmin)))
+	} else if *debugToken != "" {
+		registerDebugRoutes(r.Group("/debug", bearerAuth("debug", *debugToken)))
+	} else {
+		logInfo("未设置调试令牌，/debug/ 未开启")
+	}
+	// 登录和当前用户
+	if authConfig.users != "" {
+		r.POST("/api/login", loginHandler)
+	}
+	r.POST("/api/logout", logoutHandler)
+	// 以下接口按角色分组：viewer 读取资源，editor 上传和编辑，admin 删除和管理；未开启认证时不检查
+	view := r.Group("/", requireRole(roleViewer))
+	edit := r.Group("/", requireRole(roleEditor))
+	admin := r.Group("/", requireRole(roleAdmin))
+	view.GET("/api/me", meHandler)
 	// 处理静态文件(这样处理后data文件夹里面的文件就可以被加载到浏览器中了)
 	// 例如：http://localhost:5004/pic/1.jpg
-	r.Static("/data", "../data/")
+	// -protect 匹配的路径需要签名 URL，例如 /data/clients/acme/car.glb?exp=…&kid=…&sig=…，有效的签名不再需要登录
+	r.Group("/data", hideProjects(), signedURLMiddleware(), requireRole(roleViewer)).Static("/", dataRoot)
+	// 签发签名 URL：开启认证时需要 editor，否则用 -sign-token
+	if authConfig.key != nil {
+		edit.POST("/api/signed-urls", signURLHandler)
+	} else if *signToken != "" {
+		r.POST("/api/signed-urls", bearerAuth("sign", *signToken), signURLHandler)
+	}
 	// 创建一个get请求
-	r.GET("png_", png)
-	fmt.Println("启动成功！")
-	r.Run(":3000")
+	view.GET("png_", png)
+	// 模型相关接口，例如：/api/models/car/car.glb/inspect
+	view.GET("/api/models/*path", modelAction)
+	edit.POST("/api/models/*path", modelPostAction)
+	// 资源依赖关系，例如：/api/assets/car/car.gltf/dependencies
+	view.GET("/api/assets/*path", assetAction)
+	// 场景打包：导出依赖闭包为 zip，导入见 /p/:project/api/bundles
+	view.GET("/api/bundles", exportBundleHandler)
+	// 场景、协作、书签、预设和布局；/p/:project/api/ 下有同样一套，存放在项目目录中
+	registerSceneRoutes(view.Group("/api"), edit.Group("/api"), admin.Group("/api"))
+	// 项目：独立的资源目录、场景、预设、布局和成员，例如 /p/acme/data/car/car.glb、/p/acme/api/scenes
+	view.GET("/api/projects", listProjectsHandler)
+	admin.POST("/api/projects", createProjectHandler)
+	pview := view.Group("/p/:project", projectAccess(roleViewer))
+	pedit := view.Group("/p/:project", projectAccess(roleEditor))
+	padmin := view.Group("/p/:project", projectAccess(roleAdmin))
+	pview.GET("", getProjectHandler)
+	padmin.PUT("/members", putProjectMembersHandler)
+	pview.GET("/data/*path", projectAssetHandler)
+	pedit.PUT("/data/*path", putProjectAssetHandler)
+	padmin.DELETE("/data/*path", deleteProjectAssetHandler)
+	pedit.POST("/api/bundles", importBundleHandler)
+	registerSceneRoutes(pview.Group("/api"), pedit.Group("/api"), padmin.Group("/api"))
+	// 点云切片，客户端按屏幕空间误差逐个请求节点
+	edit.POST("/api/pointclouds", ingestPointCloudHandler)
+	view.GET("/api/pointclouds", listPointCloudsHandler)
+	view.GET("/api/pointclouds/:id", pointCloudHandler)
+	view.GET("/api/pointclouds/:id/nodes/:node", pointCloudNodeHandler)
+	// 前端上报的 Web Vitals 及按页面、构建版本的统计
+	view.POST("/api/vitals", postVitalsHandler)
+	view.GET("/api/vitals/summary", vitalsSummaryHandler)
+	// three.js 渲染循环的帧时间和 renderer.info 统计，按场景、GPU 类别和版本比较
+	view.POST("/api/telemetry/render", postRenderStatsHandler)
+	view.GET("/api/telemetry/render/summary", renderSummaryHandler)
+	view.GET("/api/telemetry/render/regressions", renderRegressionsHandler)
+	// 前端错误上报，按指纹分组并用上传的 source map 还原堆栈
+	view.POST("/api/errors", postErrorHandler)
+	view.GET("/api/errors", listErrorsHandler)
+	view.GET("/api/errors/:fingerprint", errorGroupHandler)
+	admin.PUT("/api/sourcemaps/:release/*file", putSourceMapHandler)
+	// 后台任务进度
+	view.GET("/api/jobs", listJobsHandler)
+	view.GET("/api/jobs/:id", jobHandler)
+	// 先占用端口再报告启动成功，端口被占用时直接退出
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		logError("监听失败", "addr", *addr, "error", err)
+		os.Exit(1)
+	}
+	logInfo("启动成功！", "addr", ln.Addr().String(), "data", dataRoot, "state", stateRoot)
+	if err := r.RunListener(ln); err != nil {
+		logError("服务退出", "error", err)
+		os.Exit(1)
+	}
+}
+
+// registerSceneRoutes 注册场景、协作、书签、漫游、预设和布局接口，view、edit、admin 是按角色分好的 /api 分组
+func registerSceneRoutes(view, edit, admin *gin.RouterGroup) {
+	// three.js 场景（Object3D.toJSON 格式）
+	view.GET("/scenes", listScenesHandler)
+	edit.POST("/scenes", createSceneHandler)
+	view.GET("/scenes/:id", getSceneHandler)
+	view.GET("/scenes/:id/meta", sceneMetaHandler)
+	view.GET("/scenes/:id/thumbnail.png", sceneThumbnailHandler)
+	edit.PUT("/scenes/:id", updateSceneHandler)
+	admin.DELETE("/scenes/:id", deleteSceneHandler)
+	// 多人协作编辑场景（WebSocket）
+	edit.GET("/scenes/:id/collab", collabHandler)
+	// 在线用户的相机、选择和指针（WebSocket），普通 GET 返回在线列表
+	view.GET("/scenes/:id/presence", presenceHandler)
+	// 相机书签和漫游路线，路线可按帧率预先采样为相机位姿
+	view.GET("/scenes/:id/bookmarks", listBookmarksHandler)
+	edit.POST("/scenes/:id/bookmarks", createBookmarkHandler)
+	view.GET("/scenes/:id/bookmarks/:bid", getBookmarkHandler)
+	edit.PUT("/scenes/:id/bookmarks/:bid", updateBookmarkHandler)
+	admin.DELETE("/scenes/:id/bookmarks/:bid", deleteBookmarkHandler)
+	view.GET("/scenes/:id/tours", listToursHandler)
+	edit.POST("/scenes/:id/tours", createTourHandler)
+	view.GET("/scenes/:id/tours/:tid", getTourHandler)
+	view.GET("/scenes/:id/tours/:tid/path", tourPathHandler)
+	edit.PUT("/scenes/:id/tours/:tid", updateTourHandler)
+	admin.DELETE("/scenes/:id/tours/:tid", deleteTourHandler)
+	// lil-gui 参数预设，按场景和 GUI 文件夹保存，可导入导出
+	view.GET("/presets", listPresetsHandler)
+	edit.POST("/presets", createPresetHandler)
+	view.GET("/presets/export", exportPresetsHandler)
+	edit.POST("/presets/import", importPresetsHandler)
+	view.GET("/presets/:id", getPresetHandler)
+	view.GET("/presets/:id/state", presetStateHandler)
+	view.GET("/presets/:id/diff", presetDiffHandler)
+	edit.PUT("/presets/:id", updatePresetHandler)
+	admin.DELETE("/presets/:id", deletePresetHandler)
+	// 前端面板布局：个人布局属于当前登录的用户，共用布局由 admin 保存
+	view.GET("/layouts/:name", getLayoutHandler)
+	edit.PUT("/layouts/:name", putLayoutHandler)
+	admin.PUT("/layouts/:name/shared", putSharedLayoutHandler)
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// meshData 是各种导入格式共用的中间网格：共享顶点数组，按材质分组的三角形索引
+type meshData struct {
+	Positions []float32 // xyz
+	Normals   []float32 // xyz，可为空
+	UVs       []float32 // uv，glTF 约定（v 轴向下），可为空
+	Colors    []float32 // rgb，可为空
+	Groups    []meshGroup
+	Materials []meshMaterial
+
+	GeneratedNormals bool // 法线是否由转换器补算
+}
+
+type meshGroup struct {
+	Name     string
+	Material int // -1 表示无材质
+	Indices  []uint32
+}
+
+// meshMaterial 是从 MTL 等格式换算过来的 PBR 材质，贴图路径为本地文件路径
+type meshMaterial struct {
+	Name         string
+	BaseColor    [4]float64
+	Metallic     float64
+	Roughness    float64
+	Emissive     [3]float64
+	BaseColorMap string
+	NormalMap    string
+	EmissiveMap  string
+	DoubleSided  bool
+}
+
+func defaultMeshMaterial(name string) meshMaterial {
+	return meshMaterial{Name: name, BaseColor: [4]float64{0.8, 0.8, 0.8, 1}, Roughness: 1}
+}
+
+func (m *meshData) vertexCount() int {
+	return len(m.Positions) / 3
+}
+
+func (m *meshData) triangleCount() int {
+	n := 0
+	for _, g := range m.Groups {
+		n += len(g.Indices) / 3
+	}
+	return n
+}
+
+// faceNormal 返回三角形未归一化的法线（长度为面积的两倍）
+func faceNormal(p []float32, a, b, c uint32) [3]float64 {
+	ax, ay, az := float64(p[3*a]), float64(p[3*a+1]), float64(p[3*a+2])
+	ux, uy, uz := float64(p[3*b])-ax, float64(p[3*b+1])-ay, float64(p[3*b+2])-az
+	vx, vy, vz := float64(p[3*c])-ax, float64(p[3*c+1])-ay, float64(p[3*c+2])-az
+	return [3]float64{uy*vz - uz*vy, uz*vx - ux*vz, ux*vy - uy*vx}
+}
+
+func normalize3(v [3]float64) [3]float64 {
+	l := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	if l == 0 {
+		return [3]float64{0, 0, 1}
+	}
+	return [3]float64{v[0] / l, v[1] / l, v[2] / l}
+}
+
+// computeNormals 按面积加权生成平滑顶点法线
+func (m *meshData) computeNormals() {
+	acc := make([][3]float64, m.vertexCount())
+	for _, g := range m.Groups {
+		for t := 0; t+2 < len(g.Indices); t += 3 {
+			a, b, c := g.Indices[t], g.Indices[t+1], g.Indices[t+2]
+			n := faceNormal(m.Positions, a, b, c)
+			for _, i := range [3]uint32{a, b, c} {
+				acc[i][0] += n[0]
+				acc[i][1] += n[1]
+				acc[i][2] += n[2]
+			}
+		}
+	}
+	m.Normals = make([]float32, 3*len(acc))
+	for i, n := range acc {
+		n = normalize3(n)
+		m.Normals[3*i], m.Normals[3*i+1], m.Normals[3*i+2] = float32(n[0]), float32(n[1]), float32(n[2])
+	}
+}
+
+// textureOptions 控制转换时贴图的处理方式
+type textureOptions struct {
+	Embed  bool   // true 时把图片写入 GLB，否则引用相对路径
+	OutDir string // 输出文件所在目录，引用路径相对于它计算
+}
+
+// meshTextureReport 记录转换中每张贴图的处理结果
+type meshTextureReport struct {
+	Source   string `json:"source"`
+	URI      string `json:"uri,omitempty"`
+	Embedded bool   `json:"embedded"`
+	Missing  bool   `json:"missing,omitempty"`
+}
+
+// toGLTF 把中间网格写入构建器，返回贴图处理结果和警告
+func (m *meshData) toGLTF(b *gltfBuilder, name string, opts textureOptions) ([]meshTextureReport, []string) {
+	var warnings []string
+	var reports []meshTextureReport
+	textures := map[string]int{} // 本地路径 -> 纹理索引，-1 表示不可用
+
+	texture := func(file string) *GLTFTextureInfo {
+		if file == "" {
+			return nil
+		}
+		if t, ok := textures[file]; ok {
+			if t < 0 {
+				return nil
+			}
+			return &GLTFTextureInfo{Index: t}
+		}
+		rep := meshTextureReport{Source: dataRelPath(file), Embedded: opts.Embed}
+		data, err := os.ReadFile(file)
+		if err != nil || !withinRoot(file) {
+			rep.Missing, rep.Embedded = true, false
+			reports = append(reports, rep)
+			warnings = append(warnings, "texture not found: "+dataRelPath(file))
+			textures[file] = -1
+			return nil
+		}
+		var img int
+		if opts.Embed {
+			img = b.addImage(data, imageMimeType(file, data), filepath.Base(file))
+		} else {
+			rel, err := filepath.Rel(opts.OutDir, file)
+			if err != nil {
+				rel = file
+			}
+			rep.URI = uriEscapePath(filepath.ToSlash(rel))
+			img = b.addImageURI(rep.URI, filepath.Base(file))
+		}
+		reports = append(reports, rep)
+		t := b.addTexture(img)
+		textures[file] = t
+		return &GLTFTextureInfo{Index: t}
+	}
+
+	matIndex := make([]int, len(m.Materials))
+	for i, mm := range m.Materials {
+		mat := GLTFMaterial{
+			Name: mm.Name,
+			PBRMetallicRoughness: &GLTFPBR{
+				BaseColorFactor:  mm.BaseColor[:],
+				MetallicFactor:   floatPtr(mm.Metallic),
+				RoughnessFactor:  floatPtr(mm.Roughness),
+				BaseColorTexture: texture(mm.BaseColorMap),
+			},
+			NormalTexture:   texture(mm.NormalMap),
+			EmissiveTexture: texture(mm.EmissiveMap),
+			DoubleSided:     mm.DoubleSided,
+		}
+		if mm.Emissive != [3]float64{} || mat.EmissiveTexture != nil {
+			mat.EmissiveFactor = mm.Emissive[:]
+			if mat.EmissiveTexture != nil && mm.Emissive == [3]float64{} {
+				mat.EmissiveFactor = []float64{1, 1, 1}
+			}
+		}
+		if mm.BaseColor[3] < 1 {
+			mat.AlphaMode = "BLEND"
+		}
+		b.doc.Materials = append(b.doc.Materials, mat)
+		matIndex[i] = len(b.doc.Materials) - 1
+	}
+
+	attrs := map[string]int{"POSITION": b.addFloatAccessor(m.Positions, "VEC3", true)}
+	if len(m.Normals) > 0 {
+		attrs["NORMAL"] = b.addFloatAccessor(m.Normals, "VEC3", false)
+	}
+	if len(m.UVs) > 0 {
+		attrs["TEXCOORD_0"] = b.addFloatAccessor(m.UVs, "VEC2", false)
+	}
+	if len(m.Colors) > 0 {
+		attrs["COLOR_0"] = b.addFloatAccessor(m.Colors, "VEC3", false)
+	}
+
+	mesh := GLTFMesh{Name: name}
+	for _, g := range m.Groups {
+		if len(g.Indices) == 0 {
+			continue
+		}
+		idx := b.addIndexAccessor(g.Indices)
+		p := GLTFPrimitive{Attributes: attrs, Indices: &idx}
+		if g.Material >= 0 {
+			mi := matIndex[g.Material]
+			p.Material = &mi
+		}
+		mesh.Primitives = append(mesh.Primitives, p)
+	}
+	b.doc.Meshes = append(b.doc.Meshes, mesh)
+	meshIdx := len(b.doc.Meshes) - 1
+	b.doc.Nodes = append(b.doc.Nodes, GLTFNode{Name: name, Mesh: &meshIdx})
+	scene := 0
+	b.doc.Scene = &scene
+	b.doc.Scenes = []GLTFScene{{Nodes: []int{len(b.doc.Nodes) - 1}}}
+	return reports, warnings
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// imageMimeType 根据文件头（其次扩展名）判断图片 MIME 类型
+func imageMimeType(file string, data []byte) string {
+	switch {
+	case len(data) >= 8 && string(data[:8]) == "\x89PNG\r\n\x1a\n":
+		return "image/png"
+	case len(data) >= 3 && data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF:
+		return "image/jpeg"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".webp":
+		return "image/webp"
+	case ".ktx2":
+		return "image/ktx2"
+	}
+	return "application/octet-stream"
+}
+
+// uriEscapePath 对相对路径中的特殊字符做百分号编码，保留斜杠
+func uriEscapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, s := range parts {
+		parts[i] = url.PathEscape(s)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,818 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// EXT_meshopt_compression 的码流实现（与 meshoptimizer / three.js MeshoptDecoder 兼容）：
+// 顶点缓冲使用 ATTRIBUTES 模式（版本 0），三角形索引使用 TRIANGLES 模式（版本 1），
+// 其它索引使用 INDICES 模式。只支持 filter 为 NONE 的数据。
+
+const extMeshopt = "EXT_meshopt_compression"
+
+const (
+	meshoptVertexHeader   = 0xa0
+	meshoptIndexHeader    = 0xe0
+	meshoptSequenceHeader = 0xd0
+	meshoptByteGroup      = 16
+	meshoptVertexTail     = 32
+	meshoptIndexTail      = 16
+)
+
+// meshoptCodeAux 是三角形编码中两个顶点 FIFO 下标组合的常用值表，随码流写在末尾
+var meshoptCodeAux = [16]byte{0x00, 0x76, 0x87, 0x56, 0x67, 0x78, 0xa9, 0x86, 0x65, 0x89, 0x68, 0x98, 0x01, 0x69, 0, 0}
+
+// MeshoptView 是 bufferView 上 EXT_meshopt_compression 扩展的内容
+type MeshoptView struct {
+	Buffer     int    `json:"buffer"`
+	ByteOffset int    `json:"byteOffset,omitempty"`
+	ByteLength int    `json:"byteLength"`
+	ByteStride int    `json:"byteStride"`
+	Count      int    `json:"count"`
+	Mode       string `json:"mode"`
+	Filter     string `json:"filter,omitempty"`
+}
+
+// isMeshoptFallback 判断缓冲是否为不含数据的 meshopt 回退占位缓冲
+func isMeshoptFallback(b GLTFBuffer) bool {
+	raw, ok := b.Extensions[extMeshopt]
+	if !ok || b.URI != "" {
+		return false
+	}
+	var ext struct {
+		Fallback bool `json:"fallback"`
+	}
+	return json.Unmarshal(raw, &ext) == nil && ext.Fallback
+}
+
+// decodeMeshoptView 解压一个带 EXT_meshopt_compression 的 bufferView
+func (f *GLTFFile) decodeMeshoptView(i int, raw json.RawMessage) ([]byte, error) {
+	if data, ok := f.decoded[i]; ok {
+		return data, nil
+	}
+	var ext MeshoptView
+	if err := json.Unmarshal(raw, &ext); err != nil {
+		return nil, fmt.Errorf("bufferView %d: %s: %v", i, extMeshopt, err)
+	}
+	if ext.Buffer < 0 || ext.Buffer >= len(f.Buffers) || f.Buffers[ext.Buffer] == nil {
+		return nil, fmt.Errorf("bufferView %d: compressed buffer %d unavailable", i, ext.Buffer)
+	}
+	buf := f.Buffers[ext.Buffer]
+	if !sliceInBounds(ext.ByteOffset, ext.ByteLength, len(buf)) {
+		return nil, fmt.Errorf("bufferView %d: compressed data exceeds buffer %d", i, ext.Buffer)
+	}
+	// 解码后的大小是 count*byteStride，先检查再分配
+	if ext.Count < 0 || ext.ByteStride <= 0 || ext.Count > gltfMaxDecodedBytes/ext.ByteStride {
+		return nil, fmt.Errorf("bufferView %d: invalid %s count %d or byteStride %d", i, extMeshopt, ext.Count, ext.ByteStride)
+	}
+	if ext.Filter != "" && ext.Filter != "NONE" {
+		return nil, fmt.Errorf("bufferView %d: meshopt filter %s is not supported", i, ext.Filter)
+	}
+	src := buf[ext.ByteOffset : ext.ByteOffset+ext.ByteLength]
+	var data []byte
+	var err error
+	switch ext.Mode {
+	case "ATTRIBUTES":
+		data, err = decodeMeshoptVertices(src, ext.Count, ext.ByteStride)
+	case "TRIANGLES":
+		data, err = decodeMeshoptTriangles(src, ext.Count, ext.ByteStride)
+	case "INDICES":
+		data, err = decodeMeshoptIndices(src, ext.Count, ext.ByteStride)
+	default:
+		err = fmt.Errorf("unknown mode %q", ext.Mode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bufferView %d: %s: %v", i, extMeshopt, err)
+	}
+	if f.decoded == nil {
+		f.decoded = map[int][]byte{}
+	}
+	f.decoded[i] = data
+	return data, nil
+}
+
+// meshoptBlockSize 返回一个顶点块的元素数：块不超过 8KB，且为 16 的倍数
+func meshoptBlockSize(stride int) int {
+	n := (8192 / stride) &^ (meshoptByteGroup - 1)
+	if n > 256 {
+		n = 256
+	}
+	return n
+}
+
+// encodeMeshoptVertices 按字节位置对相邻元素做差分和 zigzag，再按 16 字节一组变长打包
+func encodeMeshoptVertices(data []byte, count, stride int) []byte {
+	out := []byte{meshoptVertexHeader}
+	first := make([]byte, stride)
+	if count > 0 {
+		copy(first, data[:stride])
+	}
+	last := append([]byte(nil), first...)
+	block := meshoptBlockSize(stride)
+	buf := make([]byte, 256)
+	for off := 0; off < count; off += block {
+		n := count - off
+		if n > block {
+			n = block
+		}
+		padded := (n + meshoptByteGroup - 1) &^ (meshoptByteGroup - 1)
+		for k := 0; k < stride; k++ {
+			for i := range buf[:padded] {
+				buf[i] = 0
+			}
+			p := last[k]
+			for i := 0; i < n; i++ {
+				v := data[(off+i)*stride+k]
+				d := v - p
+				buf[i] = d<<1 ^ byte(int8(d)>>7)
+				p = v
+			}
+			out = meshoptEncodeBytes(out, buf[:padded])
+		}
+		copy(last, data[(off+n-1)*stride:(off+n)*stride])
+	}
+	// 末尾写入第一个元素作为差分基准，不足 32 字节时在前面补 0
+	if stride < meshoptVertexTail {
+		out = append(out, make([]byte, meshoptVertexTail-stride)...)
+	}
+	return append(out, first...)
+}
+
+// meshoptEncodeBytes 为每组 16 个字节选择 0/2/4/8 位中最短的编码
+func meshoptEncodeBytes(out, buf []byte) []byte {
+	groups := len(buf) / meshoptByteGroup
+	header := len(out)
+	out = append(out, make([]byte, (groups+3)/4)...)
+	bitsTable := [4]int{0, 2, 4, 8}
+	for g := 0; g < groups; g++ {
+		group := buf[g*meshoptByteGroup : (g+1)*meshoptByteGroup]
+		best, bestSize := 3, meshoptByteGroup
+		for k := 0; k < 3; k++ {
+			if size := meshoptGroupSize(group, bitsTable[k]); size < bestSize {
+				best, bestSize = k, size
+			}
+		}
+		out[header+g/4] |= byte(best << uint(g%4*2))
+		out = meshoptEncodeGroup(out, group, bitsTable[best])
+	}
+	return out
+}
+
+func meshoptGroupSize(group []byte, bits int) int {
+	if bits == 0 {
+		for _, b := range group {
+			if b != 0 {
+				return 1 << 30
+			}
+		}
+		return 0
+	}
+	size := meshoptByteGroup * bits / 8
+	sentinel := byte(1<<uint(bits) - 1)
+	for _, b := range group {
+		if b >= sentinel {
+			size++
+		}
+	}
+	return size
+}
+
+// meshoptEncodeGroup 写入定长部分（每值 bits 位，高位在前），超出范围的值用全 1 占位后跟完整字节
+func meshoptEncodeGroup(out, group []byte, bits int) []byte {
+	switch bits {
+	case 0:
+		return out
+	case 8:
+		return append(out, group...)
+	}
+	per := 8 / bits
+	sentinel := byte(1<<uint(bits) - 1)
+	for i := 0; i < meshoptByteGroup; i += per {
+		var b byte
+		for k := 0; k < per; k++ {
+			v := group[i+k]
+			if v >= sentinel {
+				v = sentinel
+			}
+			b = b<<uint(bits) | v
+		}
+		out = append(out, b)
+	}
+	for _, v := range group {
+		if v >= sentinel {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func decodeMeshoptVertices(src []byte, count, stride int) ([]byte, error) {
+	if stride <= 0 || stride > 256 || stride%4 != 0 {
+		return nil, fmt.Errorf("invalid byteStride %d", stride)
+	}
+	tail := stride
+	if tail < meshoptVertexTail {
+		tail = meshoptVertexTail
+	}
+	if len(src) < 1+tail {
+		return nil, errors.New("stream too short")
+	}
+	if src[0] != meshoptVertexHeader {
+		return nil, fmt.Errorf("unsupported vertex stream header 0x%02x", src[0])
+	}
+	last := append([]byte(nil), src[len(src)-stride:]...)
+	data := src[1 : len(src)-tail]
+	out := make([]byte, count*stride)
+	block := meshoptBlockSize(stride)
+	buf := make([]byte, 256)
+	pos := 0
+	var err error
+	for off := 0; off < count; off += block {
+		n := count - off
+		if n > block {
+			n = block
+		}
+		padded := (n + meshoptByteGroup - 1) &^ (meshoptByteGroup - 1)
+		for k := 0; k < stride; k++ {
+			if pos, err = meshoptDecodeBytes(data, pos, buf[:padded]); err != nil {
+				return nil, err
+			}
+			p := last[k]
+			for i := 0; i < n; i++ {
+				z := buf[i]
+				p += z>>1 ^ -(z & 1)
+				out[(off+i)*stride+k] = p
+			}
+		}
+		copy(last, out[(off+n-1)*stride:(off+n)*stride])
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("%d unexpected bytes after vertex data", len(data)-pos)
+	}
+	return out, nil
+}
+
+func meshoptDecodeBytes(data []byte, pos int, buf []byte) (int, error) {
+	groups := len(buf) / meshoptByteGroup
+	hsize := (groups + 3) / 4
+	if pos+hsize > len(data) {
+		return 0, errors.New("truncated byte group header")
+	}
+	header := data[pos : pos+hsize]
+	pos += hsize
+	for g := 0; g < groups; g++ {
+		group := buf[g*meshoptByteGroup : (g+1)*meshoptByteGroup]
+		switch header[g/4] >> uint(g%4*2) & 3 {
+		case 0:
+			for i := range group {
+				group[i] = 0
+			}
+		case 3:
+			if pos+meshoptByteGroup > len(data) {
+				return 0, errors.New("truncated byte group")
+			}
+			copy(group, data[pos:])
+			pos += meshoptByteGroup
+		default:
+			bits := 2
+			if header[g/4]>>uint(g%4*2)&3 == 2 {
+				bits = 4
+			}
+			per := 8 / bits
+			sentinel := byte(1<<uint(bits) - 1)
+			extra := pos + meshoptByteGroup*bits/8
+			if extra > len(data) {
+				return 0, errors.New("truncated byte group")
+			}
+			for i := range group {
+				v := data[pos+i/per] >> uint(8-bits*(i%per+1)) & sentinel
+				if v == sentinel {
+					if extra >= len(data) {
+						return 0, errors.New("truncated byte group")
+					}
+					v = data[extra]
+					extra++
+				}
+				group[i] = v
+			}
+			pos = extra
+		}
+	}
+	return pos, nil
+}
+
+func appendVByte(out []byte, v uint32) []byte {
+	for {
+		if v > 127 {
+			out = append(out, byte(v&127|128))
+		} else {
+			return append(out, byte(v))
+		}
+		v >>= 7
+	}
+}
+
+func readVByte(data []byte, pos *int) (uint32, error) {
+	var v uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		if *pos >= len(data) {
+			return 0, errors.New("truncated varint")
+		}
+		b := data[*pos]
+		*pos++
+		v |= uint32(b&127) << shift
+		if b < 128 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("varint too long")
+}
+
+// appendIndexDelta 以 zigzag varint 写入相对上一个显式索引的差值
+func appendIndexDelta(out []byte, index, last uint32) []byte {
+	d := index - last
+	return appendVByte(out, d<<1^uint32(int32(d)>>31))
+}
+
+func readIndexDelta(data []byte, pos *int, last uint32) (uint32, error) {
+	v, err := readVByte(data, pos)
+	if err != nil {
+		return 0, err
+	}
+	return last + (v>>1 ^ -(v & 1)), nil
+}
+
+// meshoptFifo 是三角形编码中使用的 16 项顶点/边环形队列
+type meshoptFifo struct {
+	verts [16]uint32
+	edges [16][2]uint32
+	voff  int
+	eoff  int
+}
+
+func newMeshoptFifo() *meshoptFifo {
+	q := &meshoptFifo{}
+	for i := range q.verts {
+		q.verts[i] = ^uint32(0)
+		q.edges[i] = [2]uint32{^uint32(0), ^uint32(0)}
+	}
+	return q
+}
+
+func (q *meshoptFifo) pushVertex(v uint32, cond bool) {
+	q.verts[q.voff] = v
+	if cond {
+		q.voff = (q.voff + 1) & 15
+	}
+}
+
+func (q *meshoptFifo) pushEdge(a, b uint32) {
+	q.edges[q.eoff] = [2]uint32{a, b}
+	q.eoff = (q.eoff + 1) & 15
+}
+
+// vertex 返回 v 在队列中距最新一项的位置，不存在时返回 -1
+func (q *meshoptFifo) vertex(v uint32) int {
+	for i := 0; i < 16; i++ {
+		if q.verts[(q.voff-1-i)&15] == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// edge 查找三角形的某条边，返回 位置<<2 | 旋转
+func (q *meshoptFifo) edge(a, b, c uint32) int {
+	for i := 0; i < 16; i++ {
+		e := q.edges[(q.eoff-1-i)&15]
+		switch {
+		case e[0] == a && e[1] == b:
+			return i << 2
+		case e[0] == b && e[1] == c:
+			return i<<2 | 1
+		case e[0] == c && e[1] == a:
+			return i<<2 | 2
+		}
+	}
+	return -1
+}
+
+var meshoptTriangleOrder = [3][3]int{{0, 1, 2}, {1, 2, 0}, {2, 0, 1}}
+
+// encodeMeshoptTriangles 用边/顶点 FIFO 编码三角形列表（会保持绕序地旋转三角形）
+func encodeMeshoptTriangles(idx []uint32) []byte {
+	const fecmax = 13
+	ntri := len(idx) / 3
+	code := make([]byte, ntri)
+	var out []byte // 三角形代码之后的附加数据：codeaux 字节和显式索引
+	q := newMeshoptFifo()
+	var next, last uint32
+	for t := 0; t < ntri; t++ {
+		tri := idx[3*t : 3*t+3]
+		if fer := q.edge(tri[0], tri[1], tri[2]); fer >= 0 && fer>>2 < 15 {
+			order := meshoptTriangleOrder[fer&3]
+			a, b, c := tri[order[0]], tri[order[1]], tri[order[2]]
+			fe := fer >> 2
+			fc := q.vertex(c)
+			var fec int
+			switch {
+			case fc >= 1 && fc < fecmax:
+				fec = fc
+			case c == next:
+				fec = 0
+				next++
+			default:
+				fec = 15
+				if c+1 == last {
+					fec, last = 13, c
+				} else if c == last+1 {
+					fec, last = 14, c
+				}
+			}
+			code[t] = byte(fe<<4 | fec)
+			if fec == 15 {
+				out = appendIndexDelta(out, c, last)
+				last = c
+			}
+			if fec == 0 || fec >= fecmax {
+				q.pushVertex(c, true)
+			}
+			q.pushEdge(c, b)
+			q.pushEdge(a, c)
+			continue
+		}
+
+		rot := 0
+		if tri[1] == next {
+			rot = 1
+		} else if tri[2] == next {
+			rot = 2
+		}
+		order := meshoptTriangleOrder[rot]
+		a, b, c := tri[order[0]], tri[order[1]], tri[order[2]]
+		fb, fc := q.vertex(b), q.vertex(c)
+		fea := 15
+		if a == next {
+			fea = 0
+			next++
+		}
+		feb := 15
+		if fb >= 0 && fb < 14 {
+			feb = fb + 1
+		} else if b == next {
+			feb = 0
+			next++
+		}
+		fec := 15
+		if fc >= 0 && fc < 14 {
+			fec = fc + 1
+		} else if c == next {
+			fec = 0
+			next++
+		}
+		aux := byte(feb<<4 | fec)
+		auxIndex := -1
+		for k := 0; k < 14; k++ {
+			if meshoptCodeAux[k] == aux {
+				auxIndex = k
+				break
+			}
+		}
+		if fea == 0 && auxIndex >= 0 {
+			code[t] = byte(0xf0 | auxIndex)
+		} else {
+			code[t] = 0xfe
+			if fea == 15 {
+				code[t] = 0xff
+			}
+			out = append(out, aux)
+		}
+		if fea == 15 {
+			out = appendIndexDelta(out, a, last)
+			last = a
+		}
+		if feb == 15 {
+			out = appendIndexDelta(out, b, last)
+			last = b
+		}
+		if fec == 15 {
+			out = appendIndexDelta(out, c, last)
+			last = c
+		}
+		q.pushVertex(a, true)
+		q.pushVertex(b, feb == 0 || feb == 15)
+		q.pushVertex(c, fec == 0 || fec == 15)
+		q.pushEdge(b, a)
+		q.pushEdge(c, b)
+		q.pushEdge(a, c)
+	}
+	stream := make([]byte, 0, 1+ntri+len(out)+meshoptIndexTail)
+	stream = append(stream, meshoptIndexHeader|1)
+	stream = append(stream, code...)
+	stream = append(stream, out...)
+	return append(stream, meshoptCodeAux[:]...)
+}
+
+func decodeMeshoptTriangles(src []byte, count, stride int) ([]byte, error) {
+	if count%3 != 0 {
+		return nil, fmt.Errorf("TRIANGLES count %d is not a multiple of 3", count)
+	}
+	ntri := count / 3
+	if len(src) < 1+ntri+meshoptIndexTail {
+		return nil, errors.New("stream too short")
+	}
+	if src[0]&0xf0 != meshoptIndexHeader || src[0]&0x0f > 1 {
+		return nil, fmt.Errorf("unsupported index stream header 0x%02x", src[0])
+	}
+	fecmax := 15
+	if src[0]&0x0f == 1 {
+		fecmax = 13
+	}
+	code := src[1 : 1+ntri]
+	end := len(src) - meshoptIndexTail
+	aux := src[end:]
+	data := src[:end]
+	pos := 1 + ntri
+	q := newMeshoptFifo()
+	var next, last uint32
+	idx := make([]uint32, 0, count)
+	var err error
+	for _, ct := range code {
+		if ct < 0xf0 {
+			e := q.edges[(q.eoff-1-int(ct>>4))&15]
+			a, b := e[0], e[1]
+			fec := int(ct & 15)
+			var c uint32
+			if fec < fecmax {
+				if fec == 0 {
+					c = next
+					next++
+				} else {
+					c = q.verts[(q.voff-1-fec)&15]
+				}
+				q.pushVertex(c, fec == 0)
+			} else {
+				switch fec {
+				case 13:
+					c = last - 1
+				case 14:
+					c = last + 1
+				default:
+					if c, err = readIndexDelta(data, &pos, last); err != nil {
+						return nil, err
+					}
+				}
+				last = c
+				q.pushVertex(c, true)
+			}
+			idx = append(idx, a, b, c)
+			q.pushEdge(c, b)
+			q.pushEdge(a, c)
+			continue
+		}
+		var a, b, c uint32
+		var feb, fec int
+		if ct < 0xfe {
+			x := aux[ct&15]
+			feb, fec = int(x>>4), int(x&15)
+			a = next
+			next++
+		} else {
+			if pos >= len(data) {
+				return nil, errors.New("truncated triangle data")
+			}
+			x := data[pos]
+			pos++
+			feb, fec = int(x>>4), int(x&15)
+			if x == 0 {
+				next = 0
+			}
+			if ct == 0xfe {
+				a = next
+				next++
+			}
+		}
+		if feb == 0 {
+			b = next
+			next++
+		} else {
+			b = q.verts[(q.voff-feb)&15]
+		}
+		if fec == 0 {
+			c = next
+			next++
+		} else {
+			c = q.verts[(q.voff-fec)&15]
+		}
+		if ct == 0xff {
+			if a, err = readIndexDelta(data, &pos, last); err != nil {
+				return nil, err
+			}
+			last = a
+		}
+		if feb == 15 {
+			if b, err = readIndexDelta(data, &pos, last); err != nil {
+				return nil, err
+			}
+			last = b
+		}
+		if fec == 15 {
+			if c, err = readIndexDelta(data, &pos, last); err != nil {
+				return nil, err
+			}
+			last = c
+		}
+		idx = append(idx, a, b, c)
+		q.pushVertex(a, true)
+		q.pushVertex(b, feb == 0 || feb == 15)
+		q.pushVertex(c, fec == 0 || fec == 15)
+		q.pushEdge(b, a)
+		q.pushEdge(c, b)
+		q.pushEdge(a, c)
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("%d unexpected bytes after triangle data", len(data)-pos)
+	}
+	return packIndices(idx, stride)
+}
+
+// encodeMeshoptIndices 编码任意索引序列：在两个基准之间选择较近的一个做差分
+func encodeMeshoptIndices(idx []uint32) []byte {
+	out := []byte{meshoptSequenceHeader | 1}
+	var last [2]uint32
+	current := 0
+	for _, index := range idx {
+		cd := int32(index - last[current])
+		if cd >= 30 || cd <= -30 {
+			current ^= 1
+		}
+		d := index - last[current]
+		v := d<<1 ^ uint32(int32(d)>>31)
+		out = appendVByte(out, v<<1|uint32(current))
+		last[current] = index
+	}
+	return append(out, 0, 0, 0, 0)
+}
+
+func decodeMeshoptIndices(src []byte, count, stride int) ([]byte, error) {
+	if len(src) < 1+count+4 {
+		return nil, errors.New("stream too short")
+	}
+	if src[0]&0xf0 != meshoptSequenceHeader || src[0]&0x0f > 1 {
+		return nil, fmt.Errorf("unsupported index sequence header 0x%02x", src[0])
+	}
+	data := src[:len(src)-4]
+	pos := 1
+	var last [2]uint32
+	idx := make([]uint32, count)
+	for i := range idx {
+		v, err := readVByte(data, &pos)
+		if err != nil {
+			return nil, err
+		}
+		current := v & 1
+		v >>= 1
+		last[current] += v>>1 ^ -(v & 1)
+		idx[i] = last[current]
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("%d unexpected bytes after index data", len(data)-pos)
+	}
+	return packIndices(idx, stride)
+}
+
+// packIndices 把索引写成 2 或 4 字节小端
+func packIndices(idx []uint32, stride int) ([]byte, error) {
+	out := make([]byte, len(idx)*stride)
+	for i, v := range idx {
+		switch stride {
+		case 2:
+			binary.LittleEndian.PutUint16(out[2*i:], uint16(v))
+		case 4:
+			binary.LittleEndian.PutUint32(out[4*i:], v)
+		default:
+			return nil, fmt.Errorf("invalid index byteStride %d", stride)
+		}
+	}
+	return out, nil
+}
+
+func unpackIndices(data []byte, stride int) []uint32 {
+	idx := make([]uint32, len(data)/stride)
+	for i := range idx {
+		if stride == 2 {
+			idx[i] = uint32(binary.LittleEndian.Uint16(data[2*i:]))
+		} else {
+			idx[i] = binary.LittleEndian.Uint32(data[4*i:])
+		}
+	}
+	return idx
+}
+
+// MeshoptReport 记录压缩结果
+type MeshoptReport struct {
+	Views           int    `json:"views"`
+	RawBytes        int    `json:"rawBytes"`
+	CompressedBytes int    `json:"compressedBytes"`
+	Fallback        string `json:"fallback,omitempty"` // 未压缩回退数据的文件，空表示没有回退数据
+}
+
+// meshoptCompress 压缩构建器中的顶点和索引 bufferView：压缩数据留在 GLB BIN（缓冲 0），
+// 原始数据移到缓冲 1。fallbackURI 非空时缓冲 1 指向该文件，扩展为可选；
+// 否则缓冲 1 只是占位，扩展变为必需。返回缓冲 1 的内容，没有可压缩数据时返回 nil
+func meshoptCompress(b *gltfBuilder, fallbackURI string) ([]byte, *MeshoptReport) {
+	doc := b.doc
+	viewAccessor := map[int]*GLTFAccessor{}
+	for i := range doc.Accessors {
+		if bv := doc.Accessors[i].BufferView; bv != nil {
+			if _, ok := viewAccessor[*bv]; !ok {
+				viewAccessor[*bv] = &doc.Accessors[i]
+			}
+		}
+	}
+	triangles := map[*GLTFAccessor]bool{}
+	for _, m := range doc.Meshes {
+		for _, p := range m.Primitives {
+			if p.Indices != nil && p.primitiveMode() == gltfTriangles {
+				triangles[&doc.Accessors[*p.Indices]] = true
+			}
+		}
+	}
+
+	rep := &MeshoptReport{Fallback: fallbackURI}
+	var bin, fallback []byte
+	align := func(buf []byte) []byte {
+		for len(buf)%4 != 0 {
+			buf = append(buf, 0)
+		}
+		return buf
+	}
+	for i := range doc.BufferViews {
+		bv := &doc.BufferViews[i]
+		data := b.bin[bv.ByteOffset : bv.ByteOffset+bv.ByteLength]
+		acc := viewAccessor[i]
+		var enc []byte
+		ext := MeshoptView{Filter: "NONE"}
+		if acc != nil && acc.ByteOffset == 0 {
+			switch bv.Target {
+			case gltfArrayBuffer:
+				stride := bv.ByteStride
+				if stride == 0 {
+					stride = acc.ElementSize()
+				}
+				if stride%4 == 0 && stride <= 256 && len(data)%stride == 0 {
+					ext.Mode, ext.ByteStride, ext.Count = "ATTRIBUTES", stride, len(data)/stride
+					enc = encodeMeshoptVertices(data, ext.Count, stride)
+				}
+			case gltfElementArrayBuffer:
+				stride := gltfComponentSize(acc.ComponentType)
+				if stride == 2 || stride == 4 {
+					idx := unpackIndices(data, stride)
+					ext.ByteStride, ext.Count = stride, len(idx)
+					if triangles[acc] && len(idx)%3 == 0 {
+						ext.Mode = "TRIANGLES"
+						enc = encodeMeshoptTriangles(idx)
+					} else {
+						ext.Mode = "INDICES"
+						enc = encodeMeshoptIndices(idx)
+					}
+				}
+			}
+		}
+		// 很小的缓冲压缩后反而更大，这时保持原样
+		if enc == nil || len(enc) >= len(data) {
+			bin = align(bin)
+			bv.ByteOffset = len(bin)
+			bin = append(bin, data...)
+			continue
+		}
+		bin = align(bin)
+		ext.ByteOffset, ext.ByteLength = len(bin), len(enc)
+		bin = append(bin, enc...)
+		fallback = align(fallback)
+		bv.Buffer, bv.ByteOffset = 1, len(fallback)
+		fallback = append(fallback, data...)
+		js, _ := json.Marshal(ext)
+		if bv.Extensions == nil {
+			bv.Extensions = map[string]json.RawMessage{}
+		}
+		bv.Extensions[extMeshopt] = js
+		rep.Views++
+		rep.RawBytes += len(data)
+		rep.CompressedBytes += len(enc)
+	}
+	if rep.Views == 0 {
+		return nil, rep
+	}
+	b.bin = bin
+	fb := GLTFBuffer{ByteLength: len(fallback), URI: fallbackURI}
+	if fallbackURI == "" {
+		fb.Extensions = map[string]json.RawMessage{extMeshopt: json.RawMessage(`{"fallback":true}`)}
+	}
+	doc.Buffers = []GLTFBuffer{{ByteLength: len(bin)}, fb}
+	b.useExtension(extMeshopt, fallbackURI == "")
+	return fallback, rep
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMeshoptViewMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+	}{
+		{"negative count", `{"buffer":0,"byteLength":24,"byteStride":12,"count":-1,"mode":"ATTRIBUTES"}`},
+		{"huge count", `{"buffer":0,"byteLength":24,"byteStride":12,"count":9223372036854775807,"mode":"ATTRIBUTES"}`},
+		{"zero stride", `{"buffer":0,"byteLength":24,"byteStride":0,"count":2,"mode":"ATTRIBUTES"}`},
+		{"range past buffer", `{"buffer":0,"byteOffset":16,"byteLength":24,"byteStride":12,"count":2,"mode":"ATTRIBUTES"}`},
+		{"unknown buffer", `{"buffer":4,"byteLength":24,"byteStride":12,"count":2,"mode":"ATTRIBUTES"}`},
+		{"bad header", `{"buffer":0,"byteLength":24,"byteStride":12,"count":2,"mode":"ATTRIBUTES"}`},
+		{"unknown mode", `{"buffer":0,"byteLength":24,"byteStride":12,"count":2,"mode":"POINTS"}`},
+		{"filter", `{"buffer":0,"byteLength":24,"byteStride":12,"count":2,"mode":"ATTRIBUTES","filter":"OCTAHEDRAL"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testGLTF(GLTFAccessor{}, 0)
+			if _, err := f.decodeMeshoptView(0, json.RawMessage(tt.ext)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestMeshoptVerticesRoundTrip(t *testing.T) {
+	data := make([]byte, 40*12)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	enc := encodeMeshoptVertices(data, 40, 12)
+	got, err := decodeMeshoptVertices(enc, 40, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Fatal("decoded vertices differ from the input")
+	}
+	// 截断或多出字节的流都应报错，不能越界读取
+	for _, src := range [][]byte{enc[:len(enc)/2], enc[:3], append(append([]byte(nil), enc[:len(enc)-12]...), make([]byte, 40)...)} {
+		if _, err := decodeMeshoptVertices(src, 40, 12); err == nil {
+			t.Errorf("expected an error for a %d byte stream", len(src))
+		}
+	}
+	if _, err := decodeMeshoptVertices(enc, 40, 10); err == nil || !strings.Contains(err.Error(), "byteStride") {
+		t.Errorf("expected a byteStride error, got %v", err)
+	}
+}
+
+func TestMeshoptIndicesRoundTrip(t *testing.T) {
+	idx := []uint32{0, 1, 2, 2, 1, 3, 3, 1, 4, 7, 8, 9}
+	for _, mode := range []string{"TRIANGLES", "INDICES"} {
+		var enc []byte
+		decode := decodeMeshoptIndices
+		if mode == "TRIANGLES" {
+			enc, decode = encodeMeshoptTriangles(idx), decodeMeshoptTriangles
+		} else {
+			enc = encodeMeshoptIndices(idx)
+		}
+		got, err := decode(enc, len(idx), 4)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		for i, v := range unpackIndices(got, 4) {
+			if v != idx[i] {
+				t.Fatalf("%s: index %d = %d, want %d", mode, i, v, idx[i])
+			}
+		}
+		if _, err := decode(enc[:len(enc)/2], len(idx), 4); err == nil {
+			t.Errorf("%s: expected an error for a truncated stream", mode)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 手写的 Prometheus 文本格式指标，不引入 client_golang
+
+// metricLatencyBuckets 是请求耗时直方图的上界（秒）
+var metricLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// responseKinds 按扩展名给响应分类，用于统计各类资源的流量
+var responseKinds = map[string]string{
+	".glb": "model", ".gltf": "model", ".obj": "model", ".stl": "model", ".ply": "model", ".fbx": "model",
+	".bin": "buffer", ".drc": "buffer",
+	".png": "texture", ".jpg": "texture", ".jpeg": "texture", ".webp": "texture", ".ktx2": "texture",
+	".basis": "texture", ".hdr": "texture", ".exr": "texture",
+	".json": "json",
+}
+
+type requestKey struct {
+	method, route, status string
+}
+
+type latencyHistogram struct {
+	counts []uint64 // 与 metricLatencyBuckets 对应，不累计
+	sum    float64
+	count  uint64
+}
+
+type cacheCounter struct {
+	hits, misses uint64
+}
+
+var metrics = struct {
+	sync.Mutex
+	started  time.Time
+	inflight int64
+	requests map[requestKey]*latencyHistogram
+	bytes    map[string]uint64
+	caches   map[string]*cacheCounter
+}{
+	started:  time.Now(),
+	requests: map[requestKey]*latencyHistogram{},
+	bytes:    map[string]uint64{},
+	caches:   map[string]*cacheCounter{},
+}
+
+// responseKind 返回请求路径对应的资源类别，例如缩略图算作 texture；其余 /api 下的接口为 api
+func responseKind(p string) string {
+	if k, ok := responseKinds[strings.ToLower(path.Ext(p))]; ok {
+		return k
+	}
+	if strings.HasPrefix(p, "/api/") {
+		return "api"
+	}
+	return "other"
+}
+
+// metricsMiddleware 统计请求数、耗时、响应字节数和正在处理的请求数；路由使用模板，例如 /api/scenes/:id
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		atomic.AddInt64(&metrics.inflight, 1)
+		c.Next()
+		atomic.AddInt64(&metrics.inflight, -1)
+		elapsed := time.Since(start).Seconds()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		key := requestKey{c.Request.Method, route, strconv.Itoa(c.Writer.Status())}
+		size := c.Writer.Size()
+		metrics.Lock()
+		defer metrics.Unlock()
+		h := metrics.requests[key]
+		if h == nil {
+			h = &latencyHistogram{counts: make([]uint64, len(metricLatencyBuckets))}
+			metrics.requests[key] = h
+		}
+		if i := sort.SearchFloat64s(metricLatencyBuckets, elapsed); i < len(metricLatencyBuckets) {
+			h.counts[i]++
+		}
+		h.sum += elapsed
+		h.count++
+		if size > 0 {
+			metrics.bytes[responseKind(c.Request.URL.Path)] += uint64(size)
+		}
+	}
+}
+
+// cacheLookup 记录一次缓存查找，name 例如 thumbnail、asset_refs
+func cacheLookup(name string, hit bool) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	cc := metrics.caches[name]
+	if cc == nil {
+		cc = &cacheCounter{}
+		metrics.caches[name] = cc
+	}
+	if hit {
+		cc.hits++
+	} else {
+		cc.misses++
+	}
+}
+
+// promLabels 按 Prometheus 文本格式转义标签值，参数为 名称, 值, 名称, 值 ...
+func promLabels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		fmt.Fprintf(&b, `%s="%s"`, kv[i], v)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func promHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func promFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeMetrics 输出全部指标，同一指标的各行按标签排序，便于比较
+func writeMetrics(w io.Writer) {
+	metrics.Lock()
+	keys := make([]requestKey, 0, len(metrics.requests))
+	for k := range metrics.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		x, y := keys[a], keys[b]
+		if x.route != y.route {
+			return x.route < y.route
+		}
+		if x.method != y.method {
+			return x.method < y.method
+		}
+		return x.status < y.status
+	})
+
+	promHeader(w, "tserver_http_requests_total", "counter", "HTTP requests by method, route template and status.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "tserver_http_requests_total%s %d\n", promLabels("method", k.method, "route", k.route, "status", k.status), metrics.requests[k].count)
+	}
+	promHeader(w, "tserver_http_request_duration_seconds", "histogram", "HTTP request latency by method, route template and status.")
+	for _, k := range keys {
+		h := metrics.requests[k]
+		labels := promLabels("method", k.method, "route", k.route, "status", k.status)
+		var cum uint64
+		for i, le := range metricLatencyBuckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "tserver_http_request_duration_seconds_bucket%s %d\n",
+				promLabels("method", k.method, "route", k.route, "status", k.status, "le", promFloat(le)), cum)
+		}
+		fmt.Fprintf(w, "tserver_http_request_duration_seconds_bucket%s %d\n",
+			promLabels("method", k.method, "route", k.route, "status", k.status, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "tserver_http_request_duration_seconds_sum%s %s\n", labels, promFloat(h.sum))
+		fmt.Fprintf(w, "tserver_http_request_duration_seconds_count%s %d\n", labels, h.count)
+	}
+	promHeader(w, "tserver_http_requests_in_flight", "gauge", "HTTP requests currently being served, including open WebSocket connections.")
+	fmt.Fprintf(w, "tserver_http_requests_in_flight %d\n", atomic.LoadInt64(&metrics.inflight))
+
+	promHeader(w, "tserver_http_response_bytes_total", "counter", "Response body bytes by asset kind.")
+	kinds := make([]string, 0, len(metrics.bytes))
+	for k := range metrics.bytes {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		fmt.Fprintf(w, "tserver_http_response_bytes_total%s %d\n", promLabels("kind", k), metrics.bytes[k])
+	}
+
+	names := make([]string, 0, len(metrics.caches))
+	for n := range metrics.caches {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	promHeader(w, "tserver_cache_lookups_total", "counter", "Cache lookups by cache and result.")
+	for _, n := range names {
+		cc := metrics.caches[n]
+		fmt.Fprintf(w, "tserver_cache_lookups_total%s %d\n", promLabels("cache", n, "result", "hit"), cc.hits)
+		fmt.Fprintf(w, "tserver_cache_lookups_total%s %d\n", promLabels("cache", n, "result", "miss"), cc.misses)
+	}
+	promHeader(w, "tserver_cache_hit_ratio", "gauge", "Share of cache lookups that were hits since start.")
+	for _, n := range names {
+		cc := metrics.caches[n]
+		fmt.Fprintf(w, "tserver_cache_hit_ratio%s %s\n", promLabels("cache", n), promFloat(float64(cc.hits)/float64(cc.hits+cc.misses)))
+	}
+	started := metrics.started
+	metrics.Unlock()
+
+	queued, running := jobs.Depth()
+	promHeader(w, "tserver_jobs", "gauge", "Background jobs by state.")
+	fmt.Fprintf(w, "tserver_jobs%s %d\n", promLabels("state", jobQueued), queued)
+	fmt.Fprintf(w, "tserver_jobs%s %d\n", promLabels("state", jobRunning), running)
+	promHeader(w, "tserver_jobs_capacity", "gauge", "Maximum number of queued background jobs.")
+	fmt.Fprintf(w, "tserver_jobs_capacity %d\n", cap(jobs.pending))
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	promHeader(w, "go_info", "gauge", "Go version the server was built with.")
+	fmt.Fprintf(w, "go_info%s 1\n", promLabels("version", runtime.Version()))
+	promHeader(w, "go_goroutines", "gauge", "Number of goroutines.")
+	fmt.Fprintf(w, "go_goroutines %d\n", runtime.NumGoroutine())
+	promHeader(w, "go_memstats_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	fmt.Fprintf(w, "go_memstats_heap_alloc_bytes %d\n", ms.HeapAlloc)
+	promHeader(w, "go_memstats_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.")
+	fmt.Fprintf(w, "go_memstats_heap_inuse_bytes %d\n", ms.HeapInuse)
+	promHeader(w, "go_memstats_sys_bytes", "gauge", "Bytes of memory obtained from the OS.")
+	fmt.Fprintf(w, "go_memstats_sys_bytes %d\n", ms.Sys)
+	promHeader(w, "go_memstats_next_gc_bytes", "gauge", "Heap size target of the next GC cycle.")
+	fmt.Fprintf(w, "go_memstats_next_gc_bytes %d\n", ms.NextGC)
+	promHeader(w, "go_memstats_mallocs_total", "counter", "Cumulative count of heap objects allocated.")
+	fmt.Fprintf(w, "go_memstats_mallocs_total %d\n", ms.Mallocs)
+	promHeader(w, "go_gc_cycles_total", "counter", "Completed GC cycles.")
+	fmt.Fprintf(w, "go_gc_cycles_total %d\n", ms.NumGC)
+	promHeader(w, "go_gc_pause_seconds_total", "counter", "Cumulative GC stop-the-world pause time.")
+	fmt.Fprintf(w, "go_gc_pause_seconds_total %s\n", promFloat(float64(ms.PauseTotalNs)/1e9))
+	promHeader(w, "process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.")
+	fmt.Fprintf(w, "process_start_time_seconds %d\n", started.Unix())
+}
+
+// metricsHandler 处理 GET /metrics
+func metricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	writeMetrics(c.Writer)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponseKind(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"/data/models/a.GLB", "model"},
+		{"/data/models/a.bin", "buffer"},
+		{"/data/tex/a.ktx2", "texture"},
+		{"/api/thumbnails/a.png", "texture"},
+		{"/data/scenes/s1.json", "json"},
+		{"/api/scenes", "api"},
+		{"/index.html", "other"},
+	}
+	for _, tt := range tests {
+		if got := responseKind(tt.path); got != tt.want {
+			t.Errorf("responseKind(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPromLabels(t *testing.T) {
+	tests := []struct {
+		kv   []string
+		want string
+	}{
+		{[]string{"a", "1"}, `{a="1"}`},
+		{[]string{"a", "1", "b", "2"}, `{a="1",b="2"}`},
+		{[]string{"route", `x"y\z` + "\n"}, `{route="x\"y\\z\n"}`},
+	}
+	for _, tt := range tests {
+		if got := promLabels(tt.kv...); got != tt.want {
+			t.Errorf("promLabels(%q) = %s, want %s", tt.kv, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	slow := func(c *gin.Context) {
+		time.Sleep(30 * time.Millisecond)
+		c.String(http.StatusOK, "hello")
+	}
+	serveTest(http.MethodGet, "/api/test/:id", "/api/test/42", "", metricsMiddleware(), slow)
+	cacheLookup("test_cache", true)
+	cacheLookup("test_cache", false)
+	cacheLookup("test_cache", false)
+
+	w := serveTest(http.MethodGet, "/metrics", "/metrics", "", metricsHandler)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("content type %q", w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		`tserver_http_requests_total{method="GET",route="/api/test/:id",status="200"} 1`,
+		`tserver_http_request_duration_seconds_bucket{method="GET",route="/api/test/:id",status="200",le="0.025"} 0`,
+		`tserver_http_request_duration_seconds_bucket{method="GET",route="/api/test/:id",status="200",le="+Inf"} 1`,
+		`tserver_http_requests_in_flight 0`,
+		`tserver_cache_lookups_total{cache="test_cache",result="hit"} 1`,
+		`tserver_cache_lookups_total{cache="test_cache",result="miss"} 2`,
+		"# TYPE go_goroutines gauge",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q", line)
+		}
+	}
+	if !strings.Contains(body, `tserver_cache_hit_ratio{cache="test_cache"} 0.333`) {
+		t.Error("missing hit ratio")
+	}
+	if !strings.Contains(body, `tserver_http_response_bytes_total{kind="api"} `) {
+		t.Error("missing response bytes")
+	}
+}
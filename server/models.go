@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelAction 按路径后缀分发模型接口（gin 的通配参数只能放在路由末尾）
+func modelAction(c *gin.Context) {
+	p := c.Param("path")
+	switch {
+	case strings.HasSuffix(p, "/inspect"):
+		inspectHandler(c, strings.TrimSuffix(p, "/inspect"))
+	case strings.HasSuffix(p, "/thumbnail.png"):
+		thumbnailHandler(c, strings.TrimSuffix(p, "/thumbnail.png"))
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown model action"})
+	}
+}
+
+// modelPostAction 分发需要写入的模型接口
+func modelPostAction(c *gin.Context) {
+	p := c.Param("path")
+	switch {
+	case strings.HasSuffix(p, "/convert"):
+		convertHandler(c, strings.TrimSuffix(p, "/convert"))
+	case strings.HasSuffix(p, "/optimize"):
+		optimizeHandler(c, strings.TrimSuffix(p, "/optimize"))
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown model action"})
+	}
+}
+
+// inspectHandler 返回 glTF/GLB 的结构统计和校验报告
+func inspectHandler(c *gin.Context, rel string) {
+	file, ok := modelFile(c, rel)
+	if !ok {
+		return
+	}
+	end := startSpan(c, "transform")
+	rep, err := inspectModel(file)
+	end()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rep)
+}
+
+// modelFile 解析并检查模型文件路径，失败时直接写出错误响应；受保护的模型同样需要签名
+func modelFile(c *gin.Context, rel string) (string, bool) {
+	if !checkSigned(c, rel) {
+		return "", false
+	}
+	file, err := resolveDataPath(rel)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	st, err := os.Stat(file)
+	if err != nil || st.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model not found"})
+		return "", false
+	}
+	// 转换、优化等会读取外部 buffer 和贴图，它们受保护时也需要签名
+	if !checkSignedRefs(c, dataRelPath(file)) {
+		return "", false
+	}
+	return file, true
+}
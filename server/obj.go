@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// objKey 唯一标识 OBJ 面中的一个顶点引用（位置/纹理/法线），用于生成索引几何
+type objKey struct {
+	v, vt, vn int
+}
+
+// objParser 逐行读取 Wavefront OBJ，构造 meshData
+type objParser struct {
+	dir      string
+	mesh     *meshData
+	warnings []string
+
+	v, vt, vn []float32
+	vc        []float32 // 扩展的顶点颜色（v x y z r g b）
+	hasColor  bool
+
+	verts      map[objKey]uint32
+	vertPos    []int // 输出顶点对应的 v 索引，用于补算法线
+	missingN   bool
+	mtlNames   map[string]int
+	group      int         // 当前写入的 Groups 下标，-1 表示尚未开始
+	groups     map[int]int // 材质 -> Groups 下标
+	skipped    int
+	degenerate int
+}
+
+// parseOBJ 读取 OBJ 文件及其引用的 MTL 材质库
+func parseOBJ(file string) (*meshData, []string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	p := &objParser{
+		dir:      filepath.Dir(file),
+		mesh:     &meshData{},
+		verts:    map[objKey]uint32{},
+		mtlNames: map[string]int{},
+		groups:   map[int]int{},
+		group:    -1,
+	}
+	if err := p.parse(f); err != nil {
+		return nil, p.warnings, err
+	}
+	p.finish()
+	return p.mesh, p.warnings, nil
+}
+
+func (p *objParser) warnf(format string, args ...interface{}) {
+	if len(p.warnings) < 100 {
+		p.warnings = append(p.warnings, fmt.Sprintf(format, args...))
+	}
+}
+
+func (p *objParser) parse(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	var pending string
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		// 行尾反斜杠表示续行
+		if strings.HasSuffix(line, "\\") {
+			pending += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		line = pending + line
+		pending = ""
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := p.statement(fields); err != nil {
+			return fmt.Errorf("obj line %d: %w", lineNo, err)
+		}
+	}
+	return sc.Err()
+}
+
+func (p *objParser) statement(fields []string) error {
+	args := fields[1:]
+	switch fields[0] {
+	case "v":
+		vals, err := parseFloats(args, 3)
+		if err != nil {
+			return err
+		}
+		p.v = append(p.v, vals[0], vals[1], vals[2])
+		if len(vals) >= 6 {
+			p.hasColor = true
+			p.vc = append(p.vc, vals[3], vals[4], vals[5])
+		} else {
+			p.vc = append(p.vc, 1, 1, 1)
+		}
+	case "vt":
+		vals, err := parseFloats(args, 1)
+		if err != nil {
+			return err
+		}
+		u, v := vals[0], float32(0)
+		if len(vals) > 1 {
+			v = vals[1]
+		}
+		// OBJ 的 v 轴向上，glTF 向下
+		p.vt = append(p.vt, u, 1-v)
+	case "vn":
+		vals, err := parseFloats(args, 3)
+		if err != nil {
+			return err
+		}
+		p.vn = append(p.vn, vals[0], vals[1], vals[2])
+	case "f":
+		return p.face(args)
+	case "usemtl":
+		name := strings.Join(args, " ")
+		p.useMaterial(name)
+	case "mtllib":
+		for _, lib := range splitMTLLib(args) {
+			p.loadMTL(lib)
+		}
+	case "p", "l", "curv", "curv2", "surf":
+		p.skipped++
+	case "o", "g", "s", "mg", "vp":
+		// 对象/分组/平滑组只影响组织方式，这里按材质合并
+	default:
+		p.warnf("unsupported statement %q", fields[0])
+	}
+	return nil
+}
+
+// splitMTLLib 处理 mtllib 参数：全部以 .mtl 结尾时视为多个文件，否则视为带空格的单个文件名
+func splitMTLLib(args []string) []string {
+	for _, a := range args {
+		if !strings.HasSuffix(strings.ToLower(a), ".mtl") {
+			return []string{strings.Join(args, " ")}
+		}
+	}
+	return args
+}
+
+func parseFloats(args []string, min int) ([]float32, error) {
+	if len(args) < min {
+		return nil, fmt.Errorf("expected %d values, got %d", min, len(args))
+	}
+	out := make([]float32, len(args))
+	for i, a := range args {
+		f, err := strconv.ParseFloat(a, 32)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = float32(f)
+	}
+	return out, nil
+}
+
+// resolveIndex 把 OBJ 的 1 起始或负数相对索引转换为 0 起始索引
+func resolveIndex(s string, n int) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case i > 0 && i <= n:
+		return i - 1, nil
+	case i < 0 && -i <= n:
+		return n + i, nil
+	}
+	return 0, fmt.Errorf("index %d out of range (have %d)", i, n)
+}
+
+func (p *objParser) face(args []string) error {
+	if len(args) < 3 {
+		p.degenerate++
+		return nil
+	}
+	if p.group < 0 {
+		p.useMaterial("")
+	}
+	idx := make([]uint32, len(args))
+	for i, a := range args {
+		parts := strings.Split(a, "/")
+		var k objKey
+		var err error
+		if k.v, err = resolveIndex(parts[0], len(p.v)/3); err != nil || k.v < 0 {
+			return fmt.Errorf("bad vertex reference %q", a)
+		}
+		k.vt, k.vn = -1, -1
+		if len(parts) > 1 {
+			if k.vt, err = resolveIndex(parts[1], len(p.vt)/2); err != nil {
+				return fmt.Errorf("bad texcoord reference %q", a)
+			}
+		}
+		if len(parts) > 2 {
+			if k.vn, err = resolveIndex(parts[2], len(p.vn)/3); err != nil {
+				return fmt.Errorf("bad normal reference %q", a)
+			}
+		}
+		idx[i] = p.vertex(k)
+	}
+	// 多边形按扇形三角化
+	for i := 1; i+1 < len(idx); i++ {
+		a, b, c := idx[0], idx[i], idx[i+1]
+		if a == b || b == c || a == c {
+			p.degenerate++
+			continue
+		}
+		g := &p.mesh.Groups[p.group]
+		g.Indices = append(g.Indices, a, b, c)
+	}
+	return nil
+}
+
+func (p *objParser) vertex(k objKey) uint32 {
+	if i, ok := p.verts[k]; ok {
+		return i
+	}
+	m := p.mesh
+	i := uint32(m.vertexCount())
+	p.verts[k] = i
+	p.vertPos = append(p.vertPos, k.v)
+	m.Positions = append(m.Positions, p.v[3*k.v], p.v[3*k.v+1], p.v[3*k.v+2])
+	m.Colors = append(m.Colors, p.vc[3*k.v], p.vc[3*k.v+1], p.vc[3*k.v+2])
+	if k.vt >= 0 {
+		m.UVs = append(m.UVs, p.vt[2*k.vt], p.vt[2*k.vt+1])
+	} else {
+		m.UVs = append(m.UVs, 0, 0)
+	}
+	if k.vn >= 0 {
+		m.Normals = append(m.Normals, p.vn[3*k.vn], p.vn[3*k.vn+1], p.vn[3*k.vn+2])
+	} else {
+		m.Normals = append(m.Normals, 0, 0, 0)
+		p.missingN = true
+	}
+	return i
+}
+
+func (p *objParser) useMaterial(name string) {
+	mat := -1
+	if name != "" {
+		i, ok := p.mtlNames[name]
+		if !ok {
+			p.warnf("material %q not defined in any mtllib", name)
+			p.mesh.Materials = append(p.mesh.Materials, defaultMeshMaterial(name))
+			i = len(p.mesh.Materials) - 1
+			p.mtlNames[name] = i
+		}
+		mat = i
+	}
+	g, ok := p.groups[mat]
+	if !ok {
+		p.mesh.Groups = append(p.mesh.Groups, meshGroup{Name: name, Material: mat})
+		g = len(p.mesh.Groups) - 1
+		p.groups[mat] = g
+	}
+	p.group = g
+}
+
+// finish 补算缺失的法线，去掉无用的属性
+func (p *objParser) finish() {
+	m := p.mesh
+	if p.missingN {
+		m.GeneratedNormals = true
+		// 按原始位置索引累加面法线，使共享位置但 uv 不同的顶点得到一致的平滑法线
+		acc := make([][3]float64, len(p.v)/3)
+		for _, g := range m.Groups {
+			for t := 0; t+2 < len(g.Indices); t += 3 {
+				a, b, c := g.Indices[t], g.Indices[t+1], g.Indices[t+2]
+				n := faceNormal(m.Positions, a, b, c)
+				for _, i := range [3]uint32{a, b, c} {
+					pi := p.vertPos[i]
+					acc[pi][0] += n[0]
+					acc[pi][1] += n[1]
+					acc[pi][2] += n[2]
+				}
+			}
+		}
+		for i := 0; i < m.vertexCount(); i++ {
+			n := m.Normals[3*i : 3*i+3]
+			if n[0] != 0 || n[1] != 0 || n[2] != 0 {
+				continue
+			}
+			s := normalize3(acc[p.vertPos[i]])
+			n[0], n[1], n[2] = float32(s[0]), float32(s[1]), float32(s[2])
+		}
+	}
+	if len(p.vt) == 0 {
+		m.UVs = nil
+	}
+	if !p.hasColor {
+		m.Colors = nil
+	}
+	if p.skipped > 0 {
+		p.warnf("%d point/line/curve elements ignored", p.skipped)
+	}
+	if p.degenerate > 0 {
+		p.warnf("%d degenerate faces dropped", p.degenerate)
+	}
+}
+
+// loadMTL 读取材质库，文件缺失只记警告
+func (p *objParser) loadMTL(name string) {
+	file, err := resolveRelative(p.dir, strings.ReplaceAll(name, "\\", "/"))
+	if err != nil {
+		p.warnf("mtllib %q: %v", name, err)
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		p.warnf("mtllib %q not found", name)
+		return
+	}
+	defer f.Close()
+	mats, warnings := parseMTL(f, filepath.Dir(file))
+	p.warnings = append(p.warnings, warnings...)
+	for _, m := range mats {
+		if i, ok := p.mtlNames[m.Name]; ok {
+			p.mesh.Materials[i] = m
+			continue
+		}
+		p.mesh.Materials = append(p.mesh.Materials, m)
+		p.mtlNames[m.Name] = len(p.mesh.Materials) - 1
+	}
+}
+
+// mtlOptionArgs 是贴图语句中各选项后面跟的参数个数（-o/-s/-t 为 1~3 个数字）
+var mtlOptionArgs = map[string]int{
+	"-blendu": 1, "-blendv": 1, "-bm": 1, "-boost": 1, "-cc": 1, "-clamp": 1,
+	"-imfchan": 1, "-mm": 2, "-texres": 1, "-type": 1,
+	"-o": 3, "-s": 3, "-t": 3,
+}
+
+// mtlMapFile 跳过贴图语句的选项，返回文件名
+func mtlMapFile(args []string) string {
+	i := 0
+	for i < len(args) {
+		opt := args[i]
+		n, ok := mtlOptionArgs[opt]
+		if !ok {
+			break
+		}
+		i++
+		if opt == "-o" || opt == "-s" || opt == "-t" {
+			// 后两个参数可省略，遇到非数字即停止
+			for j := 0; j < n && i < len(args); j++ {
+				if _, err := strconv.ParseFloat(args[i], 64); err != nil {
+					break
+				}
+				i++
+			}
+			continue
+		}
+		i += n
+	}
+	if i >= len(args) {
+		return ""
+	}
+	return strings.ReplaceAll(strings.Join(args[i:], " "), "\\", "/")
+}
+
+// parseMTL 把 MTL 的 Phong 参数换算为 PBR 材质
+func parseMTL(r io.Reader, dir string) ([]meshMaterial, []string) {
+	var mats []meshMaterial
+	var warnings []string
+	var cur *meshMaterial
+	var ns float64 = -1
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		if ns >= 0 {
+			// Blinn-Phong 高光指数到粗糙度的常用近似
+			cur.Roughness = math.Sqrt(2 / (ns + 2))
+		}
+		mats = append(mats, *cur)
+	}
+	mapPath := func(args []string) string {
+		name := mtlMapFile(args)
+		if name == "" {
+			return ""
+		}
+		file, err := resolveRelative(dir, name)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("texture %q: %v", name, err))
+			return ""
+		}
+		return file
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		args := fields[1:]
+		if fields[0] == "newmtl" {
+			flush()
+			m := defaultMeshMaterial(strings.Join(args, " "))
+			cur, ns = &m, -1
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		vals, _ := parseFloats(args, 0)
+		switch strings.ToLower(fields[0]) {
+		case "kd":
+			if len(vals) >= 3 {
+				cur.BaseColor[0], cur.BaseColor[1], cur.BaseColor[2] = float64(vals[0]), float64(vals[1]), float64(vals[2])
+			}
+		case "ke":
+			if len(vals) >= 3 {
+				cur.Emissive = [3]float64{float64(vals[0]), float64(vals[1]), float64(vals[2])}
+			}
+		case "d":
+			if len(vals) >= 1 {
+				cur.BaseColor[3] = float64(vals[len(vals)-1])
+			}
+		case "tr":
+			if len(vals) >= 1 {
+				cur.BaseColor[3] = 1 - float64(vals[0])
+			}
+		case "ns":
+			if len(vals) >= 1 {
+				ns = float64(vals[0])
+			}
+		case "pr":
+			if len(vals) >= 1 {
+				cur.Roughness, ns = float64(vals[0]), -1
+			}
+		case "pm":
+			if len(vals) >= 1 {
+				cur.Metallic = float64(vals[0])
+			}
+		case "map_kd":
+			cur.BaseColorMap = mapPath(args)
+		case "map_bump", "bump", "norm", "map_kn":
+			cur.NormalMap = mapPath(args)
+		case "map_ke":
+			cur.EmissiveMap = mapPath(args)
+		case "map_d", "map_ka", "map_ks", "map_ns", "refl", "disp", "map_pr", "map_pm":
+			warnings = append(warnings, fmt.Sprintf("material %q: %s is not converted", cur.Name, fields[0]))
+		}
+	}
+	flush()
+	return mats, warnings
+}
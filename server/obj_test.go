@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseOBJ(t *testing.T) {
+	m, _, err := parseOBJ(writeTestFile(t, "t.obj", []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nvt 0 0\nf 1/1 2/1 3/1 -1/1\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Groups) != 1 || len(m.Groups[0].Indices) != 6 {
+		t.Fatalf("got groups %+v, want one quad split into two triangles", m.Groups)
+	}
+}
+
+func TestParseOBJMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"vertex index past end", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n"},
+		{"zero index", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 0 1 2\n"},
+		{"negative index past start", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf -1 -2 -4\n"},
+		{"huge index", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 99999999999999999999\n"},
+		{"texcoord index past end", "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nf 1/2 2/1 3/1\n"},
+		{"normal index past end", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1//1 2//1 3//1\n"},
+		{"short vertex", "v 0 0\n"},
+		{"bad number", "v 0 x 0\n"},
+		{"face before vertices", "f 1 2 3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parseOBJ(writeTestFile(t, "t.obj", []byte(tt.data))); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseOBJMaterialOutsideRoot(t *testing.T) {
+	root := filepath.Dir(setTestDataRoot(t))
+	os.WriteFile(filepath.Join(root, "secret.mtl"), []byte("newmtl leaked\nKd 1 0 0\n"), 0644)
+	file := filepath.Join(dataRoot, "t.obj")
+	os.WriteFile(file, []byte("mtllib ../secret.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl leaked\nf 1 2 3\n"), 0644)
+	m, warnings, err := parseOBJ(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未定义的材质用默认颜色占位，不能读到根目录外文件里的 Kd
+	if len(m.Materials) != 1 || m.Materials[0].BaseColor[1] == 0 || len(warnings) == 0 || !strings.Contains(warnings[0], "escapes") {
+		t.Fatalf("material outside the data root was loaded: %+v, warnings %v", m.Materials, warnings)
+	}
+}
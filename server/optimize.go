@@ -0,0 +1,1375 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OptimizeOptions 是 GLB 优化任务的参数
+type OptimizeOptions struct {
+	Epsilon  float64 // 顶点焊接时位置的容差
+	Quantize bool    // 用 KHR_mesh_quantization 把位置、法线和 UV 量化为整型
+	Meshopt  bool    // 用 EXT_meshopt_compression 压缩顶点和索引缓冲
+	Fallback bool    // 压缩时另外写出未压缩的 .bin，供不支持该扩展的客户端使用
+}
+
+// 量化位置时使用的位数，在精度和压缩率之间折中
+const quantizePositionBits = 14
+
+// ModelStats 是优化前后用于对比的统计
+type ModelStats struct {
+	Bytes       int64 `json:"bytes"`
+	DrawCalls   int   `json:"drawCalls"`
+	Nodes       int   `json:"nodes"`
+	Meshes      int   `json:"meshes"`
+	Primitives  int   `json:"primitives"`
+	Vertices    int   `json:"vertices"`
+	Triangles   int   `json:"triangles"`
+	Accessors   int   `json:"accessors"`
+	BufferViews int   `json:"bufferViews"`
+	Buffers     int   `json:"buffers"`
+	Materials   int   `json:"materials"`
+	Textures    int   `json:"textures"`
+	Images      int   `json:"images"`
+}
+
+// OptimizeReport 是优化任务的结果
+type OptimizeReport struct {
+	Source     string         `json:"source"`
+	Output     string         `json:"output"`
+	Before     ModelStats     `json:"before"`
+	After      ModelStats     `json:"after"`
+	Welded     int            `json:"weldedVertices"`
+	Degenerate int            `json:"degenerateTriangles"`
+	Merged     int            `json:"mergedPrimitives"`
+	ACMRBefore float64        `json:"acmrBefore"` // 平均每个三角形的缓存未命中数，越低越好
+	ACMRAfter  float64        `json:"acmrAfter"`
+	Quantized  map[string]int `json:"quantized,omitempty"` // 属性名 -> 被量化的访问器数
+	Meshopt    *MeshoptReport `json:"meshopt,omitempty"`
+	Warnings   []string       `json:"warnings"`
+	DurationMs int64          `json:"durationMs"`
+}
+
+// docStats 统计文档的结构数量（不含文件大小）
+func docStats(doc *GLTF) ModelStats {
+	rep := &ModelReport{}
+	rep.summarizeMeshes(&GLTFFile{Doc: doc})
+	return ModelStats{
+		DrawCalls:   rep.Totals.DrawCalls,
+		Nodes:       len(doc.Nodes),
+		Meshes:      len(doc.Meshes),
+		Primitives:  rep.Totals.Primitives,
+		Vertices:    rep.Totals.Vertices,
+		Triangles:   rep.Totals.Triangles,
+		Accessors:   len(doc.Accessors),
+		BufferViews: len(doc.BufferViews),
+		Buffers:     len(doc.Buffers),
+		Materials:   len(doc.Materials),
+		Textures:    len(doc.Textures),
+		Images:      len(doc.Images),
+	}
+}
+
+// optimizedPath 返回优化结果的输出路径：与原文件同目录，文件名加 .optimized
+func optimizedPath(src string) string {
+	return strings.TrimSuffix(src, filepath.Ext(src)) + ".optimized.glb"
+}
+
+// checkRewritable 检查文档是否能被解码后重新编码（压缩扩展和稀疏访问器暂不支持）
+func checkRewritable(f *GLTFFile) error {
+	for i, err := range f.BufferErrors {
+		return fmt.Errorf("buffer %d: %v", i, err)
+	}
+	for _, e := range f.Doc.ExtensionsUsed {
+		switch e {
+		case "KHR_draco_mesh_compression", "KHR_meshopt_compression":
+			return fmt.Errorf("compressed geometry (%s) is not supported", e)
+		}
+	}
+	for i, a := range f.Doc.Accessors {
+		if len(a.Sparse) > 0 {
+			return fmt.Errorf("accessor %d: sparse accessors are not supported", i)
+		}
+	}
+	return nil
+}
+
+// optimizeGLB 重写 GLB：去重、焊接、生成索引、缓存重排并删除无用对象
+func optimizeGLB(src string, opts OptimizeOptions) (*OptimizeReport, error) {
+	start := time.Now()
+	st, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	f, err := loadGLTF(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRewritable(f); err != nil {
+		return nil, err
+	}
+	if opts.Epsilon <= 0 {
+		opts.Epsilon = 1e-5
+	}
+	out := optimizedPath(src)
+	rep := &OptimizeReport{
+		Source: dataRelPath(src),
+		Output: dataRelPath(out),
+		Before: docStats(f.Doc),
+	}
+	rep.Before.Bytes = st.Size()
+
+	o := newGLTFRewriter(f, rep)
+	o.opts = opts
+	if err := o.rewrite(); err != nil {
+		return nil, err
+	}
+	if opts.Meshopt {
+		fallbackFile := strings.TrimSuffix(out, ".glb") + ".fallback.bin"
+		uri := ""
+		if opts.Fallback {
+			uri = url.PathEscape(filepath.Base(fallbackFile))
+		}
+		fallback, mrep := meshoptCompress(o.b, uri)
+		if fallback != nil && opts.Fallback {
+			if err := writeFileAtomic(fallbackFile, fallback, 0644); err != nil {
+				return nil, err
+			}
+			mrep.Fallback = dataRelPath(fallbackFile)
+		}
+		rep.Meshopt = mrep
+	}
+	glb, err := o.b.glb()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(out, glb, 0644); err != nil {
+		return nil, err
+	}
+	rep.After = docStats(o.b.doc)
+	rep.After.Bytes = int64(len(glb))
+	rep.DurationMs = time.Since(start).Milliseconds()
+	if rep.Warnings == nil {
+		rep.Warnings = []string{}
+	}
+	js, _ := json.MarshalIndent(rep, "", "  ")
+	if err := writeFileAtomic(strings.TrimSuffix(out, ".glb")+".report.json", js, 0644); err != nil {
+		return rep, err
+	}
+	return rep, nil
+}
+
+// gltfRewriter 把源文档重新编码到新的构建器中，所有引用按需惰性映射并去重
+type gltfRewriter struct {
+	f    *GLTFFile
+	b    *gltfBuilder
+	rep  *OptimizeReport
+	opts OptimizeOptions
+
+	nodeMap []int
+	accMap  map[int]int
+	accHash map[[32]byte]int
+	imgMap  map[int]int
+	imgHash map[[32]byte]int
+	smpMap  map[int]int
+	smpHash map[string]int
+	texMap  map[int]int
+	texHash map[[2]int]int
+	matMap  map[int]int
+	matHash map[string]int
+	meshMap map[int]int
+	skinMap map[int]int
+	// 位置被量化的网格（新编号）及其反量化参数，引用它们的节点需要加一个带变换的子节点
+	meshQuant map[int]*posQuant
+	// 不能量化位置的源网格：蒙皮、变形目标或节点带扩展（如 GPU 实例化）
+	keepPositions map[int]bool
+	acmrTris      [2]int
+	acmrMiss      [2]int
+}
+
+func newGLTFRewriter(f *GLTFFile, rep *OptimizeReport) *gltfRewriter {
+	b := newGLTFBuilder(f.Doc.Asset.Generator)
+	b.doc.Asset = f.Doc.Asset
+	b.doc.Asset.Generator = strings.TrimSpace(f.Doc.Asset.Generator + " (tServer optimize)")
+	return &gltfRewriter{
+		f:       f,
+		b:       b,
+		rep:     rep,
+		accMap:  map[int]int{},
+		accHash: map[[32]byte]int{},
+		imgMap:  map[int]int{},
+		imgHash: map[[32]byte]int{},
+		smpMap:  map[int]int{},
+		smpHash: map[string]int{},
+		texMap:  map[int]int{},
+		texHash: map[[2]int]int{},
+		matMap:  map[int]int{},
+		matHash: map[string]int{},
+		meshMap: map[int]int{},
+		skinMap: map[int]int{},
+
+		meshQuant:     map[int]*posQuant{},
+		keepPositions: map[int]bool{},
+	}
+}
+
+func (o *gltfRewriter) warnf(format string, args ...interface{}) {
+	o.rep.Warnings = append(o.rep.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (o *gltfRewriter) rewrite() error {
+	src := o.f.Doc
+	dst := o.b.doc
+	// 源文件的 meshopt 压缩在读取时已解开，需要时由 meshoptCompress 重新加上
+	dst.ExtensionsUsed = removeString(src.ExtensionsUsed, extMeshopt)
+	dst.ExtensionsRequired = removeString(src.ExtensionsRequired, extMeshopt)
+	dst.Extensions = src.Extensions
+	dst.Extras = src.Extras
+	dst.Cameras = src.Cameras
+
+	o.pruneNodes()
+	for _, n := range src.Nodes {
+		if n.Mesh != nil && (n.Skin != nil || len(n.Extensions) > 0) {
+			o.keepPositions[*n.Mesh] = true
+		}
+	}
+	kept := 0
+	for _, ni := range o.nodeMap {
+		if ni >= 0 {
+			kept++
+		}
+	}
+	var dequant []GLTFNode
+	for i, n := range src.Nodes {
+		if o.nodeMap[i] < 0 {
+			continue
+		}
+		nn := n
+		nn.Children = o.mapNodes(n.Children)
+		if n.Mesh != nil {
+			m, err := o.mesh(*n.Mesh)
+			if err != nil {
+				return err
+			}
+			nn.Mesh = &m
+			// 量化后的位置通过子节点的平移和缩放还原
+			if q := o.meshQuant[m]; q != nil {
+				dequant = append(dequant, GLTFNode{
+					Mesh:        &m,
+					Translation: q.Offset[:],
+					Scale:       []float64{q.Scale, q.Scale, q.Scale},
+				})
+				nn.Mesh = nil
+				nn.Children = append(nn.Children, kept+len(dequant)-1)
+			}
+		}
+		dst.Nodes = append(dst.Nodes, nn)
+	}
+	dst.Nodes = append(dst.Nodes, dequant...)
+	for i := range dst.Nodes {
+		if s := dst.Nodes[i].Skin; s != nil {
+			ns, err := o.skin(*s)
+			if err != nil {
+				return err
+			}
+			dst.Nodes[i].Skin = &ns
+		}
+	}
+	for _, s := range src.Scenes {
+		s.Nodes = o.mapNodes(s.Nodes)
+		dst.Scenes = append(dst.Scenes, s)
+	}
+	dst.Scene = src.Scene
+	for i, a := range src.Animations {
+		na, err := o.animation(a)
+		if err != nil {
+			return fmt.Errorf("animation %d: %w", i, err)
+		}
+		if len(na.Channels) > 0 {
+			dst.Animations = append(dst.Animations, na)
+		}
+	}
+	if o.acmrTris[0] > 0 {
+		o.rep.ACMRBefore = round3(float64(o.acmrMiss[0]) / float64(o.acmrTris[0]))
+		o.rep.ACMRAfter = round3(float64(o.acmrMiss[1]) / float64(o.acmrTris[1]))
+	}
+	return nil
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// pruneNodes 计算保留的节点：场景中可达，并且不是没有任何内容的匿名叶子节点
+func (o *gltfRewriter) pruneNodes() {
+	doc := o.f.Doc
+	n := len(doc.Nodes)
+	reachable := make([]bool, n)
+	if len(doc.Scenes) == 0 {
+		for i := range reachable {
+			reachable[i] = true
+		}
+	}
+	var visit func(i int)
+	visit = func(i int) {
+		if i < 0 || i >= n || reachable[i] {
+			return
+		}
+		reachable[i] = true
+		for _, c := range doc.Nodes[i].Children {
+			visit(c)
+		}
+	}
+	for _, s := range doc.Scenes {
+		for _, r := range s.Nodes {
+			visit(r)
+		}
+	}
+	// 骨骼关节和动画目标即使为空也要保留
+	pinned := make([]bool, n)
+	for _, s := range doc.Skins {
+		for _, j := range s.Joints {
+			if j >= 0 && j < n {
+				pinned[j] = true
+			}
+		}
+		if s.Skeleton != nil && *s.Skeleton >= 0 && *s.Skeleton < n {
+			pinned[*s.Skeleton] = true
+		}
+	}
+	for _, a := range doc.Animations {
+		for _, c := range a.Channels {
+			if c.Target.Node != nil && *c.Target.Node >= 0 && *c.Target.Node < n {
+				pinned[*c.Target.Node] = true
+			}
+		}
+	}
+	keep := make([]bool, n)
+	seen := make([]bool, n) // 防止层级中存在环时无限递归
+	var decide func(i int) bool
+	decide = func(i int) bool {
+		if seen[i] {
+			return keep[i]
+		}
+		seen[i] = true
+		nd := &doc.Nodes[i]
+		k := pinned[i] || nd.Mesh != nil || nd.Camera != nil || nd.Skin != nil ||
+			nd.Name != "" || len(nd.Extensions) > 0 || len(nd.Extras) > 0
+		for _, c := range nd.Children {
+			if c >= 0 && c < n && reachable[c] && decide(c) {
+				k = true
+			}
+		}
+		keep[i] = k
+		return k
+	}
+	for i := range doc.Nodes {
+		if reachable[i] {
+			decide(i)
+		}
+	}
+	o.nodeMap = make([]int, n)
+	next, removed := 0, 0
+	for i := range doc.Nodes {
+		if reachable[i] && keep[i] {
+			o.nodeMap[i] = next
+			next++
+		} else {
+			o.nodeMap[i] = -1
+			removed++
+		}
+	}
+	if removed > 0 {
+		o.warnf("%d unused nodes removed", removed)
+	}
+}
+
+func (o *gltfRewriter) mapNodes(list []int) []int {
+	var out []int
+	for _, c := range list {
+		if c >= 0 && c < len(o.nodeMap) && o.nodeMap[c] >= 0 {
+			out = append(out, o.nodeMap[c])
+		}
+	}
+	return out
+}
+
+// addAccessor 写入编码好的访问器数据，内容完全相同的访问器只写一次
+func (o *gltfRewriter) addAccessor(data []byte, acc GLTFAccessor, target, stride int) int {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%s|%v|%d|%d|%d|", acc.ComponentType, acc.Type, acc.Normalized, acc.Count, target, stride)
+	h.Write(data)
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+	if i, ok := o.accHash[key]; ok {
+		return i
+	}
+	bv := o.b.addBufferView(data, stride, target)
+	acc.BufferView = &bv
+	o.b.doc.Accessors = append(o.b.doc.Accessors, acc)
+	i := len(o.b.doc.Accessors) - 1
+	o.accHash[key] = i
+	return i
+}
+
+// encodeAccessor 把 float 值按模板访问器的分量类型编码
+func (o *gltfRewriter) encodeAccessor(vals []float64, tmpl *GLTFAccessor, target int) int {
+	n := gltfTypeComponents(tmpl.Type)
+	acc := GLTFAccessor{
+		Name:          tmpl.Name,
+		ComponentType: tmpl.ComponentType,
+		Normalized:    tmpl.Normalized,
+		Count:         len(vals) / n,
+		Type:          tmpl.Type,
+		Extensions:    tmpl.Extensions,
+		Extras:        tmpl.Extras,
+	}
+	if tmpl.Min != nil || tmpl.Max != nil {
+		acc.Min, acc.Max = float64Bounds(vals, n)
+	}
+	data := encodeComponents(vals, &acc)
+	// 顶点属性的每个元素必须按 4 字节对齐（例如量化为 byte 的 VEC3 法线）
+	stride := 0
+	if elem := acc.ElementSize(); target == gltfArrayBuffer && elem%4 != 0 {
+		stride = (elem + 3) &^ 3
+		padded := make([]byte, acc.Count*stride)
+		for e := 0; e < acc.Count; e++ {
+			copy(padded[e*stride:], data[e*elem:(e+1)*elem])
+		}
+		data = padded
+	}
+	return o.addAccessor(data, acc, target, stride)
+}
+
+// accessor 原样重新编码源文档中的访问器
+func (o *gltfRewriter) accessor(i int, target int) (int, error) {
+	if ni, ok := o.accMap[i]; ok {
+		return ni, nil
+	}
+	vals, err := o.f.ReadAccessor(i)
+	if err != nil {
+		return 0, err
+	}
+	ni := o.encodeAccessor(vals, &o.f.Doc.Accessors[i], target)
+	o.accMap[i] = ni
+	return ni, nil
+}
+
+// encodeComponents 是 readComponent 的逆过程，矩阵列按 4 字节对齐
+func encodeComponents(vals []float64, acc *GLTFAccessor) []byte {
+	n := gltfTypeComponents(acc.Type)
+	csize := gltfComponentSize(acc.ComponentType)
+	elem := acc.ElementSize()
+	cols, rows := 1, n
+	switch acc.Type {
+	case "MAT2":
+		cols, rows = 2, 2
+	case "MAT3":
+		cols, rows = 3, 3
+	case "MAT4":
+		cols, rows = 4, 4
+	}
+	colStride := rows * csize
+	if cols > 1 {
+		colStride = (rows*csize + 3) &^ 3
+	}
+	count := len(vals) / n
+	out := make([]byte, count*elem)
+	for e := 0; e < count; e++ {
+		for c := 0; c < cols; c++ {
+			for r := 0; r < rows; r++ {
+				putComponent(out[e*elem+c*colStride+r*csize:], vals[e*n+c*rows+r], acc.ComponentType, acc.Normalized)
+			}
+		}
+	}
+	return out
+}
+
+func putComponent(b []byte, v float64, componentType int, normalized bool) {
+	switch componentType {
+	case gltfByte:
+		if normalized {
+			v *= 127
+		}
+		b[0] = byte(int8(clampRound(v, -128, 127)))
+	case gltfUnsignedByte:
+		if normalized {
+			v *= 255
+		}
+		b[0] = byte(clampRound(v, 0, 255))
+	case gltfShort:
+		if normalized {
+			v *= 32767
+		}
+		binary.LittleEndian.PutUint16(b, uint16(int16(clampRound(v, -32768, 32767))))
+	case gltfUnsignedShort:
+		if normalized {
+			v *= 65535
+		}
+		binary.LittleEndian.PutUint16(b, uint16(clampRound(v, 0, 65535)))
+	case gltfUnsignedInt:
+		binary.LittleEndian.PutUint32(b, uint32(clampRound(v, 0, math.MaxUint32)))
+	case gltfFloat:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+	}
+}
+
+func clampRound(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, math.Round(v)))
+}
+
+// float64Bounds 计算每个分量的最小值和最大值
+func float64Bounds(vals []float64, n int) (min, max []float64) {
+	f := make([]float32, len(vals))
+	for i, v := range vals {
+		f[i] = float32(v)
+	}
+	return floatBounds(f, n)
+}
+
+// image 复制图片：内嵌图片按内容去重，外部图片按 URI 去重
+func (o *gltfRewriter) image(i int) (int, error) {
+	if ni, ok := o.imgMap[i]; ok {
+		return ni, nil
+	}
+	img := o.f.Doc.Images[i]
+	var key [32]byte
+	var ni int
+	if img.BufferView != nil {
+		data, err := o.f.ImageData(i)
+		if err != nil {
+			return 0, err
+		}
+		key = sha256.Sum256(data)
+		if prev, ok := o.imgHash[key]; ok {
+			o.imgMap[i] = prev
+			return prev, nil
+		}
+		ni = o.b.addImage(data, img.MimeType, img.Name)
+	} else {
+		key = sha256.Sum256([]byte("uri:" + img.URI))
+		if prev, ok := o.imgHash[key]; ok {
+			o.imgMap[i] = prev
+			return prev, nil
+		}
+		o.b.doc.Images = append(o.b.doc.Images, GLTFImage{Name: img.Name, URI: img.URI, MimeType: img.MimeType})
+		ni = len(o.b.doc.Images) - 1
+	}
+	o.b.doc.Images[ni].Extensions = img.Extensions
+	o.b.doc.Images[ni].Extras = img.Extras
+	o.imgHash[key] = ni
+	o.imgMap[i] = ni
+	return ni, nil
+}
+
+func (o *gltfRewriter) sampler(i int) int {
+	if ni, ok := o.smpMap[i]; ok {
+		return ni
+	}
+	s := o.f.Doc.Samplers[i]
+	name := s.Name
+	s.Name = ""
+	js, _ := json.Marshal(s)
+	if prev, ok := o.smpHash[string(js)]; ok {
+		o.smpMap[i] = prev
+		return prev
+	}
+	s.Name = name
+	o.b.doc.Samplers = append(o.b.doc.Samplers, s)
+	ni := len(o.b.doc.Samplers) - 1
+	o.smpHash[string(js)] = ni
+	o.smpMap[i] = ni
+	return ni
+}
+
+// texture 复制纹理，采样器和图片相同的纹理合并
+func (o *gltfRewriter) texture(i int) (int, error) {
+	if ni, ok := o.texMap[i]; ok {
+		return ni, nil
+	}
+	doc := o.f.Doc
+	if i < 0 || i >= len(doc.Textures) {
+		return 0, fmt.Errorf("texture %d out of range", i)
+	}
+	t := doc.Textures[i]
+	key := [2]int{-1, -1}
+	nt := GLTFTexture{Name: t.Name, Extensions: t.Extensions, Extras: t.Extras}
+	if t.Sampler != nil {
+		s := o.sampler(*t.Sampler)
+		nt.Sampler, key[0] = &s, s
+	}
+	if t.Source != nil {
+		img, err := o.image(*t.Source)
+		if err != nil {
+			return 0, err
+		}
+		nt.Source, key[1] = &img, img
+	}
+	if len(t.Extensions) == 0 {
+		if prev, ok := o.texHash[key]; ok {
+			o.texMap[i] = prev
+			return prev, nil
+		}
+	}
+	o.b.doc.Textures = append(o.b.doc.Textures, nt)
+	ni := len(o.b.doc.Textures) - 1
+	if len(t.Extensions) == 0 {
+		o.texHash[key] = ni
+	}
+	o.texMap[i] = ni
+	return ni, nil
+}
+
+// material 复制材质并重映射纹理；除名称外完全相同的材质合并
+func (o *gltfRewriter) material(i int) (int, error) {
+	if ni, ok := o.matMap[i]; ok {
+		return ni, nil
+	}
+	doc := o.f.Doc
+	if i < 0 || i >= len(doc.Materials) {
+		return 0, fmt.Errorf("material %d out of range", i)
+	}
+	m := cloneMaterial(doc.Materials[i])
+	for _, slot := range materialTextureSlots(&m) {
+		t, err := o.texture(slot.Info.Index)
+		if err != nil {
+			return 0, err
+		}
+		slot.Info.Index = t
+	}
+	for name, raw := range m.Extensions {
+		remapped, err := o.remapExtensionTextures(raw)
+		if err != nil {
+			return 0, fmt.Errorf("material %d extension %s: %w", i, name, err)
+		}
+		m.Extensions[name] = remapped
+	}
+	name := m.Name
+	m.Name = ""
+	js, _ := json.Marshal(m)
+	if prev, ok := o.matHash[string(js)]; ok {
+		o.matMap[i] = prev
+		return prev, nil
+	}
+	m.Name = name
+	o.b.doc.Materials = append(o.b.doc.Materials, m)
+	ni := len(o.b.doc.Materials) - 1
+	o.matHash[string(js)] = ni
+	o.matMap[i] = ni
+	return ni, nil
+}
+
+// cloneMaterial 深拷贝材质，避免修改源文档
+func cloneMaterial(m GLTFMaterial) GLTFMaterial {
+	js, _ := json.Marshal(m)
+	var c GLTFMaterial
+	json.Unmarshal(js, &c)
+	return c
+}
+
+// remapExtensionTextures 重映射材质扩展（KHR_materials_* 等）中以 Texture 结尾的 textureInfo
+func (o *gltfRewriter) remapExtensionTextures(raw json.RawMessage) (json.RawMessage, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return raw, nil
+	}
+	var walk func(v interface{}) error
+	walk = func(v interface{}) error {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, child := range t {
+				if info, ok := child.(map[string]interface{}); ok && strings.HasSuffix(k, "Texture") {
+					if idx, ok := info["index"].(json.Number); ok {
+						old, err := strconv.Atoi(idx.String())
+						if err != nil {
+							return err
+						}
+						ni, err := o.texture(old)
+						if err != nil {
+							return err
+						}
+						info["index"] = ni
+					}
+				}
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			for _, child := range t {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (o *gltfRewriter) skin(i int) (int, error) {
+	if ni, ok := o.skinMap[i]; ok {
+		return ni, nil
+	}
+	doc := o.f.Doc
+	if i < 0 || i >= len(doc.Skins) {
+		return 0, fmt.Errorf("skin %d out of range", i)
+	}
+	s := doc.Skins[i]
+	ns := GLTFSkin{Name: s.Name, Extras: s.Extras, Joints: o.mapNodes(s.Joints)}
+	if s.Skeleton != nil && o.nodeMap[*s.Skeleton] >= 0 {
+		sk := o.nodeMap[*s.Skeleton]
+		ns.Skeleton = &sk
+	}
+	if s.InverseBindMatrices != nil {
+		a, err := o.accessor(*s.InverseBindMatrices, 0)
+		if err != nil {
+			return 0, err
+		}
+		ns.InverseBindMatrices = &a
+	}
+	o.b.doc.Skins = append(o.b.doc.Skins, ns)
+	o.skinMap[i] = len(o.b.doc.Skins) - 1
+	return o.skinMap[i], nil
+}
+
+// animation 复制动画，目标节点已删除的通道一并去掉
+func (o *gltfRewriter) animation(a GLTFAnimation) (GLTFAnimation, error) {
+	na := GLTFAnimation{Name: a.Name, Extras: a.Extras}
+	samplerMap := map[int]int{}
+	for _, c := range a.Channels {
+		if c.Target.Node != nil {
+			if o.nodeMap[*c.Target.Node] < 0 {
+				continue
+			}
+			n := o.nodeMap[*c.Target.Node]
+			c.Target.Node = &n
+		}
+		si, ok := samplerMap[c.Sampler]
+		if !ok {
+			s := a.Samplers[c.Sampler]
+			in, err := o.accessor(s.Input, 0)
+			if err != nil {
+				return na, err
+			}
+			out, err := o.accessor(s.Output, 0)
+			if err != nil {
+				return na, err
+			}
+			na.Samplers = append(na.Samplers, GLTFAnimationSampler{Input: in, Output: out, Interpolation: s.Interpolation, Extras: s.Extras})
+			si = len(na.Samplers) - 1
+			samplerMap[c.Sampler] = si
+		}
+		c.Sampler = si
+		na.Channels = append(na.Channels, c)
+	}
+	return na, nil
+}
+
+// vertexStream 是一个顶点属性（或变形目标属性）解码后的数据
+type vertexStream struct {
+	Name   string // 属性名；变形目标为 "<target>/<属性名>"
+	Tmpl   *GLTFAccessor
+	Comps  int
+	Values []float64
+}
+
+// primData 是解码后的图元：各属性流共用同一套顶点编号
+type primData struct {
+	Prim     GLTFPrimitive
+	Material int    // 去重后的材质编号，-1 表示没有材质
+	Shared   string // 源属性访问器的签名，相同签名的图元共用顶点数据；合并过的图元为空
+	Streams  []vertexStream
+	Indices  []uint32
+	Count    int
+}
+
+func (p *primData) key() string {
+	var parts []string
+	for _, s := range p.Streams {
+		parts = append(parts, fmt.Sprintf("%s:%d:%s:%v", s.Name, s.Tmpl.ComponentType, s.Tmpl.Type, s.Tmpl.Normalized))
+	}
+	return fmt.Sprintf("%d|%d|%s", p.Material, p.Prim.primitiveMode(), strings.Join(parts, ","))
+}
+
+// decodePrimitive 读取图元的全部属性和索引
+func (o *gltfRewriter) decodePrimitive(prim GLTFPrimitive) (*primData, error) {
+	doc := o.f.Doc
+	pd := &primData{Prim: prim, Count: -1}
+	add := func(name string, a int) error {
+		if a < 0 || a >= len(doc.Accessors) {
+			return fmt.Errorf("attribute %s: accessor %d out of range", name, a)
+		}
+		vals, err := o.f.ReadAccessor(a)
+		if err != nil {
+			return err
+		}
+		acc := &doc.Accessors[a]
+		if pd.Count >= 0 && acc.Count != pd.Count {
+			return fmt.Errorf("attribute %s has %d elements, expected %d", name, acc.Count, pd.Count)
+		}
+		pd.Count = acc.Count
+		pd.Streams = append(pd.Streams, vertexStream{Name: name, Tmpl: acc, Comps: gltfTypeComponents(acc.Type), Values: vals})
+		return nil
+	}
+	for _, name := range sortedKeys(prim.Attributes) {
+		if err := add(name, prim.Attributes[name]); err != nil {
+			return nil, err
+		}
+	}
+	for t, target := range prim.Targets {
+		for _, name := range sortedKeys(target) {
+			if err := add(fmt.Sprintf("%d/%s", t, name), target[name]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if pd.Count < 0 {
+		return nil, errors.New("primitive has no attributes")
+	}
+	idx, err := o.f.ReadIndices(&prim)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range idx {
+		if int64(v) >= int64(pd.Count) {
+			return nil, fmt.Errorf("index %d at %d exceeds vertex count %d", v, i, pd.Count)
+		}
+	}
+	pd.Indices = idx
+	return pd, nil
+}
+
+// mesh 复制网格：合并同材质图元，三角形图元做焊接、去退化和缓存重排
+func (o *gltfRewriter) mesh(i int) (int, error) {
+	if ni, ok := o.meshMap[i]; ok {
+		return ni, nil
+	}
+	doc := o.f.Doc
+	if i < 0 || i >= len(doc.Meshes) {
+		return 0, fmt.Errorf("mesh %d out of range", i)
+	}
+	m := doc.Meshes[i]
+	var prims []*primData
+	merged := map[string]*primData{}
+	for j, p := range m.Primitives {
+		pd, err := o.decodePrimitive(p)
+		if err != nil {
+			return 0, fmt.Errorf("mesh %d primitive %d: %w", i, j, err)
+		}
+		sig, _ := json.Marshal([]interface{}{p.Attributes, p.Targets})
+		pd.Shared = string(sig)
+		pd.Material = -1
+		if p.Material != nil {
+			if pd.Material, err = o.material(*p.Material); err != nil {
+				return 0, err
+			}
+		}
+		// 只合并没有扩展的三角形图元，其它图元保持原样
+		mergeable := p.primitiveMode() == gltfTriangles && len(p.Extensions) == 0 && len(p.Extras) == 0
+		if mergeable {
+			if prev, ok := merged[pd.key()]; ok {
+				appendPrimData(prev, pd)
+				prev.Shared = ""
+				o.rep.Merged++
+				continue
+			}
+			merged[pd.key()] = pd
+		}
+		prims = append(prims, pd)
+	}
+
+	// 共用顶点数据的三角形图元一起处理，输出时仍共用同一组访问器
+	var groups [][]*primData
+	shared := map[string]int{}
+	for _, pd := range prims {
+		if pd.Prim.primitiveMode() != gltfTriangles {
+			continue
+		}
+		if g, ok := shared[pd.Shared]; ok && pd.Shared != "" {
+			groups[g] = append(groups[g], pd)
+			continue
+		}
+		shared[pd.Shared] = len(groups)
+		groups = append(groups, []*primData{pd})
+	}
+	for _, g := range groups {
+		o.optimizeTriangles(g)
+	}
+
+	var q *posQuant
+	if o.opts.Quantize && !o.keepPositions[i] {
+		q = quantizePositions(prims)
+	}
+	nm := GLTFMesh{Name: m.Name, Weights: m.Weights, Extensions: m.Extensions, Extras: m.Extras}
+	for _, pd := range prims {
+		nm.Primitives = append(nm.Primitives, o.encodePrimitive(pd, q))
+	}
+	o.b.doc.Meshes = append(o.b.doc.Meshes, nm)
+	ni := len(o.b.doc.Meshes) - 1
+	o.meshMap[i] = ni
+	if q != nil {
+		o.meshQuant[ni] = q
+	}
+	return ni, nil
+}
+
+// appendPrimData 把 src 的顶点和索引追加到 dst（两者属性布局相同）
+func appendPrimData(dst, src *primData) {
+	base := uint32(dst.Count)
+	for k := range dst.Streams {
+		dst.Streams[k].Values = append(dst.Streams[k].Values, src.Streams[k].Values...)
+	}
+	for _, i := range src.Indices {
+		dst.Indices = append(dst.Indices, i+base)
+	}
+	dst.Count += src.Count
+}
+
+// optimizeTriangles 焊接顶点、删除退化三角形、按 Forsyth 算法重排索引，再按首次使用顺序重排顶点。
+// group 中的图元共用同一组顶点数据（来自相同的源访问器）
+func (o *gltfRewriter) optimizeTriangles(group []*primData) {
+	pd := group[0]
+	remap := weldVertices(pd, o.opts.Epsilon)
+	for i, r := range remap {
+		if int(r) != i {
+			o.rep.Welded++
+		}
+	}
+
+	order := make([]int32, pd.Count)
+	for i := range order {
+		order[i] = -1
+	}
+	next := int32(0)
+	for _, p := range group {
+		o.acmrTris[0] += len(p.Indices) / 3
+		o.acmrMiss[0] += cacheMisses(p.Indices, 32)
+
+		tris := make([]uint32, 0, len(p.Indices))
+		for t := 0; t+2 < len(p.Indices); t += 3 {
+			a, b, c := remap[p.Indices[t]], remap[p.Indices[t+1]], remap[p.Indices[t+2]]
+			if a == b || b == c || a == c {
+				o.rep.Degenerate++
+				continue
+			}
+			tris = append(tris, a, b, c)
+		}
+		tris = forsythOrder(tris, pd.Count)
+
+		// 按索引中首次出现的顺序重新编号顶点，未使用的顶点丢弃
+		for k, v := range tris {
+			if order[v] < 0 {
+				order[v] = next
+				next++
+			}
+			tris[k] = uint32(order[v])
+		}
+		p.Indices = tris
+		o.acmrTris[1] += len(tris) / 3
+		o.acmrMiss[1] += cacheMisses(tris, 32)
+	}
+
+	streams := make([]vertexStream, len(pd.Streams))
+	for s, st := range pd.Streams {
+		vals := make([]float64, int(next)*st.Comps)
+		for old, nw := range order {
+			if nw >= 0 {
+				copy(vals[int(nw)*st.Comps:], st.Values[old*st.Comps:(old+1)*st.Comps])
+			}
+		}
+		st.Values = vals
+		streams[s] = st
+	}
+	for _, p := range group {
+		p.Streams = streams
+		p.Count = int(next)
+	}
+}
+
+// weldVertices 把所有属性在容差内相同的顶点合并，返回旧顶点到代表顶点的映射
+func weldVertices(pd *primData, eps float64) []uint32 {
+	remap := make([]uint32, pd.Count)
+	seen := make(map[string]uint32, pd.Count)
+	var key []byte
+	var buf [8]byte
+	for v := 0; v < pd.Count; v++ {
+		key = key[:0]
+		for _, st := range pd.Streams {
+			step := 1e-4
+			if st.Name == "POSITION" || strings.HasSuffix(st.Name, "/POSITION") {
+				step = eps
+			}
+			if st.Tmpl.ComponentType != gltfFloat && !st.Tmpl.Normalized {
+				step = 1 // 整型属性（如 JOINTS_0）必须完全相同
+			}
+			for c := 0; c < st.Comps; c++ {
+				q := int64(math.Round(st.Values[v*st.Comps+c] / step))
+				binary.LittleEndian.PutUint64(buf[:], uint64(q))
+				key = append(key, buf[:]...)
+			}
+		}
+		if prev, ok := seen[string(key)]; ok {
+			remap[v] = prev
+			continue
+		}
+		seen[string(key)] = uint32(v)
+		remap[v] = uint32(v)
+	}
+	return remap
+}
+
+// encodePrimitive 把处理后的图元数据写回构建器
+func (o *gltfRewriter) encodePrimitive(pd *primData, q *posQuant) GLTFPrimitive {
+	p := GLTFPrimitive{
+		Attributes: map[string]int{},
+		Mode:       pd.Prim.Mode,
+		Extensions: pd.Prim.Extensions,
+		Extras:     pd.Prim.Extras,
+	}
+	if pd.Material >= 0 {
+		m := pd.Material
+		p.Material = &m
+	}
+	for _, st := range pd.Streams {
+		if o.opts.Quantize {
+			st = o.quantizeStream(st, q)
+		}
+		a := o.encodeAccessor(st.Values, st.Tmpl, gltfArrayBuffer)
+		if slash := strings.IndexByte(st.Name, '/'); slash >= 0 {
+			t, _ := strconv.Atoi(st.Name[:slash])
+			for len(p.Targets) <= t {
+				p.Targets = append(p.Targets, map[string]int{})
+			}
+			p.Targets[t][st.Name[slash+1:]] = a
+			continue
+		}
+		p.Attributes[st.Name] = a
+	}
+	// 三角形图元总是带索引；其它图元只在原来有索引时保留
+	if len(pd.Indices) > 0 && (pd.Prim.Indices != nil || pd.Prim.primitiveMode() == gltfTriangles) {
+		idx := pd.Indices
+		var max uint32
+		for _, i := range idx {
+			if i > max {
+				max = i
+			}
+		}
+		acc := GLTFAccessor{Count: len(idx), Type: "SCALAR", ComponentType: gltfUnsignedInt}
+		if max < 65535 {
+			acc.ComponentType = gltfUnsignedShort
+		}
+		vals := make([]float64, len(idx))
+		for i, v := range idx {
+			vals[i] = float64(v)
+		}
+		a := o.addAccessor(encodeComponents(vals, &acc), acc, gltfElementArrayBuffer, 0)
+		p.Indices = &a
+	}
+	return p
+}
+
+// cacheMisses 用 FIFO 缓存模拟统计顶点着色器缓存未命中次数
+func cacheMisses(idx []uint32, size int) int {
+	cache := make([]uint32, 0, size)
+	misses := 0
+	for _, v := range idx {
+		hit := false
+		for _, c := range cache {
+			if c == v {
+				hit = true
+				break
+			}
+		}
+		if hit {
+			continue
+		}
+		misses++
+		if len(cache) == size {
+			cache = cache[1:]
+		}
+		cache = append(cache, v)
+	}
+	return misses
+}
+
+// Forsyth 线性时间顶点缓存优化的评分参数
+const (
+	forsythCacheSize   = 32
+	forsythDecayPower  = 1.5
+	forsythLastTri     = 0.75
+	forsythValenceBase = 2.0
+	forsythValencePow  = 0.5
+)
+
+func forsythVertexScore(cachePos, remaining int) float64 {
+	if remaining == 0 {
+		return -1
+	}
+	score := 0.0
+	if cachePos >= 0 {
+		if cachePos < 3 {
+			score = forsythLastTri
+		} else {
+			s := 1 - float64(cachePos-3)/float64(forsythCacheSize-3)
+			score = math.Pow(s, forsythDecayPower)
+		}
+	}
+	return score + forsythValenceBase*math.Pow(float64(remaining), -forsythValencePow)
+}
+
+// forsythOrder 按 Tom Forsyth 的算法重排三角形，提高 GPU 顶点缓存命中率
+func forsythOrder(idx []uint32, vertexCount int) []uint32 {
+	nt := len(idx) / 3
+	if nt == 0 {
+		return idx
+	}
+	// 顶点 -> 相邻三角形
+	valence := make([]int, vertexCount)
+	for _, v := range idx {
+		valence[v]++
+	}
+	offsets := make([]int, vertexCount+1)
+	for v := 0; v < vertexCount; v++ {
+		offsets[v+1] = offsets[v] + valence[v]
+	}
+	adj := make([]int, len(idx))
+	fill := append([]int(nil), offsets[:vertexCount]...)
+	for t := 0; t < nt; t++ {
+		for k := 0; k < 3; k++ {
+			v := idx[3*t+k]
+			adj[fill[v]] = t
+			fill[v]++
+		}
+	}
+	remaining := append([]int(nil), valence...)
+	cachePos := make([]int, vertexCount)
+	vscore := make([]float64, vertexCount)
+	for v := range cachePos {
+		cachePos[v] = -1
+		vscore[v] = forsythVertexScore(-1, remaining[v])
+	}
+	added := make([]bool, nt)
+	tscore := make([]float64, nt)
+	for t := 0; t < nt; t++ {
+		tscore[t] = vscore[idx[3*t]] + vscore[idx[3*t+1]] + vscore[idx[3*t+2]]
+	}
+	out := make([]uint32, 0, len(idx))
+	cache := make([]uint32, 0, forsythCacheSize+3)
+	best := -1
+	scan := 0
+	for len(out) < len(idx) {
+		if best < 0 {
+			// 缓存中没有候选时，线性扫描找一个未输出的三角形里分数最高的
+			bs := -1.0
+			for ; scan < nt && added[scan]; scan++ {
+			}
+			for t := scan; t < nt; t++ {
+				if !added[t] && tscore[t] > bs {
+					bs, best = tscore[t], t
+				}
+			}
+		}
+		t := best
+		added[t] = true
+		tri := idx[3*t : 3*t+3]
+		out = append(out, tri...)
+
+		// 把三角形顶点移到缓存头部
+		newCache := make([]uint32, 0, forsythCacheSize+3)
+		newCache = append(newCache, tri...)
+		for _, v := range cache {
+			if v != tri[0] && v != tri[1] && v != tri[2] {
+				newCache = append(newCache, v)
+			}
+		}
+		for _, v := range tri {
+			remaining[v]--
+			// 从邻接表中删除该三角形
+			lo, hi := offsets[v], offsets[v]+valence[v]
+			for k := lo; k < hi; k++ {
+				if adj[k] == t {
+					adj[k] = adj[hi-1]
+					valence[v]--
+					break
+				}
+			}
+		}
+		// 被挤出缓存的顶点
+		for k := forsythCacheSize; k < len(newCache); k++ {
+			cachePos[newCache[k]] = -1
+			vscore[newCache[k]] = forsythVertexScore(-1, remaining[newCache[k]])
+		}
+		if len(newCache) > forsythCacheSize {
+			newCache = newCache[:forsythCacheSize]
+		}
+		for k, v := range newCache {
+			cachePos[v] = k
+			vscore[v] = forsythVertexScore(k, remaining[v])
+		}
+		cache = newCache
+
+		// 只需更新缓存内顶点相邻三角形的分数，并从中选出下一个
+		best = -1
+		bs := -1.0
+		for _, v := range cache {
+			for k := offsets[v]; k < offsets[v]+valence[v]; k++ {
+				tt := adj[k]
+				tscore[tt] = vscore[idx[3*tt]] + vscore[idx[3*tt+1]] + vscore[idx[3*tt+2]]
+				if tscore[tt] > bs {
+					bs, best = tscore[tt], tt
+				}
+			}
+		}
+	}
+	return out
+}
+
+// optimizeHandler 处理 POST /api/models/*path/optimize，以后台任务执行
+func optimizeHandler(c *gin.Context, rel string) {
+	src, ok := modelFile(c, rel)
+	if !ok {
+		return
+	}
+	opts := OptimizeOptions{
+		Quantize: c.Query("quantize") == "true",
+		Fallback: c.Query("fallback") != "none",
+	}
+	switch c.Query("compress") {
+	case "":
+	case "meshopt":
+		opts.Meshopt = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "compress must be meshopt"})
+		return
+	}
+	if e := c.Query("epsilon"); e != "" {
+		v, err := strconv.ParseFloat(e, 64)
+		if err != nil || v <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "epsilon must be a positive number"})
+			return
+		}
+		opts.Epsilon = v
+	}
+	job, err := jobs.Submit("optimize", dataRelPath(src), requestID(c), func(j *Job) (interface{}, error) {
+		return optimizeGLB(src, opts)
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job": job.ID, "output": dataRelPath(optimizedPath(src))})
+}
+
+// posQuant 是网格位置的反量化参数：原始位置 = 量化值 * Scale + Offset
+type posQuant struct {
+	Offset [3]float64
+	Scale  float64
+}
+
+// quantizePositions 根据网格所有图元的包围盒计算统一缩放的量化参数
+// （各轴缩放相同，法线方向不受影响）；没有 float 位置或含变形目标时返回 nil
+func quantizePositions(prims []*primData) *posQuant {
+	min := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	found := false
+	for _, pd := range prims {
+		if len(pd.Prim.Targets) > 0 {
+			return nil
+		}
+		for _, st := range pd.Streams {
+			if st.Name != "POSITION" {
+				continue
+			}
+			if st.Tmpl.ComponentType != gltfFloat {
+				return nil
+			}
+			for i, v := range st.Values {
+				min[i%3] = math.Min(min[i%3], v)
+				max[i%3] = math.Max(max[i%3], v)
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	extent := math.Max(max[0]-min[0], math.Max(max[1]-min[1], max[2]-min[2]))
+	scale := 1.0
+	if extent > 0 {
+		scale = extent / float64(int(1)<<quantizePositionBits-1)
+	}
+	return &posQuant{Offset: min, Scale: scale}
+}
+
+// quantizeStream 把 float 的 POSITION、NORMAL、TANGENT 和 [0,1] 内的 TEXCOORD 改为整型访问器。
+// 变形目标和其它属性保持不变
+func (o *gltfRewriter) quantizeStream(st vertexStream, q *posQuant) vertexStream {
+	if st.Tmpl.ComponentType != gltfFloat || strings.Contains(st.Name, "/") {
+		return st
+	}
+	acc := *st.Tmpl
+	switch {
+	case st.Name == "POSITION" && q != nil:
+		vals := make([]float64, len(st.Values))
+		for i, v := range st.Values {
+			vals[i] = math.Round((v - q.Offset[i%3]) / q.Scale)
+		}
+		st.Values = vals
+		acc.ComponentType = gltfUnsignedShort
+	case st.Name == "NORMAL" || st.Name == "TANGENT":
+		acc.ComponentType, acc.Normalized = gltfByte, true
+		acc.Min, acc.Max = nil, nil
+	case strings.HasPrefix(st.Name, "TEXCOORD_") && within01(st.Values):
+		acc.ComponentType, acc.Normalized = gltfUnsignedShort, true
+		acc.Min, acc.Max = nil, nil
+	default:
+		return st
+	}
+	st.Tmpl = &acc
+	o.b.useExtension("KHR_mesh_quantization", true)
+	if o.rep.Quantized == nil {
+		o.rep.Quantized = map[string]int{}
+	}
+	o.rep.Quantized[st.Name]++
+	return st
+}
+
+func within01(vals []float64) bool {
+	for _, v := range vals {
+		if v < 0 || v > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// removeString 返回去掉 s 之后的新切片
+func removeString(list []string, s string) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWeldVertices(t *testing.T) {
+	pos := &GLTFAccessor{ComponentType: gltfFloat, Type: "VEC3"}
+	joints := &GLTFAccessor{ComponentType: gltfUnsignedByte, Type: "VEC4"}
+	tests := []struct {
+		name    string
+		streams []vertexStream
+		count   int
+		want    []uint32
+	}{
+		{"identical", []vertexStream{{"POSITION", pos, 3, []float64{0, 0, 0, 1, 0, 0, 0, 0, 0}}}, 3, []uint32{0, 1, 0}},
+		{"within epsilon", []vertexStream{{"POSITION", pos, 3, []float64{0, 0, 0, 1e-7, 0, 0}}}, 2, []uint32{0, 0}},
+		{"outside epsilon", []vertexStream{{"POSITION", pos, 3, []float64{0, 0, 0, 1e-3, 0, 0}}}, 2, []uint32{0, 1}},
+		{"other attribute differs", []vertexStream{
+			{"POSITION", pos, 3, []float64{0, 0, 0, 0, 0, 0}},
+			{"JOINTS_0", joints, 4, []float64{0, 0, 0, 0, 1, 0, 0, 0}},
+		}, 2, []uint32{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := weldVertices(&primData{Streams: tt.streams, Count: tt.count}, 1e-5)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheMisses(t *testing.T) {
+	tests := []struct {
+		idx  []uint32
+		size int
+		want int
+	}{
+		{nil, 4, 0},
+		{[]uint32{0, 1, 2, 2, 1, 3}, 4, 4},
+		{[]uint32{0, 1, 2, 3, 0}, 3, 5}, // 0 已被挤出 FIFO
+	}
+	for _, tt := range tests {
+		if got := cacheMisses(tt.idx, tt.size); got != tt.want {
+			t.Errorf("cacheMisses(%v, %d) = %d, want %d", tt.idx, tt.size, got, tt.want)
+		}
+	}
+}
+
+// gridIndices 生成 n×n 网格的三角形索引，按列优先排列以制造较差的缓存顺序
+func gridIndices(n int) []uint32 {
+	var idx []uint32
+	at := func(x, y int) uint32 { return uint32(y*(n+1) + x) }
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			idx = append(idx, at(x, y), at(x+1, y), at(x, y+1), at(x+1, y), at(x+1, y+1), at(x, y+1))
+		}
+	}
+	return idx
+}
+
+// triangleSet 把三角形规范化为可比较的集合（忽略顶点起点）
+func triangleSet(idx []uint32) [][3]uint32 {
+	var tris [][3]uint32
+	for i := 0; i+2 < len(idx); i += 3 {
+		a, b, c := idx[i], idx[i+1], idx[i+2]
+		for a > b || a > c {
+			a, b, c = b, c, a
+		}
+		tris = append(tris, [3]uint32{a, b, c})
+	}
+	sort.Slice(tris, func(i, j int) bool {
+		for k := 0; k < 3; k++ {
+			if tris[i][k] != tris[j][k] {
+				return tris[i][k] < tris[j][k]
+			}
+		}
+		return false
+	})
+	return tris
+}
+
+func TestForsythOrder(t *testing.T) {
+	const n = 32
+	idx := gridIndices(n)
+	got := forsythOrder(append([]uint32(nil), idx...), (n+1)*(n+1))
+	want, have := triangleSet(idx), triangleSet(got)
+	if len(want) != len(have) {
+		t.Fatalf("got %d triangles, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if want[i] != have[i] {
+			t.Fatalf("triangle %d: got %v, want %v (winding or set changed)", i, have[i], want[i])
+		}
+	}
+	if before, after := cacheMisses(idx, 16), cacheMisses(got, 16); after >= before {
+		t.Fatalf("cache misses %d -> %d, expected an improvement", before, after)
+	}
+}
+
+// writeGridGLB 写入 n×n 个方格组成的不带索引网格（每个方格两个三角形、6 个顶点），
+// 最后再加一个退化三角形
+func writeGridGLB(t *testing.T, file string, n int) {
+	t.Helper()
+	var pos []float32
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			x0, y0, x1, y1 := float32(x), float32(y), float32(x+1), float32(y+1)
+			pos = append(pos, x0, y0, 0, x1, y0, 0, x1, y1, 0, x0, y0, 0, x1, y1, 0, x0, y1, 0)
+		}
+	}
+	pos = append(pos, 0, 0, 0, 0, 0, 0, 1, 0, 0)
+	b := newGLTFBuilder("test")
+	a := b.addFloatAccessor(pos, "VEC3", true)
+	b.doc.Meshes = []GLTFMesh{{Primitives: []GLTFPrimitive{{Attributes: map[string]int{"POSITION": a}}}}}
+	b.doc.Nodes = []GLTFNode{{Mesh: intPtr(0)}}
+	b.doc.Scenes = []GLTFScene{{Nodes: []int{0}}}
+	glb, err := b.glb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, glb, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptimizeGLB(t *testing.T) {
+	const n = 16
+	root := setTestDataRoot(t)
+	src := filepath.Join(root, "grid.glb")
+	writeGridGLB(t, src, n)
+	tests := []struct {
+		name      string
+		opts      OptimizeOptions
+		extension string
+	}{
+		{"plain", OptimizeOptions{}, ""},
+		{"quantize", OptimizeOptions{Quantize: true}, "KHR_mesh_quantization"},
+		{"meshopt", OptimizeOptions{Meshopt: true, Fallback: true}, "EXT_meshopt_compression"},
+		{"quantize and meshopt", OptimizeOptions{Quantize: true, Meshopt: true}, "EXT_meshopt_compression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep, err := optimizeGLB(src, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 焊接后每个格点只剩一个顶点，退化三角形被丢弃
+			if rep.Before.Vertices != 6*n*n+3 || rep.After.Vertices != (n+1)*(n+1) || rep.After.Triangles != 2*n*n || rep.Degenerate != 1 {
+				t.Fatalf("unexpected report %+v", rep)
+			}
+			if rep.ACMRAfter > rep.ACMRBefore {
+				t.Fatalf("ACMR got worse: %v -> %v", rep.ACMRBefore, rep.ACMRAfter)
+			}
+			out := filepath.Join(root, rep.Output)
+			ins, err := inspectModel(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ins.Validation.Valid {
+				t.Fatalf("optimized GLB is invalid: %+v", ins.Validation.Errors)
+			}
+			f, err := loadGLTF(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			used := tt.extension == ""
+			for _, e := range f.Doc.ExtensionsUsed {
+				used = used || e == tt.extension
+			}
+			if !used {
+				t.Fatalf("extensionsUsed = %v, want %s", f.Doc.ExtensionsUsed, tt.extension)
+			}
+			// 压缩或量化后的数据经节点变换后必须还原到原来的格点上
+			var node GLTFNode
+			for _, nd := range f.Doc.Nodes {
+				if nd.Mesh != nil {
+					node = nd
+				}
+			}
+			pos, err := f.ReadAccessor(f.Doc.Meshes[*node.Mesh].Primitives[0].Attributes["POSITION"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, v := range pos {
+				if node.Scale != nil {
+					v = v*node.Scale[i%3] + node.Translation[i%3]
+				}
+				if math.Abs(v-math.Round(v)) > 1e-2 || v < 0 || v > n {
+					t.Fatalf("position component %d = %v is off the grid", i, v)
+				}
+			}
+		})
+	}
+}
+
+func TestOptimizeGLBIndexOutOfRange(t *testing.T) {
+	root := setTestDataRoot(t)
+	src := filepath.Join(root, "bad.glb")
+	b := newGLTFBuilder("test")
+	a := b.addFloatAccessor([]float32{0, 0, 0, 1, 0, 0, 0, 1, 0}, "VEC3", true)
+	idx := b.addIndexAccessor([]uint32{0, 1, 3})
+	b.doc.Meshes = []GLTFMesh{{Primitives: []GLTFPrimitive{{Attributes: map[string]int{"POSITION": a}, Indices: intPtr(idx)}}}}
+	b.doc.Nodes = []GLTFNode{{Mesh: intPtr(0)}}
+	b.doc.Scenes = []GLTFScene{{Nodes: []int{0}}}
+	glb, err := b.glb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, glb, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := optimizeGLB(src, OptimizeOptions{}); err == nil || !strings.Contains(err.Error(), "exceeds vertex count") {
+		t.Fatalf("got %v, want an index range error", err)
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cloudPoint 是读入内存的一个点，位置相对于点云的 offset 存为 float32
+type cloudPoint struct {
+	X, Y, Z float32
+	R, G, B uint8
+}
+
+// pointSet 是读取 PLY/XYZ 后得到的点集
+type pointSet struct {
+	Offset   [3]float64 // 第一个点的坐标，避免大坐标在 float32 下丢精度
+	Points   []cloudPoint
+	HasColor bool
+}
+
+func (ps *pointSet) add(x, y, z float64, r, g, b uint8) {
+	if len(ps.Points) == 0 {
+		ps.Offset = [3]float64{x, y, z}
+	}
+	ps.Points = append(ps.Points, cloudPoint{
+		X: float32(x - ps.Offset[0]),
+		Y: float32(y - ps.Offset[1]),
+		Z: float32(z - ps.Offset[2]),
+		R: r, G: g, B: b,
+	})
+}
+
+// readPointFile 根据扩展名读取 PLY 或 XYZ/CSV/TXT 点文件，maxPoints 为 0 表示不限
+func readPointFile(file string, maxPoints int) (*pointSet, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 1<<20)
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".ply":
+		return readPLY(r, maxPoints)
+	case ".xyz", ".csv", ".txt", ".pts":
+		return readXYZ(r, maxPoints)
+	default:
+		return nil, fmt.Errorf("unsupported point cloud format %q", ext)
+	}
+}
+
+var errTooManyPoints = errors.New("point cloud exceeds the point limit")
+
+// plyMaxListLen 是 list 属性（例如 face 的顶点列表）允许的最大元素个数
+const plyMaxListLen = 1 << 16
+
+// plyProperty 是 PLY 头中声明的一个属性；list 属性有单独的计数类型
+type plyProperty struct {
+	Name      string
+	Type      string
+	List      bool
+	CountType string
+}
+
+type plyElement struct {
+	Name  string
+	Count int
+	Props []plyProperty
+}
+
+// plyTypeSize 返回 PLY 标量类型的字节数
+func plyTypeSize(t string) int {
+	switch t {
+	case "char", "uchar", "int8", "uint8":
+		return 1
+	case "short", "ushort", "int16", "uint16":
+		return 2
+	case "int", "uint", "float", "int32", "uint32", "float32":
+		return 4
+	case "double", "float64":
+		return 8
+	}
+	return 0
+}
+
+// readPLY 支持 ascii、binary_little_endian 和 binary_big_endian 三种编码
+func readPLY(r *bufio.Reader, maxPoints int) (*pointSet, error) {
+	format, elems, err := readPLYHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch format {
+	case "ascii":
+	case "binary_little_endian":
+		order = binary.LittleEndian
+	case "binary_big_endian":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("ply: unsupported format %q", format)
+	}
+	for _, e := range elems {
+		for _, p := range e.Props {
+			if plyTypeSize(p.Type) == 0 || p.List && plyTypeSize(p.CountType) == 0 {
+				return nil, fmt.Errorf("ply: unknown type in property %q", p.Name)
+			}
+		}
+	}
+
+	ps := &pointSet{}
+	for _, e := range elems {
+		if e.Name != "vertex" {
+			if err := skipPLYElement(r, e, order); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if maxPoints > 0 && e.Count > maxPoints {
+			return nil, errTooManyPoints
+		}
+		if err := readPLYVertices(r, e, order, ps); err != nil {
+			return nil, err
+		}
+	}
+	if len(ps.Points) == 0 {
+		return nil, errors.New("ply: no vertices")
+	}
+	return ps, nil
+}
+
+// readPLYHeader 解析 PLY 文件头，返回编码格式和元素声明
+func readPLYHeader(r *bufio.Reader) (string, []*plyElement, error) {
+	line, err := r.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "ply" {
+		return "", nil, errors.New("ply: missing magic")
+	}
+	var format string
+	var elems []*plyElement
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", nil, errors.New("ply: unterminated header")
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		switch f[0] {
+		case "format":
+			if len(f) < 2 {
+				return "", nil, errors.New("ply: malformed format line")
+			}
+			format = f[1]
+		case "element":
+			if len(f) < 3 {
+				return "", nil, errors.New("ply: malformed element line")
+			}
+			n, err := strconv.Atoi(f[2])
+			if err != nil || n < 0 {
+				return "", nil, fmt.Errorf("ply: bad element count %q", f[2])
+			}
+			elems = append(elems, &plyElement{Name: f[1], Count: n})
+		case "property":
+			if len(elems) == 0 {
+				return "", nil, errors.New("ply: property before element")
+			}
+			e := elems[len(elems)-1]
+			switch {
+			case len(f) >= 5 && f[1] == "list":
+				e.Props = append(e.Props, plyProperty{Name: f[4], Type: f[3], List: true, CountType: f[2]})
+			case len(f) >= 3:
+				e.Props = append(e.Props, plyProperty{Name: f[2], Type: f[1]})
+			default:
+				return "", nil, errors.New("ply: malformed property line")
+			}
+		case "end_header":
+			return format, elems, nil
+		}
+	}
+}
+
+// readPLYVertices 读取 vertex 元素中的坐标和颜色，其余属性忽略
+func readPLYVertices(r *bufio.Reader, e *plyElement, order binary.ByteOrder, ps *pointSet) error {
+	idx := map[string]int{}
+	for i, p := range e.Props {
+		idx[p.Name] = i
+	}
+	ix, okx := idx["x"]
+	iy, oky := idx["y"]
+	iz, okz := idx["z"]
+	if !okx || !oky || !okz {
+		return errors.New("ply: vertex element lacks x/y/z")
+	}
+	ir, okr := idx["red"]
+	ig, okg := idx["green"]
+	ib, okb := idx["blue"]
+	if !okr {
+		ir, okr = idx["diffuse_red"]
+		ig, okg = idx["diffuse_green"]
+		ib, okb = idx["diffuse_blue"]
+	}
+	ps.HasColor = okr && okg && okb
+	colorScale := 1.0
+	if ps.HasColor {
+		switch e.Props[ir].Type {
+		case "float", "double", "float32", "float64":
+			colorScale = 255
+		case "ushort", "uint16":
+			colorScale = 1.0 / 257
+		}
+	}
+	// 预分配以文件头声明的数量为准，但设上限，避免伪造的头部一次性申请过多内存
+	prealloc := e.Count
+	if prealloc > 1<<22 {
+		prealloc = 1 << 22
+	}
+	ps.Points = make([]cloudPoint, 0, prealloc)
+	vals := make([]float64, len(e.Props))
+	for n := 0; n < e.Count; n++ {
+		if order == nil {
+			if err := readPLYASCIIRow(r, e, vals); err != nil {
+				return fmt.Errorf("ply: vertex %d: %w", n, err)
+			}
+		} else if err := readPLYBinaryRow(r, e, order, vals); err != nil {
+			return fmt.Errorf("ply: vertex %d: %w", n, err)
+		}
+		var cr, cg, cb uint8 = 255, 255, 255
+		if ps.HasColor {
+			cr, cg, cb = clampByte(vals[ir]*colorScale), clampByte(vals[ig]*colorScale), clampByte(vals[ib]*colorScale)
+		}
+		ps.add(vals[ix], vals[iy], vals[iz], cr, cg, cb)
+	}
+	return nil
+}
+
+func readPLYASCIIRow(r *bufio.Reader, e *plyElement, vals []float64) error {
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return err
+	}
+	f := strings.Fields(line)
+	k := 0
+	for i, p := range e.Props {
+		if p.List {
+			if k >= len(f) {
+				return errors.New("truncated row")
+			}
+			n, err := strconv.Atoi(f[k])
+			if err != nil {
+				return fmt.Errorf("list count: %w", err)
+			}
+			if n < 0 || n > plyMaxListLen || k+n >= len(f) {
+				return fmt.Errorf("invalid list count %d", n)
+			}
+			k += 1 + n
+			continue
+		}
+		if k >= len(f) {
+			return errors.New("truncated row")
+		}
+		v, err := strconv.ParseFloat(f[k], 64)
+		if err != nil {
+			return err
+		}
+		vals[i] = v
+		k++
+	}
+	return nil
+}
+
+func readPLYBinaryRow(r *bufio.Reader, e *plyElement, order binary.ByteOrder, vals []float64) error {
+	var buf [8]byte
+	for i, p := range e.Props {
+		if p.List {
+			cs := plyTypeSize(p.CountType)
+			if _, err := io.ReadFull(r, buf[:cs]); err != nil {
+				return err
+			}
+			c := plyDecode(buf[:cs], p.CountType, order)
+			if !(c >= 0 && c <= plyMaxListLen) {
+				return fmt.Errorf("invalid list count %v", c)
+			}
+			n := int(c)
+			if _, err := r.Discard(n * plyTypeSize(p.Type)); err != nil {
+				return err
+			}
+			continue
+		}
+		sz := plyTypeSize(p.Type)
+		if _, err := io.ReadFull(r, buf[:sz]); err != nil {
+			return err
+		}
+		vals[i] = plyDecode(buf[:sz], p.Type, order)
+	}
+	return nil
+}
+
+// skipPLYElement 跳过不关心的元素（例如 face）
+func skipPLYElement(r *bufio.Reader, e *plyElement, order binary.ByteOrder) error {
+	fixed := 0
+	hasList := false
+	for _, p := range e.Props {
+		if p.List {
+			hasList = true
+		} else {
+			fixed += plyTypeSize(p.Type)
+		}
+	}
+	for n := 0; n < e.Count; n++ {
+		switch {
+		case order == nil:
+			if _, err := r.ReadString('\n'); err != nil {
+				return nil
+			}
+		case !hasList:
+			if _, err := r.Discard(fixed * (e.Count - n)); err != nil {
+				return err
+			}
+			return nil
+		default:
+			vals := make([]float64, len(e.Props))
+			if err := readPLYBinaryRow(r, e, order, vals); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func plyDecode(b []byte, t string, order binary.ByteOrder) float64 {
+	switch t {
+	case "char", "int8":
+		return float64(int8(b[0]))
+	case "uchar", "uint8":
+		return float64(b[0])
+	case "short", "int16":
+		return float64(int16(order.Uint16(b)))
+	case "ushort", "uint16":
+		return float64(order.Uint16(b))
+	case "int", "int32":
+		return float64(int32(order.Uint32(b)))
+	case "uint", "uint32":
+		return float64(order.Uint32(b))
+	case "float", "float32":
+		return float64(math.Float32frombits(order.Uint32(b)))
+	case "double", "float64":
+		return math.Float64frombits(order.Uint64(b))
+	}
+	return 0
+}
+
+func clampByte(v float64) uint8 {
+	switch {
+	case v <= 0 || math.IsNaN(v):
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// readXYZ 读取每行 "x y z [r g b]" 的文本点文件，分隔符可以是空白、逗号或分号；
+// 无法解析为数字的行（如 CSV 表头）跳过。颜色范围由前 1000 个点判断：全部不超过 1 时按 0~1 处理
+func readXYZ(r *bufio.Reader, maxPoints int) (*pointSet, error) {
+	const probe = 1000
+	ps := &pointSet{HasColor: true}
+	var probed [][3]float64
+	scale := 0.0 // 0 表示颜色范围尚未确定
+	decide := func() {
+		scale = 255
+		for _, c := range probed {
+			if c[0] > 1 || c[1] > 1 || c[2] > 1 {
+				scale = 1
+				break
+			}
+		}
+		for i, c := range probed {
+			p := &ps.Points[i]
+			p.R, p.G, p.B = clampByte(c[0]*scale), clampByte(c[1]*scale), clampByte(c[2]*scale)
+		}
+		probed = nil
+	}
+	split := func(c rune) bool { return c == ' ' || c == '\t' || c == ',' || c == ';' }
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		f := strings.FieldsFunc(sc.Text(), split)
+		if len(f) < 3 {
+			continue
+		}
+		var v [6]float64
+		n := len(f)
+		if n > 6 {
+			n = 6
+		}
+		ok := true
+		for i := 0; i < n; i++ {
+			x, err := strconv.ParseFloat(f[i], 64)
+			if err != nil {
+				ok = false
+				break
+			}
+			v[i] = x
+		}
+		if !ok {
+			continue
+		}
+		if maxPoints > 0 && len(ps.Points) >= maxPoints {
+			return nil, errTooManyPoints
+		}
+		if n < 6 {
+			ps.HasColor = false
+		}
+		ps.add(v[0], v[1], v[2], 255, 255, 255)
+		if !ps.HasColor {
+			continue
+		}
+		if scale == 0 {
+			probed = append(probed, [3]float64{v[3], v[4], v[5]})
+			if len(probed) == probe {
+				decide()
+			}
+			continue
+		}
+		p := &ps.Points[len(ps.Points)-1]
+		p.R, p.G, p.B = clampByte(v[3]*scale), clampByte(v[4]*scale), clampByte(v[5]*scale)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ps.Points) == 0 {
+		return nil, errors.New("xyz: no points")
+	}
+	if ps.HasColor && scale == 0 {
+		decide()
+	}
+	if !ps.HasColor {
+		for i := range ps.Points {
+			p := &ps.Points[i]
+			p.R, p.G, p.B = 255, 255, 255
+		}
+	}
+	return ps, nil
+}
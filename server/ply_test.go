@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+const plyASCIIHeader = "ply\nformat ascii 1.0\nelement vertex 2\nproperty float x\nproperty float y\nproperty float z\nproperty list uchar int extra\nend_header\n"
+
+func TestReadPLYASCII(t *testing.T) {
+	ps, err := readPLY(bufio.NewReader(strings.NewReader(plyASCIIHeader+"1 2 3 2 7 8\n4 5 6 0\n")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.Points) != 2 || ps.Offset != [3]float64{1, 2, 3} || ps.Points[1].X != 3 {
+		t.Fatalf("unexpected points %+v offset %v", ps.Points, ps.Offset)
+	}
+}
+
+func TestReadPLYMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"missing magic", "plx\nformat ascii 1.0\nend_header\n"},
+		{"unterminated header", "ply\nformat ascii 1.0\nelement vertex 1\n"},
+		{"negative element count", "ply\nformat ascii 1.0\nelement vertex -1\nend_header\n"},
+		{"property before element", "ply\nformat ascii 1.0\nproperty float x\nend_header\n"},
+		{"unknown type", "ply\nformat ascii 1.0\nelement vertex 1\nproperty quad x\nend_header\n1\n"},
+		{"unknown format", "ply\nformat packed 1.0\nelement vertex 1\nproperty float x\nend_header\n"},
+		{"missing xyz", "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nend_header\n1\n"},
+		{"negative list count", plyASCIIHeader + "1 2 3 -1\n4 5 6 0\n"},
+		{"list count past row", plyASCIIHeader + "1 2 3 9 1\n4 5 6 0\n"},
+		{"huge list count", plyASCIIHeader + "1 2 3 99999999 1\n4 5 6 0\n"},
+		{"non-numeric list count", plyASCIIHeader + "1 2 3 x\n4 5 6 0\n"},
+		{"truncated row", plyASCIIHeader + "1 2\n"},
+		{"no vertices", "ply\nformat ascii 1.0\nelement vertex 0\nproperty float x\nproperty float y\nproperty float z\nend_header\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readPLY(bufio.NewReader(strings.NewReader(tt.data)), 0); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadPLYBinaryListCount(t *testing.T) {
+	header := "ply\nformat binary_little_endian 1.0\nelement vertex 1\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list int int vertex_indices\nend_header\n"
+	var b bytes.Buffer
+	b.WriteString(header)
+	for _, v := range []float32{1, 2, 3} {
+		binary.Write(&b, binary.LittleEndian, math.Float32bits(v))
+	}
+	for _, count := range []int32{-1, plyMaxListLen + 1, math.MaxInt32} {
+		data := append(append([]byte(nil), b.Bytes()...), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(data[len(data)-4:], uint32(count))
+		if _, err := readPLY(bufio.NewReader(bytes.NewReader(data)), 0); err == nil {
+			t.Errorf("list count %d: expected an error", count)
+		}
+	}
+}
+
+func TestReadPLYPointLimit(t *testing.T) {
+	data := "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n1 1 1\n2 2 2\n"
+	if _, err := readPLY(bufio.NewReader(strings.NewReader(data)), 2); !errors.Is(err, errTooManyPoints) {
+		t.Fatalf("got %v, want errTooManyPoints", err)
+	}
+}
+
+func TestReadXYZ(t *testing.T) {
+	ps, err := readXYZ(bufio.NewReader(strings.NewReader("# header\nx,y,z\n1,2,3\nbad line\n4;5;6\n1 2\n")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.Points) != 2 || ps.HasColor {
+		t.Fatalf("got %d points (color %v), want 2 without color", len(ps.Points), ps.HasColor)
+	}
+	if _, err := readXYZ(bufio.NewReader(strings.NewReader("1 2 3\n4 5 6\n")), 1); !errors.Is(err, errTooManyPoints) {
+		t.Fatalf("got %v, want errTooManyPoints", err)
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 八叉树切片参数：每个节点在 pcGrid³ 的网格里每格最多保留一个点，
+// 其余点下放到子节点；点数不超过 pcNodePoints 的节点直接作为叶子
+const (
+	pcGrid         = 128
+	pcNodePoints   = 65536
+	pcMaxDepth     = 20
+	pcDefaultLimit = 20_000_000 // 切片时所有点都在内存中，每点 16 字节，2000 万点约 0.5 GB
+)
+
+// 节点数据块格式（小端）：
+//
+//	0  "TPC1"
+//	4  uint32 点数 n
+//	8  uint32 标志位，bit0 表示带颜色
+//	12 uint32 保留
+//	16 float64×3 节点立方体最小角（绝对坐标）
+//	40 float64 立方体边长
+//	48 uint16×3×n 量化坐标，x = min + q/65535*size
+//	.. 补齐到 4 字节
+//	.. uint8×3×n RGB 颜色（带颜色时）
+const (
+	pcChunkMagic  = "TPC1"
+	pcChunkHeader = 48
+	pcFlagColor   = 1
+)
+
+// pcIngesting 记录正在切片的点云 id，同一 id 同时只能有一个任务，避免共用临时目录
+var pcIngesting = struct {
+	sync.Mutex
+	m map[string]bool
+}{m: map[string]bool{}}
+
+var (
+	pointCloudIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	nodeIDPattern       = regexp.MustCompile(`^r[0-7]{0,20}$`)
+)
+
+// PointCloudNode 是层级文件中的一个八叉树节点
+type PointCloudNode struct {
+	ID       string     `json:"id"`
+	Level    int        `json:"level"`
+	Points   int        `json:"points"`
+	Min      [3]float64 `json:"min"`
+	Size     float64    `json:"size"`
+	Spacing  float64    `json:"spacing"` // 该层点间距，客户端据此计算屏幕空间误差
+	Children []string   `json:"children,omitempty"`
+}
+
+// PointCloudMeta 是 metadata.json 的内容
+type PointCloudMeta struct {
+	ID       string           `json:"id"`
+	Source   string           `json:"source"`
+	Points   int              `json:"points"`
+	HasColor bool             `json:"hasColor"`
+	Min      [3]float64       `json:"min"`
+	Max      [3]float64       `json:"max"`
+	Spacing  float64          `json:"spacing"`
+	Depth    int              `json:"depth"`
+	Format   string           `json:"format"`
+	Created  time.Time        `json:"created"`
+	Nodes    []PointCloudNode `json:"nodes,omitempty"`
+}
+
+// pointCloudRoot 返回点云切片的存放目录
+func pointCloudRoot() string {
+	return filepath.Join(dataRoot, "pointclouds")
+}
+
+// octreeBuilder 递归地把点集写成八叉树节点文件
+type octreeBuilder struct {
+	dir      string
+	offset   [3]float64
+	hasColor bool
+	nodes    []PointCloudNode
+	occupied []uint64
+	written  int
+	total    int
+	depth    int
+	progress func(float64)
+}
+
+// buildPointCloud 读取点文件并生成八叉树切片，完成后替换同 id 的旧数据
+func buildPointCloud(id, src string, limit int, progress func(float64)) (*PointCloudMeta, error) {
+	ps, err := readPointFile(src, limit)
+	if err != nil {
+		return nil, err
+	}
+	progress(0.2)
+
+	// 打乱顺序，使每个节点的网格抽样不偏向文件中的扫描顺序；固定种子保证结果可复现
+	rng := rand.New(rand.NewSource(1))
+	rng.Shuffle(len(ps.Points), func(i, j int) { ps.Points[i], ps.Points[j] = ps.Points[j], ps.Points[i] })
+
+	lo := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	hi := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range ps.Points {
+		for i, v := range [3]float32{p.X, p.Y, p.Z} {
+			lo[i] = math.Min(lo[i], float64(v))
+			hi[i] = math.Max(hi[i], float64(v))
+		}
+	}
+	size := math.Max(hi[0]-lo[0], math.Max(hi[1]-lo[1], hi[2]-lo[2]))
+	if size == 0 {
+		size = 1
+	}
+	// 稍微放大立方体，保证最大值落在最后一个格子内
+	size *= 1 + 1e-6
+
+	root := pointCloudRoot()
+	final := filepath.Join(root, id)
+	tmp := filepath.Join(root, "."+id+".tmp")
+	os.RemoveAll(tmp)
+	if err := os.MkdirAll(filepath.Join(tmp, "nodes"), 0755); err != nil {
+		return nil, err
+	}
+	b := &octreeBuilder{
+		dir:      tmp,
+		offset:   ps.Offset,
+		hasColor: ps.HasColor,
+		occupied: make([]uint64, pcGrid*pcGrid*pcGrid/64),
+		total:    len(ps.Points),
+		progress: func(f float64) { progress(0.2 + 0.8*f) },
+	}
+	if err := b.build("r", 0, lo, size, ps.Points); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	sort.Slice(b.nodes, func(i, j int) bool {
+		if len(b.nodes[i].ID) != len(b.nodes[j].ID) {
+			return len(b.nodes[i].ID) < len(b.nodes[j].ID)
+		}
+		return b.nodes[i].ID < b.nodes[j].ID
+	})
+
+	meta := &PointCloudMeta{
+		ID:       id,
+		Source:   dataRelPath(src),
+		Points:   len(ps.Points),
+		HasColor: ps.HasColor,
+		Spacing:  size / pcGrid,
+		Depth:    b.depth,
+		Format:   "tpc1",
+		Created:  time.Now().UTC(),
+		Nodes:    b.nodes,
+	}
+	for i := 0; i < 3; i++ {
+		meta.Min[i] = lo[i] + ps.Offset[i]
+		meta.Max[i] = hi[i] + ps.Offset[i]
+	}
+	js, err := json.Marshal(meta)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "metadata.json"), js, 0644); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	os.RemoveAll(final)
+	if err := os.Rename(tmp, final); err != nil {
+		return nil, err
+	}
+	// 任务结果里不带节点列表，完整层级通过 GET /api/pointclouds/:id 获取
+	meta.Nodes = nil
+	return meta, nil
+}
+
+// build 处理一个节点：网格抽样出本层的点，剩余点按八分体下放给子节点
+func (b *octreeBuilder) build(id string, level int, min [3]float64, size float64, pts []cloudPoint) error {
+	if level > b.depth {
+		b.depth = level
+	}
+	node := PointCloudNode{
+		ID:      id,
+		Level:   level,
+		Size:    size,
+		Spacing: size / pcGrid,
+	}
+	for i := range min {
+		node.Min[i] = min[i] + b.offset[i]
+	}
+
+	keep := len(pts)
+	if len(pts) > pcNodePoints && level < pcMaxDepth {
+		keep = b.sample(min, size, pts)
+	}
+	if err := b.writeChunk(id, node.Min, size, min, pts[:keep]); err != nil {
+		return err
+	}
+	node.Points = keep
+	b.written += keep
+	b.progress(float64(b.written) / float64(b.total))
+
+	rest := pts[keep:]
+	if len(rest) > 0 {
+		half := size / 2
+		mid := [3]float64{min[0] + half, min[1] + half, min[2] + half}
+		for oct, part := range splitOctants(rest, mid) {
+			if len(part) == 0 {
+				continue
+			}
+			childMin := min
+			for axis := 0; axis < 3; axis++ {
+				if oct&(4>>axis) != 0 {
+					childMin[axis] = mid[axis]
+				}
+			}
+			childID := fmt.Sprintf("%s%d", id, oct)
+			node.Children = append(node.Children, childID)
+			if err := b.build(childID, level+1, childMin, half, part); err != nil {
+				return err
+			}
+		}
+	}
+	b.nodes = append(b.nodes, node)
+	return nil
+}
+
+// sample 在节点网格中每格保留第一个点，把保留的点移到切片前部，返回保留数量
+func (b *octreeBuilder) sample(min [3]float64, size float64, pts []cloudPoint) int {
+	for i := range b.occupied {
+		b.occupied[i] = 0
+	}
+	scale := pcGrid / size
+	k := 0
+	for i := range pts {
+		p := &pts[i]
+		x := gridCell(float64(p.X)-min[0], scale)
+		y := gridCell(float64(p.Y)-min[1], scale)
+		z := gridCell(float64(p.Z)-min[2], scale)
+		cell := (x*pcGrid+y)*pcGrid + z
+		if b.occupied[cell/64]&(1<<(cell%64)) != 0 {
+			continue
+		}
+		b.occupied[cell/64] |= 1 << (cell % 64)
+		pts[k], pts[i] = pts[i], pts[k]
+		k++
+		if k == pcNodePoints {
+			break
+		}
+	}
+	return k
+}
+
+func gridCell(v, scale float64) int {
+	c := int(v * scale)
+	if c < 0 {
+		return 0
+	}
+	if c >= pcGrid {
+		return pcGrid - 1
+	}
+	return c
+}
+
+// splitOctants 原地把点按八分体分组，下标为 x<<2|y<<1|z（1 表示在中点之上）
+func splitOctants(pts []cloudPoint, mid [3]float64) [8][]cloudPoint {
+	var out [8][]cloudPoint
+	coord := func(p *cloudPoint, axis int) float64 {
+		switch axis {
+		case 0:
+			return float64(p.X)
+		case 1:
+			return float64(p.Y)
+		}
+		return float64(p.Z)
+	}
+	var split func(pts []cloudPoint, axis, oct int)
+	split = func(pts []cloudPoint, axis, oct int) {
+		if axis == 3 {
+			out[oct] = pts
+			return
+		}
+		i := 0
+		for j := range pts {
+			if coord(&pts[j], axis) < mid[axis] {
+				pts[i], pts[j] = pts[j], pts[i]
+				i++
+			}
+		}
+		split(pts[:i], axis+1, oct)
+		split(pts[i:], axis+1, oct|4>>axis)
+	}
+	split(pts, 0, 0)
+	return out
+}
+
+// writeChunk 把节点的点量化后写成二进制块
+func (b *octreeBuilder) writeChunk(id string, absMin [3]float64, size float64, relMin [3]float64, pts []cloudPoint) error {
+	n := len(pts)
+	posBytes := (6*n + 3) &^ 3
+	buf := make([]byte, pcChunkHeader+posBytes, pcChunkHeader+posBytes+3*n)
+	copy(buf, pcChunkMagic)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(n))
+	if b.hasColor {
+		binary.LittleEndian.PutUint32(buf[8:], pcFlagColor)
+	}
+	for i := 0; i < 3; i++ {
+		binary.LittleEndian.PutUint64(buf[16+8*i:], math.Float64bits(absMin[i]))
+	}
+	binary.LittleEndian.PutUint64(buf[40:], math.Float64bits(size))
+	q := 65535 / size
+	for i, p := range pts {
+		o := pcChunkHeader + 6*i
+		binary.LittleEndian.PutUint16(buf[o:], quantize16((float64(p.X)-relMin[0])*q))
+		binary.LittleEndian.PutUint16(buf[o+2:], quantize16((float64(p.Y)-relMin[1])*q))
+		binary.LittleEndian.PutUint16(buf[o+4:], quantize16((float64(p.Z)-relMin[2])*q))
+	}
+	if b.hasColor {
+		for _, p := range pts {
+			buf = append(buf, p.R, p.G, p.B)
+		}
+	}
+	return os.WriteFile(filepath.Join(b.dir, "nodes", id+".bin"), buf, 0644)
+}
+
+func quantize16(v float64) uint16 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 65535:
+		return 65535
+	}
+	return uint16(v + 0.5)
+}
+
+// readPointCloudMeta 读取已切片点云的元数据
+func readPointCloudMeta(id string) (*PointCloudMeta, error) {
+	data, err := os.ReadFile(filepath.Join(pointCloudRoot(), id, "metadata.json"))
+	if err != nil {
+		return nil, err
+	}
+	meta := new(PointCloudMeta)
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// ingestRequest 是 POST /api/pointclouds 的请求体
+type ingestRequest struct {
+	Source string `json:"source" binding:"required"`
+	ID     string `json:"id"`
+}
+
+// ingestPointCloudHandler 提交点云切片任务，返回 202 和任务 id
+func ingestPointCloudHandler(c *gin.Context) {
+	var req ingestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkSigned(c, req.Source) {
+		return
+	}
+	src, err := resolveDataPath(req.Source)
+	if err == nil {
+		if st, serr := os.Stat(src); serr != nil || st.IsDir() {
+			err = errors.New("source file not found")
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch strings.ToLower(filepath.Ext(src)) {
+	case ".ply", ".xyz", ".csv", ".txt", ".pts":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be a PLY or XYZ/CSV point file"})
+		return
+	}
+	id := req.ID
+	if id == "" {
+		id = sanitizeID(strings.TrimSuffix(filepath.Base(src), filepath.Ext(src)))
+	}
+	if !pointCloudIDPattern.MatchString(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must match " + pointCloudIDPattern.String()})
+		return
+	}
+	pcIngesting.Lock()
+	busy := pcIngesting.m[id]
+	pcIngesting.m[id] = true
+	pcIngesting.Unlock()
+	if busy {
+		c.JSON(http.StatusConflict, gin.H{"error": "point cloud " + id + " is already being ingested"})
+		return
+	}
+	release := func() {
+		pcIngesting.Lock()
+		delete(pcIngesting.m, id)
+		pcIngesting.Unlock()
+	}
+	job, err := jobs.Submit("pointcloud", id, requestID(c), func(j *Job) (interface{}, error) {
+		defer release()
+		return buildPointCloud(id, src, pcDefaultLimit, func(p float64) { jobs.SetProgress(j, p) })
+	})
+	if err != nil {
+		release()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"id": id, "job": job.ID})
+}
+
+// sanitizeID 把文件名转换为合法的 id
+func sanitizeID(name string) string {
+	b := []byte(name)
+	for i, ch := range b {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '_') {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 64 {
+		b = b[:64]
+	}
+	return string(b)
+}
+
+// listPointCloudsHandler 列出已切片的点云（不含节点列表）
+func listPointCloudsHandler(c *gin.Context) {
+	entries, err := os.ReadDir(pointCloudRoot())
+	list := []PointCloudMeta{}
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !pointCloudIDPattern.MatchString(e.Name()) {
+			continue
+		}
+		meta, err := readPointCloudMeta(e.Name())
+		if err != nil {
+			continue
+		}
+		meta.Nodes = nil
+		list = append(list, *meta)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// pointCloudHandler 返回点云的完整层级
+func pointCloudHandler(c *gin.Context) {
+	id := c.Param("id")
+	if !pointCloudIDPattern.MatchString(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.File(filepath.Join(pointCloudRoot(), id, "metadata.json"))
+}
+
+// pointCloudNodeHandler 返回一个节点的二进制数据块
+func pointCloudNodeHandler(c *gin.Context) {
+	id, node := c.Param("id"), strings.TrimSuffix(c.Param("node"), ".bin")
+	if !pointCloudIDPattern.MatchString(id) || !nodeIDPattern.MatchString(node) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	file := filepath.Join(pointCloudRoot(), id, "nodes", node+".bin")
+	if _, err := os.Stat(file); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		return
+	}
+	c.Header("Content-Type", "application/octet-stream")
+	c.File(file)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildPointCloud(t *testing.T) {
+	root := setTestDataRoot(t)
+	// 超过 pcNodePoints 个点，根节点必须抽样并分出子节点
+	const n = pcNodePoints + 20000
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		x, y, z := float64(i%97), float64(i/97%89), float64(i/(97*89))
+		fmt.Fprintf(&b, "%g %g %g %d %d %d\n", 1000+x/10, 2000+y/10, z/10, i%256, 0, 255)
+	}
+	src := filepath.Join(root, "scan.xyz")
+	os.WriteFile(src, []byte(b.String()), 0644)
+
+	var last float64
+	meta, err := buildPointCloud("scan", src, 0, func(f float64) {
+		if f < last {
+			t.Errorf("progress went back from %v to %v", last, f)
+		}
+		last = f
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Points != n || !meta.HasColor || meta.Depth < 1 || meta.Source != "scan.xyz" {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+	// 坐标相对第一个点存为 float32，允许微小误差
+	if math.Abs(meta.Min[0]-1000) > 1e-3 || math.Abs(meta.Max[0]-1009.6) > 1e-3 {
+		t.Fatalf("bounds %v..%v do not include the offset", meta.Min, meta.Max)
+	}
+
+	full, err := readPointCloudMeta("scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := map[string]PointCloudNode{}
+	for _, node := range full.Nodes {
+		byID[node.ID] = node
+	}
+	total := 0
+	for _, node := range full.Nodes {
+		for _, ch := range node.Children {
+			if c, ok := byID[ch]; !ok || c.Level != node.Level+1 || !strings.HasPrefix(ch, node.ID) {
+				t.Errorf("node %s has bad child %s", node.ID, ch)
+			}
+		}
+		data, err := os.ReadFile(filepath.Join(pointCloudRoot(), "scan", "nodes", node.ID+".bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := int(binary.LittleEndian.Uint32(data[4:]))
+		want := pcChunkHeader + (6*count+3)&^3 + 3*count
+		if string(data[:4]) != pcChunkMagic || count != node.Points || len(data) != want {
+			t.Fatalf("node %s: magic %q, %d points (meta %d), %d bytes (want %d)", node.ID, data[:4], count, node.Points, len(data), want)
+		}
+		if size := math.Float64frombits(binary.LittleEndian.Uint64(data[40:])); size != node.Size {
+			t.Errorf("node %s: chunk size %v, meta %v", node.ID, size, node.Size)
+		}
+		total += count
+	}
+	if total != n {
+		t.Fatalf("nodes hold %d points, want %d", total, n)
+	}
+	if _, err := os.Stat(filepath.Join(pointCloudRoot(), ".scan.tmp")); !os.IsNotExist(err) {
+		t.Fatal("temporary directory left behind")
+	}
+}
+
+func TestBuildPointCloudLimit(t *testing.T) {
+	root := setTestDataRoot(t)
+	src := filepath.Join(root, "a.xyz")
+	os.WriteFile(src, []byte("0 0 0\n1 1 1\n2 2 2\n"), 0644)
+	if _, err := buildPointCloud("a", src, 2, func(float64) {}); err != errTooManyPoints {
+		t.Fatalf("got %v, want errTooManyPoints", err)
+	}
+	if _, err := os.Stat(filepath.Join(pointCloudRoot(), "a")); !os.IsNotExist(err) {
+		t.Fatal("a rejected ingest left output behind")
+	}
+}
+
+func TestSplitOctants(t *testing.T) {
+	var pts []cloudPoint
+	for oct := 0; oct < 8; oct++ {
+		for k := 0; k <= oct; k++ {
+			pts = append(pts, cloudPoint{X: float32(oct >> 2 & 1), Y: float32(oct >> 1 & 1), Z: float32(oct & 1)})
+		}
+	}
+	for oct, part := range splitOctants(pts, [3]float64{0.5, 0.5, 0.5}) {
+		if len(part) != oct+1 {
+			t.Errorf("octant %d has %d points, want %d", oct, len(part), oct+1)
+		}
+		for _, p := range part {
+			if got := int(p.X)<<2 | int(p.Y)<<1 | int(p.Z); got != oct {
+				t.Errorf("point %+v landed in octant %d", p, oct)
+			}
+		}
+	}
+}
+
+func TestQuantize16(t *testing.T) {
+	for in, want := range map[float64]uint16{-5: 0, 0: 0, 0.4: 0, 0.5: 1, 65534.6: 65535, 1e9: 65535, math.Inf(1): 65535} {
+		if got := quantize16(in); got != want {
+			t.Errorf("quantize16(%v) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeID(t *testing.T) {
+	for in, want := range map[string]string{
+		"scan_01":               "scan_01",
+		"my scan.final":         "my_scan_final",
+		"../../etc":             "______etc",
+		strings.Repeat("a", 70): strings.Repeat("a", 64),
+	} {
+		got := sanitizeID(in)
+		if got != want || !pointCloudIDPattern.MatchString(got) {
+			t.Errorf("sanitizeID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReadPointFileExtension(t *testing.T) {
+	file := writeTestFile(t, "a.las", []byte("LASF"))
+	if _, err := readPointFile(file, 0); err == nil {
+		t.Fatal("expected an error for an unsupported extension")
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	presenceFlushInterval = 50 * time.Millisecond // 每个房间最多每秒广播 20 次
+	presenceIdleAfter     = time.Minute
+	presenceIdleClose     = 30 * time.Minute
+	presenceMaxMessage    = 64 << 10
+	presenceMaxSelection  = 256
+	presenceMaxName       = 64
+	// follow 的特殊目标，表示始终跟随当前主讲人
+	presenceFollowPresenter = "presenter"
+)
+
+var presenceColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// PresenceCamera 是客户端相机的位姿，前端据此绘制其他人的视锥
+type PresenceCamera struct {
+	Position   [3]float64 `json:"position"`
+	Quaternion [4]float64 `json:"quaternion"`
+	Fov        float64    `json:"fov,omitempty"` // 透视相机的竖直视角（度），正交相机为 0
+	Aspect     float64    `json:"aspect"`
+	Near       float64    `json:"near"`
+	Far        float64    `json:"far"`
+}
+
+// PresencePointer 是指针射线与场景的交点
+type PresencePointer struct {
+	Point  [3]float64 `json:"point"`
+	Object string     `json:"object,omitempty"`
+}
+
+// PresenceState 是一个用户在场景中的实时状态，不落盘
+type PresenceState struct {
+	Actor     string           `json:"actor"`
+	Name      string           `json:"name,omitempty"`
+	Color     string           `json:"color,omitempty"`
+	Camera    *PresenceCamera  `json:"camera,omitempty"`
+	Selection []string         `json:"selection,omitempty"`
+	Pointer   *PresencePointer `json:"pointer,omitempty"`
+	Following string           `json:"following,omitempty"`
+	Idle      bool             `json:"idle"`
+	Joined    time.Time        `json:"joined"`
+	Updated   time.Time        `json:"updated"`
+}
+
+// presenceMessage 是 presence 通道上的消息：
+//
+//	客户端 hello {actor, name, color} -> welcome {peers, presenter}，其他人收到 join {peer}
+//	客户端 update {camera, selection, pointer}：camera 省略时保持不变，selection 和 pointer 整体替换；
+//	  服务端合并同一用户的多次更新，每 presenceFlushInterval 广播一次 updates {peers}
+//	客户端 present / unpresent：成为或不再是主讲人，所有人收到 presenter {presenter}
+//	客户端 follow {target}：跟随某人的相机，target 为 "presenter" 时跟随当前主讲人，空字符串取消
+//	服务端 leave {actor}；一段时间没有 update 的用户在 updates 中标记为 idle
+type presenceMessage struct {
+	Type      string           `json:"type"`
+	Actor     string           `json:"actor,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Color     string           `json:"color,omitempty"`
+	Camera    *PresenceCamera  `json:"camera,omitempty"`
+	Selection []string         `json:"selection,omitempty"`
+	Pointer   *PresencePointer `json:"pointer,omitempty"`
+	Target    string           `json:"target,omitempty"`
+	Peer      *PresenceState   `json:"peer,omitempty"`
+	Peers     []PresenceState  `json:"peers,omitempty"`
+	Presenter *string          `json:"presenter,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// presenceRoom 是一个场景的 presence 会话，同一 actor 只保留最新的连接
+type presenceRoom struct {
+	key       string // store.key(场景 id)
+	mu        sync.Mutex
+	peers     map[string]*presencePeer
+	presenter string
+	changed   map[string]bool
+	done      chan struct{}
+}
+
+type presencePeer struct {
+	conn  *collabPeer
+	state PresenceState
+}
+
+var presenceRooms = struct {
+	sync.Mutex
+	m map[string]*presenceRoom
+}{m: map[string]*presenceRoom{}}
+
+// joinPresenceRoom 加入房间并发送 welcome，房间不存在时创建并启动广播循环
+func joinPresenceRoom(key string, p *collabPeer, hello *presenceMessage) *presenceRoom {
+	presenceRooms.Lock()
+	defer presenceRooms.Unlock()
+	r := presenceRooms.m[key]
+	if r == nil {
+		r = &presenceRoom{key: key, peers: map[string]*presencePeer{}, changed: map[string]bool{}, done: make(chan struct{})}
+		presenceRooms.m[key] = r
+		go r.run()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old := r.peers[p.actor]; old != nil {
+		old.conn.close("replaced by a new connection")
+	}
+	now := time.Now().UTC()
+	peer := &presencePeer{conn: p, state: PresenceState{Actor: p.actor, Name: hello.Name, Color: hello.Color, Joined: now, Updated: now}}
+	r.peers[p.actor] = peer
+	presenter := r.presenter
+	r.send(p, presenceMessage{Type: "welcome", Actor: p.actor, Peers: r.states(false), Presenter: &presenter})
+	r.broadcast(presenceMessage{Type: "join", Peer: &peer.state}, p)
+	return r
+}
+
+// leave 移除连接；主讲人离开时清空主讲人，跟随者取消跟随，最后一个人离开时关闭房间
+func (r *presenceRoom) leave(p *collabPeer) {
+	presenceRooms.Lock()
+	defer presenceRooms.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cur := r.peers[p.actor]; cur == nil || cur.conn != p {
+		return // 已被同一 actor 的新连接替换
+	}
+	delete(r.peers, p.actor)
+	delete(r.changed, p.actor)
+	r.broadcast(presenceMessage{Type: "leave", Actor: p.actor}, nil)
+	if r.presenter == p.actor {
+		r.setPresenter("")
+	}
+	for actor, peer := range r.peers {
+		if peer.state.Following == p.actor {
+			peer.state.Following = ""
+			r.changed[actor] = true
+		}
+	}
+	if len(r.peers) == 0 {
+		delete(presenceRooms.m, r.key)
+		close(r.done)
+	}
+}
+
+// handle 处理一条客户端消息
+func (r *presenceRoom) handle(p *collabPeer, m *presenceMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	peer := r.peers[p.actor]
+	if peer == nil || peer.conn != p {
+		return errors.New("connection was replaced")
+	}
+	st := &peer.state
+	switch m.Type {
+	case "update":
+		if err := checkPresenceUpdate(m); err != nil {
+			return err
+		}
+		if m.Camera != nil {
+			st.Camera = m.Camera
+		}
+		st.Selection, st.Pointer = m.Selection, m.Pointer
+	case "present":
+		r.setPresenter(p.actor)
+	case "unpresent":
+		if r.presenter == p.actor {
+			r.setPresenter("")
+		}
+	case "follow":
+		if m.Target != "" && m.Target != presenceFollowPresenter && (m.Target == p.actor || r.peers[m.Target] == nil) {
+			return fmt.Errorf("cannot follow %q", m.Target)
+		}
+		st.Following = m.Target
+	default:
+		return errors.New("unknown message type " + m.Type)
+	}
+	st.Updated, st.Idle = time.Now().UTC(), false
+	r.changed[p.actor] = true
+	return nil
+}
+
+// checkPresenceUpdate 检查相机参数并把四元数归一化
+func checkPresenceUpdate(m *presenceMessage) error {
+	if len(m.Selection) > presenceMaxSelection {
+		return fmt.Errorf("selection exceeds %d objects", presenceMaxSelection)
+	}
+	cam := m.Camera
+	if cam == nil {
+		return nil
+	}
+	q := cam.Quaternion
+	l := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+	switch {
+	case l == 0:
+		return errors.New("camera quaternion must not be zero")
+	case cam.Fov < 0 || cam.Fov >= 180:
+		return errors.New("camera fov must be in [0, 180)")
+	case cam.Aspect <= 0:
+		return errors.New("camera aspect must be positive")
+	case cam.Near < 0 || cam.Far <= cam.Near:
+		return errors.New("camera near and far must satisfy 0 <= near < far")
+	}
+	for i := range cam.Quaternion {
+		cam.Quaternion[i] /= l
+	}
+	return nil
+}
+
+// setPresenter 更换主讲人并通知所有人，调用方持有 r.mu
+func (r *presenceRoom) setPresenter(actor string) {
+	r.presenter = actor
+	r.broadcast(presenceMessage{Type: "presenter", Presenter: &actor}, nil)
+}
+
+// run 定期广播变化的状态，并标记或断开长时间没有更新的用户
+func (r *presenceRoom) run() {
+	t := time.NewTicker(presenceFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case now := <-t.C:
+			r.flush(now)
+		}
+	}
+}
+
+func (r *presenceRoom) flush(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for actor, peer := range r.peers {
+		idle := now.Sub(peer.state.Updated)
+		switch {
+		case idle > presenceIdleClose:
+			peer.conn.close("idle timeout")
+		case idle > presenceIdleAfter && !peer.state.Idle:
+			peer.state.Idle = true
+			r.changed[actor] = true
+		}
+	}
+	if len(r.changed) == 0 {
+		return
+	}
+	r.broadcast(presenceMessage{Type: "updates", Peers: r.states(true)}, nil)
+	r.changed = map[string]bool{}
+}
+
+// states 返回按 actor 排序的状态，changed 为 true 时只返回有变化的
+func (r *presenceRoom) states(changed bool) []PresenceState {
+	list := []PresenceState{}
+	for actor, peer := range r.peers {
+		if !changed || r.changed[actor] {
+			list = append(list, peer.state)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Actor < list[b].Actor })
+	return list
+}
+
+func (r *presenceRoom) send(p *collabPeer, m presenceMessage) {
+	if msg, err := json.Marshal(m); err == nil {
+		p.push(msg)
+	}
+}
+
+// broadcast 发给除 except 以外的所有连接，调用方持有 r.mu
+func (r *presenceRoom) broadcast(m presenceMessage, except *collabPeer) {
+	msg, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	for _, peer := range r.peers {
+		if peer.conn != except {
+			peer.conn.push(msg)
+		}
+	}
+}
+
+// presenceHandler 处理 GET /api/scenes/:id/presence：WebSocket 连接加入房间，普通请求返回当前在线的用户
+func presenceHandler(c *gin.Context) {
+	id, ok := sceneID(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	if _, err := os.Stat(s.sceneMetaFile(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		presenceRooms.Lock()
+		r := presenceRooms.m[s.key(id)]
+		presenceRooms.Unlock()
+		peers, presenter := []PresenceState{}, ""
+		if r != nil {
+			r.mu.Lock()
+			peers, presenter = r.states(false), r.presenter
+			r.mu.Unlock()
+		}
+		c.JSON(http.StatusOK, gin.H{"peers": peers, "presenter": presenter})
+		return
+	}
+	conn, err := collabUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	conn.SetReadLimit(presenceMaxMessage)
+
+	var hello presenceMessage
+	conn.SetReadDeadline(time.Now().Add(collabHelloWait))
+	err = conn.ReadJSON(&hello)
+	switch {
+	case err != nil || hello.Type != "hello" || !collabActorPattern.MatchString(hello.Actor):
+		err = errors.New("expected hello with a valid actor")
+	case len(hello.Name) > presenceMaxName:
+		err = fmt.Errorf("name exceeds %d bytes", presenceMaxName)
+	case hello.Color != "" && !presenceColorPattern.MatchString(hello.Color):
+		err = errors.New("color must look like #rrggbb")
+	}
+	if err != nil {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()), time.Now().Add(collabWriteWait))
+		conn.Close()
+		return
+	}
+	p := &collabPeer{conn: conn, actor: hello.Actor, send: make(chan []byte, collabSendBuffer)}
+	go p.writeLoop()
+	room := joinPresenceRoom(s.key(id), p, &hello)
+	defer room.leave(p)
+	defer p.close("")
+
+	conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+	for {
+		var m presenceMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(collabPongWait))
+		if err := room.handle(p, &m); err != nil {
+			room.send(p, presenceMessage{Type: "error", Error: err.Error()})
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCheckPresenceUpdate(t *testing.T) {
+	cam := func(q [4]float64, fov, aspect, near, far float64) *PresenceCamera {
+		return &PresenceCamera{Quaternion: q, Fov: fov, Aspect: aspect, Near: near, Far: far}
+	}
+	tests := []struct {
+		name string
+		m    presenceMessage
+		ok   bool
+	}{
+		{"no camera", presenceMessage{Selection: []string{"a"}}, true},
+		{"perspective", presenceMessage{Camera: cam([4]float64{0, 0, 0, 2}, 50, 1.5, 0.1, 100)}, true},
+		{"orthographic", presenceMessage{Camera: cam([4]float64{0, 0, 0, 1}, 0, 1, 0, 10)}, true},
+		{"zero quaternion", presenceMessage{Camera: cam([4]float64{}, 50, 1, 0.1, 100)}, false},
+		{"fov 180", presenceMessage{Camera: cam([4]float64{0, 0, 0, 1}, 180, 1, 0.1, 100)}, false},
+		{"zero aspect", presenceMessage{Camera: cam([4]float64{0, 0, 0, 1}, 50, 0, 0.1, 100)}, false},
+		{"far before near", presenceMessage{Camera: cam([4]float64{0, 0, 0, 1}, 50, 1, 10, 1)}, false},
+		{"selection too large", presenceMessage{Selection: make([]string, presenceMaxSelection+1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPresenceUpdate(&tt.m)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got %v, want ok=%v", err, tt.ok)
+			}
+			// 通过校验的四元数被归一化
+			if c := tt.m.Camera; err == nil && c != nil {
+				q := c.Quaternion
+				if l := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3]); math.Abs(l-1) > 1e-12 {
+					t.Fatalf("quaternion length %v", l)
+				}
+			}
+		})
+	}
+}
+
+func testPresencePeer(actor string) *collabPeer {
+	return &collabPeer{actor: actor, send: make(chan []byte, 64)}
+}
+
+// nextPresence 读取下一条指定类型的消息，跳过定时广播的 updates
+func nextPresence(t *testing.T, p *collabPeer, typ string) presenceMessage {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-p.send:
+			var m presenceMessage
+			json.Unmarshal(msg, &m)
+			if m.Type == typ {
+				return m
+			}
+		case <-timeout:
+			t.Fatalf("%s: no %s message", p.actor, typ)
+		}
+	}
+}
+
+func TestPresenceRoom(t *testing.T) {
+	const id = "presence-test"
+	a, b := testPresencePeer("a"), testPresencePeer("b")
+	r := joinPresenceRoom(id, a, &presenceMessage{Name: "Ann"})
+	nextPresence(t, a, "welcome")
+	joinPresenceRoom(id, b, &presenceMessage{Name: "Bob"})
+	if m := nextPresence(t, b, "welcome"); len(m.Peers) != 2 || m.Peers[0].Name != "Ann" {
+		t.Fatalf("welcome peers = %+v", m.Peers)
+	}
+	if m := nextPresence(t, a, "join"); m.Peer == nil || m.Peer.Actor != "b" {
+		t.Fatalf("join = %+v", m)
+	}
+
+	for _, tt := range []struct {
+		from *collabPeer
+		m    presenceMessage
+		ok   bool
+	}{
+		{b, presenceMessage{Type: "follow", Target: "b"}, false},
+		{b, presenceMessage{Type: "follow", Target: "nobody"}, false},
+		{b, presenceMessage{Type: "wave"}, false},
+		{b, presenceMessage{Type: "follow", Target: "a"}, true},
+		{a, presenceMessage{Type: "present"}, true},
+	} {
+		if err := r.handle(tt.from, &tt.m); (err == nil) != tt.ok {
+			t.Fatalf("%s %+v: got %v, want ok=%v", tt.from.actor, tt.m, err, tt.ok)
+		}
+	}
+	if m := nextPresence(t, b, "presenter"); *m.Presenter != "a" {
+		t.Fatalf("presenter = %q", *m.Presenter)
+	}
+
+	// 主讲人离开：主讲人清空，跟随者取消跟随
+	r.leave(a)
+	if m := nextPresence(t, b, "presenter"); *m.Presenter != "" {
+		t.Fatalf("presenter after leave = %q", *m.Presenter)
+	}
+	r.mu.Lock()
+	following := r.peers["b"].state.Following
+	r.mu.Unlock()
+	if following != "" {
+		t.Fatalf("b still follows %q", following)
+	}
+	r.leave(b)
+	select {
+	case <-r.done:
+	default:
+		t.Fatal("empty room was not closed")
+	}
+	presenceRooms.Lock()
+	_, ok := presenceRooms.m[id]
+	presenceRooms.Unlock()
+	if ok {
+		t.Fatal("empty room is still registered")
+	}
+}
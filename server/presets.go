@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	presetMaxBytes      = 1 << 20
+	presetExportVersion = 1
+	presetMaxImport     = 1000
+)
+
+// presetsMu 串行化预设的写操作，保证每个 GUI 文件夹最多一个默认预设
+var presetsMu sync.Mutex
+
+// Preset 是一份 lil-gui 参数预设，State 是 gui.save() 的结果，可直接交给 gui.load()
+type Preset struct {
+	ID      string          `json:"id"`
+	Scene   string          `json:"scene"`
+	Folder  string          `json:"folder"` // GUI 文件夹路径，空字符串表示根 GUI
+	Name    string          `json:"name"`
+	Author  string          `json:"author"`
+	Default bool            `json:"default"`
+	State   json.RawMessage `json:"state"`
+	Created time.Time       `json:"created"`
+	Updated time.Time       `json:"updated"`
+	URL     string          `json:"url,omitempty"` // 分享链接，返回 State 本身
+}
+
+// presetRequest 是创建/更新预设的请求体；更新时 scene 被忽略
+type presetRequest struct {
+	Scene   string          `json:"scene"`
+	Folder  string          `json:"folder" binding:"max=256"`
+	Name    string          `json:"name" binding:"required,max=128"`
+	Author  string          `json:"author" binding:"max=64"`
+	Default bool            `json:"default"`
+	State   json.RawMessage `json:"state" binding:"required"`
+}
+
+// PresetExport 是导出文件的格式，导入时按 scene/folder/name 匹配已有预设
+type PresetExport struct {
+	Version  int       `json:"version"`
+	Scene    string    `json:"scene"`
+	Exported time.Time `json:"exported"`
+	Presets  []Preset  `json:"presets"`
+}
+
+// PresetChange 是两份预设之间的一处差异，Path 是 JSON Pointer
+type PresetChange struct {
+	Op   string      `json:"op"` // add | remove | replace
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+func (s store) presetsRoot() string {
+	return filepath.Join(s.root, "presets")
+}
+
+func (s store) presetFile(scene, id string) string {
+	return filepath.Join(s.presetsRoot(), scene, id+".json")
+}
+
+// checkPresetState 检查 gui.save() 的结构：{controllers: {名称: 值}, folders: {标题: 同样的结构}}
+func checkPresetState(raw json.RawMessage) error {
+	var state interface{}
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	return checkGUIState("/state", state)
+}
+
+func checkGUIState(p string, v interface{}) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be an object", p)
+	}
+	for k, val := range m {
+		switch k {
+		case "controllers":
+			if _, ok := val.(map[string]interface{}); !ok {
+				return fmt.Errorf("%s/controllers must be an object", p)
+			}
+		case "folders":
+			folders, ok := val.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s/folders must be an object", p)
+			}
+			for title, f := range folders {
+				if err := checkGUIState(p+"/folders/"+escapePointer(title), f); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("%s: unexpected key %q", p, k)
+		}
+	}
+	return nil
+}
+
+func (s store) readPreset(file string) (*Preset, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Preset)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	p.URL = s.apiURL("/presets/" + p.ID + "/state")
+	return p, nil
+}
+
+// findPreset 按 id 查找预设，id 全局唯一
+func (s store) findPreset(id string) (*Preset, error) {
+	if !sceneIDPattern.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+	files, _ := filepath.Glob(filepath.Join(s.presetsRoot(), "*", id+".json"))
+	if len(files) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return s.readPreset(files[0])
+}
+
+// listPresets 返回场景的预设，folder 为 nil 时不按文件夹过滤
+func (s store) listPresets(scene string, folder *string) ([]*Preset, error) {
+	files, err := filepath.Glob(filepath.Join(s.presetsRoot(), scene, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	list := []*Preset{}
+	for _, f := range files {
+		p, err := s.readPreset(f)
+		if err != nil || folder != nil && p.Folder != *folder {
+			continue
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		x, y := list[a], list[b]
+		if x.Folder != y.Folder {
+			return x.Folder < y.Folder
+		}
+		if x.Default != y.Default {
+			return x.Default
+		}
+		return x.Name < y.Name
+	})
+	return list, nil
+}
+
+// savePreset 写入预设；设为默认时取消同一文件夹中其他预设的默认标记。调用方持有 presetsMu
+func (s store) savePreset(p *Preset) error {
+	if p.Default {
+		folder := p.Folder
+		others, err := s.listPresets(p.Scene, &folder)
+		if err != nil {
+			return err
+		}
+		for _, o := range others {
+			if o.ID != p.ID && o.Default {
+				o.Default = false
+				if err := s.writePreset(o); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return s.writePreset(p)
+}
+
+func (s store) writePreset(p *Preset) error {
+	p.URL = ""
+	js, err := json.Marshal(p)
+	p.URL = s.apiURL("/presets/" + p.ID + "/state")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.presetFile(p.Scene, p.ID), js, 0644)
+}
+
+// presetByName 查找同一场景、文件夹中同名的预设
+func (s store) presetByName(scene, folder, name string) (*Preset, error) {
+	list, err := s.listPresets(scene, &folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// bindPreset 读取并校验请求体，失败时直接写出错误响应
+func bindPreset(c *gin.Context) (*presetRequest, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, presetMaxBytes)
+	var req presetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err := checkPresetState(req.State); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	// 开启认证时作者就是当前登录的用户，不能冒充他人
+	if cl := currentUser(c); cl != nil {
+		req.Author = cl.Subject
+	}
+	return &req, true
+}
+
+// presetScene 检查场景键，scene id 或前端自定义的名字都可以
+func presetScene(c *gin.Context, scene string) bool {
+	if !projectNamePattern.MatchString(scene) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scene"})
+		return false
+	}
+	return true
+}
+
+// presetParam 读取路由中的预设，失败时直接写出错误响应
+func presetParam(c *gin.Context) (*Preset, bool) {
+	s := requestStore(c)
+	p, err := s.findPreset(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "preset not found"})
+		return nil, false
+	}
+	return p, true
+}
+
+// listPresetsHandler 处理 GET /api/presets?scene=&folder=
+func listPresetsHandler(c *gin.Context) {
+	s := requestStore(c)
+	scene := c.Query("scene")
+	if !presetScene(c, scene) {
+		return
+	}
+	var folder *string
+	if f, ok := c.GetQuery("folder"); ok {
+		folder = &f
+	}
+	list, err := s.listPresets(scene, folder)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// createPresetHandler 处理 POST /api/presets，同一文件夹中重名返回 409
+func createPresetHandler(c *gin.Context) {
+	s := requestStore(c)
+	req, ok := bindPreset(c)
+	if !ok || !presetScene(c, req.Scene) {
+		return
+	}
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	if dup, err := s.presetByName(req.Scene, req.Folder, req.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if dup != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "a preset with this name already exists", "id": dup.ID})
+		return
+	}
+	now := time.Now().UTC()
+	p := &Preset{
+		ID: newJobID(), Scene: req.Scene, Folder: req.Folder, Name: req.Name, Author: req.Author,
+		Default: req.Default, State: req.State, Created: now, Updated: now,
+	}
+	if err := s.savePreset(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, p)
+}
+
+// getPresetHandler 处理 GET /api/presets/:id
+func getPresetHandler(c *gin.Context) {
+	if p, ok := presetParam(c); ok {
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// presetStateHandler 处理 GET /api/presets/:id/state，用于按链接分享：gui.load(await res.json())
+func presetStateHandler(c *gin.Context) {
+	p, ok := presetParam(c)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", p.State)
+}
+
+// updatePresetHandler 处理 PUT /api/presets/:id
+func updatePresetHandler(c *gin.Context) {
+	s := requestStore(c)
+	req, ok := bindPreset(c)
+	if !ok {
+		return
+	}
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	p, ok := presetParam(c)
+	if !ok {
+		return
+	}
+	if dup, err := s.presetByName(p.Scene, req.Folder, req.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if dup != nil && dup.ID != p.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "a preset with this name already exists", "id": dup.ID})
+		return
+	}
+	p.Folder, p.Name, p.Default, p.State = req.Folder, req.Name, req.Default, req.State
+	if req.Author != "" {
+		p.Author = req.Author
+	}
+	p.Updated = time.Now().UTC()
+	if err := s.savePreset(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// deletePresetHandler 处理 DELETE /api/presets/:id
+func deletePresetHandler(c *gin.Context) {
+	s := requestStore(c)
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	p, ok := presetParam(c)
+	if !ok {
+		return
+	}
+	if err := os.Remove(s.presetFile(p.Scene, p.ID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// presetDiffHandler 处理 GET /api/presets/:id/diff?against=，默认与同一文件夹的默认预设比较
+func presetDiffHandler(c *gin.Context) {
+	s := requestStore(c)
+	p, ok := presetParam(c)
+	if !ok {
+		return
+	}
+	var base *Preset
+	if against := c.Query("against"); against != "" {
+		b, err := s.findPreset(against)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "preset to compare against not found"})
+			return
+		}
+		base = b
+	} else {
+		folder := p.Folder
+		list, err := s.listPresets(p.Scene, &folder)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, o := range list {
+			if o.Default {
+				base = o
+			}
+		}
+		if base == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "folder has no default preset"})
+			return
+		}
+	}
+	var from, to interface{}
+	json.Unmarshal(base.State, &from)
+	json.Unmarshal(p.State, &to)
+	changes := []PresetChange{}
+	diffJSON("", from, to, &changes)
+	c.JSON(http.StatusOK, gin.H{"preset": p.ID, "against": base.ID, "changes": changes})
+}
+
+// diffJSON 递归比较两个 JSON 值，对象逐键比较，其余类型整体替换
+func diffJSON(p string, from, to interface{}, out *[]PresetChange) {
+	a, aok := from.(map[string]interface{})
+	b, bok := to.(map[string]interface{})
+	if !aok || !bok {
+		if !reflect.DeepEqual(from, to) {
+			*out = append(*out, PresetChange{Op: "replace", Path: p, From: from, To: to})
+		}
+		return
+	}
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		kp := p + "/" + escapePointer(k)
+		av, inA := a[k]
+		bv, inB := b[k]
+		switch {
+		case !inA:
+			*out = append(*out, PresetChange{Op: "add", Path: kp, To: bv})
+		case !inB:
+			*out = append(*out, PresetChange{Op: "remove", Path: kp, From: av})
+		default:
+			diffJSON(kp, av, bv, out)
+		}
+	}
+}
+
+// exportPresetsHandler 处理 GET /api/presets/export?scene=&folder=，下载为 JSON 文件
+func exportPresetsHandler(c *gin.Context) {
+	s := requestStore(c)
+	scene := c.Query("scene")
+	if !presetScene(c, scene) {
+		return
+	}
+	var folder *string
+	if f, ok := c.GetQuery("folder"); ok {
+		folder = &f
+	}
+	list, err := s.listPresets(scene, folder)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	doc := PresetExport{Version: presetExportVersion, Scene: scene, Exported: time.Now().UTC(), Presets: []Preset{}}
+	for _, p := range list {
+		p.URL = ""
+		doc.Presets = append(doc.Presets, *p)
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-presets.json"`, scene))
+	c.IndentedJSON(http.StatusOK, doc)
+}
+
+// importPresetsHandler 处理 POST /api/presets/import?scene=&overwrite=；
+// scene 为空时导入到导出时的场景，同名预设默认跳过，overwrite=true 时覆盖
+func importPresetsHandler(c *gin.Context) {
+	s := requestStore(c)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, presetMaxBytes*16)
+	var doc PresetExport
+	if err := c.ShouldBindJSON(&doc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if doc.Version != presetExportVersion {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("unsupported export version %d", doc.Version)})
+		return
+	}
+	if len(doc.Presets) > presetMaxImport {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("export contains more than %d presets", presetMaxImport)})
+		return
+	}
+	scene := c.DefaultQuery("scene", doc.Scene)
+	if !presetScene(c, scene) {
+		return
+	}
+	overwrite := c.Query("overwrite") == "true"
+	// 先整体校验，避免导入一半
+	for i, p := range doc.Presets {
+		err := checkPresetState(p.State)
+		if err == nil && (p.Name == "" || len(p.Name) > 128 || len(p.Folder) > 256 || len(p.Author) > 64) {
+			err = errors.New("name, folder or author is invalid")
+		}
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("presets/%d: %v", i, err)})
+			return
+		}
+	}
+
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	imported, skipped := []*Preset{}, []string{}
+	now := time.Now().UTC()
+	for _, in := range doc.Presets {
+		existing, err := s.presetByName(scene, in.Folder, in.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		p := &Preset{ID: newJobID(), Scene: scene, Folder: in.Folder, Name: in.Name, Author: in.Author, Created: now}
+		if existing != nil {
+			if !overwrite {
+				skipped = append(skipped, in.Name)
+				continue
+			}
+			p = existing
+			p.Author = in.Author
+		}
+		p.State, p.Updated = in.State, now
+		// 不覆盖时保留文件夹中已有的默认预设
+		p.Default = in.Default && (overwrite || !s.folderHasDefault(scene, in.Folder))
+		if err := s.savePreset(p); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		imported = append(imported, p)
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": imported, "skipped": skipped})
+}
+
+func (s store) folderHasDefault(scene, folder string) bool {
+	list, _ := s.listPresets(scene, &folder)
+	for _, p := range list {
+		if p.Default {
+			return true
+		}
+	}
+	return false
+}
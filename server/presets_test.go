@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveTest 把 handler 挂到 route 上并执行一个请求
+func serveTest(method, route, target, body string, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, route, handlers...)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCheckPresetState(t *testing.T) {
+	tests := []struct {
+		state string
+		ok    bool
+	}{
+		{`{}`, true},
+		{`{"controllers":{"speed":1,"color":"#ff0000"},"folders":{"Light/Sun":{"controllers":{"on":true}}}}`, true},
+		{`[]`, false},
+		{`{"controllers":[]}`, false},
+		{`{"folders":{"a":{"folders":{"b":{"extra":1}}}}}`, false},
+		{`{"values":{}}`, false},
+		{`{`, false},
+	}
+	for _, tt := range tests {
+		if err := checkPresetState(json.RawMessage(tt.state)); (err == nil) != tt.ok {
+			t.Errorf("checkPresetState(%s) = %v, want ok=%v", tt.state, err, tt.ok)
+		}
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     []PresetChange
+	}{
+		{`{"a":1}`, `{"a":1}`, nil},
+		{`{"a":1}`, `{"a":2}`, []PresetChange{{Op: "replace", Path: "/a", From: 1.0, To: 2.0}}},
+		{`{"a":1}`, `{"b":1}`, []PresetChange{{Op: "remove", Path: "/a", From: 1.0}, {Op: "add", Path: "/b", To: 1.0}}},
+		{`{"f":{"x/y":[1]}}`, `{"f":{"x/y":[1,2]}}`, []PresetChange{{Op: "replace", Path: "/f/x~1y", From: []interface{}{1.0}, To: []interface{}{1.0, 2.0}}}},
+		{`{"a":{"b":1}}`, `{"a":3}`, []PresetChange{{Op: "replace", Path: "/a", From: map[string]interface{}{"b": 1.0}, To: 3.0}}},
+	}
+	for _, tt := range tests {
+		var from, to interface{}
+		json.Unmarshal([]byte(tt.from), &from)
+		json.Unmarshal([]byte(tt.to), &to)
+		var got []PresetChange
+		diffJSON("", from, to, &got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("diffJSON(%s, %s) = %+v, want %+v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestSavePresetSingleDefault(t *testing.T) {
+	setTestDataRoot(t)
+	a := &Preset{ID: newJobID(), Scene: "s1", Name: "a", Default: true, State: json.RawMessage(`{}`)}
+	b := &Preset{ID: newJobID(), Scene: "s1", Name: "b", Default: true, State: json.RawMessage(`{}`)}
+	other := &Preset{ID: newJobID(), Scene: "s1", Folder: "Light", Name: "c", Default: true, State: json.RawMessage(`{}`)}
+	for _, p := range []*Preset{a, other, b} {
+		if err := globalStore().savePreset(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, _ := globalStore().listPresets("s1", nil)
+	defaults := map[string]bool{}
+	for _, p := range list {
+		defaults[p.Name] = p.Default
+	}
+	// 同一文件夹只保留最后设置的默认预设，其它文件夹不受影响
+	if want := map[string]bool{"a": false, "b": true, "c": true}; !reflect.DeepEqual(defaults, want) {
+		t.Fatalf("defaults = %v, want %v", defaults, want)
+	}
+}
+
+func TestImportPresets(t *testing.T) {
+	setTestDataRoot(t)
+	export := func(speed int, defaults bool) string {
+		doc := PresetExport{Version: presetExportVersion, Scene: "s1", Exported: time.Now()}
+		for _, name := range []string{"fast", "slow"} {
+			doc.Presets = append(doc.Presets, Preset{
+				Name: name, Author: "ann", Default: defaults && name == "fast",
+				State: json.RawMessage(`{"controllers":{"speed":` + strconv.Itoa(speed) + `}}`),
+			})
+		}
+		js, _ := json.Marshal(doc)
+		return string(js)
+	}
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		status   int
+		imported int
+		skipped  int
+	}{
+		{"first import", "/api/presets/import", export(1, true), http.StatusOK, 2, 0},
+		{"same names are skipped", "/api/presets/import", export(2, false), http.StatusOK, 0, 2},
+		{"overwrite", "/api/presets/import?overwrite=true", export(3, false), http.StatusOK, 2, 0},
+		{"other scene", "/api/presets/import?scene=s2", export(1, true), http.StatusOK, 2, 0},
+		{"bad scene", "/api/presets/import?scene=../x", export(1, true), http.StatusBadRequest, 0, 0},
+		{"bad version", "/api/presets/import", `{"version":9,"presets":[]}`, http.StatusUnprocessableEntity, 0, 0},
+		{"bad state", "/api/presets/import", `{"version":1,"scene":"s3","presets":[{"name":"x","state":{}},{"name":"y","state":[]}]}`, http.StatusUnprocessableEntity, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTest(http.MethodPost, "/api/presets/import", tt.target, tt.body, importPresetsHandler)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var res struct {
+				Imported []Preset
+				Skipped  []string
+			}
+			json.Unmarshal(w.Body.Bytes(), &res)
+			if len(res.Imported) != tt.imported || len(res.Skipped) != tt.skipped {
+				t.Fatalf("imported %d, skipped %d", len(res.Imported), len(res.Skipped))
+			}
+		})
+	}
+	// 覆盖导入后状态更新，且导入时没有默认标记的预设取消了原来的默认
+	list, _ := globalStore().listPresets("s1", nil)
+	if len(list) != 2 || list[0].Default || string(list[0].State) != `{"controllers":{"speed":3}}` {
+		t.Fatalf("presets after overwrite: %+v", list)
+	}
+	// 整体校验失败时一个都不导入
+	if list, _ := globalStore().listPresets("s3", nil); len(list) != 0 {
+		t.Fatalf("rejected import wrote %d presets", len(list))
+	}
+}
+
+func TestPresetAuthorFromLogin(t *testing.T) {
+	setTestDataRoot(t)
+	login := func(c *gin.Context) { c.Set("claims", &Claims{Subject: "ann", Role: roleEditor}) }
+	body := `{"scene":"s1","name":"fast","author":"mallory","state":{}}`
+	w := serveTest(http.MethodPost, "/api/presets", "/api/presets", body, login, createPresetHandler)
+	var p Preset
+	json.Unmarshal(w.Body.Bytes(), &p)
+	if w.Code != http.StatusCreated || p.Author != "ann" {
+		t.Fatalf("create: status %d, author %q", w.Code, p.Author)
+	}
+	w = serveTest(http.MethodPut, "/api/presets/:id", "/api/presets/"+p.ID, body, login, updatePresetHandler)
+	json.Unmarshal(w.Body.Bytes(), &p)
+	if w.Code != http.StatusOK || p.Author != "ann" {
+		t.Fatalf("update: status %d, author %q", w.Code, p.Author)
+	}
+}
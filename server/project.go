@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 项目是独立的命名空间：projects/<name>/ 下有自己的资源、场景、预设和布局，通过 /p/<name>/ 访问，
+// 成员按项目分配角色。全局的 /data 和 /api/models 等接口看不到 projects/ 下的文件
+
+// projectMetaFile 保存项目信息，以点开头，不会通过 /p/<name>/data 暴露
+const projectMetaFile = ".project.json"
+
+// projectUploadMaxBytes 是单个资源上传的大小上限
+const projectUploadMaxBytes = 512 << 20
+
+// projectManagedDirs 由场景、预设等接口维护，不能通过资源上传直接改写
+var projectManagedDirs = map[string]bool{"scenes": true, "presets": true, "layouts": true, "cameras": true}
+
+var errProjectPath = errors.New("project files are only available under /p/<project>/")
+
+// projectsMu 串行化项目信息的写操作
+var projectsMu sync.Mutex
+
+// ProjectMember 是项目成员及其在项目内的角色
+type ProjectMember struct {
+	User string `json:"user" binding:"required"`
+	Role string `json:"role" binding:"required,oneof=viewer editor admin"`
+}
+
+// Project 是项目信息
+type Project struct {
+	Name    string          `json:"name"`
+	Title   string          `json:"title"`
+	Created time.Time       `json:"created"`
+	Members []ProjectMember `json:"members"`
+}
+
+// store 是一个存储命名空间：全局数据目录，或某个项目的目录。场景、预设、布局和相机都按 store 存放
+type store struct {
+	root    string
+	project string // 全局为空
+}
+
+func globalStore() store {
+	return store{root: dataRoot}
+}
+
+func projectStore(name string) store {
+	return store{root: filepath.Join(projectsRoot(), name), project: name}
+}
+
+// requestStore 返回请求所在的命名空间：/p/:project/ 下的路由为该项目，其余为全局
+func requestStore(c *gin.Context) store {
+	if v, ok := c.Get("store"); ok {
+		return v.(store)
+	}
+	return globalStore()
+}
+
+// dataURL 返回 s.root 下文件的访问地址
+func (s store) dataURL(file string) string {
+	rel, _ := filepath.Rel(s.root, file)
+	if s.project == "" {
+		return "/data/" + filepath.ToSlash(rel)
+	}
+	return "/p/" + s.project + "/data/" + filepath.ToSlash(rel)
+}
+
+// apiURL 返回接口地址，例如 s.apiURL("/scenes/" + id)
+func (s store) apiURL(p string) string {
+	if s.project == "" {
+		return "/api" + p
+	}
+	return "/p/" + s.project + "/api" + p
+}
+
+// key 用于区分不同命名空间中同 id 的协作房间等
+func (s store) key(id string) string {
+	return s.project + "/" + id
+}
+
+// resolve 把项目内的相对路径解析为本地路径。.. 在拼接前已被消去；路径中不能有以点开头的段（项目信息、协作状态等）；
+// 已存在的部分解开符号链接后必须仍在项目目录内，否则返回 errOutsideRoot
+func (s store) resolve(rel string) (string, error) {
+	clean := path.Clean("/" + strings.ReplaceAll(rel, "\\", "/"))
+	for _, seg := range strings.Split(clean, "/") {
+		if strings.HasPrefix(seg, ".") || strings.ContainsRune(seg, 0) {
+			return "", errOutsideRoot
+		}
+	}
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return "", err
+	}
+	full := filepath.Join(s.root, filepath.FromSlash(clean))
+	// 从完整路径往上找到第一个存在的位置，解开其中的符号链接
+	existing, rest := full, ""
+	for {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !pathWithin(root, real) {
+				return "", errOutsideRoot
+			}
+			return filepath.Join(real, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing || !pathWithin(s.root, parent) {
+			return "", errOutsideRoot
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// pathWithin 判断 full 是否为 root 或其下的路径
+func pathWithin(root, full string) bool {
+	r, err := filepath.Rel(root, full)
+	if err != nil {
+		return false
+	}
+	return r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator))
+}
+
+func readProject(name string) (*Project, error) {
+	if !projectNamePattern.MatchString(name) {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(projectsRoot(), name, projectMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	p := new(Project)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func writeProject(p *Project) error {
+	js, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(projectsRoot(), p.Name, projectMetaFile), js, 0644)
+}
+
+// projectRole 返回用户在项目中的角色；全局 admin 视为项目 admin，未开启认证时所有人都是 admin
+func projectRole(c *gin.Context, p *Project) string {
+	cl := currentUser(c)
+	if authConfig.key == nil || cl != nil && cl.Role == roleAdmin {
+		return roleAdmin
+	}
+	if cl == nil {
+		return ""
+	}
+	for _, m := range p.Members {
+		if m.User == cl.Subject {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// projectAccess 加载 /p/:project 中的项目并要求当前用户在项目内至少具有 role 角色。
+// 不是成员时与项目不存在一样返回 404，不暴露项目名
+func projectAccess(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := readProject(c.Param("project"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			return
+		}
+		have := projectRole(c, p)
+		if have == "" {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			return
+		}
+		if roleLevels[have] < roleLevels[role] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this action requires the " + role + " role in the project"})
+			return
+		}
+		c.Set("project", p)
+		c.Set("store", projectStore(p.Name))
+		c.Next()
+	}
+}
+
+// hideProjects 让全局 /data 看不到 projects/ 下的文件，包括经符号链接指进去的
+func hideProjects() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p := c.Param("filepath"); inProjects(p) || inProjects(realDataRel(dataPath(p))) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errProjectPath.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkProjectMembers 检查成员列表，失败时直接写出错误响应
+func checkProjectMembers(c *gin.Context, members []ProjectMember) bool {
+	seen := map[string]bool{}
+	for _, m := range members {
+		if !userNamePattern.MatchString(m.User) || seen[m.User] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "members must have unique, valid user names"})
+			return false
+		}
+		seen[m.User] = true
+	}
+	return true
+}
+
+// listProjectsHandler 处理 GET /api/projects，只列出当前用户所在的项目
+func listProjectsHandler(c *gin.Context) {
+	entries, err := os.ReadDir(projectsRoot())
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	list := []gin.H{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p, err := readProject(e.Name())
+		if err != nil {
+			continue
+		}
+		if role := projectRole(c, p); role != "" {
+			list = append(list, gin.H{"name": p.Name, "title": p.Title, "role": role})
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a]["name"].(string) < list[b]["name"].(string) })
+	c.JSON(http.StatusOK, list)
+}
+
+// createProjectHandler 处理 POST /api/projects，body 为 {name, title, members}；
+// 已有同名目录（例如之前导入的场景包）但没有项目信息时会接管该目录
+func createProjectHandler(c *gin.Context) {
+	var req struct {
+		Name    string          `json:"name" binding:"required"`
+		Title   string          `json:"title"`
+		Members []ProjectMember `json:"members" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !projectNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must match " + projectNamePattern.String()})
+		return
+	}
+	if !checkProjectMembers(c, req.Members) {
+		return
+	}
+	projectsMu.Lock()
+	defer projectsMu.Unlock()
+	if _, err := readProject(req.Name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "project already exists"})
+		return
+	}
+	if st, err := os.Lstat(filepath.Join(projectsRoot(), req.Name)); err == nil && !st.IsDir() {
+		c.JSON(http.StatusConflict, gin.H{"error": "a file with this name is in the way"})
+		return
+	}
+	p := &Project{Name: req.Name, Title: req.Title, Created: time.Now().UTC(), Members: req.Members}
+	if p.Members == nil {
+		p.Members = []ProjectMember{}
+	}
+	if err := writeProject(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, p)
+}
+
+// getProjectHandler 处理 GET /p/:project
+func getProjectHandler(c *gin.Context) {
+	p := c.MustGet("project").(*Project)
+	c.JSON(http.StatusOK, gin.H{"name": p.Name, "title": p.Title, "created": p.Created, "members": p.Members, "role": projectRole(c, p)})
+}
+
+// putProjectMembersHandler 处理 PUT /p/:project/members，body 为 {members}，整体替换成员列表
+func putProjectMembersHandler(c *gin.Context) {
+	var req struct {
+		Members []ProjectMember `json:"members" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkProjectMembers(c, req.Members) {
+		return
+	}
+	projectsMu.Lock()
+	defer projectsMu.Unlock()
+	p, err := readProject(c.Param("project"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	p.Members = req.Members
+	if err := writeProject(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// projectFile 解析 /p/:project/data/*path 中的路径，失败时直接写出错误响应
+func projectFile(c *gin.Context) (string, bool) {
+	file, err := requestStore(c).resolve(c.Param("path"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return "", false
+	}
+	return file, true
+}
+
+// projectAssetHandler 处理 GET /p/:project/data/*path
+func projectAssetHandler(c *gin.Context) {
+	file, ok := projectFile(c)
+	if !ok {
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || st.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, st.Name(), st.ModTime(), f)
+}
+
+// managedPath 判断路径是否属于场景、预设等接口维护的目录
+func managedPath(rel string) bool {
+	clean := path.Clean("/" + strings.ReplaceAll(rel, "\\", "/"))
+	first := strings.SplitN(strings.TrimPrefix(clean, "/"), "/", 2)[0]
+	return projectManagedDirs[first]
+}
+
+// putProjectAssetHandler 处理 PUT /p/:project/data/*path，请求体为文件内容
+func putProjectAssetHandler(c *gin.Context) {
+	if managedPath(c.Param("path")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "this directory is managed by the scenes, presets and layouts APIs"})
+		return
+	}
+	file, ok := projectFile(c)
+	if !ok {
+		return
+	}
+	if st, err := os.Stat(file); err == nil && st.IsDir() {
+		c.JSON(http.StatusConflict, gin.H{"error": "path is a directory"})
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, projectUploadMaxBytes))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	_, existed := os.Stat(file)
+	if err := writeFileAtomic(file, data, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusCreated
+	if existed == nil {
+		status = http.StatusOK
+	}
+	s := requestStore(c)
+	c.JSON(status, gin.H{"url": s.dataURL(filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+c.Param("path"))))), "bytes": len(data)})
+}
+
+// deleteProjectAssetHandler 处理 DELETE /p/:project/data/*path
+func deleteProjectAssetHandler(c *gin.Context) {
+	if managedPath(c.Param("path")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "this directory is managed by the scenes, presets and layouts APIs"})
+		return
+	}
+	file, ok := projectFile(c)
+	if !ok {
+		return
+	}
+	st, err := os.Stat(file)
+	if err != nil || st.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	if err := os.Remove(file); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
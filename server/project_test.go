@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testDataRoot 建立临时数据根目录，包含项目 a、b 和一些跨目录的符号链接
+func testDataRoot(t *testing.T) string {
+	t.Helper()
+	old := dataRoot
+	t.Cleanup(func() { dataRoot = old })
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setDataRoot(filepath.Join(base, "data")); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"projects/a/models", "projects/b", "public"} {
+		os.MkdirAll(filepath.Join(dataRoot, dir), 0755)
+	}
+	os.WriteFile(filepath.Join(base, "outside.txt"), []byte("outside"), 0644)
+	os.WriteFile(filepath.Join(dataRoot, "projects/a/models/car.glb"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dataRoot, "projects/b/secret.bin"), []byte("b"), 0644)
+	links := map[string]string{
+		"projects/a/to-b":        "../b",
+		"projects/a/to-outside":  "../../../outside.txt",
+		"projects/a/inner":       "models",
+		"projects/a/to-global":   "../../public",
+		"public/to-project":      "../projects/b",
+		"public/to-projects":     "../projects",
+		"public/to-project-file": "../projects/b/secret.bin",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dataRoot, name)); err != nil {
+			t.Skip("symlinks are not supported:", err)
+		}
+	}
+	return base
+}
+
+func TestStoreResolve(t *testing.T) {
+	testDataRoot(t)
+	s := projectStore("a")
+	ok := map[string]string{
+		"models/car.glb":     "projects/a/models/car.glb",
+		"/models/car.glb":    "projects/a/models/car.glb",
+		`models\car.glb`:     "projects/a/models/car.glb",
+		"inner/car.glb":      "projects/a/models/car.glb",
+		"new/dir/file.glb":   "projects/a/new/dir/file.glb",
+		"models/../x.glb":    "projects/a/x.glb",
+		"../../public/x.glb": "projects/a/public/x.glb", // 按 URL 规范化，不会越出根目录
+	}
+	for rel, want := range ok {
+		full, err := s.resolve(rel)
+		if err != nil {
+			t.Errorf("resolve(%q): %v", rel, err)
+			continue
+		}
+		if got := dataRelPath(full); got != want {
+			t.Errorf("resolve(%q) = %s, want %s", rel, got, want)
+		}
+	}
+	for _, rel := range []string{
+		"to-b/secret.bin",
+		"to-b/new.bin",
+		"to-outside",
+		"to-global/x.glb",
+		".project.json",
+		"models/.hidden",
+		"models/car.glb\x00.png",
+	} {
+		if full, err := s.resolve(rel); err == nil {
+			t.Errorf("resolve(%q) = %s, want an error", rel, full)
+		}
+	}
+}
+
+func TestResolveDataPathHidesProjects(t *testing.T) {
+	testDataRoot(t)
+	for _, rel := range []string{
+		"projects/b/secret.bin",
+		"/projects",
+		`projects\b\secret.bin`,
+		"public/../projects/b/secret.bin",
+		"public/to-project/secret.bin",
+		"public/to-projects/b/secret.bin",
+		"public/to-project-file",
+	} {
+		if _, err := resolveDataPath(rel); !errors.Is(err, errProjectPath) {
+			t.Errorf("resolveDataPath(%q): got %v, want errProjectPath", rel, err)
+		}
+	}
+	if _, err := resolveDataPath("public/model.glb"); err != nil {
+		t.Errorf("resolveDataPath(public/model.glb): %v", err)
+	}
+}
+
+func TestResolveRelativeStaysInProject(t *testing.T) {
+	testDataRoot(t)
+	projA := filepath.Join(dataRoot, "projects/a/models")
+	public := filepath.Join(dataRoot, "public")
+	tests := []struct {
+		dir, rel string
+		ok       bool
+	}{
+		{projA, "tex/wheel.png", true},
+		{projA, "../../b/secret.bin", false},
+		{projA, "../to-b/secret.bin", false},
+		{projA, "../../../public/x.png", false},
+		{projA, "../../../../outside.txt", false},
+		{public, "x.png", true},
+		{public, "../projects/b/secret.bin", false},
+		{public, "to-project/secret.bin", false},
+		{public, "to-projects/b/secret.bin", false},
+	}
+	for _, tt := range tests {
+		_, err := resolveRelative(tt.dir, tt.rel)
+		if (err == nil) != tt.ok {
+			t.Errorf("resolveRelative(%s, %q): got %v, want ok=%v", dataRelPath(tt.dir), tt.rel, err, tt.ok)
+		}
+	}
+}
+
+func TestManagedPath(t *testing.T) {
+	for rel, want := range map[string]bool{
+		"scenes/a.json":       true,
+		"/presets":            true,
+		`layouts\x.json`:      true,
+		"models/../cameras/x": true,
+		"models/scenes/a":     false,
+		"scenesx/a":           false,
+	} {
+		if got := managedPath(rel); got != want {
+			t.Errorf("managedPath(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestProjectAccess(t *testing.T) {
+	testDataRoot(t)
+	if err := writeProject(&Project{Name: "a", Members: []ProjectMember{{"ann", roleEditor}, {"vic", roleViewer}}}); err != nil {
+		t.Fatal(err)
+	}
+	oldKey := authConfig.key
+	t.Cleanup(func() { authConfig.key = oldKey })
+	_, authConfig.key, _ = ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name    string
+		project string
+		claims  *Claims
+		role    string
+		status  int
+	}{
+		{"editor edits", "a", &Claims{Subject: "ann", Role: roleViewer}, roleEditor, http.StatusNoContent},
+		{"viewer reads", "a", &Claims{Subject: "vic", Role: roleViewer}, roleViewer, http.StatusNoContent},
+		{"viewer cannot edit", "a", &Claims{Subject: "vic", Role: roleEditor}, roleEditor, http.StatusForbidden},
+		{"global admin", "a", &Claims{Subject: "root", Role: roleAdmin}, roleAdmin, http.StatusNoContent},
+		{"not a member", "a", &Claims{Subject: "eve", Role: roleEditor}, roleViewer, http.StatusNotFound},
+		{"anonymous", "a", nil, roleViewer, http.StatusNotFound},
+		{"no metadata", "b", &Claims{Subject: "root", Role: roleAdmin}, roleViewer, http.StatusNotFound},
+		{"bad name", "..", &Claims{Subject: "root", Role: roleAdmin}, roleViewer, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setClaims := func(c *gin.Context) {
+				if tt.claims != nil {
+					c.Set("claims", tt.claims)
+				}
+			}
+			check := func(c *gin.Context) {
+				if s := requestStore(c); s.project != tt.project {
+					t.Errorf("store %+v", s)
+				}
+				c.Status(http.StatusNoContent)
+			}
+			w := serveTest(http.MethodGet, "/p/:project/x", "/p/"+tt.project+"/x", "", setClaims, projectAccess(tt.role), check)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// 纯 CPU 光栅化渲染：z-buffer、逐顶点法线插值、基础色纹理采样、方向光 + 环境光。
+// 只用于生成缩略图，不追求与 three.js 的 PBR 结果一致。
+
+type vec3 [3]float64
+
+func (a vec3) add(b vec3) vec3      { return vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func (a vec3) sub(b vec3) vec3      { return vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func (a vec3) scale(s float64) vec3 { return vec3{a[0] * s, a[1] * s, a[2] * s} }
+func (a vec3) dot(b vec3) float64   { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func (a vec3) length() float64      { return math.Sqrt(a.dot(a)) }
+func (a vec3) lerp(b vec3, t float64) vec3 {
+	return vec3{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t, a[2] + (b[2]-a[2])*t}
+}
+func (a vec3) cross(b vec3) vec3 {
+	return vec3{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+func (a vec3) norm() vec3 {
+	l := math.Sqrt(a.dot(a))
+	if l == 0 {
+		return a
+	}
+	return a.scale(1 / l)
+}
+
+// mat4 按 glTF 的列主序存储
+type mat4 [16]float64
+
+var identity4 = mat4{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+
+func (a mat4) mul(b mat4) mat4 {
+	var m mat4
+	for c := 0; c < 4; c++ {
+		for r := 0; r < 4; r++ {
+			var s float64
+			for k := 0; k < 4; k++ {
+				s += a[k*4+r] * b[c*4+k]
+			}
+			m[c*4+r] = s
+		}
+	}
+	return m
+}
+
+func (a mat4) point(p vec3) vec3 {
+	return vec3{
+		a[0]*p[0] + a[4]*p[1] + a[8]*p[2] + a[12],
+		a[1]*p[0] + a[5]*p[1] + a[9]*p[2] + a[13],
+		a[2]*p[0] + a[6]*p[1] + a[10]*p[2] + a[14],
+	}
+}
+
+// normalMatrix 返回左上 3x3 的逆转置（列主序），用于变换法线
+func (a mat4) normalMatrix() [9]float64 {
+	m := [9]float64{a[0], a[1], a[2], a[4], a[5], a[6], a[8], a[9], a[10]}
+	det := m[0]*(m[4]*m[8]-m[7]*m[5]) - m[3]*(m[1]*m[8]-m[7]*m[2]) + m[6]*(m[1]*m[5]-m[4]*m[2])
+	if det == 0 {
+		return m
+	}
+	inv := 1 / det
+	// 逆矩阵的转置等于伴随矩阵（不转置）除以行列式
+	return [9]float64{
+		(m[4]*m[8] - m[5]*m[7]) * inv, (m[5]*m[6] - m[3]*m[8]) * inv, (m[3]*m[7] - m[4]*m[6]) * inv,
+		(m[2]*m[7] - m[1]*m[8]) * inv, (m[0]*m[8] - m[2]*m[6]) * inv, (m[1]*m[6] - m[0]*m[7]) * inv,
+		(m[1]*m[5] - m[2]*m[4]) * inv, (m[2]*m[3] - m[0]*m[5]) * inv, (m[0]*m[4] - m[1]*m[3]) * inv,
+	}
+}
+
+func mulNormal(m [9]float64, n vec3) vec3 {
+	return vec3{
+		m[0]*n[0] + m[3]*n[1] + m[6]*n[2],
+		m[1]*n[0] + m[4]*n[1] + m[7]*n[2],
+		m[2]*n[0] + m[5]*n[1] + m[8]*n[2],
+	}.norm()
+}
+
+// nodeMatrix 返回节点的局部变换（matrix 优先，否则由 TRS 组合）
+func nodeMatrix(n *GLTFNode) mat4 {
+	if len(n.Matrix) == 16 {
+		var m mat4
+		copy(m[:], n.Matrix)
+		return m
+	}
+	t := vec3{}
+	if len(n.Translation) == 3 {
+		copy(t[:], n.Translation)
+	}
+	q := [4]float64{0, 0, 0, 1}
+	if len(n.Rotation) == 4 {
+		copy(q[:], n.Rotation)
+	}
+	s := vec3{1, 1, 1}
+	if len(n.Scale) == 3 {
+		copy(s[:], n.Scale)
+	}
+	x, y, z, w := q[0], q[1], q[2], q[3]
+	return mat4{
+		(1 - 2*(y*y+z*z)) * s[0], (2 * (x*y + z*w)) * s[0], (2 * (x*z - y*w)) * s[0], 0,
+		(2 * (x*y - z*w)) * s[1], (1 - 2*(x*x+z*z)) * s[1], (2 * (y*z + x*w)) * s[1], 0,
+		(2 * (x*z + y*w)) * s[2], (2 * (y*z - x*w)) * s[2], (1 - 2*(x*x+y*y)) * s[2], 0,
+		t[0], t[1], t[2], 1,
+	}
+}
+
+// renderTexture 是解码后的基础色纹理
+type renderTexture struct {
+	img          *image.NRGBA
+	wrapS, wrapT int
+}
+
+// renderMaterial 是光栅化用到的材质子集
+type renderMaterial struct {
+	Base      [4]float64 // 线性空间
+	Emissive  vec3
+	Texture   *renderTexture
+	AlphaMask float64 // MASK 模式的阈值，< 0 表示不裁剪
+}
+
+// renderMesh 是已变换到世界空间的三角形网格
+type renderMesh struct {
+	Pos     []vec3
+	Normals []vec3 // 可能为空，此时使用面法线
+	UVs     [][2]float64
+	Colors  [][4]float64
+	Indices []uint32
+	Mat     *renderMaterial
+}
+
+// renderScene 把文档默认场景展开为世界空间网格
+func renderScene(f *GLTFFile) ([]renderMesh, error) {
+	doc := f.Doc
+	var roots []int
+	switch {
+	case len(doc.Scenes) > 0:
+		s := 0
+		if doc.Scene != nil && *doc.Scene >= 0 && *doc.Scene < len(doc.Scenes) {
+			s = *doc.Scene
+		}
+		roots = doc.Scenes[s].Nodes
+	default:
+		child := make([]bool, len(doc.Nodes))
+		for _, n := range doc.Nodes {
+			for _, c := range n.Children {
+				if c >= 0 && c < len(child) {
+					child[c] = true
+				}
+			}
+		}
+		for i := range doc.Nodes {
+			if !child[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	materials := map[int]*renderMaterial{}
+	textures := map[int]*renderTexture{}
+	var meshes []renderMesh
+	visited := make([]bool, len(doc.Nodes))
+	var walk func(i int, parent mat4)
+	walk = func(i int, parent mat4) {
+		if i < 0 || i >= len(doc.Nodes) || visited[i] {
+			return
+		}
+		visited[i] = true
+		n := &doc.Nodes[i]
+		world := parent.mul(nodeMatrix(n))
+		if n.Mesh != nil && *n.Mesh >= 0 && *n.Mesh < len(doc.Meshes) {
+			for _, p := range doc.Meshes[*n.Mesh].Primitives {
+				rm, ok := buildRenderMesh(f, &p, world)
+				if !ok {
+					continue
+				}
+				mi := -1
+				if p.Material != nil {
+					mi = *p.Material
+				}
+				if materials[mi] == nil {
+					materials[mi] = renderMaterialFor(f, mi, textures)
+				}
+				rm.Mat = materials[mi]
+				meshes = append(meshes, rm)
+			}
+		}
+		for _, c := range n.Children {
+			walk(c, world)
+		}
+	}
+	for _, r := range roots {
+		walk(r, identity4)
+	}
+	if len(meshes) == 0 {
+		return nil, errors.New("model has no renderable triangles")
+	}
+	return meshes, nil
+}
+
+// buildRenderMesh 读取三角形图元（含条带和扇形）并变换到世界空间
+func buildRenderMesh(f *GLTFFile, p *GLTFPrimitive, world mat4) (renderMesh, bool) {
+	var rm renderMesh
+	mode := p.primitiveMode()
+	if mode != gltfTriangles && mode != gltfTriangleStrip && mode != gltfTriangleFan {
+		return rm, false
+	}
+	pa, ok := p.Attributes["POSITION"]
+	if !ok {
+		return rm, false
+	}
+	pos, err := f.ReadAccessor(pa)
+	if err != nil || len(pos) < 9 {
+		return rm, false
+	}
+	rm.Pos = make([]vec3, len(pos)/3)
+	for i := range rm.Pos {
+		rm.Pos[i] = world.point(vec3{pos[3*i], pos[3*i+1], pos[3*i+2]})
+	}
+	if a, ok := p.Attributes["NORMAL"]; ok {
+		if nv, err := f.ReadAccessor(a); err == nil && len(nv) == len(pos) {
+			nm := world.normalMatrix()
+			rm.Normals = make([]vec3, len(rm.Pos))
+			for i := range rm.Normals {
+				rm.Normals[i] = mulNormal(nm, vec3{nv[3*i], nv[3*i+1], nv[3*i+2]})
+			}
+		}
+	}
+	if a, ok := p.Attributes["TEXCOORD_0"]; ok {
+		if uv, err := f.ReadAccessor(a); err == nil && len(uv) == 2*len(rm.Pos) {
+			rm.UVs = make([][2]float64, len(rm.Pos))
+			for i := range rm.UVs {
+				rm.UVs[i] = [2]float64{uv[2*i], uv[2*i+1]}
+			}
+		}
+	}
+	if a, ok := p.Attributes["COLOR_0"]; ok {
+		cv, err := f.ReadAccessor(a)
+		n := 0
+		if err == nil && len(rm.Pos) > 0 {
+			n = len(cv) / len(rm.Pos)
+		}
+		if n == 3 || n == 4 {
+			rm.Colors = make([][4]float64, len(rm.Pos))
+			for i := range rm.Colors {
+				c := [4]float64{1, 1, 1, 1}
+				copy(c[:], cv[n*i:n*i+n])
+				rm.Colors[i] = c
+			}
+		}
+	}
+	idx, err := f.ReadIndices(p)
+	if err != nil {
+		return rm, false
+	}
+	switch mode {
+	case gltfTriangles:
+		rm.Indices = idx[:len(idx)/3*3]
+	case gltfTriangleStrip:
+		for i := 0; i+2 < len(idx); i++ {
+			if i%2 == 0 {
+				rm.Indices = append(rm.Indices, idx[i], idx[i+1], idx[i+2])
+			} else {
+				rm.Indices = append(rm.Indices, idx[i+1], idx[i], idx[i+2])
+			}
+		}
+	case gltfTriangleFan:
+		for i := 1; i+1 < len(idx); i++ {
+			rm.Indices = append(rm.Indices, idx[0], idx[i], idx[i+1])
+		}
+	}
+	for _, v := range rm.Indices {
+		if int(v) >= len(rm.Pos) {
+			return rm, false
+		}
+	}
+	return rm, len(rm.Indices) > 0
+}
+
+// renderMaterialFor 提取材质的基础色、自发光和基础色纹理；无法解码的纹理会被忽略
+func renderMaterialFor(f *GLTFFile, i int, cache map[int]*renderTexture) *renderMaterial {
+	m := &renderMaterial{Base: [4]float64{0.8, 0.8, 0.8, 1}, AlphaMask: -1}
+	doc := f.Doc
+	if i < 0 || i >= len(doc.Materials) {
+		return m
+	}
+	mat := &doc.Materials[i]
+	if pbr := mat.PBRMetallicRoughness; pbr != nil {
+		m.Base = [4]float64{1, 1, 1, 1}
+		if len(pbr.BaseColorFactor) == 4 {
+			copy(m.Base[:], pbr.BaseColorFactor)
+		}
+		if ti := pbr.BaseColorTexture; ti != nil && ti.TexCoord == 0 {
+			m.Texture = loadRenderTexture(f, ti.Index, cache)
+		}
+	}
+	if len(mat.EmissiveFactor) == 3 {
+		copy(m.Emissive[:], mat.EmissiveFactor)
+	}
+	if mat.AlphaMode == "MASK" {
+		m.AlphaMask = 0.5
+		if mat.AlphaCutoff != nil {
+			m.AlphaMask = *mat.AlphaCutoff
+		}
+	}
+	return m
+}
+
+func loadRenderTexture(f *GLTFFile, i int, cache map[int]*renderTexture) *renderTexture {
+	if t, ok := cache[i]; ok {
+		return t
+	}
+	cache[i] = nil
+	doc := f.Doc
+	if i < 0 || i >= len(doc.Textures) || doc.Textures[i].Source == nil {
+		return nil
+	}
+	data, err := f.ImageData(*doc.Textures[i].Source)
+	if err != nil {
+		return nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	t := &renderTexture{wrapS: 10497, wrapT: 10497}
+	if s := doc.Textures[i].Sampler; s != nil && *s >= 0 && *s < len(doc.Samplers) {
+		if w := doc.Samplers[*s].WrapS; w != 0 {
+			t.wrapS = w
+		}
+		if w := doc.Samplers[*s].WrapT; w != 0 {
+			t.wrapT = w
+		}
+	}
+	if n, ok := img.(*image.NRGBA); ok {
+		t.img = n
+	} else {
+		b := img.Bounds()
+		t.img = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(t.img, t.img.Bounds(), img, b.Min, draw.Src)
+	}
+	cache[i] = t
+	return t
+}
+
+// wrapCoord 按采样器的 wrap 模式把整数纹素坐标映射到 [0, n)
+func wrapCoord(i, n, mode int) int {
+	switch mode {
+	case 33071: // CLAMP_TO_EDGE
+		if i < 0 {
+			return 0
+		}
+		if i >= n {
+			return n - 1
+		}
+		return i
+	case 33648: // MIRRORED_REPEAT
+		p := 2 * n
+		i = ((i % p) + p) % p
+		if i >= n {
+			i = p - 1 - i
+		}
+		return i
+	default: // REPEAT
+		return ((i % n) + n) % n
+	}
+}
+
+// sample 双线性采样，返回线性空间 RGBA
+func (t *renderTexture) sample(u, v float64) [4]float64 {
+	w, h := t.img.Rect.Dx(), t.img.Rect.Dy()
+	x := u*float64(w) - 0.5
+	y := v*float64(h) - 0.5
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	var out [4]float64
+	for _, s := range [4]struct {
+		dx, dy int
+		wt     float64
+	}{{0, 0, (1 - fx) * (1 - fy)}, {1, 0, fx * (1 - fy)}, {0, 1, (1 - fx) * fy}, {1, 1, fx * fy}} {
+		px := wrapCoord(x0+s.dx, w, t.wrapS)
+		py := wrapCoord(y0+s.dy, h, t.wrapT)
+		o := py*t.img.Stride + px*4
+		c := t.img.Pix[o : o+4]
+		out[0] += s.wt * srgbToLinear[c[0]]
+		out[1] += s.wt * srgbToLinear[c[1]]
+		out[2] += s.wt * srgbToLinear[c[2]]
+		out[3] += s.wt * float64(c[3]) / 255
+	}
+	return out
+}
+
+var srgbToLinear = func() (t [256]float64) {
+	for i := range t {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			t[i] = c / 12.92
+		} else {
+			t[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+	return
+}()
+
+func linearToSRGB(c float64) uint8 {
+	if c <= 0 {
+		return 0
+	}
+	if c >= 1 {
+		return 255
+	}
+	if c <= 0.0031308 {
+		c *= 12.92
+	} else {
+		c = 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+	return uint8(c*255 + 0.5)
+}
+
+// renderCamera 是自动取景的透视相机
+type renderCamera struct {
+	Eye, Right, Up, Forward vec3
+	Focal                   float64 // 视口半宽对应的焦距
+	Light                   vec3    // 指向光源的方向
+}
+
+// 自动取景：从右前上方看向包围球中心，包围球正好填满视野
+const renderFOV = 35 * math.Pi / 180
+
+func frameCamera(meshes []renderMesh) renderCamera {
+	min := vec3{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max := vec3{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, m := range meshes {
+		for _, i := range m.Indices {
+			p := m.Pos[i]
+			for k := 0; k < 3; k++ {
+				min[k] = math.Min(min[k], p[k])
+				max[k] = math.Max(max[k], p[k])
+			}
+		}
+	}
+	center := min.add(max).scale(0.5)
+	radius := math.Sqrt(max.sub(min).dot(max.sub(min))) / 2
+	if radius == 0 {
+		radius = 1
+	}
+	dir := vec3{1, 0.7, 1.6}.norm()
+	dist := radius / math.Sin(renderFOV/2) * 1.02
+	cam := renderCamera{Eye: center.add(dir.scale(dist))}
+	cam.Forward = dir.scale(-1)
+	cam.Right = cam.Forward.cross(vec3{0, 1, 0}).norm()
+	cam.Up = cam.Right.cross(cam.Forward)
+	cam.Focal = 1 / math.Tan(renderFOV/2)
+	// 主光从相机左上方照射
+	cam.Light = cam.Right.scale(-0.45).add(cam.Up.scale(0.8)).add(cam.Forward.scale(-0.55)).norm()
+	return cam
+}
+
+const (
+	renderAmbient = 0.35
+	renderDiffuse = 0.8
+)
+
+// rasterize 以 size*ss 的分辨率渲染，再按 ss×ss 盒式滤波下采样抗锯齿，背景透明
+func rasterize(meshes []renderMesh, size, ss int) *image.NRGBA {
+	cam := frameCamera(meshes)
+	w := size * ss
+	depth := make([]float64, w*w)
+	for i := range depth {
+		depth[i] = math.Inf(1)
+	}
+	colorBuf := make([][3]float64, w*w)
+	covered := make([]bool, w*w)
+	half := float64(w) / 2
+
+	type sv struct {
+		x, y, iz float64 // 屏幕坐标与 1/深度
+	}
+	for mi := range meshes {
+		m := &meshes[mi]
+		proj := make([]sv, len(m.Pos))
+		for i, p := range m.Pos {
+			d := p.sub(cam.Eye)
+			z := d.dot(cam.Forward)
+			if z <= 1e-9 {
+				z = 1e-9
+			}
+			proj[i] = sv{
+				x:  half + d.dot(cam.Right)*cam.Focal/z*half,
+				y:  half - d.dot(cam.Up)*cam.Focal/z*half,
+				iz: 1 / z,
+			}
+		}
+		for t := 0; t+2 < len(m.Indices); t += 3 {
+			i0, i1, i2 := m.Indices[t], m.Indices[t+1], m.Indices[t+2]
+			a, b, c := proj[i0], proj[i1], proj[i2]
+			area := (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x)
+			if area == 0 || math.IsNaN(area) {
+				continue
+			}
+			faceN := m.Pos[i1].sub(m.Pos[i0]).cross(m.Pos[i2].sub(m.Pos[i0])).norm()
+			minX := int(math.Max(0, math.Floor(math.Min(a.x, math.Min(b.x, c.x)))))
+			maxX := int(math.Min(float64(w-1), math.Ceil(math.Max(a.x, math.Max(b.x, c.x)))))
+			minY := int(math.Max(0, math.Floor(math.Min(a.y, math.Min(b.y, c.y)))))
+			maxY := int(math.Min(float64(w-1), math.Ceil(math.Max(a.y, math.Max(b.y, c.y)))))
+			for py := minY; py <= maxY; py++ {
+				fy := float64(py) + 0.5
+				for px := minX; px <= maxX; px++ {
+					fx := float64(px) + 0.5
+					w0 := ((b.x-fx)*(c.y-fy) - (b.y-fy)*(c.x-fx)) / area
+					w1 := ((c.x-fx)*(a.y-fy) - (c.y-fy)*(a.x-fx)) / area
+					w2 := 1 - w0 - w1
+					if w0 < 0 || w1 < 0 || w2 < 0 {
+						continue
+					}
+					// 透视校正插值
+					p0, p1, p2 := w0*a.iz, w1*b.iz, w2*c.iz
+					iz := p0 + p1 + p2
+					z := 1 / iz
+					o := py*w + px
+					if z >= depth[o] {
+						continue
+					}
+					p0, p1, p2 = p0*z, p1*z, p2*z
+					rgba, ok := shadeFragment(m, &cam, i0, i1, i2, p0, p1, p2, faceN)
+					if !ok {
+						continue
+					}
+					depth[o] = z
+					colorBuf[o] = rgba
+					covered[o] = true
+				}
+			}
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	n := float64(ss * ss)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var sum [3]float64
+			hits := 0
+			for sy := 0; sy < ss; sy++ {
+				for sx := 0; sx < ss; sx++ {
+					o := (y*ss+sy)*w + x*ss + sx
+					if covered[o] {
+						hits++
+						sum[0] += colorBuf[o][0]
+						sum[1] += colorBuf[o][1]
+						sum[2] += colorBuf[o][2]
+					}
+				}
+			}
+			if hits == 0 {
+				continue
+			}
+			h := float64(hits)
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: linearToSRGB(sum[0] / h),
+				G: linearToSRGB(sum[1] / h),
+				B: linearToSRGB(sum[2] / h),
+				A: uint8(h/n*255 + 0.5),
+			})
+		}
+	}
+	return img
+}
+
+// shadeFragment 计算片元颜色（线性空间）；MASK 材质低于阈值时丢弃
+func shadeFragment(m *renderMesh, cam *renderCamera, i0, i1, i2 uint32, w0, w1, w2 float64, faceN vec3) ([3]float64, bool) {
+	base := m.Mat.Base
+	if m.Mat.Texture != nil && m.UVs != nil {
+		u := w0*m.UVs[i0][0] + w1*m.UVs[i1][0] + w2*m.UVs[i2][0]
+		v := w0*m.UVs[i0][1] + w1*m.UVs[i1][1] + w2*m.UVs[i2][1]
+		t := m.Mat.Texture.sample(u, v)
+		for k := range base {
+			base[k] *= t[k]
+		}
+	}
+	if m.Colors != nil {
+		for k := range base {
+			base[k] *= w0*m.Colors[i0][k] + w1*m.Colors[i1][k] + w2*m.Colors[i2][k]
+		}
+	}
+	if m.Mat.AlphaMask >= 0 && base[3] < m.Mat.AlphaMask {
+		return [3]float64{}, false
+	}
+	n := faceN
+	if m.Normals != nil {
+		n = m.Normals[i0].scale(w0).add(m.Normals[i1].scale(w1)).add(m.Normals[i2].scale(w2)).norm()
+	}
+	// 双面光照：法线背对相机时翻转
+	if n.dot(cam.Forward) > 0 {
+		n = n.scale(-1)
+	}
+	light := renderAmbient + renderDiffuse*math.Max(0, n.dot(cam.Light))
+	return [3]float64{
+		base[0]*light + m.Mat.Emissive[0],
+		base[1]*light + m.Mat.Emissive[1],
+		base[2]*light + m.Mat.Emissive[2],
+	}, true
+}
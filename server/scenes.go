@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sceneMaxBytes     = 64 << 20
+	sceneMaxThumbnail = 2 << 20
+)
+
+var sceneIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// scenesMu 串行化场景的写操作，保证场景文件和元数据一致
+var scenesMu sync.Mutex
+
+// SceneMeta 是场景的列表信息，保存在 scenes/<id>.meta.json；场景本身是 scenes/<id>.json，可直接交给 ObjectLoader
+type SceneMeta struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Author    string    `json:"author"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	Size      int64     `json:"size"`
+	URL       string    `json:"url"`
+	Thumbnail string    `json:"thumbnail,omitempty"`
+}
+
+// sceneRequest 是创建/更新场景的请求体
+type sceneRequest struct {
+	Name      string          `json:"name"`
+	Author    string          `json:"author"`
+	Scene     json.RawMessage `json:"scene" binding:"required"`
+	Thumbnail string          `json:"thumbnail"` // 可选，canvas.toDataURL() 得到的 PNG data URI
+}
+
+// sceneInvalid 表示场景文档没有通过校验
+type sceneInvalid struct{ issues []Issue }
+
+func (e *sceneInvalid) Error() string {
+	return fmt.Sprintf("invalid scene: %d problems", len(e.issues))
+}
+
+// scenesRoot 返回命名空间中场景的存放目录
+func (s store) scenesRoot() string {
+	return filepath.Join(s.root, "scenes")
+}
+
+func (s store) sceneFile(id string) string {
+	return filepath.Join(s.scenesRoot(), id+".json")
+}
+
+func (s store) sceneMetaFile(id string) string {
+	return filepath.Join(s.scenesRoot(), id+".meta.json")
+}
+
+// sceneThumbnailFile 缩略图放在隐藏目录里，不参与依赖检查
+func (s store) sceneThumbnailFile(id string) string {
+	return filepath.Join(s.scenesRoot(), ".thumbnails", id+".png")
+}
+
+func (s store) readSceneMeta(id string) (*SceneMeta, error) {
+	data, err := os.ReadFile(s.sceneMetaFile(id))
+	if err != nil {
+		return nil, err
+	}
+	m := new(SceneMeta)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	m.URL = s.dataURL(s.sceneFile(id))
+	if _, err := os.Stat(s.sceneThumbnailFile(id)); err == nil {
+		m.Thumbnail = s.apiURL("/scenes/" + id + "/thumbnail.png")
+	} else {
+		m.Thumbnail = ""
+	}
+	return m, nil
+}
+
+// parseSceneRequest 校验请求中的场景和缩略图
+func parseSceneRequest(req *sceneRequest) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(req.Scene, &doc); err != nil {
+		return nil, &sceneInvalid{[]Issue{{Code: "INVALID_JSON", Pointer: "", Message: err.Error()}}}
+	}
+	if issues := validateThreeScene(doc); len(issues) > 0 {
+		return nil, &sceneInvalid{issues}
+	}
+	if req.Name == "" {
+		// 默认使用根对象的名字
+		if root, ok := doc.(map[string]interface{}); ok {
+			if obj, ok := root["object"].(map[string]interface{}); ok {
+				req.Name, _ = obj["name"].(string)
+			}
+		}
+	}
+	if req.Thumbnail == "" {
+		return nil, nil
+	}
+	if dataURIMime(req.Thumbnail) != "image/png" {
+		return nil, errors.New("thumbnail must be a PNG data uri")
+	}
+	png, err := decodeDataURI(req.Thumbnail)
+	if err != nil {
+		return nil, fmt.Errorf("thumbnail: %w", err)
+	}
+	if len(png) > sceneMaxThumbnail {
+		return nil, fmt.Errorf("thumbnail exceeds %d bytes", sceneMaxThumbnail)
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(png)); err != nil {
+		return nil, fmt.Errorf("thumbnail: %w", err)
+	}
+	return png, nil
+}
+
+// saveScene 写入场景文件、缩略图和元数据；prev 为 nil 时表示新建
+func (s store) saveScene(id string, req *sceneRequest, thumb []byte, prev *SceneMeta) (*SceneMeta, error) {
+	now := time.Now().UTC()
+	m := &SceneMeta{ID: id, Name: req.Name, Author: req.Author, Created: now, Updated: now, Size: int64(len(req.Scene))}
+	if prev != nil {
+		m.Created = prev.Created
+		if m.Author == "" {
+			m.Author = prev.Author
+		}
+	}
+	if m.Name == "" {
+		m.Name = id
+	}
+	if err := writeFileAtomic(s.sceneFile(id), req.Scene, 0644); err != nil {
+		return nil, err
+	}
+	if thumb != nil {
+		if err := writeFileAtomic(s.sceneThumbnailFile(id), thumb, 0644); err != nil {
+			return nil, err
+		}
+	}
+	js, _ := json.MarshalIndent(m, "", "  ")
+	if err := writeFileAtomic(s.sceneMetaFile(id), js, 0644); err != nil {
+		return nil, err
+	}
+	return s.readSceneMeta(id)
+}
+
+// bindScene 读取并校验请求体，失败时直接写出错误响应
+func bindScene(c *gin.Context) (*sceneRequest, []byte, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, sceneMaxBytes)
+	var req sceneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	// 开启认证时作者就是当前登录的用户，不能冒充他人
+	if cl := currentUser(c); cl != nil {
+		req.Author = cl.Subject
+	}
+	thumb, err := parseSceneRequest(&req)
+	var inv *sceneInvalid
+	switch {
+	case errors.As(err, &inv):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "errors": inv.issues})
+		return nil, nil, false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	return &req, thumb, true
+}
+
+// sceneID 检查路由中的场景 id，失败时直接写出错误响应
+func sceneID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if !sceneIDPattern.MatchString(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scene id"})
+		return "", false
+	}
+	return id, true
+}
+
+// sceneETag 以场景文件内容哈希作为 ETag
+func (s store) sceneETag(id string) (string, error) {
+	hash, err := fileHash(s.sceneFile(id))
+	if err != nil {
+		return "", err
+	}
+	return `"` + hash[:32] + `"`, nil
+}
+
+// listScenesHandler 处理 GET /api/scenes?author=，按更新时间倒序
+func listScenesHandler(c *gin.Context) {
+	s := requestStore(c)
+	entries, err := os.ReadDir(s.scenesRoot())
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	author := c.Query("author")
+	list := []SceneMeta{}
+	for _, e := range entries {
+		id := strings.TrimSuffix(e.Name(), ".meta.json")
+		if e.IsDir() || id == e.Name() || !sceneIDPattern.MatchString(id) {
+			continue
+		}
+		m, err := s.readSceneMeta(id)
+		if err != nil || author != "" && m.Author != author {
+			continue
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Updated.After(list[b].Updated) })
+	c.JSON(http.StatusOK, list)
+}
+
+// createSceneHandler 处理 POST /api/scenes
+func createSceneHandler(c *gin.Context) {
+	req, thumb, ok := bindScene(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	scenesMu.Lock()
+	defer scenesMu.Unlock()
+	m, err := s.saveScene(newJobID(), req, thumb, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+// getSceneHandler 处理 GET /api/scenes/:id，返回 three.js JSON 本身
+func getSceneHandler(c *gin.Context) {
+	id, ok := sceneID(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	end := startSpan(c, "storage")
+	etag, err := s.sceneETag(id)
+	end()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Content-Type", "application/json")
+	c.File(s.sceneFile(id))
+}
+
+// sceneMetaHandler 处理 GET /api/scenes/:id/meta
+func sceneMetaHandler(c *gin.Context) {
+	id, ok := sceneID(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	m, err := s.readSceneMeta(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// updateSceneHandler 处理 PUT /api/scenes/:id；带 If-Match 时内容已被他人修改则返回 412
+func updateSceneHandler(c *gin.Context) {
+	id, ok := sceneID(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	req, thumb, ok := bindScene(c)
+	if !ok {
+		return
+	}
+	scenesMu.Lock()
+	defer scenesMu.Unlock()
+	prev, err := s.readSceneMeta(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+	if match := c.GetHeader("If-Match"); match != "" {
+		if etag, err := s.sceneETag(id); err != nil || etag != match {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "scene was modified"})
+			return
+		}
+	}
+	m, err := s.saveScene(id, req, thumb, prev)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 整体替换后协作状态失效
+	collabReset(s, id, "scene was replaced")
+	c.JSON(http.StatusOK, m)
+}
+
+// deleteSceneHandler 处理 DELETE /api/scenes/:id
+func deleteSceneHandler(c *gin.Context) {
+	id, ok := sceneID(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	scenesMu.Lock()
+	defer scenesMu.Unlock()
+	if _, err := os.Stat(s.sceneMetaFile(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+	collabReset(s, id, "scene was deleted")
+	for _, f := range []string{s.sceneFile(id), s.sceneThumbnailFile(id), s.sceneMetaFile(id), s.camerasFile(id)} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// sceneThumbnailHandler 处理 GET /api/scenes/:id/thumbnail.png
+func sceneThumbnailHandler(c *gin.Context) {
+	id, ok := sceneID(c)
+	if !ok {
+		return
+	}
+	s := requestStore(c)
+	file := s.sceneThumbnailFile(id)
+	if _, err := os.Stat(file); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "thumbnail not found"})
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.File(file)
+}
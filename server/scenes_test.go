@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	pngenc "image/png"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testPNGDataURI(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := pngenc.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestParseSceneRequest(t *testing.T) {
+	png := testPNGDataURI(t)
+	tests := []struct {
+		name      string
+		req       sceneRequest
+		invalid   bool // 场景没有通过校验
+		err       bool // 其它请求错误
+		wantName  string
+		wantThumb bool
+	}{
+		{"default name", sceneRequest{Scene: json.RawMessage(testThreeScene)}, false, false, "demo", false},
+		{"explicit name", sceneRequest{Name: "city", Scene: json.RawMessage(testThreeScene)}, false, false, "city", false},
+		{"thumbnail", sceneRequest{Scene: json.RawMessage(testThreeScene), Thumbnail: png}, false, false, "demo", true},
+		{"bad json", sceneRequest{Scene: json.RawMessage(`{`)}, true, false, "", false},
+		{"invalid scene", sceneRequest{Scene: json.RawMessage(`{"metadata":{}}`)}, true, false, "", false},
+		{"jpeg thumbnail", sceneRequest{Scene: json.RawMessage(testThreeScene), Thumbnail: "data:image/jpeg;base64,AAAA"}, false, true, "", false},
+		{"corrupt thumbnail", sceneRequest{Scene: json.RawMessage(testThreeScene), Thumbnail: "data:image/png;base64,AAAA"}, false, true, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			thumb, err := parseSceneRequest(&req)
+			var inv *sceneInvalid
+			switch {
+			case tt.invalid:
+				if !errors.As(err, &inv) || len(inv.issues) == 0 {
+					t.Fatalf("got %v, want a validation error", err)
+				}
+			case tt.err:
+				if err == nil || errors.As(err, &inv) {
+					t.Fatalf("got %v, want a request error", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if req.Name != tt.wantName || (thumb != nil) != tt.wantThumb {
+					t.Fatalf("name %q, thumbnail %v", req.Name, thumb != nil)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveScene(t *testing.T) {
+	setTestDataRoot(t)
+	const id = "0123456789abcdef"
+	req := &sceneRequest{Name: "demo", Author: "ann", Scene: json.RawMessage(testThreeScene)}
+	first, err := globalStore().saveScene(id, req, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.URL != "/data/scenes/"+id+".json" || first.Thumbnail != "" || first.Size != int64(len(testThreeScene)) {
+		t.Fatalf("unexpected meta %+v", first)
+	}
+	// 更新时保留创建时间；没有给出作者时沿用原来的作者
+	png, _ := parseSceneRequest(&sceneRequest{Scene: json.RawMessage(testThreeScene), Thumbnail: testPNGDataURI(t)})
+	second, err := globalStore().saveScene(id, &sceneRequest{Scene: json.RawMessage(testThreeScene)}, png, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Created.Equal(first.Created) || second.Author != "ann" || second.Name != id || second.Thumbnail == "" {
+		t.Fatalf("unexpected meta after update %+v", second)
+	}
+}
+
+func TestSceneAuthorFromLogin(t *testing.T) {
+	setTestDataRoot(t)
+	login := func(c *gin.Context) { c.Set("claims", &Claims{Subject: "ann", Role: roleEditor}) }
+	body := `{"name":"demo","author":"mallory","scene":` + testThreeScene + `}`
+	w := serveTest(http.MethodPost, "/api/scenes", "/api/scenes", body, login, createSceneHandler)
+	var m SceneMeta
+	json.Unmarshal(w.Body.Bytes(), &m)
+	if w.Code != http.StatusCreated || m.Author != "ann" {
+		t.Fatalf("create: status %d, author %q", w.Code, m.Author)
+	}
+	w = serveTest(http.MethodPut, "/api/scenes/:id", "/api/scenes/"+m.ID, body, login, updateSceneHandler)
+	json.Unmarshal(w.Body.Bytes(), &m)
+	if w.Code != http.StatusOK || m.Author != "ann" {
+		t.Fatalf("update: status %d, author %q", w.Code, m.Author)
+	}
+	// 未开启认证时沿用请求中的作者
+	w = serveTest(http.MethodPost, "/api/scenes", "/api/scenes", body, createSceneHandler)
+	json.Unmarshal(w.Body.Bytes(), &m)
+	if m.Author != "mallory" {
+		t.Fatalf("anonymous create: author %q", m.Author)
+	}
+}
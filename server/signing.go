@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 签名 URL：/data/x.glb?exp=…&kid=…&sig=…，可选 ip 绑定客户端地址、scope 允许同一签名访问某个目录下的文件。
+// 受保护的路径没有有效签名时拒绝访问；密钥文件可以有多把密钥，第一把用于签名，其余仍可验证，用于轮换
+
+// signMinKeyBytes 是密钥的最短长度
+const signMinKeyBytes = 32
+
+// signMaxTTL 是签名 URL 的最长有效期
+const signMaxTTL = 7 * 24 * time.Hour
+
+var signKeyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+var (
+	errSignatureMissing = errors.New("this asset requires a signed URL")
+	errSignatureExpired = errors.New("signed URL has expired")
+	errSignatureInvalid = errors.New("signed URL is invalid")
+)
+
+type signKey struct {
+	id     string
+	secret []byte
+}
+
+// urlSigner 保存签名密钥和受保护的路径模式
+type urlSigner struct {
+	mu      sync.RWMutex
+	keys    []signKey
+	protect []string
+}
+
+var signer = &urlSigner{}
+
+// SignOptions 是签发 URL 的参数
+type SignOptions struct {
+	Path  string        `json:"path" binding:"required"`
+	TTL   time.Duration `json:"-"`
+	IP    string        `json:"ip"`
+	Scope string        `json:"scope"`
+}
+
+// loadSignKeys 读取密钥文件：每行 "kid 密钥"，密钥为 base64，# 开头的行是注释
+func loadSignKeys(file string) ([]signKey, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var keys []signKey
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !signKeyIDPattern.MatchString(fields[0]) {
+			return nil, fmt.Errorf("%s:%d: expected \"<kid> <base64 secret>\"", file, n)
+		}
+		if seen[fields[0]] {
+			return nil, fmt.Errorf("%s:%d: duplicate key id %q", file, n, fields[0])
+		}
+		secret, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			secret, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(fields[1], "="))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: secret is not base64", file, n)
+		}
+		if len(secret) < signMinKeyBytes {
+			return nil, fmt.Errorf("%s:%d: secret must be at least %d bytes", file, n, signMinKeyBytes)
+		}
+		seen[fields[0]] = true
+		keys = append(keys, signKey{fields[0], secret})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", file)
+	}
+	return keys, nil
+}
+
+// setupSigning 按命令行参数加载密钥和受保护路径；收到 SIGHUP 时重新读取密钥文件，轮换密钥不需要重启
+func setupSigning(keyFile, protect string) error {
+	var patterns []string
+	for _, p := range strings.Split(protect, ",") {
+		p = strings.Trim(strings.TrimSpace(p), "/")
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid protect pattern %q", p)
+		}
+		patterns = append(patterns, p)
+	}
+	if keyFile == "" {
+		if len(patterns) > 0 {
+			return fmt.Errorf("protected paths need a signing key file (-sign-keys)")
+		}
+		return nil
+	}
+	keys, err := loadSignKeys(keyFile)
+	if err != nil {
+		return err
+	}
+	signer.mu.Lock()
+	signer.keys, signer.protect = keys, patterns
+	signer.mu.Unlock()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			keys, err := loadSignKeys(keyFile)
+			if err != nil {
+				logError("重新读取签名密钥失败，继续使用旧密钥", "file", keyFile, "error", err)
+				continue
+			}
+			signer.mu.Lock()
+			signer.keys = keys
+			signer.mu.Unlock()
+			logInfo("已重新读取签名密钥", "file", keyFile, "keys", len(keys), "signing_key", keys[0].id)
+		}
+	}()
+	return nil
+}
+
+// cleanAssetPath 把 /data 下的路径规范为以 / 开头、不含 .. 的形式
+func cleanAssetPath(p string) string {
+	return path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+}
+
+// protected 判断路径或它所在的某级目录是否匹配受保护的模式
+func (s *urlSigner) protected(p string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rel := strings.TrimPrefix(cleanAssetPath(p), "/")
+	for rel != "" && rel != "." {
+		for _, pat := range s.protect {
+			if ok, _ := path.Match(pat, rel); ok {
+				return true
+			}
+		}
+		rel = path.Dir(rel)
+	}
+	return false
+}
+
+// signPayload 是参与签名的内容；有 scope 时签的是 scope，同一签名可访问其下所有文件
+func signPayload(kid string, exp int64, target, ip string) []byte {
+	return []byte(strings.Join([]string{"v1", kid, strconv.FormatInt(exp, 10), target, ip}, "\n"))
+}
+
+func hmacSign(secret, payload []byte) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// Sign 用当前密钥为 /data 下的路径生成查询参数
+func (s *urlSigner) Sign(opts SignOptions, now time.Time) (url.Values, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.keys) == 0 {
+		return nil, fmt.Errorf("no signing key is configured")
+	}
+	if opts.TTL <= 0 || opts.TTL > signMaxTTL {
+		return nil, fmt.Errorf("ttl must be between 1s and %s", signMaxTTL)
+	}
+	p := cleanAssetPath(opts.Path)
+	target := p
+	if opts.Scope != "" {
+		target = cleanAssetPath(opts.Scope)
+		if !inScope(p, target) {
+			return nil, fmt.Errorf("path %s is outside scope %s", p, target)
+		}
+	}
+	if opts.IP != "" && net.ParseIP(opts.IP) == nil {
+		return nil, fmt.Errorf("ip must be an IPv4 or IPv6 address")
+	}
+	key := s.keys[0]
+	exp := now.Add(opts.TTL).Unix()
+	q := url.Values{}
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	q.Set("kid", key.id)
+	if opts.IP != "" {
+		q.Set("ip", opts.IP)
+	}
+	if opts.Scope != "" {
+		q.Set("scope", target)
+	}
+	q.Set("sig", hmacSign(key.secret, signPayload(key.id, exp, target, opts.IP)))
+	return q, nil
+}
+
+// inScope 判断 p 是否为 scope 本身或其下的文件
+func inScope(p, scope string) bool {
+	return p == scope || strings.HasPrefix(p, strings.TrimSuffix(scope, "/")+"/")
+}
+
+// Verify 校验请求 p 的签名参数，clientIP 用于检查 ip 绑定
+func (s *urlSigner) Verify(p string, q url.Values, clientIP string, now time.Time) error {
+	sig := q.Get("sig")
+	if sig == "" {
+		return errSignatureMissing
+	}
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return errSignatureInvalid
+	}
+	target := cleanAssetPath(p)
+	if scope := q.Get("scope"); scope != "" {
+		if !inScope(target, cleanAssetPath(scope)) {
+			return errSignatureInvalid
+		}
+		target = cleanAssetPath(scope)
+	}
+	kid, ip := q.Get("kid"), q.Get("ip")
+	s.mu.RLock()
+	var secret []byte
+	for _, k := range s.keys {
+		if k.id == kid {
+			secret = k.secret
+		}
+	}
+	s.mu.RUnlock()
+	if secret == nil || !hmac.Equal([]byte(sig), []byte(hmacSign(secret, signPayload(kid, exp, target, ip)))) {
+		return errSignatureInvalid
+	}
+	// 签名正确后再检查过期时间和客户端地址
+	if now.Unix() > exp {
+		return errSignatureExpired
+	}
+	if ip != "" && !net.ParseIP(ip).Equal(net.ParseIP(clientIP)) {
+		return errSignatureInvalid
+	}
+	return nil
+}
+
+// signedTarget 返回访问 rel 时需要校验签名的路径：rel 本身受保护时为 rel；
+// 经符号链接落到受保护目录时为解开链接后的路径，签名要覆盖实际读到的文件；都不受保护时为空
+func signedTarget(rel string) string {
+	if !signer.enabled() {
+		return ""
+	}
+	if signer.protected(rel) {
+		return rel
+	}
+	if real := realDataRel(dataPath(rel)); !strings.HasPrefix(real, "..") && signer.protected(real) {
+		return real
+	}
+	return ""
+}
+
+// checkSigned 检查受保护路径的签名，失败时写出 403 并返回 false；rel 为 /data 下的路径
+func checkSigned(c *gin.Context, rel string) bool {
+	target := signedTarget(rel)
+	if target == "" {
+		return true
+	}
+	if err := signer.Verify(target, c.Request.URL.Query(), c.ClientIP(), time.Now()); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	// 签名 URL 的响应不能进入共享缓存
+	c.Header("Cache-Control", "private, no-store")
+	c.Set("signedURL", true)
+	return true
+}
+
+// signedFor 判断请求的签名参数是否允许读取 rel，不写响应
+func signedFor(c *gin.Context, rel string) bool {
+	target := signedTarget(rel)
+	return target == "" || signer.Verify(target, c.Request.URL.Query(), c.ClientIP(), time.Now()) == nil
+}
+
+// enabled 判断是否配置了受保护的路径
+func (s *urlSigner) enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.protect) > 0
+}
+
+// signedURLMiddleware 拦截 /data 下受保护路径的未签名访问
+func signedURLMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checkSigned(c, c.Param("filepath")) {
+			c.Next()
+		}
+	}
+}
+
+// signURLHandler 处理 POST /api/signed-urls，body 为 {path, ttl, ip, scope}，ttl 如 "15m"
+func signURLHandler(c *gin.Context) {
+	var req struct {
+		SignOptions
+		TTL string `json:"ttl"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts := req.SignOptions
+	opts.TTL = time.Hour
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a duration such as 15m or 2h"})
+			return
+		}
+		opts.TTL = d
+	}
+	now := time.Now()
+	q, err := signer.Sign(opts, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"url":     "/data" + cleanAssetPath(opts.Path) + "?" + q.Encode(),
+		"expires": now.Add(opts.TTL).UTC().Truncate(time.Second),
+	})
+}
+
+// runSign 实现 tServer sign 子命令，例如：tServer sign -keys keys.txt -ttl 2h clients/acme/car.glb
+func runSign(args []string) int {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	keys := fs.String("keys", "", "签名密钥文件，每行 \"kid base64密钥\"，第一把用于签名")
+	ttl := fs.Duration("ttl", time.Hour, "有效期")
+	ip := fs.String("ip", "", "只允许该客户端地址访问")
+	scope := fs.String("scope", "", "签名覆盖的目录，例如 clients/acme，可用同一签名访问其下所有文件")
+	base := fs.String("base", "", "URL 前缀，例如 https://assets.example.com")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法：tServer sign -keys 文件 [参数] 路径...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *keys == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	list, err := loadSignKeys(*keys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	s := &urlSigner{keys: list}
+	status := 0
+	for _, p := range fs.Args() {
+		q, err := s.Sign(SignOptions{Path: p, TTL: *ttl, IP: *ip, Scope: *scope}, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", p, err)
+			status = 1
+			continue
+		}
+		fmt.Println(strings.TrimSuffix(*base, "/") + "/data" + cleanAssetPath(p) + "?" + q.Encode())
+	}
+	return status
+}
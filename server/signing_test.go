@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testSigner() *urlSigner {
+	return &urlSigner{
+		keys:    []signKey{{"new", bytes.Repeat([]byte{1}, 32)}, {"old", bytes.Repeat([]byte{2}, 32)}},
+		protect: []string{"clients/*", "nda"},
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	s := testSigner()
+	now := time.Unix(1700000000, 0)
+	sign := func(opts SignOptions) url.Values {
+		t.Helper()
+		opts.TTL = time.Hour
+		q, err := s.Sign(opts, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}
+	with := func(q url.Values, key, value string) url.Values {
+		out := url.Values{}
+		for k, v := range q {
+			out[k] = append([]string(nil), v...)
+		}
+		out.Set(key, value)
+		return out
+	}
+	plain := sign(SignOptions{Path: "/clients/acme/car.glb"})
+	scoped := sign(SignOptions{Path: "/clients/acme/car.glb", Scope: "/clients/acme"})
+	bound := sign(SignOptions{Path: "/nda/a.png", IP: "10.0.0.1"})
+	oldKey := testSigner()
+	oldKey.keys = oldKey.keys[1:]
+	rotated, err := oldKey.Sign(SignOptions{Path: "/nda/a.png", TTL: time.Hour}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		q    url.Values
+		ip   string
+		at   time.Time
+		want error
+	}{
+		{"valid", "/clients/acme/car.glb", plain, "", now, nil},
+		{"cleaned path", "clients/acme/./car.glb", plain, "", now, nil},
+		{"other file", "/clients/acme/bike.glb", plain, "", now, errSignatureInvalid},
+		{"missing signature", "/clients/acme/car.glb", url.Values{}, "", now, errSignatureMissing},
+		{"tampered signature", "/clients/acme/car.glb", with(plain, "sig", "AAAA"), "", now, errSignatureInvalid},
+		{"extended expiry", "/clients/acme/car.glb", with(plain, "exp", "9999999999"), "", now, errSignatureInvalid},
+		{"bad expiry", "/clients/acme/car.glb", with(plain, "exp", "soon"), "", now, errSignatureInvalid},
+		{"unknown key", "/clients/acme/car.glb", with(plain, "kid", "gone"), "", now, errSignatureInvalid},
+		{"swapped key", "/clients/acme/car.glb", with(plain, "kid", "old"), "", now, errSignatureInvalid},
+		{"expired", "/clients/acme/car.glb", plain, "", now.Add(2 * time.Hour), errSignatureExpired},
+		{"scope file", "/clients/acme/tex/wheel.png", scoped, "", now, nil},
+		{"scope sibling prefix", "/clients/acme2/car.glb", scoped, "", now, errSignatureInvalid},
+		{"scope traversal", "/clients/acme/../other/car.glb", scoped, "", now, errSignatureInvalid},
+		{"widened scope", "/clients/other/car.glb", with(scoped, "scope", "/clients"), "", now, errSignatureInvalid},
+		{"dropped scope", "/clients/acme/tex/wheel.png", with(scoped, "scope", ""), "", now, errSignatureInvalid},
+		{"bound ip", "/nda/a.png", bound, "10.0.0.1", now, nil},
+		{"other ip", "/nda/a.png", bound, "10.0.0.2", now, errSignatureInvalid},
+		{"dropped ip", "/nda/a.png", with(bound, "ip", ""), "10.0.0.2", now, errSignatureInvalid},
+		{"rotated key", "/nda/a.png", rotated, "", now, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Verify(tt.path, tt.q, tt.ip, tt.at); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// 密钥从列表中移除后，用它签发的 URL 失效
+	s.keys = s.keys[:1]
+	if err := s.Verify("/nda/a.png", rotated, "", now); !errors.Is(err, errSignatureInvalid) {
+		t.Fatalf("removed key: got %v", err)
+	}
+}
+
+func TestSignOptionsRejected(t *testing.T) {
+	s := testSigner()
+	now := time.Now()
+	for name, opts := range map[string]SignOptions{
+		"zero ttl":      {Path: "/nda/a", TTL: 0},
+		"ttl too long":  {Path: "/nda/a", TTL: signMaxTTL + time.Second},
+		"outside scope": {Path: "/nda/a", Scope: "/clients", TTL: time.Hour},
+		"bad ip":        {Path: "/nda/a", IP: "localhost", TTL: time.Hour},
+	} {
+		if _, err := s.Sign(opts, now); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := (&urlSigner{}).Sign(SignOptions{Path: "/a", TTL: time.Hour}, now); err == nil {
+		t.Error("signing without keys should fail")
+	}
+}
+
+func TestProtected(t *testing.T) {
+	s := testSigner()
+	for p, want := range map[string]bool{
+		"/clients/acme/car.glb":      true,
+		"clients/acme":               true,
+		"/nda/x/y/z.png":             true,
+		"/nda":                       true,
+		"/clients":                   false,
+		"/public/car.glb":            false,
+		"/public/../nda/a.png":       true,
+		`\nda\a.png`:                 true,
+		"/ndaa/a.png":                false,
+		"/public/clients/acme/x.glb": false,
+	} {
+		if got := s.protected(p); got != want {
+			t.Errorf("protected(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestLoadSignKeysMalformed(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+	for name, content := range map[string]string{
+		"empty":         "# only a comment\n",
+		"missing field": "k1\n",
+		"bad kid":       "k/1 " + secret + "\n",
+		"duplicate kid": "k1 " + secret + "\nk1 " + secret + "\n",
+		"not base64":    "k1 !!!\n",
+		"short secret":  "k1 " + short + "\n",
+	} {
+		file := filepath.Join(t.TempDir(), "keys")
+		os.WriteFile(file, []byte(content), 0600)
+		if _, err := loadSignKeys(file); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAssetActionSigned(t *testing.T) {
+	root := setTestDataRoot(t)
+	writeDataFiles(t, root, map[string]string{
+		"clients/acme/car.obj": "mtllib car.mtl\nv 0 0 0\n",
+		"clients/acme/car.mtl": "newmtl paint\nmap_Kd ../../tex/shared.png\n",
+		"public/box.mtl":       "newmtl box\nmap_Kd ../tex/shared.png\n",
+		"tex/shared.png":       "png",
+	})
+	old := signer
+	signer = testSigner()
+	t.Cleanup(func() { signer = old })
+	q, err := signer.Sign(SignOptions{Path: "/clients/acme/car.obj", Scope: "/clients/acme", TTL: time.Hour}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		refs   int
+	}{
+		{"public dependents hide protected files", "/api/assets/tex/shared.png/dependents", http.StatusOK, 1},
+		{"signed dependents", "/api/assets/tex/shared.png/dependents?" + q.Encode(), http.StatusOK, 2},
+		{"unsigned protected dependencies", "/api/assets/clients/acme/car.obj/dependencies", http.StatusForbidden, 0},
+		{"signed protected dependencies", "/api/assets/clients/acme/car.obj/dependencies?recursive=true&" + q.Encode(), http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTest(http.MethodGet, "/api/assets/*path", tt.target, "", assetAction)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Dependencies []AssetRef
+				Dependents   []AssetRef
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if n := len(resp.Dependencies) + len(resp.Dependents); n != tt.refs {
+				t.Fatalf("%d refs, want %d: %s", n, tt.refs, w.Body)
+			}
+		})
+	}
+}
+
+func TestSignedURLMiddlewareSymlink(t *testing.T) {
+	root := setTestDataRoot(t)
+	writeDataFiles(t, root, map[string]string{
+		"clients/acme/car.obj": "v 0 0 0\n",
+		"public/box.obj":       "v 0 0 0\n",
+	})
+	if err := os.Symlink("../clients/acme", filepath.Join(root, "public/alias")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	old := signer
+	signer = testSigner()
+	t.Cleanup(func() { signer = old })
+	q, err := signer.Sign(SignOptions{Path: "/clients/acme/car.obj", TTL: time.Hour}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/data/public/box.obj", http.StatusNoContent},
+		{"/data/clients/acme/car.obj", http.StatusForbidden},
+		{"/data/public/alias/car.obj", http.StatusForbidden},
+		{"/data/public/alias/car.obj?" + q.Encode(), http.StatusNoContent},
+		{"/data/clients/acme/car.obj?" + q.Encode(), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		w := serveTest(http.MethodGet, "/data/*filepath", tt.target, "", signedURLMiddleware(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.target, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// sourceMap 是 Source Map v3 文件，Mappings 解码后按生成代码的行保存
+type sourceMap struct {
+	Version    int               `json:"version"`
+	File       string            `json:"file"`
+	SourceRoot string            `json:"sourceRoot"`
+	Sources    []string          `json:"sources"`
+	Names      []string          `json:"names"`
+	Mappings   string            `json:"mappings"`
+	Sections   []json.RawMessage `json:"sections"`
+	lines      [][]mapSegment
+}
+
+// mapSegment 是 mappings 中的一段，位置都从 0 开始；Source 为 -1 表示没有对应的原始位置
+type mapSegment struct {
+	GenCol   int
+	Source   int
+	OrigLine int
+	OrigCol  int
+	Name     int
+}
+
+// OriginalPosition 是生成代码中某个位置对应的原始位置，Line 和 Column 从 1 开始
+type OriginalPosition struct {
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Name   string `json:"name,omitempty"`
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+var base64Values = func() (t [128]int8) {
+	for i := range t {
+		t[i] = -1
+	}
+	for i, c := range base64Digits {
+		t[c] = int8(i)
+	}
+	return
+}()
+
+// parseSourceMap 解析并解码 Source Map；不支持分段的索引映射
+func parseSourceMap(data []byte) (*sourceMap, error) {
+	m := new(sourceMap)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Version != 3 {
+		return nil, fmt.Errorf("unsupported source map version %d", m.Version)
+	}
+	if len(m.Sections) > 0 {
+		return nil, errors.New("indexed source maps are not supported")
+	}
+	lines, err := decodeMappings(m.Mappings, len(m.Sources), len(m.Names))
+	if err != nil {
+		return nil, fmt.Errorf("mappings: %w", err)
+	}
+	m.lines = lines
+	return m, nil
+}
+
+// decodeVLQ 从 s[i:] 读出一个 Base64 VLQ 数，返回值和下一个位置
+func decodeVLQ(s string, i int) (int, int, error) {
+	value, shift := 0, 0
+	for {
+		if i >= len(s) {
+			return 0, i, errors.New("unterminated VLQ value")
+		}
+		c := s[i]
+		if c >= 128 || base64Values[c] < 0 {
+			return 0, i, fmt.Errorf("invalid base64 character %q at %d", c, i)
+		}
+		d := int(base64Values[c])
+		i++
+		value |= (d & 31) << shift
+		if d&32 == 0 {
+			break
+		}
+		shift += 5
+		if shift > 30 {
+			return 0, i, errors.New("VLQ value overflows")
+		}
+	}
+	// 最低位是符号位
+	if value&1 != 0 {
+		return -(value >> 1), i, nil
+	}
+	return value >> 1, i, nil
+}
+
+// decodeMappings 解码 mappings 字符串。除生成列在每行重置外，其余字段都相对于上一段
+func decodeMappings(s string, sources, names int) ([][]mapSegment, error) {
+	lines := [][]mapSegment{nil}
+	var source, origLine, origCol, name int
+	line, genCol := 0, 0
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case ';':
+			lines = append(lines, nil)
+			line++
+			genCol = 0
+			i++
+			continue
+		case ',':
+			i++
+			continue
+		}
+		var fields [5]int
+		n := 0
+		for i < len(s) && s[i] != ',' && s[i] != ';' {
+			if n == 5 {
+				return nil, fmt.Errorf("line %d: segment has more than 5 fields", line+1)
+			}
+			v, next, err := decodeVLQ(s, i)
+			if err != nil {
+				return nil, err
+			}
+			fields[n], i = v, next
+			n++
+		}
+		if n != 1 && n != 4 && n != 5 {
+			return nil, fmt.Errorf("line %d: segment has %d fields", line+1, n)
+		}
+		genCol += fields[0]
+		seg := mapSegment{GenCol: genCol, Source: -1, Name: -1}
+		if n >= 4 {
+			source += fields[1]
+			origLine += fields[2]
+			origCol += fields[3]
+			if source < 0 || source >= sources {
+				return nil, fmt.Errorf("line %d: source index %d out of range", line+1, source)
+			}
+			seg.Source, seg.OrigLine, seg.OrigCol = source, origLine, origCol
+		}
+		if n == 5 {
+			name += fields[4]
+			if name < 0 || name >= names {
+				return nil, fmt.Errorf("line %d: name index %d out of range", line+1, name)
+			}
+			seg.Name = name
+		}
+		lines[line] = append(lines[line], seg)
+	}
+	// 规范要求每行按生成列排序，个别工具不遵守
+	for _, segs := range lines {
+		sort.SliceStable(segs, func(a, b int) bool { return segs[a].GenCol < segs[b].GenCol })
+	}
+	return lines, nil
+}
+
+// lookup 查找生成代码第 line 行第 col 列（都从 1 开始，与浏览器堆栈一致）对应的原始位置
+func (m *sourceMap) lookup(line, col int) (*OriginalPosition, bool) {
+	if line < 1 || line > len(m.lines) {
+		return nil, false
+	}
+	segs := m.lines[line-1]
+	// 取生成列不超过 col 的最后一段
+	i := sort.Search(len(segs), func(i int) bool { return segs[i].GenCol > col-1 }) - 1
+	if i < 0 || segs[i].Source < 0 {
+		return nil, false
+	}
+	seg := segs[i]
+	pos := &OriginalPosition{Source: m.sourceName(seg.Source), Line: seg.OrigLine + 1, Column: seg.OrigCol + 1}
+	if seg.Name >= 0 {
+		pos.Name = m.Names[seg.Name]
+	}
+	return pos, true
+}
+
+// sourceName 拼上 sourceRoot，并去掉 webpack:// 之类的前缀
+func (m *sourceMap) sourceName(i int) string {
+	s := m.Sources[i]
+	if m.SourceRoot != "" && !strings.Contains(s, "://") {
+		s = strings.TrimSuffix(m.SourceRoot, "/") + "/" + s
+	}
+	if j := strings.Index(s, "://"); j >= 0 {
+		s = strings.TrimPrefix(s[j+3:], "/")
+	}
+	return path.Clean(s)
+}
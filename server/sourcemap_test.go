@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestDecodeVLQ(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"A", 0}, {"C", 1}, {"D", -1}, {"gB", 16}, {"hB", -16}, {"2H", 123},
+	}
+	for _, tt := range tests {
+		got, next, err := decodeVLQ(tt.in, 0)
+		if err != nil || got != tt.want || next != len(tt.in) {
+			t.Errorf("decodeVLQ(%q) = %d, %d, %v; want %d", tt.in, got, next, err, tt.want)
+		}
+	}
+}
+
+func TestParseSourceMap(t *testing.T) {
+	m, err := parseSourceMap([]byte(`{"version":3,"sources":["a.ts"],"names":["f"],"mappings":"AAAA,IAAIA;;EACE"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, ok := m.lookup(1, 6)
+	if !ok || pos.Source != "a.ts" || pos.Line != 1 || pos.Column != 5 || pos.Name != "f" {
+		t.Fatalf("lookup(1, 6) = %+v, %v", pos, ok)
+	}
+	if pos, ok := m.lookup(3, 3); !ok || pos.Line != 2 || pos.Column != 7 {
+		t.Fatalf("lookup(3, 3) = %+v, %v", pos, ok)
+	}
+	if _, ok := m.lookup(9, 1); ok {
+		t.Fatal("lookup past the last line should fail")
+	}
+}
+
+func TestParseSourceMapMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not json", `{"version":3,`},
+		{"version 2", `{"version":2,"sources":[],"mappings":""}`},
+		{"indexed map", `{"version":3,"sections":[{}]}`},
+		{"invalid character", `{"version":3,"sources":["a"],"mappings":"A!AA"}`},
+		{"non-ascii character", `{"version":3,"sources":["a"],"mappings":"AAAé"}`},
+		{"unterminated value", `{"version":3,"sources":["a"],"mappings":"AAAg"}`},
+		{"overflowing value", `{"version":3,"sources":["a"],"mappings":"gggggggggggggA"}`},
+		{"two fields", `{"version":3,"sources":["a"],"mappings":"AA"}`},
+		{"six fields", `{"version":3,"sources":["a"],"names":["n"],"mappings":"AAAAAA"}`},
+		{"source out of range", `{"version":3,"sources":["a"],"mappings":"ACAA"}`},
+		{"negative source", `{"version":3,"sources":["a"],"mappings":"ADAA"}`},
+		{"name out of range", `{"version":3,"sources":["a"],"names":[],"mappings":"AAAAA"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSourceMap([]byte(tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
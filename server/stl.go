@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// stlKey 用于焊接 STL 顶点：位置相同且所在面法线相同的顶点合并，保留棱角
+type stlKey struct {
+	x, y, z    float32
+	nx, ny, nz float32
+}
+
+// parseSTL 读取 ASCII 或二进制 STL，生成带平面法线的索引网格
+func parseSTL(file string) (*meshData, []string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tris [][4][3]float32 // 法线 + 三个顶点
+	if isBinarySTL(data) {
+		tris, err = readBinarySTL(data)
+	} else {
+		tris, err = readASCIISTL(data)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := &meshData{Groups: []meshGroup{{Material: -1}}, GeneratedNormals: true}
+	var warnings []string
+	verts := map[stlKey]uint32{}
+	degenerate, fixed := 0, 0
+	for _, t := range tris {
+		n := t[0]
+		// 文件中的法线经常为 0 或与绕序不一致，统一按顶点重新计算
+		p := []float32{t[1][0], t[1][1], t[1][2], t[2][0], t[2][1], t[2][2], t[3][0], t[3][1], t[3][2]}
+		fn := faceNormal(p, 0, 1, 2)
+		if fn == [3]float64{} {
+			degenerate++
+			continue
+		}
+		c := normalize3(fn)
+		if n != [3]float32{} && float64(n[0])*c[0]+float64(n[1])*c[1]+float64(n[2])*c[2] < 0.5 {
+			fixed++
+		}
+		n = [3]float32{float32(c[0]), float32(c[1]), float32(c[2])}
+		for _, v := range t[1:] {
+			k := stlKey{v[0], v[1], v[2], n[0], n[1], n[2]}
+			i, ok := verts[k]
+			if !ok {
+				i = uint32(m.vertexCount())
+				verts[k] = i
+				m.Positions = append(m.Positions, v[0], v[1], v[2])
+				m.Normals = append(m.Normals, n[0], n[1], n[2])
+			}
+			m.Groups[0].Indices = append(m.Groups[0].Indices, i)
+		}
+	}
+	if degenerate > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d degenerate facets dropped", degenerate))
+	}
+	if fixed > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d facet normals disagreed with winding order and were recomputed", fixed))
+	}
+	if len(m.Groups[0].Indices) == 0 {
+		return nil, warnings, errors.New("stl: no facets")
+	}
+	return m, warnings, nil
+}
+
+// isBinarySTL 以文件长度是否等于 84+50*n 为准判断二进制格式
+// （不少二进制 STL 的文件头也以 "solid" 开头）
+func isBinarySTL(data []byte) bool {
+	if len(data) < 84 {
+		return false
+	}
+	n := binary.LittleEndian.Uint32(data[80:84])
+	if uint64(len(data)) == 84+50*uint64(n) {
+		return true
+	}
+	return !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid"))
+}
+
+func readBinarySTL(data []byte) ([][4][3]float32, error) {
+	n := int(binary.LittleEndian.Uint32(data[80:84]))
+	if 84+50*n > len(data) {
+		return nil, fmt.Errorf("stl: header declares %d facets but file holds %d", n, (len(data)-84)/50)
+	}
+	tris := make([][4][3]float32, n)
+	for i := range tris {
+		rec := data[84+50*i:]
+		for j := 0; j < 12; j++ {
+			tris[i][j/3][j%3] = math.Float32frombits(binary.LittleEndian.Uint32(rec[4*j:]))
+		}
+	}
+	return tris, nil
+}
+
+func readASCIISTL(data []byte) ([][4][3]float32, error) {
+	var tris [][4][3]float32
+	var cur [4][3]float32
+	nv := 0
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 {
+			continue
+		}
+		switch strings.ToLower(f[0]) {
+		case "facet":
+			nv = 0
+			cur = [4][3]float32{}
+			if len(f) >= 5 {
+				v, err := stlVec(f[2:5])
+				if err != nil {
+					return nil, fmt.Errorf("stl line %d: %w", lineNo, err)
+				}
+				cur[0] = v
+			}
+		case "vertex":
+			if len(f) < 4 || nv >= 3 {
+				return nil, fmt.Errorf("stl line %d: malformed vertex", lineNo)
+			}
+			v, err := stlVec(f[1:4])
+			if err != nil {
+				return nil, fmt.Errorf("stl line %d: %w", lineNo, err)
+			}
+			nv++
+			cur[nv] = v
+		case "endfacet":
+			if nv != 3 {
+				return nil, fmt.Errorf("stl line %d: facet has %d vertices", lineNo, nv)
+			}
+			tris = append(tris, cur)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return tris, nil
+}
+
+func stlVec(s []string) ([3]float32, error) {
+	var v [3]float32
+	for i := range v {
+		f, err := strconv.ParseFloat(s[i], 32)
+		if err != nil {
+			return v, err
+		}
+		v[i] = float32(f)
+	}
+	return v, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// binarySTL 生成 n 个三角形的二进制 STL，count 为文件头声明的数量
+func binarySTL(n int, count uint32) []byte {
+	data := make([]byte, 84+50*n)
+	binary.LittleEndian.PutUint32(data[80:], count)
+	for i := 0; i < n; i++ {
+		rec := data[84+50*i:]
+		for j, v := range []float32{0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0} {
+			binary.LittleEndian.PutUint32(rec[4*j:], math.Float32bits(v))
+		}
+	}
+	return data
+}
+
+func TestParseSTL(t *testing.T) {
+	ascii := "solid t\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nvertex 0 1 0\nendloop\nendfacet\nendsolid t\n"
+	for name, data := range map[string][]byte{"ascii": []byte(ascii), "binary": binarySTL(2, 2)} {
+		m, _, err := parseSTL(writeTestFile(t, "t.stl", data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if m.vertexCount() != 3 {
+			t.Errorf("%s: got %d vertices, want 3", name, m.vertexCount())
+		}
+	}
+}
+
+func TestParseSTLMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"count beyond data", binarySTL(1, 1000)},
+		{"count overflows", binarySTL(1, math.MaxUint32)},
+		{"four vertices", []byte("solid t\nfacet normal 0 0 1\nvertex 0 0 0\nvertex 1 0 0\nvertex 0 1 0\nvertex 1 1 0\nendfacet\n")},
+		{"two vertices", []byte("solid t\nfacet normal 0 0 1\nvertex 0 0 0\nvertex 1 0 0\nendfacet\n")},
+		{"bad number", []byte("solid t\nfacet normal 0 0 1\nvertex 0 zero 0\n")},
+		{"short vertex", []byte("solid t\nfacet normal 0 0 1\nvertex 0 0\n")},
+		{"no facets", []byte("solid t\nendsolid t\n")},
+		{"header only", binarySTL(1, 1)[:84]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parseSTL(writeTestFile(t, "t.stl", tt.data)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// dataRoot 是静态资源的根目录（绝对路径），由 -data 参数指定
+var dataRoot string
+
+var errOutsideRoot = errors.New("path escapes data root")
+
+// setDataRoot 设置数据根目录
+func setDataRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	dataRoot = abs
+	return nil
+}
+
+// stateRoot 保存服务自身的数据（前端错误、source map、Web Vitals、渲染统计），由 -state 参数指定；
+// 它不在数据根目录下，不会通过 /data 暴露
+var stateRoot string
+
+// legacyStateDirs 是旧版本放在数据根目录下、现在移到 stateRoot 的目录
+var legacyStateDirs = []string{"errors", "sourcemaps", "vitals", "telemetry"}
+
+// setStateRoot 设置状态目录，须在 setDataRoot 之后调用；状态目录不能位于数据根目录内
+func setStateRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if pathWithin(dataRoot, abs) {
+		return fmt.Errorf("state directory %s must not be inside the data directory %s", abs, dataRoot)
+	}
+	stateRoot = abs
+	return nil
+}
+
+// statePath 返回状态目录下的路径，例如 statePath("errors", fp+".json")
+func statePath(elem ...string) string {
+	return filepath.Join(append([]string{stateRoot}, elem...)...)
+}
+
+// legacyStateInData 返回数据根目录下仍存在的旧状态目录，它们可以通过 /data 读取，需要手动移走
+func legacyStateInData() []string {
+	var found []string
+	for _, dir := range legacyStateDirs {
+		if st, err := os.Stat(filepath.Join(dataRoot, dir)); err == nil && st.IsDir() {
+			found = append(found, dir)
+		}
+	}
+	return found
+}
+
+// resolveDataPath 把请求里的 URL 路径映射为数据根目录下的本地路径；projects/ 下的文件只能通过 /p/<project>/ 访问，
+// 经符号链接指进 projects/ 的也不行
+func resolveDataPath(rel string) (string, error) {
+	full := dataPath(rel)
+	if inProjects(rel) || inProjects(realDataRel(full)) {
+		return "", errProjectPath
+	}
+	return full, nil
+}
+
+// dataPath 是不限制 projects/ 的 resolveDataPath，供命令行使用
+func dataPath(rel string) string {
+	clean := path.Clean("/" + strings.ReplaceAll(rel, "\\", "/"))
+	return filepath.Join(dataRoot, filepath.FromSlash(clean))
+}
+
+// resolveRelative 把相对 URI 按 dir 解析为本地路径，结果必须仍在数据根目录内，且不能跨出或跨入项目目录
+func resolveRelative(dir, rel string) (string, error) {
+	full := filepath.Join(dir, filepath.FromSlash(rel))
+	if !withinRoot(full) || projectOf(full) != projectOf(dir) {
+		return "", errOutsideRoot
+	}
+	return full, nil
+}
+
+// inProjects 判断数据根目录下的相对路径是否落在 projects/ 中
+func inProjects(rel string) bool {
+	clean := path.Clean("/" + strings.ReplaceAll(rel, "\\", "/"))
+	return clean == "/projects" || strings.HasPrefix(clean, "/projects/")
+}
+
+// realPath 解开本地路径中已存在部分的符号链接，不存在的部分原样拼在后面
+func realPath(full string) string {
+	existing, rest := full, ""
+	for {
+		if real, err := filepath.EvalSymlinks(existing); err == nil {
+			return filepath.Join(real, rest)
+		} else if !os.IsNotExist(err) {
+			return full
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return full
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// realDataRel 返回本地路径解开符号链接后相对数据根目录的斜杠形式，指到根目录之外时以 ../ 开头
+func realDataRel(full string) string {
+	root, err := filepath.EvalSymlinks(dataRoot)
+	if err != nil {
+		root = dataRoot
+	}
+	r, err := filepath.Rel(root, realPath(full))
+	if err != nil {
+		return ".."
+	}
+	return filepath.ToSlash(r)
+}
+
+// projectOf 返回本地路径（解开符号链接后）所在的项目目录名，不在 projects/ 下时为空
+func projectOf(full string) string {
+	rel := realDataRel(full)
+	if !inProjects(rel) {
+		return ""
+	}
+	return strings.SplitN(strings.TrimPrefix(rel, "projects/")+"/", "/", 2)[0]
+}
+
+// withinRoot 判断本地路径是否位于数据根目录内
+func withinRoot(full string) bool {
+	r, err := filepath.Rel(dataRoot, full)
+	if err != nil {
+		return false
+	}
+	return r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator))
+}
+
+// dataRelPath 返回本地路径相对于数据根目录的斜杠形式
+func dataRelPath(full string) string {
+	r, err := filepath.Rel(dataRoot, full)
+	if err != nil {
+		return full
+	}
+	return filepath.ToSlash(r)
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	renderMaxBytes         = 16 << 10
+	renderMaxSeries        = 2000
+	renderMaxValues        = 1000 // 每个序列保留的最近 renderer.info 样本数
+	renderMaxFrames        = 1000000
+	renderMinFrames        = 1000 // 比较两个版本时每边至少需要的帧数
+	renderSlowFrame        = 50.0 // 超过这个帧时间（毫秒）算卡顿
+	renderDefaultThreshold = 10.0 // 变差超过这个百分比算性能回退
+)
+
+// renderFrameBuckets 是帧时间直方图各桶的上界（毫秒），最后还有一个溢出桶；前端 src/renderTelemetry.ts 用同样的分桶
+var renderFrameBuckets = []float64{8, 12, 16.7, 20, 25, 33.3, 50, 66.7, 100, 200, 500}
+
+// RenderSample 是 three.js 渲染循环定期上报的一份统计
+type RenderSample struct {
+	Scene      string `json:"scene"`
+	Build      string `json:"build"`
+	GPU        string `json:"gpu"` // WEBGL_debug_renderer_info 的 UNMASKED_RENDERER_WEBGL
+	FrameTimes struct {
+		Counts []int64 `json:"counts"`
+		Sum    float64 `json:"sum"` // 毫秒
+	} `json:"frameTimes"`
+	Info struct {
+		Calls      float64 `json:"calls"`
+		Triangles  float64 `json:"triangles"`
+		Textures   float64 `json:"textures"`
+		Geometries float64 `json:"geometries"`
+	} `json:"info"`
+}
+
+// Percentiles 是一组数据的百分位数
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99,omitempty"`
+}
+
+// RenderSummary 是一个场景在某类 GPU、某个构建版本下的渲染统计
+type RenderSummary struct {
+	Scene      string      `json:"scene"`
+	GPU        string      `json:"gpu"`
+	Build      string      `json:"build"`
+	Renderer   string      `json:"renderer"` // 最近一次上报的完整 GPU 字符串
+	Samples    int         `json:"samples"`
+	Frames     int64       `json:"frames"`
+	FPS        float64     `json:"fps"`
+	FrameTime  Percentiles `json:"frameTime"`
+	SlowFrames float64     `json:"slowFrames"` // 卡顿帧占比
+	Calls      Percentiles `json:"calls"`
+	Triangles  Percentiles `json:"triangles"`
+	Textures   Percentiles `json:"textures"`
+	Geometries Percentiles `json:"geometries"`
+	FirstSeen  time.Time   `json:"firstSeen"`
+	LastSeen   time.Time   `json:"lastSeen"`
+}
+
+// RenderRegression 是一项变差超过阈值的指标，Change 为百分比
+type RenderRegression struct {
+	Metric string  `json:"metric"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+	Change float64 `json:"change"`
+}
+
+// RenderComparison 是同一场景、同一类 GPU 下两个构建版本的比较
+type RenderComparison struct {
+	Scene        string             `json:"scene"`
+	GPU          string             `json:"gpu"`
+	Baseline     string             `json:"baseline"`
+	Build        string             `json:"build"`
+	Insufficient bool               `json:"insufficient,omitempty"` // 帧数不够，不做判断
+	Regressions  []RenderRegression `json:"regressions"`
+}
+
+type renderSeries struct {
+	Scene      string    `json:"scene"`
+	GPU        string    `json:"gpu"`
+	Build      string    `json:"build"`
+	Renderer   string    `json:"renderer"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Samples    int       `json:"samples"`
+	Frames     int64     `json:"frames"`
+	FrameSum   float64   `json:"frameSum"`
+	Histogram  []int64   `json:"histogram"`
+	Calls      []float64 `json:"calls"`
+	Triangles  []float64 `json:"triangles"`
+	Textures   []float64 `json:"textures"`
+	Geometries []float64 `json:"geometries"`
+}
+
+// renderStore 在内存中按 场景/GPU 类别/构建版本 累计统计，定期写入状态目录的 telemetry/render.json
+type renderStore struct {
+	mu     sync.Mutex
+	series map[string]*renderSeries
+	dirty  bool
+}
+
+var renderStats = &renderStore{series: map[string]*renderSeries{}}
+
+func renderStatsFile() string {
+	return statePath("telemetry", "render.json")
+}
+
+// startRenderStats 读取上次保存的统计并开始定期保存，在 setStateRoot 之后调用
+func startRenderStats() {
+	if err := renderStats.load(); err != nil && !os.IsNotExist(err) {
+		logError("读取渲染统计失败", "error", err)
+	}
+	workerBeat("render_stats", vitalsFlushPeriod)
+	go func() {
+		for range time.Tick(vitalsFlushPeriod) {
+			workerBeat("render_stats", vitalsFlushPeriod)
+			if err := renderStats.flush(); err != nil {
+				logError("保存渲染统计失败", "error", err)
+			}
+		}
+	}()
+}
+
+func (s *renderStore) load() error {
+	data, err := os.ReadFile(renderStatsFile())
+	if err != nil {
+		return err
+	}
+	var list []*renderSeries
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rs := range list {
+		if len(rs.Histogram) == len(renderFrameBuckets)+1 {
+			s.series[vitalsKey(rs.Scene, rs.GPU, rs.Build)] = rs
+		}
+	}
+	return nil
+}
+
+func (s *renderStore) flush() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	list := make([]*renderSeries, 0, len(s.series))
+	for _, rs := range s.series {
+		list = append(list, rs)
+	}
+	js, err := json.Marshal(list)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(renderStatsFile(), js, 0644)
+}
+
+// appendRecent 追加一个值，只保留最近 renderMaxValues 个
+func appendRecent(values []float64, v float64) []float64 {
+	values = append(values, v)
+	if len(values) > renderMaxValues*5/4 {
+		values = append([]float64(nil), values[len(values)-renderMaxValues:]...)
+	}
+	return values
+}
+
+func (s *renderStore) add(r *RenderSample, gpu string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := vitalsKey(r.Scene, gpu, r.Build)
+	rs := s.series[key]
+	if rs == nil {
+		if len(s.series) >= renderMaxSeries {
+			return false
+		}
+		rs = &renderSeries{Scene: r.Scene, GPU: gpu, Build: r.Build, FirstSeen: now, Histogram: make([]int64, len(renderFrameBuckets)+1)}
+		s.series[key] = rs
+	}
+	rs.Renderer, rs.LastSeen = r.GPU, now
+	rs.Samples++
+	for i, n := range r.FrameTimes.Counts {
+		rs.Histogram[i] += n
+		rs.Frames += n
+	}
+	rs.FrameSum += r.FrameTimes.Sum
+	rs.Calls = appendRecent(rs.Calls, r.Info.Calls)
+	rs.Triangles = appendRecent(rs.Triangles, r.Info.Triangles)
+	rs.Textures = appendRecent(rs.Textures, r.Info.Textures)
+	rs.Geometries = appendRecent(rs.Geometries, r.Info.Geometries)
+	s.dirty = true
+	return true
+}
+
+// histogramPercentile 在直方图中找到第 p 百分位所在的桶，在桶内线性插值；落在溢出桶时返回最后一个上界
+func histogramPercentile(counts []int64, total int64, p float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	target := p / 100 * float64(total)
+	var cum float64
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if cum+float64(n) >= target {
+			if i == len(renderFrameBuckets) {
+				return renderFrameBuckets[i-1]
+			}
+			lo := 0.0
+			if i > 0 {
+				lo = renderFrameBuckets[i-1]
+			}
+			return lo + (renderFrameBuckets[i]-lo)*(target-cum)/float64(n)
+		}
+		cum += float64(n)
+	}
+	return renderFrameBuckets[len(renderFrameBuckets)-1]
+}
+
+func valuePercentiles(values []float64) Percentiles {
+	if len(values) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return Percentiles{P50: percentile(sorted, 50), P95: percentile(sorted, 95)}
+}
+
+func (rs *renderSeries) summary() RenderSummary {
+	r := RenderSummary{
+		Scene: rs.Scene, GPU: rs.GPU, Build: rs.Build, Renderer: rs.Renderer,
+		Samples: rs.Samples, Frames: rs.Frames, FirstSeen: rs.FirstSeen, LastSeen: rs.LastSeen,
+		FrameTime: Percentiles{
+			P50: histogramPercentile(rs.Histogram, rs.Frames, 50),
+			P95: histogramPercentile(rs.Histogram, rs.Frames, 95),
+			P99: histogramPercentile(rs.Histogram, rs.Frames, 99),
+		},
+		Calls: valuePercentiles(rs.Calls), Triangles: valuePercentiles(rs.Triangles),
+		Textures: valuePercentiles(rs.Textures), Geometries: valuePercentiles(rs.Geometries),
+	}
+	if rs.FrameSum > 0 {
+		r.FPS = 1000 * float64(rs.Frames) / rs.FrameSum
+	}
+	if rs.Frames > 0 {
+		var slow int64
+		for i, n := range rs.Histogram {
+			if i == len(renderFrameBuckets) || renderFrameBuckets[i] > renderSlowFrame {
+				slow += n
+			}
+		}
+		r.SlowFrames = float64(slow) / float64(rs.Frames)
+	}
+	return r
+}
+
+// summaries 返回符合过滤条件的统计，空字符串的条件不生效
+func (s *renderStore) summaries(scene, gpu, build string) []RenderSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []RenderSummary{}
+	for _, rs := range s.series {
+		if scene != "" && rs.Scene != scene || gpu != "" && rs.GPU != gpu || build != "" && rs.Build != build {
+			continue
+		}
+		out = append(out, rs.summary())
+	}
+	sort.Slice(out, func(a, b int) bool {
+		x, y := out[a], out[b]
+		if x.Scene != y.Scene {
+			return x.Scene < y.Scene
+		}
+		if x.GPU != y.GPU {
+			return x.GPU < y.GPU
+		}
+		return x.FirstSeen.Before(y.FirstSeen)
+	})
+	return out
+}
+
+// gpuClass 把 GPU 字符串归类，ANGLE (...) 包装和驱动版本不影响结果
+func gpuClass(renderer string) string {
+	r := strings.ToLower(renderer)
+	has := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(r, w) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case r == "":
+		return "unknown"
+	case has("swiftshader", "llvmpipe", "softpipe", "software", "microsoft basic render"):
+		return "software"
+	case has("apple"):
+		return "apple"
+	case has("nvidia", "geforce", "quadro", "tesla"):
+		return "nvidia"
+	case has("amd", "radeon", "ati "):
+		return "amd"
+	case has("intel"):
+		return "intel"
+	case has("adreno"):
+		return "adreno"
+	case has("mali"):
+		return "mali"
+	case has("powervr"):
+		return "powervr"
+	}
+	return "other"
+}
+
+// compareRender 比较两个版本，帧时间、绘制调用等变大或 fps 变小超过 threshold% 时记为回退
+func compareRender(base, cur RenderSummary, threshold float64) RenderComparison {
+	c := RenderComparison{Scene: cur.Scene, GPU: cur.GPU, Baseline: base.Build, Build: cur.Build, Regressions: []RenderRegression{}}
+	if base.Frames < renderMinFrames || cur.Frames < renderMinFrames {
+		c.Insufficient = true
+		return c
+	}
+	check := func(metric string, before, after float64, higherIsWorse bool) {
+		if before <= 0 {
+			return
+		}
+		change := (after - before) / before * 100
+		if !higherIsWorse {
+			change = -change
+		}
+		if change > threshold {
+			c.Regressions = append(c.Regressions, RenderRegression{Metric: metric, Before: before, After: after, Change: change})
+		}
+	}
+	check("frameTime.p50", base.FrameTime.P50, cur.FrameTime.P50, true)
+	check("frameTime.p95", base.FrameTime.P95, cur.FrameTime.P95, true)
+	check("fps", base.FPS, cur.FPS, false)
+	check("calls.p50", base.Calls.P50, cur.Calls.P50, true)
+	check("triangles.p50", base.Triangles.P50, cur.Triangles.P50, true)
+	return c
+}
+
+// postRenderStatsHandler 处理 POST /api/telemetry/render
+func postRenderStatsHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, renderMaxBytes)
+	var r RenderSample
+	if err := json.NewDecoder(c.Request.Body).Decode(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if r.Build == "" {
+		r.Build = "unknown"
+	}
+	issues := []Issue{}
+	if !projectNamePattern.MatchString(r.Scene) {
+		issues = append(issues, Issue{Code: "VALUE_NOT_IN_LIST", Pointer: "/scene", Message: "invalid scene"})
+	}
+	if !vitalsBuildPattern.MatchString(r.Build) {
+		issues = append(issues, Issue{Code: "VALUE_NOT_IN_LIST", Pointer: "/build", Message: "invalid build"})
+	}
+	if len(r.GPU) > 256 {
+		issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: "/gpu", Message: "gpu must be at most 256 characters"})
+	}
+	var total int64
+	if len(r.FrameTimes.Counts) != len(renderFrameBuckets)+1 {
+		issues = append(issues, Issue{Code: "ARRAY_LENGTH", Pointer: "/frameTimes/counts",
+			Message: fmt.Sprintf("expected %d buckets with upper bounds %v ms plus overflow", len(renderFrameBuckets)+1, renderFrameBuckets)})
+	}
+	for i, n := range r.FrameTimes.Counts {
+		if n < 0 {
+			issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: fmt.Sprintf("/frameTimes/counts/%d", i), Message: "count must not be negative"})
+		}
+		total += n
+	}
+	if total <= 0 || total > renderMaxFrames {
+		issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: "/frameTimes/counts", Message: fmt.Sprintf("a sample needs 1 to %d frames", renderMaxFrames)})
+	}
+	if r.FrameTimes.Sum < 0 {
+		issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: "/frameTimes/sum", Message: "sum must not be negative"})
+	}
+	for name, v := range map[string]float64{"calls": r.Info.Calls, "triangles": r.Info.Triangles, "textures": r.Info.Textures, "geometries": r.Info.Geometries} {
+		if v < 0 {
+			issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: "/info/" + name, Message: name + " must not be negative"})
+		}
+	}
+	if len(issues) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid render sample", "errors": issues})
+		return
+	}
+	gpu := gpuClass(r.GPU)
+	if !renderStats.add(&r, gpu, time.Now().UTC()) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "series limit reached"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"gpu": gpu})
+}
+
+// renderSummaryHandler 处理 GET /api/telemetry/render/summary?scene=&gpu=&build=
+func renderSummaryHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"buckets": renderFrameBuckets,
+		"series":  renderStats.summaries(c.Query("scene"), c.Query("gpu"), c.Query("build")),
+	})
+}
+
+func buildIndex(list []RenderSummary, build string) int {
+	for i, s := range list {
+		if s.Build == build {
+			return i
+		}
+	}
+	return -1
+}
+
+// renderRegressionsHandler 处理 GET /api/telemetry/render/regressions?scene=&build=&baseline=&threshold=。
+// 按场景和 GPU 类别分别比较：没给 build 时取最新出现的版本，没给 baseline 时取它之前出现的版本
+func renderRegressionsHandler(c *gin.Context) {
+	threshold := renderDefaultThreshold
+	if t := c.Query("threshold"); t != "" {
+		v, err := strconv.ParseFloat(t, 64)
+		if err != nil || v < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a non-negative percentage"})
+			return
+		}
+		threshold = v
+	}
+	build, baseline := c.Query("build"), c.Query("baseline")
+	// summaries 已按场景、GPU 排序，同一组内按首次出现时间排序
+	groups := map[string][]RenderSummary{}
+	keys := []string{}
+	for _, s := range renderStats.summaries(c.Query("scene"), c.Query("gpu"), "") {
+		k := s.Scene + "\x00" + s.GPU
+		if groups[k] == nil {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], s)
+	}
+	out := []RenderComparison{}
+	for _, k := range keys {
+		list := groups[k]
+		cur := len(list) - 1
+		if build != "" {
+			cur = buildIndex(list, build)
+		}
+		base := cur - 1
+		if baseline != "" {
+			base = buildIndex(list, baseline)
+		}
+		if cur < 0 || base < 0 || base == cur {
+			continue
+		}
+		out = append(out, compareRender(list[base], list[cur], threshold))
+	}
+	flagged := 0
+	for _, cmp := range out {
+		if len(cmp.Regressions) > 0 {
+			flagged++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"threshold": threshold, "flagged": flagged, "comparisons": out})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGPUClass(t *testing.T) {
+	tests := []struct{ renderer, want string }{
+		{"", "unknown"},
+		{"ANGLE (NVIDIA, NVIDIA GeForce RTX 3060 Direct3D11 vs_5_0 ps_5_0, D3D11-31.0.15.3623)", "nvidia"},
+		{"ANGLE (Intel, Intel(R) UHD Graphics 620 Direct3D11 vs_5_0 ps_5_0)", "intel"},
+		{"AMD Radeon Pro 5500M OpenGL Engine", "amd"},
+		{"Apple M1", "apple"},
+		{"Adreno (TM) 640", "adreno"},
+		{"Mali-G78", "mali"},
+		{"Google SwiftShader", "software"},
+		{"llvmpipe (LLVM 15.0.7, 256 bits)", "software"},
+		{"Some New GPU", "other"},
+	}
+	for _, tt := range tests {
+		if got := gpuClass(tt.renderer); got != tt.want {
+			t.Errorf("gpuClass(%q) = %q, want %q", tt.renderer, got, tt.want)
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	counts := func(pairs ...int) []int64 {
+		c := make([]int64, len(renderFrameBuckets)+1)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			c[pairs[i]] = int64(pairs[i+1])
+		}
+		return c
+	}
+	tests := []struct {
+		name   string
+		counts []int64
+		total  int64
+		p      float64
+		want   float64
+	}{
+		{"empty", counts(), 0, 50, 0},
+		{"first bucket middle", counts(0, 100), 100, 50, 4},
+		{"interpolated", counts(1, 100), 100, 50, 10},
+		{"upper edge", counts(0, 50, 2, 50), 100, 100, 16.7},
+		{"overflow bucket", counts(0, 1, len(renderFrameBuckets), 99), 100, 95, 500},
+	}
+	for _, tt := range tests {
+		if got := histogramPercentile(tt.counts, tt.total, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// testRenderSample 是一份所有帧都落在同一个桶的上报
+func testRenderSample(build string, bucket int, frames int64, frameMs, calls float64) *RenderSample {
+	r := &RenderSample{Scene: "s1", Build: build, GPU: "Apple M1"}
+	r.FrameTimes.Counts = make([]int64, len(renderFrameBuckets)+1)
+	r.FrameTimes.Counts[bucket] = frames
+	r.FrameTimes.Sum = float64(frames) * frameMs
+	r.Info.Calls, r.Info.Triangles = calls, 1000
+	return r
+}
+
+func TestRenderSummaryAndCompare(t *testing.T) {
+	s := &renderStore{series: map[string]*renderSeries{}}
+	now := time.Now()
+	s.add(testRenderSample("v1", 2, 2000, 14, 10), "apple", now)
+	s.add(testRenderSample("v2", 6, 1500, 40, 10), "apple", now.Add(time.Hour))
+	s.add(testRenderSample("v2", 7, 500, 60, 20), "apple", now.Add(time.Hour))
+	s.add(testRenderSample("v3", 2, 10, 14, 10), "apple", now.Add(2*time.Hour))
+
+	list := s.summaries("s1", "apple", "")
+	if len(list) != 3 || list[0].Build != "v1" || list[2].Build != "v3" {
+		t.Fatalf("summaries = %+v", list)
+	}
+	v1, v2, v3 := list[0], list[1], list[2]
+	if math.Abs(v1.FPS-1000.0/14) > 1e-9 || v1.SlowFrames != 0 {
+		t.Fatalf("v1 = %+v", v1)
+	}
+	if v2.Samples != 2 || v2.Frames != 2000 || v2.SlowFrames != 0.25 {
+		t.Fatalf("v2 = %+v", v2)
+	}
+
+	tests := []struct {
+		name         string
+		base, cur    RenderSummary
+		threshold    float64
+		insufficient bool
+		metrics      []string
+	}{
+		{"regression", v1, v2, renderDefaultThreshold, false, []string{"frameTime.p50", "frameTime.p95", "fps"}},
+		{"high threshold", v1, v2, 1000, false, nil},
+		{"improvement", v2, v1, renderDefaultThreshold, false, nil},
+		{"too few frames", v1, v3, renderDefaultThreshold, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := compareRender(tt.base, tt.cur, tt.threshold)
+			if c.Insufficient != tt.insufficient || len(c.Regressions) != len(tt.metrics) {
+				t.Fatalf("got %+v", c)
+			}
+			for i, m := range tt.metrics {
+				if c.Regressions[i].Metric != m || c.Regressions[i].Change <= tt.threshold {
+					t.Fatalf("regression %d = %+v, want %s", i, c.Regressions[i], m)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderStoreFlush(t *testing.T) {
+	root := setTestDataRoot(t)
+	state := setTestStateRoot(t)
+	s := &renderStore{series: map[string]*renderSeries{}}
+	s.add(testRenderSample("v1", 2, 100, 14, 10), "apple", time.Now())
+	if err := s.flush(); err != nil {
+		t.Fatal(err)
+	}
+	// 统计保存在状态目录，不会通过 /data 暴露
+	if _, err := os.Stat(filepath.Join(state, "telemetry", "render.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "telemetry")); !os.IsNotExist(err) {
+		t.Fatalf("render stats written to the data directory: %v", err)
+	}
+	loaded := &renderStore{series: map[string]*renderSeries{}}
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.summaries("", "", ""); len(got) != 1 || got[0].Frames != 100 {
+		t.Fatalf("loaded %+v", got)
+	}
+}
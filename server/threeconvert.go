@@ -0,0 +1,970 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// threeConverter 把 ObjectLoader JSON 转换为 glTF；无法表示的内容记录到 issues
+type threeConverter struct {
+	b    *gltfBuilder
+	file string
+	opts textureOptions
+	rep  *ConversionReport
+
+	geometries map[string]threeItem
+	materials  map[string]threeItem
+	textures   map[string]threeItem
+	images     map[string]threeItem
+	worlds     map[string]mat4 // 对象 uuid -> 世界矩阵，用于灯光的 target
+
+	geomCache map[string]*threeGeometry
+	attrCache map[string]map[string]int
+	meshCache map[string]int
+	matCache  map[string]int
+	texCache  map[string]int // -1 表示不可用
+	imgCache  map[string]int
+	samplers  map[[4]int]int
+	lights    []map[string]interface{}
+
+	issues   []Issue
+	reported map[string]bool
+	warnings []string
+	texRep   []meshTextureReport
+}
+
+// threeItem 是场景中的一个资源及其在文档中的位置
+type threeItem struct {
+	Pointer string
+	Data    map[string]interface{}
+}
+
+type threeGeometry struct {
+	attrs  map[string]threeAttr
+	index  []uint32
+	groups []threeGroup
+	count  int
+}
+
+type threeAttr struct {
+	vals []float64
+	size int
+}
+
+type threeGroup struct {
+	start, count, material int
+}
+
+// three.js 的纹理常量到 glTF 采样器的映射
+var (
+	threeWrapModes = map[int]int{1000: 10497, 1001: 33071, 1002: 33648}
+	threeFilters   = map[int]int{1003: 9728, 1004: 9984, 1005: 9986, 1006: 9729, 1007: 9985, 1008: 9987}
+	// 归一化整数属性的最大值
+	threeNormalizedMax = map[string]float64{
+		"Int8Array": 127, "Uint8Array": 255, "Uint8ClampedArray": 255,
+		"Int16Array": 32767, "Uint16Array": 65535, "Int32Array": 2147483647, "Uint32Array": 4294967295,
+	}
+)
+
+// convertThreeScene 把 three.js JSON 场景写入构建器，并填写转换报告
+func convertThreeScene(src string, b *gltfBuilder, opts textureOptions, rep *ConversionReport) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("three.js: invalid JSON: %w", err)
+	}
+	if issues := validateThreeScene(doc); len(issues) > 0 {
+		return fmt.Errorf("invalid three.js scene at %q: %s (%d problems)", issues[0].Pointer, issues[0].Message, len(issues))
+	}
+	root := doc.(map[string]interface{})
+	c := &threeConverter{
+		b: b, file: src, opts: opts, rep: rep,
+		geometries: threeIndex(root, "geometries"),
+		materials:  threeIndex(root, "materials"),
+		textures:   threeIndex(root, "textures"),
+		images:     threeIndex(root, "images"),
+		worlds:     map[string]mat4{},
+		geomCache:  map[string]*threeGeometry{},
+		attrCache:  map[string]map[string]int{},
+		meshCache:  map[string]int{},
+		matCache:   map[string]int{},
+		texCache:   map[string]int{},
+		imgCache:   map[string]int{},
+		samplers:   map[[4]int]int{},
+		reported:   map[string]bool{},
+	}
+	for _, key := range []string{"animations", "skeletons", "shapes"} {
+		if list, _ := root[key].([]interface{}); len(list) > 0 {
+			c.unsupported("/"+key, "UNSUPPORTED_"+strings.ToUpper(key), "%s are not converted (%d)", key, len(list))
+		}
+	}
+
+	obj := root["object"].(map[string]interface{})
+	c.collectWorlds(obj, identity4)
+	scene := GLTFScene{Name: threeString(obj, "name")}
+	if threeString(obj, "type") == "Scene" && threeMatrix(obj) == identity4 {
+		// Scene 本身不产生节点，子对象作为 glTF 场景的根节点
+		for _, key := range []string{"background", "environment", "fog"} {
+			if v, ok := obj[key]; ok && v != nil {
+				c.unsupported("/object/"+key, "UNSUPPORTED_SCENE_PROPERTY", "scene %s is not converted", key)
+			}
+		}
+		scene.Extras = threeExtras(obj)
+		children, _ := obj["children"].([]interface{})
+		for i, ch := range children {
+			scene.Nodes = append(scene.Nodes, c.object("/object/children/"+strconv.Itoa(i), ch.(map[string]interface{}), identity4))
+		}
+	} else {
+		scene.Nodes = []int{c.object("/object", obj, identity4)}
+	}
+	b.doc.Scenes = []GLTFScene{scene}
+	s := 0
+	b.doc.Scene = &s
+	if len(c.lights) > 0 {
+		js, _ := json.Marshal(map[string]interface{}{"lights": c.lights})
+		if b.doc.Extensions == nil {
+			b.doc.Extensions = map[string]json.RawMessage{}
+		}
+		b.doc.Extensions["KHR_lights_punctual"] = js
+		b.useExtension("KHR_lights_punctual", false)
+	}
+	rep.Materials = len(b.doc.Materials)
+	rep.Textures = c.texRep
+	rep.Warnings = c.warnings
+	rep.Unsupported = c.issues
+	return nil
+}
+
+// threeIndex 按 uuid 索引资源数组
+func threeIndex(root map[string]interface{}, key string) map[string]threeItem {
+	items := map[string]threeItem{}
+	list, _ := root[key].([]interface{})
+	for i, it := range list {
+		m := it.(map[string]interface{})
+		items[m["uuid"].(string)] = threeItem{Pointer: "/" + key + "/" + strconv.Itoa(i), Data: m}
+	}
+	return items
+}
+
+// unsupported 记录一项无法转换的内容，同一位置的同一问题只记一次
+func (c *threeConverter) unsupported(pointer, code, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	key := pointer + "|" + code + "|" + msg
+	if c.reported[key] {
+		return
+	}
+	c.reported[key] = true
+	c.issues = append(c.issues, Issue{Code: code, Pointer: pointer, Message: msg})
+}
+
+// collectWorlds 预先计算所有对象的世界矩阵
+func (c *threeConverter) collectWorlds(obj map[string]interface{}, parent mat4) {
+	world := parent.mul(threeMatrix(obj))
+	if id, ok := obj["uuid"].(string); ok {
+		c.worlds[id] = world
+	}
+	children, _ := obj["children"].([]interface{})
+	for _, ch := range children {
+		c.collectWorlds(ch.(map[string]interface{}), world)
+	}
+}
+
+// object 转换一个对象及其子树，返回节点索引
+func (c *threeConverter) object(p string, obj map[string]interface{}, parent mat4) int {
+	idx := len(c.b.doc.Nodes)
+	node := GLTFNode{Name: threeString(obj, "name"), Extras: threeExtras(obj)}
+	local := threeMatrix(obj)
+	if local != identity4 {
+		node.Matrix = append([]float64(nil), local[:]...)
+	}
+	world := parent.mul(local)
+	c.b.doc.Nodes = append(c.b.doc.Nodes, node)
+	if visible, ok := obj["visible"].(bool); ok && !visible {
+		c.unsupported(p+"/visible", "UNSUPPORTED_VISIBILITY", "hidden object is visible in glTF")
+	}
+
+	var children []int
+	switch typ := threeString(obj, "type"); typ {
+	case "Scene", "Group", "Object3D", "Bone":
+	case "Mesh", "SkinnedMesh", "InstancedMesh":
+		if typ == "SkinnedMesh" {
+			c.unsupported(p, "UNSUPPORTED_SKINNING", "skinning is not converted, the mesh is exported in bind pose")
+		}
+		if typ == "InstancedMesh" {
+			c.unsupported(p, "UNSUPPORTED_INSTANCING", "InstancedMesh is exported as a single instance")
+		}
+		c.b.doc.Nodes[idx].Mesh = c.mesh(p, obj, gltfTriangles)
+	case "Points":
+		c.b.doc.Nodes[idx].Mesh = c.mesh(p, obj, gltfPoints)
+	case "Line":
+		c.b.doc.Nodes[idx].Mesh = c.mesh(p, obj, gltfLineStrip)
+	case "LineLoop":
+		c.b.doc.Nodes[idx].Mesh = c.mesh(p, obj, gltfLineLoop)
+	case "LineSegments":
+		c.b.doc.Nodes[idx].Mesh = c.mesh(p, obj, gltfLines)
+	case "PerspectiveCamera", "OrthographicCamera":
+		c.b.doc.Nodes[idx].Camera = c.camera(obj, typ)
+	case "DirectionalLight", "SpotLight", "PointLight":
+		if child := c.light(p, obj, typ, idx, world); child >= 0 {
+			children = append(children, child)
+		}
+	default:
+		c.unsupported(p, "UNSUPPORTED_OBJECT", "%s is exported as an empty node", typ)
+	}
+
+	list, _ := obj["children"].([]interface{})
+	for i, ch := range list {
+		children = append(children, c.object(p+"/children/"+strconv.Itoa(i), ch.(map[string]interface{}), world))
+	}
+	c.b.doc.Nodes[idx].Children = children
+	return idx
+}
+
+// mesh 为对象生成 glTF 网格；相同几何体和材质组合的对象共用一个网格
+func (c *threeConverter) mesh(p string, obj map[string]interface{}, mode int) *int {
+	gid, _ := obj["geometry"].(string)
+	g := c.geometries[gid]
+	if typ := threeString(g.Data, "type"); typ != "BufferGeometry" {
+		c.unsupported(g.Pointer, "UNSUPPORTED_GEOMETRY", "%s is not converted, only BufferGeometry is supported", typ)
+		return nil
+	}
+	var mats []string
+	switch m := obj["material"].(type) {
+	case string:
+		mats = []string{m}
+	case []interface{}:
+		for _, id := range m {
+			mats = append(mats, id.(string))
+		}
+	}
+	key := fmt.Sprintf("%s|%d|%s", gid, mode, strings.Join(mats, ","))
+	if i, ok := c.meshCache[key]; ok {
+		return &i
+	}
+	geo := c.geometry(gid)
+	if geo == nil {
+		return nil
+	}
+
+	// 顶点颜色只在材质开启 vertexColors 时生效，glTF 则总是把 COLOR_0 乘到底色上
+	colors := false
+	for _, id := range mats {
+		if v, _ := c.materials[id].Data["vertexColors"].(bool); v {
+			colors = true
+		}
+	}
+	attrs := c.attributes(gid, geo, colors)
+	if attrs == nil {
+		return nil
+	}
+
+	type part struct {
+		indices []uint32
+		indexed bool
+		mat     string
+	}
+	var parts []part
+	if len(mats) > 1 && len(geo.groups) > 0 {
+		for _, gr := range geo.groups {
+			if gr.material >= 0 && gr.material < len(mats) {
+				parts = append(parts, part{geo.groupIndices(gr), true, mats[gr.material]})
+			}
+		}
+	} else {
+		if len(mats) > 1 {
+			c.unsupported(p+"/material", "UNSUPPORTED_MATERIAL_ARRAY", "material array without geometry groups, only the first material is used")
+		}
+		pt := part{indices: geo.index, indexed: geo.index != nil}
+		if len(mats) > 0 {
+			pt.mat = mats[0]
+		}
+		parts = []part{pt}
+	}
+
+	mesh := GLTFMesh{Name: threeString(g.Data, "name")}
+	for _, pt := range parts {
+		prim := GLTFPrimitive{Attributes: attrs}
+		n := geo.count
+		if pt.indexed {
+			if len(pt.indices) == 0 {
+				continue
+			}
+			i := c.b.addIndexAccessor(pt.indices)
+			prim.Indices, n = &i, len(pt.indices)
+		}
+		if mode != gltfTriangles {
+			m := mode
+			prim.Mode = &m
+		} else {
+			c.rep.Triangles += n / 3
+		}
+		if pt.mat != "" {
+			mi := c.material(pt.mat)
+			prim.Material = &mi
+		}
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+	if len(mesh.Primitives) == 0 {
+		return nil
+	}
+	c.rep.Primitives += len(mesh.Primitives)
+	c.b.doc.Meshes = append(c.b.doc.Meshes, mesh)
+	i := len(c.b.doc.Meshes) - 1
+	c.meshCache[key] = i
+	return &i
+}
+
+// groupIndices 返回分组覆盖的索引；非索引几何体按顶点范围生成
+func (g *threeGeometry) groupIndices(gr threeGroup) []uint32 {
+	n := g.count
+	if g.index != nil {
+		n = len(g.index)
+	}
+	start, end := gr.start, n
+	if gr.count >= 0 && start+gr.count < n {
+		end = start + gr.count
+	}
+	if start < 0 || start >= end {
+		return nil
+	}
+	if g.index != nil {
+		return g.index[start:end]
+	}
+	idx := make([]uint32, 0, end-start)
+	for i := start; i < end; i++ {
+		idx = append(idx, uint32(i))
+	}
+	return idx
+}
+
+// geometry 解码 BufferGeometry 的属性、索引和分组，结果按 uuid 缓存
+func (c *threeConverter) geometry(gid string) *threeGeometry {
+	if g, ok := c.geomCache[gid]; ok {
+		return g
+	}
+	item := c.geometries[gid]
+	c.geomCache[gid] = nil
+	data := item.Data["data"].(map[string]interface{})
+	geo := &threeGeometry{attrs: map[string]threeAttr{}}
+	for name, raw := range data["attributes"].(map[string]interface{}) {
+		a := raw.(map[string]interface{})
+		if inter, _ := a["isInterleavedBufferAttribute"].(bool); inter {
+			c.unsupported(item.Pointer+"/data/attributes/"+escapePointer(name), "UNSUPPORTED_ATTRIBUTE", "interleaved attribute %q is not converted", name)
+			continue
+		}
+		arr := a["array"].([]interface{})
+		vals := make([]float64, len(arr))
+		for i, x := range arr {
+			vals[i] = x.(float64)
+		}
+		if norm, _ := a["normalized"].(bool); norm {
+			if max, ok := threeNormalizedMax[threeString(a, "type")]; ok {
+				for i := range vals {
+					vals[i] = math.Max(vals[i]/max, -1)
+				}
+			}
+		}
+		geo.attrs[name] = threeAttr{vals: vals, size: int(a["itemSize"].(float64))}
+	}
+	pos, ok := geo.attrs["position"]
+	if !ok {
+		return nil
+	}
+	geo.count = len(pos.vals) / pos.size
+	if idx, ok := data["index"].(map[string]interface{}); ok {
+		arr := idx["array"].([]interface{})
+		geo.index = make([]uint32, len(arr))
+		for i, x := range arr {
+			v := x.(float64)
+			if v >= float64(geo.count) {
+				c.unsupported(item.Pointer+"/data/index/array/"+strconv.Itoa(i), "INDEX_OUT_OF_RANGE", "index %v exceeds vertex count %d, geometry skipped", v, geo.count)
+				return nil
+			}
+			geo.index[i] = uint32(v)
+		}
+	}
+	groups, _ := data["groups"].([]interface{})
+	for _, gr := range groups {
+		m, ok := gr.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// count 为 Infinity 时 toJSON 写成 null，表示直到末尾
+		geo.groups = append(geo.groups, threeGroup{
+			start:    int(threeNumber(m, "start", 0)),
+			count:    int(threeNumber(m, "count", -1)),
+			material: int(threeNumber(m, "materialIndex", 0)),
+		})
+	}
+	if morph, _ := data["morphAttributes"].(map[string]interface{}); len(morph) > 0 {
+		c.unsupported(item.Pointer+"/data/morphAttributes", "UNSUPPORTED_MORPH_TARGETS", "morph targets are not converted")
+	}
+	c.geomCache[gid] = geo
+	return geo
+}
+
+// attributes 写入几何体的顶点属性访问器；colors 为 false 时省略 COLOR_0
+func (c *threeConverter) attributes(gid string, geo *threeGeometry, colors bool) map[string]int {
+	key := gid + "|" + strconv.FormatBool(colors)
+	if attrs, ok := c.attrCache[key]; ok {
+		return attrs
+	}
+	pointer := c.geometries[gid].Pointer + "/data/attributes/"
+	names := make([]string, 0, len(geo.attrs))
+	for name := range geo.attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	attrs := map[string]int{}
+	for _, name := range names {
+		a := geo.attrs[name]
+		p := pointer + escapePointer(name)
+		semantic, sizes := "", []int{1, 2, 3, 4}
+		switch name {
+		case "position":
+			semantic, sizes = "POSITION", []int{3}
+		case "normal":
+			semantic, sizes = "NORMAL", []int{3}
+		case "tangent":
+			semantic, sizes = "TANGENT", []int{4}
+		case "uv":
+			semantic, sizes = "TEXCOORD_0", []int{2}
+		case "uv1", "uv2", "uv3":
+			semantic, sizes = "TEXCOORD_"+name[2:], []int{2}
+		case "color":
+			if !colors {
+				continue
+			}
+			semantic, sizes = "COLOR_0", []int{3, 4}
+		case "skinIndex", "skinWeight":
+			c.unsupported(p, "UNSUPPORTED_ATTRIBUTE", "skinning attribute %q is not converted", name)
+			continue
+		default:
+			// glTF 允许以下划线开头的自定义属性
+			semantic = "_" + strings.ToUpper(name)
+		}
+		if !containsInt(sizes, a.size) {
+			c.unsupported(p, "UNSUPPORTED_ATTRIBUTE", "attribute %q with itemSize %d is not converted", name, a.size)
+			continue
+		}
+		if len(a.vals)/a.size != geo.count {
+			c.unsupported(p, "UNSUPPORTED_ATTRIBUTE", "attribute %q has %d elements, expected %d", name, len(a.vals)/a.size, geo.count)
+			continue
+		}
+		vals := make([]float32, len(a.vals))
+		for i, v := range a.vals {
+			vals[i] = float32(v)
+		}
+		if strings.HasPrefix(semantic, "TEXCOORD_") {
+			// three.js 的 v 轴向上，glTF 向下
+			for i := 1; i < len(vals); i += 2 {
+				vals[i] = 1 - vals[i]
+			}
+		}
+		typ := "SCALAR"
+		if a.size > 1 {
+			typ = "VEC" + strconv.Itoa(a.size)
+		}
+		attrs[semantic] = c.b.addFloatAccessor(vals, typ, semantic == "POSITION")
+	}
+	if _, ok := attrs["POSITION"]; !ok {
+		attrs = nil
+	} else if _, done := c.attrCache[gid+"|"+strconv.FormatBool(!colors)]; !done {
+		c.rep.Vertices += geo.count
+	}
+	c.attrCache[key] = attrs
+	return attrs
+}
+
+// material 转换材质并返回 glTF 材质索引
+func (c *threeConverter) material(id string) int {
+	if i, ok := c.matCache[id]; ok {
+		return i
+	}
+	item := c.materials[id]
+	d, p := item.Data, item.Pointer
+	typ := threeString(d, "type")
+	color := threeColor(d, "color", [3]float64{1, 1, 1})
+	opacity := threeNumber(d, "opacity", 1)
+	pbr := &GLTFPBR{BaseColorFactor: []float64{color[0], color[1], color[2], opacity}}
+	mat := GLTFMaterial{Name: threeString(d, "name"), PBRMetallicRoughness: pbr, Extras: threeExtras(d)}
+	handled := map[string]bool{"map": true}
+
+	switch typ {
+	case "MeshStandardMaterial", "MeshPhysicalMaterial":
+		pbr.MetallicFactor = floatPtr(threeNumber(d, "metalness", 0))
+		pbr.RoughnessFactor = floatPtr(threeNumber(d, "roughness", 1))
+		rm, _ := d["roughnessMap"].(string)
+		mm, _ := d["metalnessMap"].(string)
+		switch {
+		case rm != "" && rm == mm:
+			pbr.MetallicRoughnessTexture = c.textureInfo(d, "roughnessMap")
+			handled["roughnessMap"], handled["metalnessMap"] = true, true
+		case rm != "" || mm != "":
+			c.unsupported(p, "UNSUPPORTED_MATERIAL_PROPERTY", "separate roughnessMap and metalnessMap are not converted, glTF packs them into one texture")
+			handled["roughnessMap"], handled["metalnessMap"] = true, true
+		}
+		if typ == "MeshPhysicalMaterial" {
+			for _, k := range []string{"clearcoat", "transmission", "sheen", "iridescence", "thickness", "dispersion", "anisotropy"} {
+				if threeNumber(d, k, 0) > 0 {
+					c.unsupported(p+"/"+k, "UNSUPPORTED_MATERIAL_PROPERTY", "%s is not converted", k)
+				}
+			}
+		}
+	case "MeshBasicMaterial", "LineBasicMaterial", "LineDashedMaterial", "PointsMaterial", "SpriteMaterial":
+		pbr.MetallicFactor, pbr.RoughnessFactor = floatPtr(0), floatPtr(1)
+		mat.Extensions = map[string]json.RawMessage{"KHR_materials_unlit": json.RawMessage("{}")}
+		c.b.useExtension("KHR_materials_unlit", false)
+		if typ == "LineDashedMaterial" {
+			c.unsupported(p, "APPROXIMATED_MATERIAL", "dashes are not converted, lines are solid")
+		}
+		if typ == "PointsMaterial" && threeNumber(d, "size", 1) != 1 {
+			c.unsupported(p+"/size", "UNSUPPORTED_MATERIAL_PROPERTY", "point size is not converted")
+		}
+	case "MeshLambertMaterial", "MeshPhongMaterial", "MeshToonMaterial", "MeshMatcapMaterial":
+		pbr.MetallicFactor = floatPtr(0)
+		rough := 1.0
+		if typ == "MeshPhongMaterial" {
+			// 与 MTL 相同的 Blinn-Phong 高光指数换算
+			rough = math.Sqrt(2 / (threeNumber(d, "shininess", 30) + 2))
+		}
+		pbr.RoughnessFactor = floatPtr(rough)
+		c.unsupported(p, "APPROXIMATED_MATERIAL", "%s is approximated with a metallic-roughness material", typ)
+	default:
+		c.unsupported(p, "UNSUPPORTED_MATERIAL", "%s is exported as a default material", typ)
+	}
+	pbr.BaseColorTexture = c.textureInfo(d, "map")
+
+	if info := c.textureInfo(d, "normalMap"); info != nil {
+		mat.NormalTexture = info
+		if ns := threeFloats(d["normalScale"]); len(ns) == 2 {
+			if ns[0] != 1 {
+				info.Scale = floatPtr(ns[0])
+			}
+			if math.Abs(ns[0]) != math.Abs(ns[1]) {
+				c.unsupported(p+"/normalScale", "UNSUPPORTED_MATERIAL_PROPERTY", "non-uniform normalScale is not converted")
+			}
+		}
+		if threeNumber(d, "normalMapType", 0) != 0 {
+			c.unsupported(p+"/normalMapType", "UNSUPPORTED_MATERIAL_PROPERTY", "object-space normal maps are not converted")
+		}
+	}
+	handled["normalMap"] = true
+
+	emissive := threeColor(d, "emissive", [3]float64{})
+	if intensity := threeNumber(d, "emissiveIntensity", 1); intensity > 1 {
+		js, _ := json.Marshal(map[string]float64{"emissiveStrength": intensity})
+		if mat.Extensions == nil {
+			mat.Extensions = map[string]json.RawMessage{}
+		}
+		mat.Extensions["KHR_materials_emissive_strength"] = js
+		c.b.useExtension("KHR_materials_emissive_strength", false)
+	} else {
+		emissive = [3]float64{emissive[0] * intensity, emissive[1] * intensity, emissive[2] * intensity}
+	}
+	if emissive != [3]float64{} {
+		mat.EmissiveFactor = emissive[:]
+		mat.EmissiveTexture = c.textureInfo(d, "emissiveMap")
+	}
+	handled["emissiveMap"] = true
+
+	if info := c.textureInfo(d, "aoMap"); info != nil {
+		mat.OcclusionTexture = info
+		if s := threeNumber(d, "aoMapIntensity", 1); s != 1 {
+			info.Strength = floatPtr(s)
+		}
+	}
+	handled["aoMap"] = true
+
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.HasSuffix(k, "Map") && !handled[k] && d[k] != nil {
+			c.unsupported(p+"/"+k, "UNSUPPORTED_MATERIAL_PROPERTY", "%s is not converted", k)
+		}
+	}
+
+	if t, _ := d["transparent"].(bool); t {
+		mat.AlphaMode = "BLEND"
+	} else if cutoff := threeNumber(d, "alphaTest", 0); cutoff > 0 {
+		mat.AlphaMode, mat.AlphaCutoff = "MASK", floatPtr(cutoff)
+	}
+	switch threeNumber(d, "side", 0) {
+	case 1:
+		c.unsupported(p+"/side", "UNSUPPORTED_MATERIAL_PROPERTY", "BackSide is not converted, the material is single-sided")
+	case 2:
+		mat.DoubleSided = true
+	}
+
+	c.b.doc.Materials = append(c.b.doc.Materials, mat)
+	i := len(c.b.doc.Materials) - 1
+	c.matCache[id] = i
+	return i
+}
+
+// textureInfo 返回材质字段引用的纹理；repeat/offset 和 flipY 折算为 KHR_texture_transform
+func (c *threeConverter) textureInfo(d map[string]interface{}, key string) *GLTFTextureInfo {
+	id, ok := d[key].(string)
+	if !ok {
+		return nil
+	}
+	t := c.texture(id)
+	if t < 0 {
+		return nil
+	}
+	item := c.textures[id]
+	tex := item.Data
+	info := &GLTFTextureInfo{Index: t, TexCoord: int(threeNumber(tex, "channel", 0))}
+	if r := threeNumber(tex, "rotation", 0); r != 0 {
+		c.unsupported(item.Pointer+"/rotation", "UNSUPPORTED_TEXTURE_TRANSFORM", "texture rotation is not converted")
+	}
+	repeat, offset, center := threeVec2(tex, "repeat", 1), threeVec2(tex, "offset", 0), threeVec2(tex, "center", 0)
+	// 没有旋转时 center 只影响平移
+	ou := offset[0] + center[0]*(1-repeat[0])
+	ov := offset[1] + center[1]*(1-repeat[1])
+	// 顶点 UV 已做 v' = 1 - v；flipY 为 true（默认）时图片也是翻转的，二者抵消
+	scale := [2]float64{repeat[0], repeat[1]}
+	off := [2]float64{ou, 1 - repeat[1] - ov}
+	if flip, ok := tex["flipY"].(bool); ok && !flip {
+		scale[1], off[1] = -repeat[1], repeat[1]+ov
+	}
+	if scale != [2]float64{1, 1} || off != [2]float64{0, 0} {
+		js, _ := json.Marshal(map[string]interface{}{"offset": off, "scale": scale})
+		info.Extensions = map[string]json.RawMessage{"KHR_texture_transform": js}
+		c.b.useExtension("KHR_texture_transform", false)
+	}
+	return info
+}
+
+// texture 转换纹理和图片，返回纹理索引，不可用时返回 -1
+func (c *threeConverter) texture(id string) int {
+	if t, ok := c.texCache[id]; ok {
+		return t
+	}
+	c.texCache[id] = -1
+	tex := c.textures[id]
+	imgID, _ := tex.Data["image"].(string)
+	img, ok := c.images[imgID]
+	if !ok {
+		c.unsupported(tex.Pointer, "UNSUPPORTED_TEXTURE", "texture without image is not converted")
+		return -1
+	}
+	src, ok := c.image(imgID, img)
+	if !ok {
+		return -1
+	}
+	s := c.sampler(tex.Data)
+	c.b.doc.Textures = append(c.b.doc.Textures, GLTFTexture{Name: threeString(tex.Data, "name"), Sampler: &s, Source: &src})
+	t := len(c.b.doc.Textures) - 1
+	c.texCache[id] = t
+	return t
+}
+
+// image 嵌入 data URI 图片，外部图片按 textureOptions 嵌入或引用
+func (c *threeConverter) image(id string, img threeItem) (int, bool) {
+	if i, ok := c.imgCache[id]; ok {
+		return i, i >= 0
+	}
+	c.imgCache[id] = -1
+	var url string
+	switch u := img.Data["url"].(type) {
+	case string:
+		url = u
+	case []interface{}:
+		c.unsupported(img.Pointer+"/url", "UNSUPPORTED_IMAGE", "cube textures are not converted")
+		return -1, false
+	default:
+		c.unsupported(img.Pointer+"/url", "UNSUPPORTED_IMAGE", "raw pixel data textures are not converted")
+		return -1, false
+	}
+	name := threeString(img.Data, "name")
+	var idx int
+	if strings.HasPrefix(url, "data:") {
+		data, err := decodeDataURI(url)
+		if err != nil {
+			c.unsupported(img.Pointer+"/url", "INVALID_DATA_URI", "%v", err)
+			return -1, false
+		}
+		mime := dataURIMime(url)
+		if mime == "" {
+			mime = imageMimeType("", data)
+		}
+		if !c.supportedImage(img.Pointer, mime) {
+			return -1, false
+		}
+		idx = c.b.addImage(data, mime, name)
+		c.texRep = append(c.texRep, meshTextureReport{Source: dataRelPath(c.file) + "#" + img.Pointer, Embedded: true})
+	} else {
+		ref := resolveAssetRef(c.file, rawRef{URI: url, Kind: refImage, Escaped: true, Site: true})
+		rep := meshTextureReport{Source: ref.Path, Embedded: c.opts.Embed}
+		if ref.dangling() {
+			rep.Source, rep.Missing, rep.Embedded = url, true, false
+			c.texRep = append(c.texRep, rep)
+			c.warnings = append(c.warnings, "texture not found: "+url)
+			return -1, false
+		}
+		file := filepath.Join(dataRoot, filepath.FromSlash(ref.Path))
+		data, err := os.ReadFile(file)
+		if err != nil {
+			c.warnings = append(c.warnings, fmt.Sprintf("texture %s: %v", url, err))
+			return -1, false
+		}
+		if !c.supportedImage(img.Pointer, imageMimeType(file, data)) {
+			return -1, false
+		}
+		if name == "" {
+			name = filepath.Base(file)
+		}
+		if c.opts.Embed {
+			idx = c.b.addImage(data, imageMimeType(file, data), name)
+		} else {
+			rel, err := filepath.Rel(c.opts.OutDir, file)
+			if err != nil {
+				rel = file
+			}
+			rep.URI = uriEscapePath(filepath.ToSlash(rel))
+			idx = c.b.addImageURI(rep.URI, name)
+		}
+		c.texRep = append(c.texRep, rep)
+	}
+	c.imgCache[id] = idx
+	return idx, true
+}
+
+// supportedImage 只接受 glTF 核心规范支持的 PNG 和 JPEG
+func (c *threeConverter) supportedImage(pointer, mime string) bool {
+	if mime == "image/png" || mime == "image/jpeg" {
+		return true
+	}
+	c.unsupported(pointer, "UNSUPPORTED_IMAGE", "image type %s is not supported by core glTF", mime)
+	return false
+}
+
+// sampler 把 wrap/magFilter/minFilter 转换为采样器，相同参数共用一个
+func (c *threeConverter) sampler(tex map[string]interface{}) int {
+	wrap := threeFloats(tex["wrap"])
+	key := [4]int{10497, 10497, 9729, 9987}
+	if len(wrap) == 2 {
+		if v, ok := threeWrapModes[int(wrap[0])]; ok {
+			key[0] = v
+		}
+		if v, ok := threeWrapModes[int(wrap[1])]; ok {
+			key[1] = v
+		}
+	}
+	if v, ok := threeFilters[int(threeNumber(tex, "magFilter", 1006))]; ok && (v == 9728 || v == 9729) {
+		key[2] = v
+	}
+	if v, ok := threeFilters[int(threeNumber(tex, "minFilter", 1008))]; ok {
+		key[3] = v
+	}
+	if s, ok := c.samplers[key]; ok {
+		return s
+	}
+	c.b.doc.Samplers = append(c.b.doc.Samplers, GLTFSampler{WrapS: key[0], WrapT: key[1], MagFilter: key[2], MinFilter: key[3]})
+	s := len(c.b.doc.Samplers) - 1
+	c.samplers[key] = s
+	return s
+}
+
+// camera 转换透视或正交相机
+func (c *threeConverter) camera(obj map[string]interface{}, typ string) *int {
+	zoom := threeNumber(obj, "zoom", 1)
+	near, far := threeNumber(obj, "near", 0.1), threeNumber(obj, "far", 2000)
+	var cam map[string]interface{}
+	if typ == "PerspectiveCamera" {
+		fov := threeNumber(obj, "fov", 50) * math.Pi / 180
+		p := map[string]interface{}{
+			"yfov":  2 * math.Atan(math.Tan(fov/2)/zoom),
+			"znear": near,
+			"zfar":  far,
+		}
+		if aspect := threeNumber(obj, "aspect", 0); aspect > 0 {
+			p["aspectRatio"] = aspect
+		}
+		cam = map[string]interface{}{"type": "perspective", "perspective": p}
+	} else {
+		cam = map[string]interface{}{"type": "orthographic", "orthographic": map[string]interface{}{
+			"xmag":  (threeNumber(obj, "right", 1) - threeNumber(obj, "left", -1)) / (2 * zoom),
+			"ymag":  (threeNumber(obj, "top", 1) - threeNumber(obj, "bottom", -1)) / (2 * zoom),
+			"znear": math.Max(near, 0),
+			"zfar":  far,
+		}}
+	}
+	if name := threeString(obj, "name"); name != "" {
+		cam["name"] = name
+	}
+	js, _ := json.Marshal(cam)
+	c.b.doc.Cameras = append(c.b.doc.Cameras, js)
+	i := len(c.b.doc.Cameras) - 1
+	return &i
+}
+
+// light 转换为 KHR_lights_punctual。点光源直接挂在节点上；
+// 平行光和聚光灯朝向 target，需要一个旋转后的子节点，返回它的索引（没有时为 -1）
+func (c *threeConverter) light(p string, obj map[string]interface{}, typ string, node int, world mat4) int {
+	color := threeColor(obj, "color", [3]float64{1, 1, 1})
+	l := map[string]interface{}{
+		"color":     color[:],
+		"intensity": threeNumber(obj, "intensity", 1),
+	}
+	if name := threeString(obj, "name"); name != "" {
+		l["name"] = name
+	}
+	switch typ {
+	case "DirectionalLight":
+		l["type"] = "directional"
+	case "PointLight", "SpotLight":
+		l["type"] = "point"
+		if d := threeNumber(obj, "distance", 0); d > 0 {
+			l["range"] = d
+		}
+		if decay := threeNumber(obj, "decay", 2); decay != 2 {
+			c.unsupported(p+"/decay", "UNSUPPORTED_LIGHT_PROPERTY", "decay %v is not converted, glTF lights use inverse-square falloff", decay)
+		}
+	}
+	if typ == "SpotLight" {
+		angle := threeNumber(obj, "angle", math.Pi/3)
+		l["type"] = "spot"
+		l["spot"] = map[string]float64{
+			"outerConeAngle": angle,
+			"innerConeAngle": angle * (1 - threeNumber(obj, "penumbra", 0)),
+		}
+	}
+	c.lights = append(c.lights, l)
+	ext, _ := json.Marshal(map[string]int{"light": len(c.lights) - 1})
+	exts := map[string]json.RawMessage{"KHR_lights_punctual": ext}
+	if typ == "PointLight" {
+		c.b.doc.Nodes[node].Extensions = exts
+		return -1
+	}
+
+	// 默认 target 位于世界原点
+	target := vec3{}
+	if tid, ok := obj["target"].(string); ok {
+		if m, ok := c.worlds[tid]; ok {
+			target = m.point(vec3{})
+		}
+	}
+	dir := target.sub(world.point(vec3{}))
+	if dir.dot(dir) == 0 {
+		dir = vec3{0, 0, -1}
+	}
+	// 世界方向换到灯光的局部坐标：左上 3x3 的逆等于 normalMatrix 的转置
+	n := world.normalMatrix()
+	local := vec3{
+		n[0]*dir[0] + n[1]*dir[1] + n[2]*dir[2],
+		n[3]*dir[0] + n[4]*dir[1] + n[5]*dir[2],
+		n[6]*dir[0] + n[7]*dir[1] + n[8]*dir[2],
+	}.norm()
+	q := quatFromTo(vec3{0, 0, -1}, local)
+	child := GLTFNode{Name: threeString(obj, "name"), Extensions: exts}
+	if q != [4]float64{0, 0, 0, 1} {
+		child.Rotation = q[:]
+	}
+	c.b.doc.Nodes = append(c.b.doc.Nodes, child)
+	return len(c.b.doc.Nodes) - 1
+}
+
+// quatFromTo 返回把单位向量 a 转到单位向量 b 的四元数（xyzw）
+func quatFromTo(a, b vec3) [4]float64 {
+	d := a.dot(b)
+	if d < -0.999999 {
+		// 反向时绕任意垂直轴转 180°
+		axis := vec3{1, 0, 0}.cross(a)
+		if axis.dot(axis) < 1e-12 {
+			axis = vec3{0, 1, 0}.cross(a)
+		}
+		axis = axis.norm()
+		return [4]float64{axis[0], axis[1], axis[2], 0}
+	}
+	x := a.cross(b)
+	q := [4]float64{x[0], x[1], x[2], 1 + d}
+	l := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+	for i := range q {
+		q[i] /= l
+	}
+	return q
+}
+
+func threeString(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func threeNumber(m map[string]interface{}, key string, def float64) float64 {
+	if v, ok := m[key].(float64); ok {
+		return v
+	}
+	return def
+}
+
+func threeFloats(v interface{}) []float64 {
+	list, _ := v.([]interface{})
+	out := make([]float64, 0, len(list))
+	for _, x := range list {
+		f, ok := x.(float64)
+		if !ok {
+			return nil
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func threeVec2(m map[string]interface{}, key string, def float64) [2]float64 {
+	if v := threeFloats(m[key]); len(v) == 2 {
+		return [2]float64{v[0], v[1]}
+	}
+	return [2]float64{def, def}
+}
+
+// threeMatrix 返回对象的局部矩阵（toJSON 按列主序写出，与 glTF 相同）
+func threeMatrix(obj map[string]interface{}) mat4 {
+	m := identity4
+	if v := threeFloats(obj["matrix"]); len(v) == 16 {
+		copy(m[:], v)
+	}
+	return m
+}
+
+// threeColor 把 three.js 的十六进制颜色（sRGB）转换为 glTF 使用的线性值
+func threeColor(m map[string]interface{}, key string, def [3]float64) [3]float64 {
+	v, ok := m[key].(float64)
+	if !ok {
+		return def
+	}
+	hex := int(v)
+	return [3]float64{srgbToLinear[hex>>16&255], srgbToLinear[hex>>8&255], srgbToLinear[hex&255]}
+}
+
+// threeExtras 把非空的 userData 保存为 extras
+func threeExtras(m map[string]interface{}) json.RawMessage {
+	ud, ok := m["userData"].(map[string]interface{})
+	if !ok || len(ud) == 0 {
+		return nil
+	}
+	js, _ := json.Marshal(ud)
+	return js
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	pngenc "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertThreeScene(t *testing.T) {
+	root := setTestDataRoot(t)
+	var png bytes.Buffer
+	pngenc.Encode(&png, image.NewNRGBA(image.Rect(0, 0, 2, 2)))
+	writeDataFiles(t, root, map[string]string{"tex/a.png": png.String()})
+	lights := strings.Replace(testThreeScene, `"children": [`, `"children": [
+		{"uuid": "sun", "type": "DirectionalLight", "color": 16777215, "intensity": 2},
+		{"uuid": "cam", "type": "PerspectiveCamera", "fov": 50, "aspect": 1.5, "near": 0.1, "far": 100},`, 1)
+	tests := []struct {
+		name        string
+		scene       string
+		unsupported string // 期望在报告中出现的问题代码
+		extension   string
+	}{
+		{"mesh", testThreeScene, "", ""},
+		{"light and camera", lights, "", "KHR_lights_punctual"},
+		{"animations", strings.Replace(testThreeScene, `"images":`, `"animations": [{"name": "spin"}], "images":`, 1), "UNSUPPORTED_ANIMATIONS", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(root, "scene.json")
+			os.WriteFile(src, []byte(tt.scene), 0644)
+			rep, err := convertModel(src, ConvertOptions{Overwrite: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.Format != "threejs" || rep.Materials != 1 || len(rep.Textures) != 1 {
+				t.Fatalf("unexpected report %+v", rep)
+			}
+			found := tt.unsupported == ""
+			for _, u := range rep.Unsupported {
+				found = found || u.Code == tt.unsupported
+			}
+			if !found {
+				t.Fatalf("unsupported = %+v, want %s", rep.Unsupported, tt.unsupported)
+			}
+			ins, err := inspectModel(filepath.Join(root, rep.Output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ins.Validation.Valid {
+				t.Fatalf("converted GLB is invalid: %+v", ins.Validation.Errors)
+			}
+			f, err := loadGLTF(filepath.Join(root, rep.Output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			used := tt.extension == ""
+			for _, e := range f.Doc.ExtensionsUsed {
+				used = used || e == tt.extension
+			}
+			if !used {
+				t.Fatalf("extensionsUsed = %v, want %s", f.Doc.ExtensionsUsed, tt.extension)
+			}
+		})
+	}
+}
+
+func TestConvertThreeSceneInvalid(t *testing.T) {
+	root := setTestDataRoot(t)
+	src := filepath.Join(root, "bad.json")
+	os.WriteFile(src, []byte(strings.Replace(testThreeScene, `"geometry": "geo"`, `"geometry": "nope"`, 1)), 0644)
+	if _, err := convertModel(src, ConvertOptions{}); err == nil || !strings.Contains(err.Error(), "/object/children/0/geometry") {
+		t.Fatalf("got %v, want an error pointing at the bad reference", err)
+	}
+}
+
+func TestQuatFromTo(t *testing.T) {
+	tests := []struct{ a, b vec3 }{
+		{vec3{0, 0, -1}, vec3{0, 0, -1}},
+		{vec3{0, 0, -1}, vec3{1, 0, 0}},
+		{vec3{0, 0, -1}, vec3{0, 0, 1}},
+		{vec3{1, 0, 0}, vec3{-1, 0, 0}},
+		{vec3{0, 0, -1}, vec3{1, -1, 1}.norm()},
+	}
+	for _, tt := range tests {
+		q := quatFromTo(tt.a, tt.b)
+		m := nodeMatrix(&GLTFNode{Rotation: q[:]})
+		if got := m.point(tt.a); got.sub(tt.b).length() > 1e-9 {
+			t.Errorf("quatFromTo(%v, %v) rotates a to %v", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestThreeColor(t *testing.T) {
+	var m map[string]interface{}
+	json.Unmarshal([]byte(`{"white": 16777215, "red": 16711680, "grey": 8421504}`), &m)
+	tests := []struct {
+		key  string
+		want [3]float64
+	}{
+		{"white", [3]float64{1, 1, 1}},
+		{"red", [3]float64{1, 0, 0}},
+		{"grey", [3]float64{0.2158605, 0.2158605, 0.2158605}},
+		{"missing", [3]float64{0.5, 0.5, 0.5}},
+	}
+	for _, tt := range tests {
+		got := threeColor(m, tt.key, [3]float64{0.5, 0.5, 0.5})
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-6 {
+				t.Errorf("threeColor(%s) = %v, want %v", tt.key, got, tt.want)
+				break
+			}
+		}
+	}
+}
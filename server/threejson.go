@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// three.js 场景校验最多报告的问题数
+const threeMaxIssues = 100
+
+// threeRenderableTypes 是 ObjectLoader 会读取 geometry 和 material 的对象类型
+var threeRenderableTypes = map[string]bool{
+	"Mesh": true, "SkinnedMesh": true, "InstancedMesh": true, "BatchedMesh": true,
+	"Points": true, "Line": true, "LineLoop": true, "LineSegments": true,
+}
+
+// threeValidator 按 ObjectLoader 的解析顺序检查 Object3D.toJSON() 文档，位置使用 JSON Pointer
+type threeValidator struct {
+	issues     []Issue
+	images     map[string]bool
+	textures   map[string]bool
+	materials  map[string]bool
+	geometries map[string]bool
+	objects    map[string]string // uuid -> 首次出现的位置
+}
+
+// validateThreeScene 校验 three.js JSON 场景，返回结构错误（最多 threeMaxIssues 个）
+func validateThreeScene(doc interface{}) []Issue {
+	v := &threeValidator{objects: map[string]string{}}
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		v.error("", "TYPE_MISMATCH", "scene must be a JSON object")
+		return v.issues
+	}
+	v.metadata(root["metadata"])
+	// 资源之间只有向前的引用：texture -> image，material -> texture
+	v.images = v.collect(root, "images", nil)
+	v.textures = v.collect(root, "textures", v.texture)
+	v.materials = v.collect(root, "materials", v.material)
+	v.geometries = v.collect(root, "geometries", v.geometry)
+	if obj, ok := root["object"]; ok {
+		v.object("/object", obj)
+	} else {
+		v.error("/object", "REQUIRED", "object is required")
+	}
+	return v.issues
+}
+
+func (v *threeValidator) error(pointer, code, format string, args ...interface{}) {
+	if len(v.issues) < threeMaxIssues {
+		v.issues = append(v.issues, Issue{Code: code, Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (v *threeValidator) metadata(m interface{}) {
+	meta, ok := m.(map[string]interface{})
+	if !ok {
+		v.error("/metadata", "REQUIRED", "metadata object is required")
+		return
+	}
+	if ver, ok := meta["version"].(float64); !ok {
+		v.error("/metadata/version", "MISSING_VERSION", "version must be a number")
+	} else if ver < 4 || ver >= 5 {
+		v.error("/metadata/version", "UNSUPPORTED_VERSION", "unsupported version %v, expected 4.x", ver)
+	}
+	if typ, _ := meta["type"].(string); typ != "Object" {
+		v.error("/metadata/type", "VALUE_NOT_IN_LIST", "type must be \"Object\", got %q", typ)
+	}
+}
+
+// collect 检查资源数组（每项需要唯一的 uuid）并返回 uuid 集合，check 做各类资源自己的检查
+func (v *threeValidator) collect(root map[string]interface{}, key string, check func(pointer string, item map[string]interface{})) map[string]bool {
+	ids := map[string]bool{}
+	raw, ok := root[key]
+	if !ok {
+		return ids
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		v.error("/"+key, "TYPE_MISMATCH", "%s must be an array", key)
+		return ids
+	}
+	for i, it := range list {
+		p := fmt.Sprintf("/%s/%d", key, i)
+		item, ok := it.(map[string]interface{})
+		if !ok {
+			v.error(p, "TYPE_MISMATCH", "must be an object")
+			continue
+		}
+		id, ok := item["uuid"].(string)
+		switch {
+		case !ok || id == "":
+			v.error(p+"/uuid", "REQUIRED", "uuid must be a non-empty string")
+		case ids[id]:
+			v.error(p+"/uuid", "DUPLICATE_UUID", "duplicate uuid %q", id)
+		default:
+			ids[id] = true
+		}
+		if check != nil {
+			check(p, item)
+		}
+	}
+	return ids
+}
+
+func (v *threeValidator) requireType(p string, item map[string]interface{}) string {
+	typ, ok := item["type"].(string)
+	if !ok || typ == "" {
+		v.error(p+"/type", "REQUIRED", "type must be a non-empty string")
+	}
+	return typ
+}
+
+func (v *threeValidator) texture(p string, item map[string]interface{}) {
+	if img, ok := item["image"]; ok {
+		v.ref(p+"/image", img, v.images, "image")
+	}
+}
+
+func (v *threeValidator) material(p string, item map[string]interface{}) {
+	v.requireType(p, item)
+	keys := make([]string, 0, len(item))
+	for k := range item {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// MaterialLoader 把 map 和所有 xxxMap 字段当作纹理 uuid
+		if k != "map" && !strings.HasSuffix(k, "Map") || item[k] == nil {
+			continue
+		}
+		v.ref(p+"/"+k, item[k], v.textures, "texture")
+	}
+}
+
+func (v *threeValidator) geometry(p string, item map[string]interface{}) {
+	typ := v.requireType(p, item)
+	if typ != "BufferGeometry" && typ != "InstancedBufferGeometry" {
+		return // BoxGeometry 等参数化几何体由参数重建
+	}
+	data, ok := item["data"].(map[string]interface{})
+	if !ok {
+		v.error(p+"/data", "REQUIRED", "data is required for %s", typ)
+		return
+	}
+	attrs, ok := data["attributes"].(map[string]interface{})
+	if !ok {
+		v.error(p+"/data/attributes", "REQUIRED", "attributes must be an object")
+		return
+	}
+	if _, ok := attrs["position"]; !ok {
+		v.error(p+"/data/attributes/position", "REQUIRED", "position attribute is required")
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v.attribute(p+"/data/attributes/"+escapePointer(name), attrs[name], false)
+	}
+	if idx, ok := data["index"]; ok && idx != nil {
+		v.attribute(p+"/data/index", idx, true)
+	}
+}
+
+// attribute 检查 BufferAttribute 的 itemSize 和 array；交错属性的数据在 interleavedBuffers 中，只检查 itemSize
+func (v *threeValidator) attribute(p string, raw interface{}, index bool) {
+	a, ok := raw.(map[string]interface{})
+	if !ok {
+		v.error(p, "TYPE_MISMATCH", "attribute must be an object")
+		return
+	}
+	size, ok := a["itemSize"].(float64)
+	if !ok || size < 1 || size != float64(int(size)) {
+		v.error(p+"/itemSize", "VALUE_OUT_OF_RANGE", "itemSize must be a positive integer")
+		return
+	}
+	if inter, _ := a["isInterleavedBufferAttribute"].(bool); inter {
+		return
+	}
+	arr, ok := a["array"].([]interface{})
+	if !ok {
+		v.error(p+"/array", "TYPE_MISMATCH", "array must be an array of numbers")
+		return
+	}
+	if len(arr)%int(size) != 0 {
+		v.error(p+"/array", "ARRAY_LENGTH", "length %d is not a multiple of itemSize %d", len(arr), int(size))
+	}
+	for i, x := range arr {
+		n, ok := x.(float64)
+		if !ok {
+			v.error(p+"/array/"+strconv.Itoa(i), "TYPE_MISMATCH", "must be a number")
+			return // 同一数组只报告第一个
+		}
+		if index && (n < 0 || n != float64(int64(n))) {
+			v.error(p+"/array/"+strconv.Itoa(i), "VALUE_OUT_OF_RANGE", "index must be a non-negative integer")
+			return
+		}
+	}
+}
+
+func (v *threeValidator) object(p string, raw interface{}) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		v.error(p, "TYPE_MISMATCH", "object must be a JSON object")
+		return
+	}
+	typ := v.requireType(p, obj)
+	if id, ok := obj["uuid"].(string); !ok || id == "" {
+		v.error(p+"/uuid", "REQUIRED", "uuid must be a non-empty string")
+	} else if first, dup := v.objects[id]; dup {
+		v.error(p+"/uuid", "DUPLICATE_UUID", "duplicate uuid %q (first used at %s)", id, first)
+	} else {
+		v.objects[id] = p
+	}
+	if m, ok := obj["matrix"]; ok {
+		arr, ok := m.([]interface{})
+		if !ok || len(arr) != 16 {
+			v.error(p+"/matrix", "ARRAY_LENGTH", "matrix must be an array of 16 numbers")
+		} else {
+			for i, x := range arr {
+				if _, ok := x.(float64); !ok {
+					v.error(p+"/matrix/"+strconv.Itoa(i), "TYPE_MISMATCH", "must be a number")
+					break
+				}
+			}
+		}
+	}
+	if g, ok := obj["geometry"]; ok || threeRenderableTypes[typ] {
+		v.ref(p+"/geometry", g, v.geometries, "geometry")
+	}
+	if m, ok := obj["material"]; ok || threeRenderableTypes[typ] || typ == "Sprite" {
+		if list, isList := m.([]interface{}); isList {
+			for i, id := range list {
+				v.ref(p+"/material/"+strconv.Itoa(i), id, v.materials, "material")
+			}
+		} else {
+			v.ref(p+"/material", m, v.materials, "material")
+		}
+	}
+	if ch, ok := obj["children"]; ok {
+		list, ok := ch.([]interface{})
+		if !ok {
+			v.error(p+"/children", "TYPE_MISMATCH", "children must be an array")
+			return
+		}
+		for i, c := range list {
+			v.object(p+"/children/"+strconv.Itoa(i), c)
+		}
+	}
+}
+
+// ref 检查 uuid 引用是否指向已定义的资源
+func (v *threeValidator) ref(p string, raw interface{}, ids map[string]bool, kind string) {
+	if raw == nil {
+		v.error(p, "REQUIRED", "%s is required", kind)
+		return
+	}
+	id, ok := raw.(string)
+	if !ok {
+		v.error(p, "TYPE_MISMATCH", "must be a %s uuid", kind)
+		return
+	}
+	if !ids[id] {
+		v.error(p, "UNRESOLVED_REFERENCE", "unknown %s %q", kind, id)
+	}
+}
+
+// escapePointer 按 RFC 6901 转义 JSON Pointer 中的一段
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
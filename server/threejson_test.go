@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testThreeScene 是一个合法的 Object3D.toJSON() 文档：一个带纹理材质的网格
+const testThreeScene = `{
+	"metadata": {"version": 4.6, "type": "Object", "generator": "Object3D.toJSON"},
+	"images": [{"uuid": "img", "url": "tex/a.png"}],
+	"textures": [{"uuid": "tex", "image": "img"}],
+	"materials": [{"uuid": "mat", "type": "MeshStandardMaterial", "map": "tex"}],
+	"geometries": [
+		{"uuid": "geo", "type": "BufferGeometry", "data": {
+			"attributes": {"position": {"itemSize": 3, "type": "Float32Array", "array": [0, 0, 0, 1, 0, 0, 0, 1, 0]}},
+			"index": {"itemSize": 1, "type": "Uint16Array", "array": [0, 1, 2]}
+		}},
+		{"uuid": "box", "type": "BoxGeometry", "width": 1}
+	],
+	"object": {"uuid": "root", "type": "Scene", "name": "demo", "children": [
+		{"uuid": "m1", "type": "Mesh", "geometry": "geo", "material": "mat", "matrix": [1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]},
+		{"uuid": "m2", "type": "Mesh", "geometry": "box", "material": ["mat", "mat"]}
+	]}
+}`
+
+func TestValidateThreeScene(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace [2]string // 在合法文档上做的一处文本替换
+		code    string
+		pointer string
+	}{
+		{"valid", [2]string{}, "", ""},
+		{"missing version", [2]string{`"version": 4.6, `, ``}, "MISSING_VERSION", "/metadata/version"},
+		{"version 5", [2]string{`4.6`, `5`}, "UNSUPPORTED_VERSION", "/metadata/version"},
+		{"wrong type", [2]string{`"type": "Object"`, `"type": "Geometry"`}, "VALUE_NOT_IN_LIST", "/metadata/type"},
+		{"duplicate resource uuid", [2]string{`"uuid": "box"`, `"uuid": "geo"`}, "DUPLICATE_UUID", "/geometries/1/uuid"},
+		{"duplicate object uuid", [2]string{`"uuid": "m2"`, `"uuid": "m1"`}, "DUPLICATE_UUID", "/object/children/1/uuid"},
+		{"unknown image", [2]string{`"image": "img"`, `"image": "nope"`}, "UNRESOLVED_REFERENCE", "/textures/0/image"},
+		{"unknown texture", [2]string{`"map": "tex"`, `"map": "nope"`}, "UNRESOLVED_REFERENCE", "/materials/0/map"},
+		{"unknown geometry", [2]string{`"geometry": "geo"`, `"geometry": "nope"`}, "UNRESOLVED_REFERENCE", "/object/children/0/geometry"},
+		{"unknown material in list", [2]string{`["mat", "mat"]`, `["mat", "nope"]`}, "UNRESOLVED_REFERENCE", "/object/children/1/material/1"},
+		{"mesh without material", [2]string{`, "material": "mat"`, ``}, "REQUIRED", "/object/children/0/material"},
+		{"array length", [2]string{`[0, 0, 0, 1, 0, 0, 0, 1, 0]`, `[0, 0, 0, 1]`}, "ARRAY_LENGTH", "/geometries/0/data/attributes/position/array"},
+		{"non-numeric array", [2]string{`[0, 0, 0, 1, 0, 0, 0, 1, 0]`, `[0, 0, "x", 1, 0, 0, 0, 1, 0]`}, "TYPE_MISMATCH", "/geometries/0/data/attributes/position/array/2"},
+		{"negative index", [2]string{`[0, 1, 2]`, `[0, -1, 2]`}, "VALUE_OUT_OF_RANGE", "/geometries/0/data/index/array/1"},
+		{"bad item size", [2]string{`"itemSize": 3`, `"itemSize": 0`}, "VALUE_OUT_OF_RANGE", "/geometries/0/data/attributes/position/itemSize"},
+		{"missing position", [2]string{`"position"`, `"normal"`}, "REQUIRED", "/geometries/0/data/attributes/position"},
+		{"short matrix", [2]string{`[1,0,0,0,0,1,0,0,0,0,1,0,0,0,0,1]`, `[1,0,0]`}, "ARRAY_LENGTH", "/object/children/0/matrix"},
+		{"metadata not object", [2]string{`"metadata": {`, `"metadata": 1, "x": {`}, "REQUIRED", "/metadata"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := testThreeScene
+			if tt.replace[0] != "" {
+				src = strings.Replace(src, tt.replace[0], tt.replace[1], 1)
+			}
+			var doc interface{}
+			if err := json.Unmarshal([]byte(src), &doc); err != nil {
+				t.Fatal(err)
+			}
+			issues := validateThreeScene(doc)
+			if tt.code == "" {
+				if len(issues) > 0 {
+					t.Fatalf("unexpected issues %+v", issues)
+				}
+				return
+			}
+			for _, is := range issues {
+				if is.Code == tt.code && is.Pointer == tt.pointer {
+					return
+				}
+			}
+			t.Fatalf("missing %s at %s in %+v", tt.code, tt.pointer, issues)
+		})
+	}
+}
+
+func TestValidateThreeSceneLimit(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{"metadata":{"version":4,"type":"Object"},"object":{"uuid":"r","type":"Scene","children":[`)
+	for i := 0; i < 2*threeMaxIssues; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(`{"uuid":"m","type":"Mesh"}`)
+	}
+	sb.WriteString("]}}")
+	var doc interface{}
+	json.Unmarshal([]byte(sb.String()), &doc)
+	if got := len(validateThreeScene(doc)); got != threeMaxIssues {
+		t.Fatalf("got %d issues, want %d", got, threeMaxIssues)
+	}
+}
+
+func TestEscapePointer(t *testing.T) {
+	if got := escapePointer("a/b~c"); got != "a~1b~0c" {
+		t.Fatalf("escapePointer = %q", got)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	pngenc "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	thumbDefaultSize = 256
+	thumbMinSize     = 16
+	thumbMaxSize     = 1024
+	thumbSupersample = 2
+	// 渲染效果变化时递增，使旧的缓存失效
+	thumbRenderVersion = 1
+)
+
+// thumbSlots 限制同时进行的渲染数，光栅化会占满一个 CPU 核
+var thumbSlots = make(chan struct{}, runtime.NumCPU())
+
+// thumbInflight 合并对同一缩略图的并发请求
+var thumbInflight = struct {
+	sync.Mutex
+	m map[string]*thumbCall
+}{m: map[string]*thumbCall{}}
+
+type thumbCall struct {
+	done chan struct{}
+	png  []byte
+	err  error
+}
+
+// fileHashes 缓存文件内容哈希，文件大小和修改时间不变时不必重新读取
+var fileHashes = struct {
+	sync.Mutex
+	m map[string]fileHashEntry
+}{m: map[string]fileHashEntry{}}
+
+type fileHashEntry struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// fileHash 返回文件内容的 SHA-256（十六进制）
+func fileHash(file string) (string, error) {
+	st, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	fileHashes.Lock()
+	e, ok := fileHashes.m[file]
+	fileHashes.Unlock()
+	if ok && e.size == st.Size() && e.modTime.Equal(st.ModTime()) {
+		return e.hash, nil
+	}
+	fp, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	fileHashes.Lock()
+	fileHashes.m[file] = fileHashEntry{size: st.Size(), modTime: st.ModTime(), hash: sum}
+	fileHashes.Unlock()
+	return sum, nil
+}
+
+// loadModelFile 把 GLB/glTF/OBJ/STL/three.js JSON 统一读成 glTF 文档，后三者在内存中转换
+func loadModelFile(file string) (*GLTFFile, error) {
+	var mesh *meshData
+	var err error
+	b := newGLTFBuilder("tServer")
+	dir := filepath.Dir(file)
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".glb", ".gltf":
+		return loadGLTF(file)
+	case ".obj":
+		mesh, _, err = parseOBJ(file)
+	case ".stl":
+		mesh, _, err = parseSTL(file)
+	case ".json":
+		err = convertThreeScene(file, b, textureOptions{Embed: true, OutDir: dir}, &ConversionReport{})
+	default:
+		return nil, fmt.Errorf("unsupported model format %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mesh != nil {
+		mesh.toGLTF(b, strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)), textureOptions{Embed: true, OutDir: dir})
+	}
+	if _, err := b.glb(); err != nil {
+		return nil, err
+	}
+	f := &GLTFFile{Doc: b.doc, IsGLB: true, BIN: b.bin, Dir: dir}
+	f.loadBuffers()
+	return f, nil
+}
+
+// renderThumbnail 渲染模型缩略图并编码为 PNG
+func renderThumbnail(ctx context.Context, file string, size int) ([]byte, error) {
+	end := startSpan(ctx, "storage")
+	f, err := loadModelFile(file)
+	end()
+	if err != nil {
+		return nil, err
+	}
+	end = startSpan(ctx, "transform")
+	meshes, err := renderScene(f)
+	if err != nil {
+		end()
+		return nil, err
+	}
+	img := rasterize(meshes, size, thumbSupersample)
+	end()
+	defer startSpan(ctx, "encode")()
+	var buf bytes.Buffer
+	if err := pngenc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func thumbnailCacheDir() string {
+	return filepath.Join(dataRoot, ".cache", "thumbnails")
+}
+
+// cachedThumbnail 返回缓存的缩略图，没有时渲染并写入缓存；缓存按文件内容哈希和尺寸区分
+func cachedThumbnail(ctx context.Context, file, hash string, size int) (res []byte, rerr error) {
+	key := fmt.Sprintf("%s-%d-v%d", hash, size, thumbRenderVersion)
+	cacheFile := filepath.Join(thumbnailCacheDir(), key+".png")
+	end := startSpan(ctx, "cache")
+	data, err := os.ReadFile(cacheFile)
+	end()
+	if err == nil {
+		cacheLookup("thumbnail", true)
+		return data, nil
+	}
+	cacheLookup("thumbnail", false)
+
+	thumbInflight.Lock()
+	if call, ok := thumbInflight.m[key]; ok {
+		thumbInflight.Unlock()
+		// 同一缩略图正在被别的请求渲染，等待它的结果
+		defer startSpan(ctx, "wait")()
+		<-call.done
+		return call.png, call.err
+	}
+	call := &thumbCall{done: make(chan struct{})}
+	thumbInflight.m[key] = call
+	thumbInflight.Unlock()
+
+	end = startSpan(ctx, "queue")
+	thumbSlots <- struct{}{}
+	end()
+	// 渲染 panic 时也要归还渲染槽并唤醒等待的请求，否则它们会一直阻塞
+	defer func() {
+		if p := recover(); p != nil {
+			logError("缩略图渲染 panic", "file", dataRelPath(file), "error", fmt.Sprint(p), "stack", string(debug.Stack()))
+			call.png, call.err = nil, fmt.Errorf("render failed: %v", p)
+		}
+		<-thumbSlots
+		thumbInflight.Lock()
+		delete(thumbInflight.m, key)
+		thumbInflight.Unlock()
+		close(call.done)
+		res, rerr = call.png, call.err
+	}()
+	call.png, call.err = renderThumbnail(ctx, file, size)
+	if call.err == nil {
+		if err := os.MkdirAll(thumbnailCacheDir(), 0755); err == nil {
+			writeFileAtomic(cacheFile, call.png, 0644)
+		}
+	}
+	return call.png, call.err
+}
+
+// thumbnailHandler 处理 GET /api/models/*path/thumbnail.png?size=
+func thumbnailHandler(c *gin.Context, rel string) {
+	file, ok := modelFile(c, rel)
+	if !ok {
+		return
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".glb", ".gltf", ".obj", ".stl", ".json":
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "thumbnails are available for glb, gltf, obj, stl and three.js json files"})
+		return
+	}
+	size := thumbDefaultSize
+	if s := c.Query("size"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < thumbMinSize || v > thumbMaxSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("size must be between %d and %d", thumbMinSize, thumbMaxSize)})
+			return
+		}
+		size = v
+	}
+	end := startSpan(c, "storage")
+	hash, err := fileHash(file)
+	end()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	etag := fmt.Sprintf(`"%s-%d-v%d"`, hash[:16], size, thumbRenderVersion)
+	c.Header("ETag", etag)
+	if c.Writer.Header().Get("Cache-Control") == "" { // 签名访问时已设为 private
+		c.Header("Cache-Control", "no-cache")
+	}
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	data, err := cachedThumbnail(c, file, hash, size)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", data)
+}
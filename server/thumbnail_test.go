@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	pngenc "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNodeMatrix(t *testing.T) {
+	// 绕 Y 轴旋转 90°、放大 2 倍再平移
+	s := math.Sqrt(0.5)
+	n := &GLTFNode{Translation: []float64{1, 2, 3}, Rotation: []float64{0, s, 0, s}, Scale: []float64{2, 2, 2}}
+	tests := []struct {
+		in, want vec3
+	}{
+		{vec3{0, 0, 0}, vec3{1, 2, 3}},
+		{vec3{1, 0, 0}, vec3{1, 2, 1}},
+		{vec3{0, 1, 0}, vec3{1, 4, 3}},
+		{vec3{0, 0, 1}, vec3{3, 2, 3}},
+	}
+	m := nodeMatrix(n)
+	for _, tt := range tests {
+		if got := m.point(tt.in); got.sub(tt.want).length() > 1e-9 {
+			t.Errorf("point(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	// matrix 优先于 TRS
+	n.Matrix = identity4[:]
+	if got := nodeMatrix(n); got != identity4 {
+		t.Errorf("matrix was ignored: %v", got)
+	}
+}
+
+func TestWrapCoord(t *testing.T) {
+	tests := []struct {
+		i, n, mode, want int
+	}{
+		{-1, 4, 33071, 0},
+		{5, 4, 33071, 3},
+		{-1, 4, 10497, 3},
+		{9, 4, 10497, 1},
+		{4, 4, 33648, 3},
+		{-1, 4, 33648, 0},
+		{9, 4, 33648, 1},
+	}
+	for _, tt := range tests {
+		if got := wrapCoord(tt.i, tt.n, tt.mode); got != tt.want {
+			t.Errorf("wrapCoord(%d, %d, %d) = %d, want %d", tt.i, tt.n, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestLinearToSRGB(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		if got := linearToSRGB(srgbToLinear[i]); got != uint8(i) {
+			t.Fatalf("round trip of %d = %d", i, got)
+		}
+	}
+	if linearToSRGB(-1) != 0 || linearToSRGB(2) != 255 {
+		t.Fatal("out-of-range values are not clamped")
+	}
+}
+
+func TestCachedThumbnail(t *testing.T) {
+	root := setTestDataRoot(t)
+	src := filepath.Join(root, "grid.glb")
+	writeGridGLB(t, src, 4)
+	hash, err := fileHash(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := cachedThumbnail(context.Background(), src, hash, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := pngenc.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 64 {
+		t.Fatalf("thumbnail is %v, want 64x64", b)
+	}
+	// 模型在画面中央，四角是透明背景
+	if _, _, _, a := img.At(32, 32).RGBA(); a == 0 {
+		t.Error("center pixel is transparent")
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Error("corner pixel is not transparent")
+	}
+	entries, err := os.ReadDir(thumbnailCacheDir())
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("cache dir has %d entries (%v), want 1", len(entries), err)
+	}
+	// 之后的请求直接读缓存，即使源文件已被删除
+	os.Remove(src)
+	again, err := cachedThumbnail(context.Background(), src, hash, 64)
+	if err != nil || !bytes.Equal(again, data) {
+		t.Fatalf("cached thumbnail differs (err %v)", err)
+	}
+}
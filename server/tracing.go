@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 进程内的轻量追踪：每个请求记录若干阶段（handler、storage、transform、encode）的耗时，
+// 通过 Server-Timing 响应头返回给浏览器，慢请求保留在内存中供 /debug/traces 查看
+
+// slowTraceKeep 是保留的慢请求条数，超过后丢弃最旧的
+const slowTraceKeep = 100
+
+// maxTraceSpans 限制单个请求记录的阶段数，避免循环里打点撑大响应头
+const maxTraceSpans = 32
+
+// TraceSpan 是请求内的一个阶段，时间相对请求开始，单位毫秒
+type TraceSpan struct {
+	Name     string  `json:"name"`
+	Start    float64 `json:"startMs"`
+	Duration float64 `json:"durationMs"`
+	start    time.Time
+	end      time.Time
+}
+
+// Trace 是一个请求的追踪记录
+type Trace struct {
+	ID       string      `json:"id"`
+	Method   string      `json:"method"`
+	Route    string      `json:"route"`
+	Path     string      `json:"path"`
+	Status   int         `json:"status"`
+	Start    time.Time   `json:"start"`
+	Duration float64     `json:"durationMs"`
+	Spans    []TraceSpan `json:"spans"`
+	mu       sync.Mutex
+}
+
+type traceKey struct{}
+
+var slowTraces = struct {
+	sync.Mutex
+	threshold time.Duration
+	list      []*Trace // 环形缓冲
+	next      int
+}{threshold: 500 * time.Millisecond}
+
+// setSlowTraceThreshold 设置慢请求阈值，0 表示不保留
+func setSlowTraceThreshold(d time.Duration) {
+	slowTraces.Lock()
+	slowTraces.threshold = d
+	slowTraces.Unlock()
+}
+
+// traceOf 取出请求的追踪记录；ctx 可以是 *gin.Context 或请求的 context.Context
+func traceOf(ctx context.Context) *Trace {
+	if c, ok := ctx.(*gin.Context); ok {
+		ctx = c.Request.Context()
+	}
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// startSpan 开始一个阶段，返回结束函数，用法：defer startSpan(c, "storage")()；
+// name 原样写进 Server-Timing，只用字母、数字和连字符。ctx 上没有追踪记录时什么也不做
+func startSpan(ctx context.Context, name string) func() {
+	t := traceOf(ctx)
+	if t == nil {
+		return func() {}
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.Spans) >= maxTraceSpans {
+		return func() {}
+	}
+	i := len(t.Spans)
+	t.Spans = append(t.Spans, TraceSpan{Name: name, Start: sinceMs(t.Start, now), start: now})
+	return func() {
+		end := time.Now()
+		t.mu.Lock()
+		s := &t.Spans[i]
+		if s.end.IsZero() {
+			s.end = end
+			s.Duration = sinceMs(s.start, end)
+		}
+		t.mu.Unlock()
+	}
+}
+
+func sinceMs(start, t time.Time) float64 {
+	return float64(t.Sub(start).Microseconds()) / 1000
+}
+
+// serverTiming 按 Server-Timing 格式输出已记录的阶段；还没结束的阶段按到现在为止的耗时计算
+func (t *Trace) serverTiming() string {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.Spans)+1)
+	for _, s := range t.Spans {
+		d := s.Duration
+		if s.end.IsZero() {
+			d = sinceMs(s.start, now)
+		}
+		parts = append(parts, s.Name+";dur="+strconv.FormatFloat(d, 'f', 3, 64))
+	}
+	parts = append(parts, "total;dur="+strconv.FormatFloat(sinceMs(t.Start, now), 'f', 3, 64))
+	return strings.Join(parts, ", ")
+}
+
+// timingWriter 在响应头写出前补上 Server-Timing
+type timingWriter struct {
+	gin.ResponseWriter
+	trace *Trace
+	done  bool
+}
+
+func (w *timingWriter) setTiming() {
+	if !w.done && !w.ResponseWriter.Written() {
+		w.done = true
+		w.Header().Set("Server-Timing", w.trace.serverTiming())
+	}
+}
+
+func (w *timingWriter) WriteHeaderNow() {
+	w.setTiming()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	w.setTiming()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timingWriter) WriteString(s string) (int, error) {
+	w.setTiming()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timingWriter) Flush() {
+	w.setTiming()
+	w.ResponseWriter.Flush()
+}
+
+// tracingMiddleware 为请求建立追踪记录并记录 handler 阶段，需放在 accessLogMiddleware 之后
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t := &Trace{
+			ID:     requestID(c),
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+			Start:  time.Now(),
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), traceKey{}, t))
+		tw := &timingWriter{ResponseWriter: c.Writer, trace: t}
+		c.Writer = tw
+
+		end := startSpan(c, "handler")
+		c.Next()
+		end()
+		// 没有响应体（例如 304）时头部还没写出
+		tw.setTiming()
+
+		t.mu.Lock()
+		t.Route = c.FullPath()
+		if t.Route == "" {
+			t.Route = "unmatched"
+		}
+		t.Status = c.Writer.Status()
+		t.Duration = sinceMs(t.Start, time.Now())
+		t.mu.Unlock()
+		recordSlowTrace(c, t)
+	}
+}
+
+// recordSlowTrace 保留超过阈值的请求并输出一条带各阶段耗时的警告
+func recordSlowTrace(c *gin.Context, t *Trace) {
+	slowTraces.Lock()
+	threshold := slowTraces.threshold
+	if threshold <= 0 || t.Duration < float64(threshold.Microseconds())/1000 {
+		slowTraces.Unlock()
+		return
+	}
+	if len(slowTraces.list) < slowTraceKeep {
+		slowTraces.list = append(slowTraces.list, t)
+	} else {
+		slowTraces.list[slowTraces.next] = t
+	}
+	slowTraces.next = (slowTraces.next + 1) % slowTraceKeep
+	slowTraces.Unlock()
+
+	spans := make([]string, len(t.Spans))
+	for i, s := range t.Spans {
+		spans[i] = fmt.Sprintf("%s:%.1fms", s.Name, s.Duration)
+	}
+	requestLog(c, levelWarn, "慢请求", "route", t.Route, "status", t.Status,
+		"duration_ms", t.Duration, "spans", strings.Join(spans, ","))
+}
+
+// slowTracesHandler 处理 GET /debug/traces?min=&limit=，按耗时从高到低列出最近的慢请求
+func slowTracesHandler(c *gin.Context) {
+	min := 0.0
+	if s := c.Query("min"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min must be a non-negative number of milliseconds"})
+			return
+		}
+		min = v
+	}
+	limit := 20
+	if s := c.Query("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > slowTraceKeep {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", slowTraceKeep)})
+			return
+		}
+		limit = v
+	}
+	slowTraces.Lock()
+	list := make([]*Trace, 0, len(slowTraces.list))
+	for _, t := range slowTraces.list {
+		if t.Duration >= min {
+			list = append(list, t)
+		}
+	}
+	threshold := slowTraces.threshold
+	slowTraces.Unlock()
+	sort.Slice(list, func(a, b int) bool { return list[a].Duration > list[b].Duration })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"thresholdMs": float64(threshold.Microseconds()) / 1000, "traces": list})
+}
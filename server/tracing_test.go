@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resetSlowTraces 清空慢请求记录并设置阈值，测试结束后恢复
+func resetSlowTraces(t *testing.T, threshold time.Duration) {
+	slowTraces.Lock()
+	old := slowTraces.threshold
+	slowTraces.list, slowTraces.next, slowTraces.threshold = nil, 0, threshold
+	slowTraces.Unlock()
+	t.Cleanup(func() {
+		slowTraces.Lock()
+		slowTraces.list, slowTraces.next, slowTraces.threshold = nil, 0, old
+		slowTraces.Unlock()
+	})
+}
+
+func TestStartSpanWithoutTrace(t *testing.T) {
+	startSpan(context.Background(), "storage")()
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	captureLog(t, false, levelError)
+	resetSlowTraces(t, 5*time.Millisecond)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(tracingMiddleware())
+	r.GET("/api/slow/:id", func(c *gin.Context) {
+		end := startSpan(c, "storage")
+		time.Sleep(10 * time.Millisecond)
+		end()
+		end() // 重复调用不改变耗时
+		for i := 0; i < maxTraceSpans+5; i++ {
+			startSpan(c, "transform")()
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/api/empty", func(c *gin.Context) { c.Status(http.StatusNotModified) })
+
+	tests := []struct {
+		target string
+		slow   bool
+	}{
+		{"/api/slow/1", true},
+		{"/api/empty", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		timing := w.Header().Get("Server-Timing")
+		if !regexp.MustCompile(`^handler;dur=[0-9.]+(, [a-z]+;dur=[0-9.]+)*, total;dur=[0-9.]+$`).MatchString(timing) {
+			t.Errorf("%s: Server-Timing %q", tt.target, timing)
+		}
+	}
+
+	w := serveTest(http.MethodGet, "/debug/traces", "/debug/traces", "", slowTracesHandler)
+	var resp struct {
+		ThresholdMs float64  `json:"thresholdMs"`
+		Traces      []*Trace `json:"traces"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ThresholdMs != 5 || len(resp.Traces) != 1 {
+		t.Fatalf("response %s", w.Body)
+	}
+	tr := resp.Traces[0]
+	if tr.Route != "/api/slow/:id" || tr.Status != http.StatusOK || len(tr.Spans) != maxTraceSpans {
+		t.Fatalf("trace %+v", tr)
+	}
+	if s := tr.Spans[1]; s.Name != "storage" || s.Duration < 10 || s.Duration > tr.Duration {
+		t.Fatalf("storage span %+v", s)
+	}
+}
+
+func TestSlowTracesHandler(t *testing.T) {
+	resetSlowTraces(t, time.Second)
+	for _, d := range []float64{1200, 3000, 2000} {
+		slowTraces.list = append(slowTraces.list, &Trace{Duration: d})
+	}
+	tests := []struct {
+		query  string
+		status int
+		want   []float64
+	}{
+		{"", http.StatusOK, []float64{3000, 2000, 1200}},
+		{"?min=1500", http.StatusOK, []float64{3000, 2000}},
+		{"?limit=1", http.StatusOK, []float64{3000}},
+		{"?min=-1", http.StatusBadRequest, nil},
+		{"?limit=0", http.StatusBadRequest, nil},
+		{"?limit=1000", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		w := serveTest(http.MethodGet, "/debug/traces", "/debug/traces"+tt.query, "", slowTracesHandler)
+		if w.Code != tt.status {
+			t.Errorf("%q: status %d", tt.query, w.Code)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var resp struct{ Traces []Trace }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp.Traces) != len(tt.want) {
+			t.Errorf("%q: %d traces, want %d", tt.query, len(resp.Traces), len(tt.want))
+			continue
+		}
+		for i, d := range tt.want {
+			if resp.Traces[i].Duration != d {
+				t.Errorf("%q: trace %d duration %v, want %v", tt.query, i, resp.Traces[i].Duration, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	vitalsMaxBytes     = 64 << 10
+	vitalsMaxBatch     = 100
+	vitalsMaxSeries    = 2000
+	vitalsMaxSamples   = 2000 // 每个序列保留的最近样本数
+	vitalsRetention    = 7 * 24 * time.Hour
+	vitalsFlushPeriod  = time.Minute
+	vitalsDefaultRange = 24 * time.Hour
+)
+
+// vitalThresholds 是 web-vitals 的评级阈值：不超过第一个为 good，超过第二个为 poor；CLS 无单位，其余为毫秒
+var vitalThresholds = map[string][2]float64{
+	"CLS":  {0.1, 0.25},
+	"FID":  {100, 300},
+	"FCP":  {1800, 3000},
+	"LCP":  {2500, 4000},
+	"TTFB": {800, 1800},
+	"INP":  {200, 500},
+}
+
+// vitalsBuildPattern 检查构建版本号，错误上报的 release 也用它；首字符限定为字母数字，不会是 . 或 ..
+var vitalsBuildPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]{0,63}$`)
+
+// VitalsBatch 是前端用 navigator.sendBeacon 发送的一批指标，同一页面、同一构建版本
+type VitalsBatch struct {
+	Page    string        `json:"page"`
+	Build   string        `json:"build"`
+	Metrics []VitalMetric `json:"metrics"`
+}
+
+// VitalMetric 对应 web-vitals 回调中的 Metric，只用到 name 和 value
+type VitalMetric struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	ID    string  `json:"id,omitempty"`
+}
+
+// VitalsSeries 是一个指标在某页面、某构建版本下的统计
+type VitalsSeries struct {
+	Metric string    `json:"metric"`
+	Page   string    `json:"page"`
+	Build  string    `json:"build"`
+	Count  int       `json:"count"`
+	P50    float64   `json:"p50"`
+	P75    float64   `json:"p75"`
+	P95    float64   `json:"p95"`
+	Rating string    `json:"rating"` // 按 p75 评级：good | needs-improvement | poor
+	First  time.Time `json:"first"`
+	Last   time.Time `json:"last"`
+}
+
+type vitalSample struct {
+	T int64   `json:"t"` // Unix 毫秒
+	V float64 `json:"v"`
+}
+
+type vitalSeries struct {
+	Metric  string        `json:"metric"`
+	Page    string        `json:"page"`
+	Build   string        `json:"build"`
+	Samples []vitalSample `json:"samples"`
+}
+
+// vitalsStore 在内存中按 指标/页面/构建版本 保存最近的样本，定期写入状态目录的 vitals/samples.json
+type vitalsStore struct {
+	mu     sync.Mutex
+	series map[string]*vitalSeries
+	dirty  bool
+}
+
+var vitals = &vitalsStore{series: map[string]*vitalSeries{}}
+
+func vitalsFile() string {
+	return statePath("vitals", "samples.json")
+}
+
+// startVitals 读取上次保存的样本并开始定期保存，在 setStateRoot 之后调用
+func startVitals() {
+	if err := vitals.load(); err != nil && !os.IsNotExist(err) {
+		logError("读取 Web Vitals 数据失败", "error", err)
+	}
+	workerBeat("vitals", vitalsFlushPeriod)
+	go func() {
+		for range time.Tick(vitalsFlushPeriod) {
+			workerBeat("vitals", vitalsFlushPeriod)
+			if err := vitals.flush(); err != nil {
+				logError("保存 Web Vitals 数据失败", "error", err)
+			}
+		}
+	}()
+}
+
+func (s *vitalsStore) load() error {
+	data, err := os.ReadFile(vitalsFile())
+	if err != nil {
+		return err
+	}
+	var list []*vitalSeries
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, vs := range list {
+		s.series[vitalsKey(vs.Metric, vs.Page, vs.Build)] = vs
+	}
+	return nil
+}
+
+// flush 丢弃过期样本，有变化时写入磁盘
+func (s *vitalsStore) flush() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	cutoff := time.Now().Add(-vitalsRetention).UnixNano() / int64(time.Millisecond)
+	list := make([]*vitalSeries, 0, len(s.series))
+	for key, vs := range s.series {
+		i := sort.Search(len(vs.Samples), func(i int) bool { return vs.Samples[i].T >= cutoff })
+		if i == len(vs.Samples) {
+			delete(s.series, key)
+			continue
+		}
+		vs.Samples = vs.Samples[i:]
+		list = append(list, vs)
+	}
+	js, err := json.Marshal(list)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(vitalsFile(), js, 0644)
+}
+
+func vitalsKey(metric, page, build string) string {
+	return metric + "\x00" + page + "\x00" + build
+}
+
+// add 记录一个样本；序列数已满时不再新建序列
+func (s *vitalsStore) add(metric, page, build string, v float64, t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := vitalsKey(metric, page, build)
+	vs := s.series[key]
+	if vs == nil {
+		if len(s.series) >= vitalsMaxSeries {
+			return false
+		}
+		vs = &vitalSeries{Metric: metric, Page: page, Build: build}
+		s.series[key] = vs
+	}
+	vs.Samples = append(vs.Samples, vitalSample{T: t.UnixNano() / int64(time.Millisecond), V: v})
+	// 超出上限较多时再整体搬移，避免每次都复制
+	if len(vs.Samples) > vitalsMaxSamples*5/4 {
+		vs.Samples = append([]vitalSample(nil), vs.Samples[len(vs.Samples)-vitalsMaxSamples:]...)
+	}
+	s.dirty = true
+	return true
+}
+
+// summary 统计 since 之后的样本，空字符串的过滤条件不生效
+func (s *vitalsStore) summary(since time.Time, metric, page, build string) []VitalsSeries {
+	cutoff := since.UnixNano() / int64(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []VitalsSeries{}
+	for _, vs := range s.series {
+		if metric != "" && vs.Metric != metric || page != "" && vs.Page != page || build != "" && vs.Build != build {
+			continue
+		}
+		i := sort.Search(len(vs.Samples), func(i int) bool { return vs.Samples[i].T >= cutoff })
+		samples := vs.Samples[i:]
+		if len(samples) == 0 {
+			continue
+		}
+		values := make([]float64, len(samples))
+		for j, sm := range samples {
+			values[j] = sm.V
+		}
+		sort.Float64s(values)
+		r := VitalsSeries{
+			Metric: vs.Metric, Page: vs.Page, Build: vs.Build, Count: len(values),
+			P50: percentile(values, 50), P75: percentile(values, 75), P95: percentile(values, 95),
+			First: time.Unix(0, samples[0].T*int64(time.Millisecond)).UTC(),
+			Last:  time.Unix(0, samples[len(samples)-1].T*int64(time.Millisecond)).UTC(),
+		}
+		r.Rating = vitalRating(r.Metric, r.P75)
+		out = append(out, r)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		x, y := out[a], out[b]
+		if x.Metric != y.Metric {
+			return x.Metric < y.Metric
+		}
+		if x.Page != y.Page {
+			return x.Page < y.Page
+		}
+		return x.Build < y.Build
+	})
+	return out
+}
+
+// percentile 用最近秩法求已排序数据的百分位数
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func vitalRating(metric string, v float64) string {
+	t := vitalThresholds[metric]
+	switch {
+	case v <= t[0]:
+		return "good"
+	case v <= t[1]:
+		return "needs-improvement"
+	}
+	return "poor"
+}
+
+// vitalsPage 规范化页面路径：去掉查询参数和 hash，避免每个 URL 都成为一个序列
+func vitalsPage(page string) (string, bool) {
+	if i := strings.IndexAny(page, "?#"); i >= 0 {
+		page = page[:i]
+	}
+	if page == "" {
+		page = "/"
+	}
+	return page, strings.HasPrefix(page, "/") && len(page) <= 256
+}
+
+// postVitalsHandler 处理 POST /api/vitals。sendBeacon 发送的 Content-Type 是 text/plain，所以不检查请求头；
+// 不合法的指标逐个拒绝，其余照常记录
+func postVitalsHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, vitalsMaxBytes)
+	var batch VitalsBatch
+	if err := json.NewDecoder(c.Request.Body).Decode(&batch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, ok := vitalsPage(batch.Page)
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "page must be a path starting with /"})
+		return
+	}
+	if batch.Build == "" {
+		batch.Build = "unknown"
+	}
+	if !vitalsBuildPattern.MatchString(batch.Build) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid build"})
+		return
+	}
+	if len(batch.Metrics) == 0 || len(batch.Metrics) > vitalsMaxBatch {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("a batch needs 1 to %d metrics", vitalsMaxBatch)})
+		return
+	}
+	now := time.Now()
+	accepted := 0
+	issues := []Issue{}
+	for i, m := range batch.Metrics {
+		p := fmt.Sprintf("/metrics/%d", i)
+		limit := 600000.0 // 十分钟，更大的值多半是后台标签页
+		if m.Name == "CLS" {
+			limit = 100
+		}
+		switch _, known := vitalThresholds[m.Name]; {
+		case !known:
+			issues = append(issues, Issue{Code: "VALUE_NOT_IN_LIST", Pointer: p + "/name", Message: fmt.Sprintf("unknown metric %q", m.Name)})
+		case m.Value < 0 || m.Value > limit:
+			issues = append(issues, Issue{Code: "VALUE_OUT_OF_RANGE", Pointer: p + "/value", Message: fmt.Sprintf("%s must be between 0 and %g", m.Name, limit)})
+		case !vitals.add(m.Name, page, batch.Build, m.Value, now):
+			issues = append(issues, Issue{Code: "TOO_MANY_SERIES", Pointer: p, Message: "series limit reached"})
+		default:
+			accepted++
+		}
+	}
+	c.JSON(http.StatusAccepted, gin.H{"accepted": accepted, "rejected": len(issues), "errors": issues})
+}
+
+// vitalsSummaryHandler 处理 GET /api/vitals/summary?window=24h&metric=&page=&build=
+func vitalsSummaryHandler(c *gin.Context) {
+	window := vitalsDefaultRange
+	if w := c.Query("window"); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil || d <= 0 || d > vitalsRetention {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("window must be a duration up to %s", vitalsRetention)})
+			return
+		}
+		window = d
+	}
+	now := time.Now()
+	c.JSON(http.StatusOK, gin.H{
+		"window":    window.String(),
+		"generated": now.UTC(),
+		"series":    vitals.summary(now.Add(-window), c.Query("metric"), c.Query("page"), c.Query("build")),
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	data := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{data, 0, 1},
+		{data, 50, 5},
+		{data, 75, 8},
+		{data, 95, 10},
+		{data, 100, 10},
+		{[]float64{42}, 75, 42},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestVitalRating(t *testing.T) {
+	tests := []struct {
+		metric string
+		v      float64
+		want   string
+	}{
+		{"LCP", 2500, "good"},
+		{"LCP", 2501, "needs-improvement"},
+		{"LCP", 4000, "needs-improvement"},
+		{"LCP", 4001, "poor"},
+		{"CLS", 0.05, "good"},
+		{"CLS", 0.3, "poor"},
+		{"INP", 250, "needs-improvement"},
+	}
+	for _, tt := range tests {
+		if got := vitalRating(tt.metric, tt.v); got != tt.want {
+			t.Errorf("vitalRating(%s, %v) = %s, want %s", tt.metric, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestVitalsPage(t *testing.T) {
+	tests := []struct {
+		page string
+		want string
+		ok   bool
+	}{
+		{"/models?id=1#top", "/models", true},
+		{"", "/", true},
+		{"?x=1", "/", true},
+		{"models", "models", false},
+		{"/" + string(make([]byte, 300)), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := vitalsPage(tt.page)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("vitalsPage(%q) = %q, %v; want %q, %v", tt.page, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestVitalsStore(t *testing.T) {
+	root := setTestDataRoot(t)
+	state := setTestStateRoot(t)
+	s := &vitalsStore{series: map[string]*vitalSeries{}}
+	now := time.Now()
+	for i := 1; i <= 100; i++ {
+		s.add("LCP", "/", "v1", float64(i*100), now.Add(-time.Duration(100-i)*time.Second))
+	}
+	s.add("LCP", "/", "v2", 5000, now)
+	s.add("CLS", "/", "v1", 0.01, now.Add(-8*24*time.Hour))
+
+	tests := []struct {
+		name                string
+		since               time.Time
+		metric, page, build string
+		series              int
+		count               int
+		p75                 float64
+		rating              string
+	}{
+		{"all recent", now.Add(-time.Hour), "", "", "", 2, 0, 0, ""},
+		{"one build", now.Add(-time.Hour), "LCP", "", "v1", 1, 100, 7500, "poor"},
+		{"last ten seconds", now.Add(-9500 * time.Millisecond), "LCP", "/", "v1", 1, 10, 9800, "poor"},
+		{"older samples", now.Add(-10 * 24 * time.Hour), "CLS", "", "", 1, 1, 0.01, "good"},
+		{"no match", now.Add(-time.Hour), "FID", "", "", 0, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.summary(tt.since, tt.metric, tt.page, tt.build)
+			if len(got) != tt.series {
+				t.Fatalf("got %d series, want %d: %+v", len(got), tt.series, got)
+			}
+			if tt.series == 0 {
+				return
+			}
+			if r := got[0]; tt.series == 1 && (r.Count != tt.count || r.P75 != tt.p75 || r.Rating != tt.rating) {
+				t.Fatalf("unexpected summary %+v", r)
+			}
+		})
+	}
+
+	// 保存时丢弃超过保留期的序列，重新读取后统计不变
+	if err := s.flush(); err != nil {
+		t.Fatal(err)
+	}
+	// 样本保存在状态目录，不会通过 /data 暴露
+	if _, err := os.Stat(filepath.Join(state, "vitals", "samples.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vitals")); !os.IsNotExist(err) {
+		t.Fatalf("vitals written to the data directory: %v", err)
+	}
+	loaded := &vitalsStore{series: map[string]*vitalSeries{}}
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.series) != 2 {
+		t.Fatalf("loaded %d series, want 2 (the expired CLS series is dropped)", len(loaded.series))
+	}
+}
+
+func TestVitalsStoreLimits(t *testing.T) {
+	s := &vitalsStore{series: map[string]*vitalSeries{}}
+	now := time.Now()
+	for i := 0; i < vitalsMaxSamples*2; i++ {
+		s.add("LCP", "/", "v1", float64(i), now)
+	}
+	if n := len(s.series[vitalsKey("LCP", "/", "v1")].Samples); n > vitalsMaxSamples*5/4 {
+		t.Fatalf("series kept %d samples", n)
+	}
+	for i := 0; len(s.series) < vitalsMaxSeries; i++ {
+		s.add("LCP", "/", fmt.Sprintf("b%d", i), 1, now)
+	}
+	if s.add("LCP", "/", "one-too-many", 1, now) {
+		t.Fatal("a new series was created past the limit")
+	}
+	if !s.add("LCP", "/", "v1", 1, now) {
+		t.Fatal("existing series rejected a sample")
+	}
+}
@@ -1,14 +1,17 @@
 import React from 'react';
-import {Themes} from "./distribute/position"
+import {useLayout} from "./distribute/position"
+import Viewer from './Viewer';
 interface AppProps{
 }
 interface AppState{
 }
 function App(props: AppProps, state: AppState) {
-  let theme = Themes.TextTheme
+  let styles = useLayout("default")
+  let scene = new URLSearchParams(window.location.search).get("scene") || undefined
   return (
     <div className="App">
       <h1>Hello</h1>
+      <Viewer scene={scene} style={styles.three_line} />
     </div>
   );
 }
@@ -0,0 +1,76 @@
+import React, { CSSProperties, useEffect, useRef } from 'react';
+import { Color, Object3D, ObjectLoader, PerspectiveCamera, Scene, WebGLRenderer } from 'three';
+import { RenderTelemetry } from './renderTelemetry';
+
+interface ViewerProps {
+  // 场景 id，为空时只渲染空场景
+  scene?: string;
+  style?: CSSProperties;
+}
+
+// Viewer 用 three.js 渲染 /api/scenes/:id 的场景，渲染循环的帧时间由 RenderTelemetry 上报
+function Viewer({ scene, style }: ViewerProps) {
+  const container = useRef<HTMLDivElement>(null);
+
+  useEffect(() => {
+    const el = container.current;
+    if (!el) {
+      return;
+    }
+    let renderer: WebGLRenderer;
+    try {
+      renderer = new WebGLRenderer({ antialias: true });
+    } catch (e) {
+      // 浏览器不支持 WebGL 时不渲染
+      return;
+    }
+    renderer.setPixelRatio(window.devicePixelRatio);
+    el.appendChild(renderer.domElement);
+    const world = new Scene();
+    world.background = new Color(0xf0f0f0);
+    const camera = new PerspectiveCamera(50, 1, 0.1, 1000);
+    camera.position.set(0, 1, 5);
+    camera.lookAt(0, 0, 0);
+
+    const resize = () => {
+      const width = el.clientWidth || 1;
+      const height = el.clientHeight || 1;
+      renderer.setSize(width, height);
+      camera.aspect = width / height;
+      camera.updateProjectionMatrix();
+    };
+    resize();
+    window.addEventListener('resize', resize);
+
+    let cancelled = false;
+    if (scene) {
+      fetch('/api/scenes/' + encodeURIComponent(scene))
+        .then(res => (res.ok ? res.json() : Promise.reject(res.status)))
+        .then(json => {
+          if (!cancelled) {
+            world.add(new ObjectLoader().parse(json) as Object3D);
+          }
+        })
+        .catch(() => {});
+    }
+
+    const telemetry = new RenderTelemetry(renderer, scene || 'default');
+    renderer.setAnimationLoop(time => {
+      renderer.render(world, camera);
+      telemetry.frame(time);
+    });
+
+    return () => {
+      cancelled = true;
+      renderer.setAnimationLoop(null);
+      telemetry.dispose();
+      window.removeEventListener('resize', resize);
+      renderer.dispose();
+      el.removeChild(renderer.domElement);
+    };
+  }, [scene]);
+
+  return <div ref={container} style={style} />;
+}
+
+export default Viewer;
@@ -1,29 +1,108 @@
-export const Themes = {
-    Try_funcTheme: {
-        position: "absolute",
-        left: 10,
-        top: 5,
-        width: 400,
-        height: 500,
-        border: '1px solid rgb(180, 180, 180)',
-        borderRadius: "5px"
-    },
-    ThreeLineTheme:{
-        position: "absolute",
-        left: 10,
-        top: 5,
-        width: 400,
-        height: 500,
-        border: '1px solid rgb(180, 180, 180)',
-        borderRadius: "5px"
-    },
-    TextTheme:{
+import {CSSProperties, useEffect, useState} from "react";
+
+export type PanelId = "try_func" | "three_line" | "text"
+
+export interface PanelStyle {
+    left: number
+    top: number
+    width: number
+    height: number
+    border?: string
+    borderRadius?: string
+    hidden?: boolean
+}
+
+export interface LayoutVariant {
+    minWidth: number
+    panels: Partial<Record<PanelId, PanelStyle>>
+}
+
+export interface Layout {
+    name: string
+    user?: string
+    variants: LayoutVariant[]
+}
+
+// 服务端不可用时使用的内置布局，与 server/layouts.go 中的 builtinLayouts 一致
+export const builtinLayout: Layout = {
+    name: "default",
+    variants: [{
+        minWidth: 0,
+        panels: {
+            try_func: {left: 10, top: 5, width: 400, height: 500, border: '1px solid rgb(180, 180, 180)', borderRadius: "5px"},
+            three_line: {left: 10, top: 5, width: 400, height: 500, border: '1px solid rgb(180, 180, 180)', borderRadius: "5px"},
+            text: {left: 10, top: 5, width: 700, height: 600, border: '1px solid rgb(180, 180, 180)', borderRadius: "5px"},
+        }
+    }]
+}
+
+// 选出 minWidth 不超过视口宽度的最大变体，都不满足时用最小的
+export function activeVariant(layout: Layout, width: number): LayoutVariant {
+    let sorted = [...layout.variants].sort((a, b) => a.minWidth - b.minWidth)
+    let best = sorted[0]
+    for (let v of sorted) {
+        if (v.minWidth <= width) {
+            best = v
+        }
+    }
+    return best
+}
+
+export function panelCSS(style: PanelStyle): CSSProperties {
+    return {
         position: "absolute",
-        left: 10,
-        top: 5,
-        width: 700,
-        height: 600,
-        border: '1px solid rgb(180, 180, 180)',
-        borderRadius: "5px"
+        left: style.left,
+        top: style.top,
+        width: style.width,
+        height: style.height,
+        border: style.border,
+        borderRadius: style.borderRadius,
+        display: style.hidden ? "none" : undefined,
+    }
+}
+
+export type PanelStyles = Partial<Record<PanelId, CSSProperties>>
+
+function layoutStyles(layout: Layout, width: number): PanelStyles {
+    let styles: PanelStyles = {}
+    let panels = activeVariant(layout, width).panels
+    for (let id of Object.keys(panels) as PanelId[]) {
+        styles[id] = panelCSS(panels[id]!)
     }
-}
\ No newline at end of file
+    return styles
+}
+
+// useLayout 从 /api/layouts/:name 读取布局，并随窗口宽度切换变体；登录后服务端优先返回当前用户的个人布局
+export function useLayout(name: string): PanelStyles {
+    let [layout, setLayout] = useState<Layout>(builtinLayout)
+    let [width, setWidth] = useState(window.innerWidth)
+
+    useEffect(() => {
+        let cancelled = false
+        fetch("/api/layouts/" + encodeURIComponent(name))
+            .then(res => res.ok ? res.json() : Promise.reject(res.status))
+            .then((l: Layout) => {
+                if (!cancelled) setLayout(l)
+            })
+            .catch(() => {})
+        return () => {
+            cancelled = true
+        }
+    }, [name])
+
+    useEffect(() => {
+        let onResize = () => setWidth(window.innerWidth)
+        window.addEventListener("resize", onResize)
+        return () => window.removeEventListener("resize", onResize)
+    }, [])
+
+    return layoutStyles(layout, width)
+}
+
+// 兼容旧代码的静态主题，取内置布局的默认变体
+let builtinStyles = layoutStyles(builtinLayout, 0)
+export const Themes = {
+    Try_funcTheme: builtinStyles.try_func!,
+    ThreeLineTheme: builtinStyles.three_line!,
+    TextTheme: builtinStyles.text!,
+}
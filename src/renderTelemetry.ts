@@ -0,0 +1,66 @@
+import { WebGLRenderer } from 'three';
+
+// 与 server/telemetry.go 中的 renderFrameBuckets 一致，最后一个桶收集超过 500ms 的帧
+const bounds = [8, 12, 16.7, 20, 25, 33.3, 50, 66.7, 100, 200, 500];
+
+const gpuName = (renderer: WebGLRenderer) => {
+  const gl = renderer.getContext();
+  const ext = gl.getExtension('WEBGL_debug_renderer_info');
+  return String(gl.getParameter(ext ? ext.UNMASKED_RENDERER_WEBGL : gl.RENDERER));
+};
+
+// RenderTelemetry 在渲染循环中统计帧时间，每隔 interval 毫秒连同 renderer.info 发给 POST /api/telemetry/render。
+// 用法：在 requestAnimationFrame 回调里 renderer.render() 之后调用 telemetry.frame()
+export class RenderTelemetry {
+  private counts = new Array(bounds.length + 1).fill(0);
+  private sum = 0;
+  private last = 0;
+  private timer: number;
+  private gpu: string;
+
+  constructor(private renderer: WebGLRenderer, private scene: string, interval = 10000) {
+    this.gpu = gpuName(renderer);
+    this.timer = window.setInterval(() => this.flush(), interval);
+  }
+
+  frame(now = performance.now()) {
+    if (this.last > 0) {
+      const dt = now - this.last;
+      let i = bounds.findIndex(b => dt <= b);
+      this.counts[i < 0 ? bounds.length : i]++;
+      this.sum += dt;
+    }
+    this.last = now;
+  }
+
+  flush() {
+    // 标签页在后台时 requestAnimationFrame 暂停，下一帧的间隔不算数
+    if (document.visibilityState === 'hidden') {
+      this.last = 0;
+    }
+    if (this.counts.every(n => n === 0)) {
+      return;
+    }
+    const info = this.renderer.info;
+    const body = JSON.stringify({
+      scene: this.scene,
+      build: process.env.REACT_APP_BUILD || 'dev',
+      gpu: this.gpu,
+      frameTimes: { counts: this.counts, sum: this.sum },
+      info: {
+        calls: info.render.calls,
+        triangles: info.render.triangles,
+        textures: info.memory.textures,
+        geometries: info.memory.geometries,
+      },
+    });
+    this.counts = new Array(bounds.length + 1).fill(0);
+    this.sum = 0;
+    fetch('/api/telemetry/render', { method: 'POST', body, keepalive: true }).catch(() => {});
+  }
+
+  dispose() {
+    window.clearInterval(this.timer);
+    this.flush();
+  }
+}
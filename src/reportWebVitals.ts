@@ -1,4 +1,4 @@
-import { ReportHandler } from 'web-vitals';
+import { Metric, ReportHandler } from 'web-vitals';
 
 const reportWebVitals = (onPerfEntry?: ReportHandler) => {
   if (onPerfEntry && onPerfEntry instanceof Function) {
@@ -12,4 +12,33 @@ const reportWebVitals = (onPerfEntry?: ReportHandler) => {
   }
 };
 
+// 攒一批指标，页面隐藏时用 sendBeacon 发给 POST /api/vitals
+let queue: { name: string, value: number, id: string }[] = [];
+
+const flushVitals = () => {
+  if (queue.length === 0) {
+    return;
+  }
+  const body = JSON.stringify({
+    page: window.location.pathname,
+    build: process.env.REACT_APP_BUILD || 'dev',
+    metrics: queue,
+  });
+  queue = [];
+  if (!(navigator.sendBeacon && navigator.sendBeacon('/api/vitals', body))) {
+    fetch('/api/vitals', { method: 'POST', body, keepalive: true }).catch(() => {});
+  }
+};
+
+export const sendToServer = (metric: Metric) => {
+  queue.push({ name: metric.name, value: metric.value, id: metric.id });
+};
+
+document.addEventListener('visibilitychange', () => {
+  if (document.visibilityState === 'hidden') {
+    flushVitals();
+  }
+});
+window.addEventListener('pagehide', flushVitals);
+
 export default reportWebVitals;